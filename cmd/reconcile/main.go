@@ -0,0 +1,64 @@
+// Command reconcile checks every wallet balance against its transactions and
+// the ledger and prints a JSON report. It exits with status 1 when problems
+// remain after the run.
+//
+// Usage:
+//
+//	go run ./cmd/reconcile [-repair]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/config"
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "rebuild drifted cached wallet balances from the ledger")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Connect(&cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	reconciliationRepo := repository.NewReconciliationRepository(db)
+
+	ledgerService := service.NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+	reconciliationService := service.NewReconciliationService(reconciliationRepo, ledgerRepo, walletRepo, ledgerService, db)
+
+	report, err := reconciliationService.Run(*repair)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+
+	if !report.OK {
+		sqlDB.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/config"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/internal/worker"
+)
+
+// reconciliationJob periodically reconciles the wallets and logs the JSON report
+func reconciliationJob(cfg *config.ReconciliationConfig, reconciliationService service.ReconciliationService) worker.Job {
+	return worker.Job{
+		Name:     "reconciliation",
+		Interval: cfg.Interval,
+		Run: func(ctx context.Context) error {
+			report, err := reconciliationService.Run(cfg.Repair)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(report)
+			if err != nil {
+				return err
+			}
+			if report.OK {
+				log.Printf("reconciliation ok: %s", data)
+			} else {
+				log.Printf("WARNING: reconciliation found problems: %s", data)
+			}
+			return nil
+		},
+	}
+}
+
+// holdExpiryJob releases holds that were neither captured nor voided in time
+func holdExpiryJob(cfg *config.HoldConfig, walletService service.WalletService) worker.Job {
+	return worker.Job{
+		Name:     "hold-expiry",
+		Interval: cfg.ExpiryInterval,
+		Run: func(ctx context.Context) error {
+			expired, err := walletService.ExpireHolds(time.Now())
+			if expired > 0 {
+				log.Printf("expired %d hold(s)", expired)
+			}
+			return err
+		},
+	}
+}
+
+// idempotencyCleanupJob deletes expired idempotency keys so the table does
+// not grow without bound
+func idempotencyCleanupJob(cfg *config.IdempotencyConfig, walletService service.WalletService) worker.Job {
+	return worker.Job{
+		Name:     "idempotency-cleanup",
+		Interval: cfg.CleanupInterval,
+		Run: func(ctx context.Context) error {
+			deleted, err := walletService.DeleteExpiredIdempotencyKeys(time.Now())
+			if deleted > 0 {
+				log.Printf("deleted %d expired idempotency key(s)", deleted)
+			}
+			return err
+		},
+	}
+}
+
+// loginChallengeCleanupJob deletes expired two-factor login challenges
+func loginChallengeCleanupJob(cfg *config.TwoFactorConfig, authService service.AuthService) worker.Job {
+	return worker.Job{
+		Name:     "login-challenge-cleanup",
+		Interval: cfg.ChallengeCleanupInterval,
+		Run: func(ctx context.Context) error {
+			deleted, err := authService.DeleteExpiredLoginChallenges(time.Now())
+			if deleted > 0 {
+				log.Printf("deleted %d expired login challenge(s)", deleted)
+			}
+			return err
+		},
+	}
+}
+
+// scheduledTransferJob spawns due occurrences of recurring transfers, then
+// executes scheduled transfers once they are due
+func scheduledTransferJob(cfg *config.SchedulerConfig, recurringTransferService service.RecurringTransferService, scheduledTransferService service.ScheduledTransferService) worker.Job {
+	return worker.Job{
+		Name:     "scheduled-transfers",
+		Interval: cfg.Interval,
+		Run: func(ctx context.Context) error {
+			now := time.Now()
+			spawned, err := recurringTransferService.SpawnDue(now)
+			if spawned > 0 {
+				log.Printf("spawned %d recurring transfer occurrence(s)", spawned)
+			}
+			if err != nil {
+				// Scheduled transfers still run; the rest is spawned next time
+				log.Printf("error spawning recurring transfers: %v", err)
+			}
+
+			done, err := scheduledTransferService.ExecuteDue(now)
+			if done > 0 {
+				log.Printf("processed %d scheduled transfer(s)", done)
+			}
+			return err
+		},
+	}
+}
+
+// moneyRequestExpiryJob expires money requests that were not answered in time
+func moneyRequestExpiryJob(cfg *config.MoneyRequestConfig, moneyRequestService service.MoneyRequestService) worker.Job {
+	return worker.Job{
+		Name:     "money-request-expiry",
+		Interval: cfg.ExpiryInterval,
+		Run: func(ctx context.Context) error {
+			expired, err := moneyRequestService.ExpireDue(time.Now())
+			if expired > 0 {
+				log.Printf("expired %d money request(s)", expired)
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/api"
+	"github.com/roychanmeliaz/btechdevcases/internal/config"
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/internal/session"
+	"github.com/roychanmeliaz/btechdevcases/internal/worker"
+	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// Stop on SIGINT (Ctrl+C) or SIGTERM (docker stop)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Connect to PostgreSQL and run migrations
+	db, err := database.Connect(&cfg.Database)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("error closing database: %v", err)
+		}
+		log.Println("database connection closed")
+	}()
+
+	if err := database.Migrate(db); err != nil {
+		return err
+	}
+
+	// Open the session store; only the Redis backend connects to Redis
+	var sessions session.SessionStore
+	switch cfg.Session.Store {
+	case config.SessionStoreMemory:
+		sessions = session.NewMemoryStore(cfg.JWT.SessionTimeout, cfg.JWT.SessionMaxLifetime)
+	case config.SessionStorePostgres:
+		sessions = session.NewPostgresStore(db, cfg.JWT.SessionTimeout, cfg.JWT.SessionMaxLifetime)
+	default:
+		redisClient, err := database.ConnectRedis(ctx, &cfg.Redis)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := redisClient.Close(); err != nil {
+				log.Printf("error closing redis: %v", err)
+			}
+			log.Println("redis connection closed")
+		}()
+		sessions = session.NewRedisStore(redisClient, cfg.JWT.SessionTimeout, cfg.JWT.SessionMaxLifetime)
+	}
+	log.Printf("keeping sessions in %s", cfg.Session.Store)
+
+	// Wire repositories, services and router
+	jwtManager := customjwt.NewManager(cfg.JWT.Secret, cfg.JWT.AccessExpiration)
+
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	transferRepo := repository.NewTransferRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	reconciliationRepo := repository.NewReconciliationRepository(db)
+	holdRepo := repository.NewHoldRepository(db)
+	scheduledTransferRepo := repository.NewScheduledTransferRepository(db)
+	recurringTransferRepo := repository.NewRecurringTransferRepository(db)
+	moneyRequestRepo := repository.NewMoneyRequestRepository(db)
+	splitRepo := repository.NewSplitRepository(db)
+	limitRepo := repository.NewLimitRepository(db)
+	fxRepo := repository.NewFXRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+
+	authService := service.NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, cfg.JWT.RefreshExpiration, cfg.TwoFactor.Issuer, cfg.TwoFactor.ChallengeTTL)
+	ledgerService := service.NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+	limits := service.Limits{
+		PerTransaction: cfg.Limits.PerTransaction,
+		Daily:          cfg.Limits.Daily,
+		Monthly:        cfg.Limits.Monthly,
+		HourlyCount:    cfg.Limits.HourlyCount,
+	}
+	fees := service.FeePolicy{
+		Flat:         cfg.Fees.Flat,
+		Percent:      cfg.Fees.Percent,
+		Min:          cfg.Fees.Min,
+		Max:          cfg.Fees.Max,
+		FreePerMonth: cfg.Fees.FreePerMonth,
+	}
+	walletService := service.NewWalletService(userRepo, walletRepo, transactionRepo, transferRepo, ledgerRepo, idempotencyRepo, holdRepo, limitRepo, fxRepo, db, service.WalletOptions{
+		IdempotencyTTL: cfg.Idempotency.TTL,
+		HoldTTL:        cfg.Hold.TTL,
+		FXQuoteTTL:     cfg.FX.QuoteTTL,
+		Limits:         limits,
+		Fees:           fees,
+	})
+
+	if cfg.FX.RatesFile != "" {
+		if err := importRates(cfg.FX.RatesFile, walletService); err != nil {
+			return err
+		}
+	}
+
+	scheduledTransferService := service.NewScheduledTransferService(scheduledTransferRepo, userRepo, walletService, db)
+	recurringTransferService := service.NewRecurringTransferService(recurringTransferRepo, scheduledTransferRepo, userRepo, db)
+	moneyRequestService := service.NewMoneyRequestService(moneyRequestRepo, userRepo, walletService, db, cfg.MoneyRequest.TTL)
+	splitService := service.NewSplitService(splitRepo, userRepo, walletService, moneyRequestService, db)
+	reconciliationService := service.NewReconciliationService(reconciliationRepo, ledgerRepo, walletRepo, ledgerService, db)
+
+	// The books must balance; report it loudly if they do not
+	if err := ledgerService.CheckInvariant(); err != nil {
+		log.Printf("WARNING: ledger invariant check failed: %v", err)
+	}
+
+	// Background jobs stop when ctx is cancelled and are waited for on shutdown
+	jobs := worker.NewRunner(
+		reconciliationJob(&cfg.Reconciliation, reconciliationService),
+		holdExpiryJob(&cfg.Hold, walletService),
+		idempotencyCleanupJob(&cfg.Idempotency, walletService),
+		loginChallengeCleanupJob(&cfg.TwoFactor, authService),
+		scheduledTransferJob(&cfg.Scheduler, recurringTransferService, scheduledTransferService),
+		moneyRequestExpiryJob(&cfg.MoneyRequest, moneyRequestService),
+	)
+	jobs.Start(ctx)
+
+	// However run returns, stop the jobs and wait for them before the deferred
+	// DB and Redis closes run
+	defer func() {
+		stop()
+		jobs.Wait()
+		log.Println("background jobs stopped")
+	}()
+
+	router := api.NewRouter(authService, walletService, scheduledTransferService, recurringTransferService, moneyRequestService, splitService, jwtManager, sessions)
+	router.Setup()
+
+	srv := &http.Server{
+		Addr:         cfg.Server.Address(),
+		Handler:      router.Handler(),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("server listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Stop accepting new connections and wait for in-flight requests (including
+	// transfers) to finish; the background jobs are waited for on return
+	log.Println("shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error shutting down server: %v", err)
+		return err
+	}
+	log.Println("server stopped")
+
+	return nil
+}
+
+// importRates loads the exchange rates of the CSV file into the rate table
+func importRates(path string, walletService service.WalletService) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening exchange rate file: %w", err)
+	}
+	defer file.Close()
+
+	imported, err := walletService.ImportRates(file)
+	if err != nil {
+		return fmt.Errorf("error importing %s: %w", path, err)
+	}
+	log.Printf("imported %d exchange rates from %s", imported, path)
+	return nil
+}
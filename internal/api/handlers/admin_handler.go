@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type AdminHandler struct {
+	walletService service.WalletService
+}
+
+func NewAdminHandler(walletService service.WalletService) *AdminHandler {
+	return &AdminHandler{
+		walletService: walletService,
+	}
+}
+
+// ReverseRequest reverses part of a transfer; without an amount everything
+// not yet refunded is reversed
+type ReverseRequest struct {
+	Amount *money.Amount `json:"amount" binding:"omitempty,gt=0"`
+	Reason string        `json:"reason" binding:"required"`
+}
+
+func (h *AdminHandler) Reverse(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req ReverseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.walletService.Reverse(userID.(uint), c.Param("id"), req.Amount, req.Reason, idempotencyKey(c))
+	if err != nil {
+		writeTransferError(c, err, "error processing reversal")
+		return
+	}
+
+	writeTransferResult(c, result)
+}
+
+// SetLimitsRequest gives a user their own transfer limits. A field left out
+// falls back to the default; 0 removes the limit.
+type SetLimitsRequest struct {
+	PerTransaction *money.Amount `json:"per_transaction" binding:"omitempty,gte=0"`
+	Daily          *money.Amount `json:"daily" binding:"omitempty,gte=0"`
+	Monthly        *money.Amount `json:"monthly" binding:"omitempty,gte=0"`
+	HourlyCount    *int          `json:"hourly_count" binding:"omitempty,gte=0"`
+}
+
+func (h *AdminHandler) SetLimits(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req SetLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limits, err := h.walletService.SetLimits(uint(userID), &models.TransferLimit{
+		PerTransaction: req.PerTransaction,
+		Daily:          req.Daily,
+		Monthly:        req.Monthly,
+		HourlyCount:    req.HourlyCount,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidLimit):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating limits"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limits": limits,
+	})
+}
+
+// SetRateRequest sets the rate of the currency pair in the path. Spread is a
+// percentage taken on conversions, e.g. 0.50 for 0.5%.
+type SetRateRequest struct {
+	Rate   money.Rate   `json:"rate" binding:"required"`
+	Spread money.Amount `json:"spread" binding:"gte=0"`
+}
+
+func (h *AdminHandler) SetRate(c *gin.Context) {
+	var req SetRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate, err := h.walletService.SetRate(c.Param("from"), c.Param("to"), req.Rate, req.Spread)
+	if err != nil {
+		writeRateError(c, err, "error saving exchange rate")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rate": rate,
+	})
+}
+
+func (h *AdminHandler) DeleteRate(c *gin.Context) {
+	if err := h.walletService.DeleteRate(c.Param("from"), c.Param("to")); err != nil {
+		writeRateError(c, err, "error deleting exchange rate")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ImportRates replaces the rates listed in a CSV request body of
+// from,to,rate[,spread] lines
+func (h *AdminHandler) ImportRates(c *gin.Context) {
+	imported, err := h.walletService.ImportRates(c.Request.Body)
+	if err != nil {
+		writeRateError(c, err, "error importing exchange rates")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imported": imported,
+	})
+}
+
+func writeRateError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUnsupportedCurrency), errors.Is(err, service.ErrSameCurrency),
+		errors.Is(err, service.ErrInvalidRate), errors.Is(err, service.ErrInvalidSpread),
+		errors.Is(err, service.ErrInvalidRateFile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -7,21 +7,20 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/internal/session"
 )
 
 type AuthHandler struct {
-	authService    service.AuthService
-	redisClient    *redis.Client
-	sessionTimeout time.Duration
+	authService service.AuthService
+	sessions    session.SessionStore
 }
 
-func NewAuthHandler(authService service.AuthService, redisClient *redis.Client, sessionTimeout time.Duration) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, sessions session.SessionStore) *AuthHandler {
 	return &AuthHandler{
-		authService:    authService,
-		redisClient:    redisClient,
-		sessionTimeout: sessionTimeout,
+		authService: authService,
+		sessions:    sessions,
 	}
 }
 
@@ -36,9 +35,24 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type VerifyLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  interface{} `json:"user"`
+	Token            string      `json:"token"`
+	RefreshToken     string      `json:"refresh_token"`
+	RefreshExpiresAt time.Time   `json:"refresh_expires_at"`
+	User             interface{} `json:"user"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -77,7 +91,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, user, err := h.authService.Login(req.Email, req.Password)
+	result, err := h.authService.Login(req.Email, req.Password)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -87,17 +101,348 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Store session in Redis with expiration
-	ctx := context.Background()
-	sessionKey := "session:" + token
-	err = h.redisClient.Set(ctx, sessionKey, user.ID, h.sessionTimeout).Err()
+	if result.Challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required":  true,
+			"challenge_token":      result.Challenge.Token,
+			"challenge_expires_at": result.Challenge.ExpiresAt,
+		})
+		return
+	}
+
+	h.startSession(c, result.Tokens, result.User)
+}
+
+// VerifyLogin is the second step of a login with two-factor authentication:
+// it exchanges the challenge token and a code for a session
+func (h *AuthHandler) VerifyLogin(c *gin.Context) {
+	var req VerifyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := h.authService.VerifyLogin(req.ChallengeToken, req.Code)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidLoginChallenge) || errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrTwoFactorLocked) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	h.startSession(c, tokens, user)
+}
+
+// startSession stores the session of a completed login and returns its tokens
+func (h *AuthHandler) startSession(c *gin.Context, tokens *service.TokenPair, user *models.User) {
+	// Store session in Redis with expiration
+	sess := &models.Session{
+		ID:        tokens.FamilyID,
+		UserID:    user.ID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+	if err := h.sessions.Create(context.Background(), sess); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error creating session"})
 		return
 	}
 
+	writeAuthResponse(c, tokens, user)
+}
+
+// Refresh rotates the refresh token and issues a new access token. The
+// session must still be alive, so a refresh cannot get around the inactivity
+// timeout.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		var reuseErr *service.RefreshReuseError
+		if errors.As(err, &reuseErr) {
+			// The family is revoked; end its session so the access tokens
+			// already issued stop working as well
+			err := h.sessions.Revoke(context.Background(), reuseErr.FamilyID)
+			if err != nil && !errors.Is(err, session.ErrNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error revoking session"})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": reuseErr.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	err = h.sessions.Touch(context.Background(), tokens.FamilyID, user.ID)
+	if errors.Is(err, session.ErrNotFound) {
+		if err := h.authService.RevokeRefreshTokens(tokens.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error revoking session"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired due to inactivity"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating session"})
+		return
+	}
+
+	writeAuthResponse(c, tokens, user)
+}
+
+// Logout ends the session making the request
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.revokeSession(sessionID.(string)); err != nil && !errors.Is(err, session.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error revoking session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logged out",
+	})
+}
+
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := h.sessions.ListByUser(context.Background(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching sessions"})
+		return
+	}
+	current := c.GetString("session_id")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession ends one of the user's sessions, e.g. on a lost device
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sess, err := h.sessions.Get(context.Background(), c.Param("id"))
+	if err != nil && !errors.Is(err, session.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching session"})
+		return
+	}
+	if err != nil || sess.UserID != userID.(uint) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if err := h.revokeSession(sess.ID); err != nil && !errors.Is(err, session.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error revoking session"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutOthers ends every session of the user except the one making the
+// request
+func (h *AuthHandler) LogoutOthers(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := h.sessions.ListByUser(context.Background(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching sessions"})
+		return
+	}
+
+	revoked := 0
+	current := c.GetString("session_id")
+	for _, sess := range sessions {
+		if sess.ID == current {
+			continue
+		}
+		if err := h.revokeSession(sess.ID); err != nil {
+			if errors.Is(err, session.ErrNotFound) {
+				continue
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error revoking session"})
+			return
+		}
+		revoked++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revoked": revoked,
+	})
+}
+
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	status, err := h.authService.TwoFactorStatus(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTP starts setting up an authenticator app. The provisioning URI is
+// meant to be shown as a QR code.
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	enrollment, err := h.authService.EnrollTOTP(userID.(uint))
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           enrollment.Secret,
+		"provisioning_uri": enrollment.ProvisioningURI,
+	})
+}
+
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.ConfirmTOTP(userID.(uint), req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(userID.(uint), req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.DisableTOTP(userID.(uint), req.Code); err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "two-factor authentication disabled",
+	})
+}
+
+// revokeSession ends the session and revokes its refresh tokens, so it cannot
+// be renewed either
+func (h *AuthHandler) revokeSession(id string) error {
+	if err := h.authService.RevokeRefreshTokens(id); err != nil {
+		return err
+	}
+	return h.sessions.Revoke(context.Background(), id)
+}
+
+func writeTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+func writeAuthResponse(c *gin.Context, tokens *service.TokenPair, user *models.User) {
 	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
+		Token:            tokens.AccessToken,
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: tokens.RefreshExpiresAt,
 		User: gin.H{
 			"id":    user.ID,
 			"email": user.Email,
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/api/middleware"
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/internal/session"
+	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthHandler_Sessions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:auth_handler_sessions?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	jwtManager := customjwt.NewManager("test-secret", time.Hour)
+	authService := service.NewAuthService(
+		repository.NewUserRepository(db),
+		repository.NewWalletRepository(db),
+		repository.NewTransactionRepository(db),
+		repository.NewLedgerRepository(db),
+		repository.NewRefreshTokenRepository(db),
+		repository.NewTwoFactorRepository(db),
+		jwtManager, db, time.Hour, "AuthHandler", time.Minute,
+	)
+	sessions := session.NewMemoryStore(time.Hour, 24*time.Hour)
+	authHandler := NewAuthHandler(authService, sessions)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login", authHandler.Login)
+	protected := router.Group("/", middleware.NewAuthMiddleware(jwtManager, sessions).RequireAuth())
+	protected.POST("/auth/logout", authHandler.Logout)
+	protected.POST("/auth/logout-others", authHandler.LogoutOthers)
+	protected.GET("/auth/sessions", authHandler.ListSessions)
+	protected.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
+
+	request := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&payload).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &payload)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// listSessions lists the sessions of the user the access token belongs to
+	listSessions := func(t *testing.T, token string) []models.Session {
+		t.Helper()
+		rec := request(http.MethodGet, "/auth/sessions", token, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("failed to list sessions: %d %s", rec.Code, rec.Body)
+		}
+		var body struct {
+			Sessions []models.Session `json:"sessions"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return body.Sessions
+	}
+
+	// login starts a new session and returns its tokens and ID
+	login := func(t *testing.T, email string) (AuthResponse, string) {
+		t.Helper()
+		rec := request(http.MethodPost, "/auth/login", "", LoginRequest{Email: email, Password: "password123"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("failed to log in: %d %s", rec.Code, rec.Body)
+		}
+		var auth AuthResponse
+		json.Unmarshal(rec.Body.Bytes(), &auth)
+
+		for _, sess := range listSessions(t, auth.Token) {
+			if sess.Current {
+				return auth, sess.ID
+			}
+		}
+		t.Fatalf("expected the new session to be listed as current")
+		return auth, ""
+	}
+
+	// refreshRevoked reports whether the refresh token was revoked rather
+	// than used or expired
+	refreshRevoked := func(refreshToken string) bool {
+		_, _, err := authService.Refresh(refreshToken)
+		var reuseErr *service.RefreshReuseError
+		return errors.Is(err, service.ErrInvalidRefreshToken) && !errors.As(err, &reuseErr)
+	}
+
+	for _, email := range []string{"sessions-alice@example.com", "sessions-bob@example.com"} {
+		if _, err := authService.Register(email, "password123", "password123"); err != nil {
+			t.Fatalf("failed to register %s: %v", email, err)
+		}
+	}
+
+	laptop, laptopID := login(t, "sessions-alice@example.com")
+	phone, phoneID := login(t, "sessions-alice@example.com")
+	bob, bobID := login(t, "sessions-bob@example.com")
+
+	t.Run("sessions are listed per user with the current one marked", func(t *testing.T) {
+		listed := listSessions(t, laptop.Token)
+		if len(listed) != 2 {
+			t.Fatalf("expected 2 sessions, got %d", len(listed))
+		}
+		for _, sess := range listed {
+			if sess.Current != (sess.ID == laptopID) {
+				t.Errorf("expected only %s to be current, got %+v", laptopID, sess)
+			}
+		}
+	})
+
+	t.Run("revoking another user's session returns 404", func(t *testing.T) {
+		rec := request(http.MethodDelete, "/auth/sessions/"+bobID, laptop.Token, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+		rec = request(http.MethodDelete, "/auth/sessions/unknown", laptop.Token, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for an unknown session, got %d", rec.Code)
+		}
+
+		if rec := request(http.MethodGet, "/auth/sessions", bob.Token, nil); rec.Code != http.StatusOK {
+			t.Errorf("expected the other user's session to keep working, got %d", rec.Code)
+		}
+		if refreshRevoked(bob.RefreshToken) {
+			t.Error("expected the other user's refresh token to stay valid")
+		}
+	})
+
+	t.Run("a revoked session's refresh tokens are revoked too", func(t *testing.T) {
+		rec := request(http.MethodDelete, "/auth/sessions/"+phoneID, laptop.Token, nil)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d %s", rec.Code, rec.Body)
+		}
+
+		if rec := request(http.MethodGet, "/auth/sessions", phone.Token, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected the revoked session's access token to stop working, got %d", rec.Code)
+		}
+		if !refreshRevoked(phone.RefreshToken) {
+			t.Error("expected the revoked session's refresh token to be revoked")
+		}
+	})
+
+	t.Run("logout others keeps the current session", func(t *testing.T) {
+		tablet, _ := login(t, "sessions-alice@example.com")
+		desktop, desktopID := login(t, "sessions-alice@example.com")
+
+		rec := request(http.MethodPost, "/auth/logout-others", desktop.Token, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body)
+		}
+		var body struct {
+			Revoked int `json:"revoked"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if body.Revoked != 2 {
+			t.Errorf("expected 2 sessions revoked, got %d", body.Revoked)
+		}
+
+		listed := listSessions(t, desktop.Token)
+		if len(listed) != 1 || listed[0].ID != desktopID {
+			t.Errorf("expected only the current session to remain, got %+v", listed)
+		}
+		if refreshRevoked(desktop.RefreshToken) {
+			t.Error("expected the current session's refresh token to stay valid")
+		}
+		for _, other := range []AuthResponse{laptop, tablet} {
+			if rec := request(http.MethodGet, "/auth/sessions", other.Token, nil); rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected the other sessions to stop working, got %d", rec.Code)
+			}
+			if !refreshRevoked(other.RefreshToken) {
+				t.Error("expected the other sessions' refresh tokens to be revoked")
+			}
+		}
+	})
+
+	t.Run("logout ends the current session", func(t *testing.T) {
+		current, _ := login(t, "sessions-alice@example.com")
+
+		if rec := request(http.MethodPost, "/auth/logout", current.Token, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body)
+		}
+		if rec := request(http.MethodGet, "/auth/sessions", current.Token, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected the session to stop working, got %d", rec.Code)
+		}
+		if !refreshRevoked(current.RefreshToken) {
+			t.Error("expected the session's refresh token to be revoked")
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type MoneyRequestHandler struct {
+	moneyRequestService service.MoneyRequestService
+}
+
+func NewMoneyRequestHandler(moneyRequestService service.MoneyRequestService) *MoneyRequestHandler {
+	return &MoneyRequestHandler{
+		moneyRequestService: moneyRequestService,
+	}
+}
+
+type CreateMoneyRequestRequest struct {
+	Payee  string       `json:"payee" binding:"required,email"`
+	Amount money.Amount `json:"amount" binding:"required,gt=0"`
+	Notes  string       `json:"notes"`
+}
+
+func (h *MoneyRequestHandler) Create(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateMoneyRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := h.moneyRequestService.Create(userID.(uint), req.Payee, req.Amount, req.Notes)
+	if err != nil {
+		writeMoneyRequestError(c, err, "error creating money request")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"money_request": request,
+	})
+}
+
+func (h *MoneyRequestHandler) Get(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	request, err := h.moneyRequestService.Get(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeMoneyRequestError(c, err, "error fetching money request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"money_request": request,
+	})
+}
+
+func (h *MoneyRequestHandler) ListIncoming(c *gin.Context) {
+	h.list(c, h.moneyRequestService.ListIncoming)
+}
+
+func (h *MoneyRequestHandler) ListOutgoing(c *gin.Context) {
+	h.list(c, h.moneyRequestService.ListOutgoing)
+}
+
+func (h *MoneyRequestHandler) list(c *gin.Context, fn func(userID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error)) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	requests, err := fn(userID.(uint), models.MoneyRequestStatus(c.Query("status")))
+	if err != nil {
+		writeMoneyRequestError(c, err, "error fetching money requests")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"money_requests": requests,
+	})
+}
+
+func (h *MoneyRequestHandler) Accept(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	request, result, err := h.moneyRequestService.Accept(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeMoneyRequestError(c, err, "error accepting money request")
+		return
+	}
+
+	if result.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"money_request": request,
+		"transfer":      result.Transfer,
+	})
+}
+
+func (h *MoneyRequestHandler) Decline(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	request, err := h.moneyRequestService.Decline(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeMoneyRequestError(c, err, "error declining money request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"money_request": request,
+	})
+}
+
+func (h *MoneyRequestHandler) Cancel(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	request, err := h.moneyRequestService.Cancel(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeMoneyRequestError(c, err, "error cancelling money request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"money_request": request,
+	})
+}
+
+func writeMoneyRequestError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrMoneyRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMoneyRequestNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMoneyRequestNotPending), errors.Is(err, service.ErrMoneyRequestExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfRequest), errors.Is(err, service.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		writeTransferError(c, err, fallback)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type RecurringTransferHandler struct {
+	recurringTransferService service.RecurringTransferService
+}
+
+func NewRecurringTransferHandler(recurringTransferService service.RecurringTransferService) *RecurringTransferHandler {
+	return &RecurringTransferHandler{
+		recurringTransferService: recurringTransferService,
+	}
+}
+
+type CreateRecurringTransferRequest struct {
+	Recipient      string       `json:"recipient" binding:"required,email"`
+	Amount         money.Amount `json:"amount" binding:"required,gt=0"`
+	Notes          string       `json:"notes"`
+	Frequency      string       `json:"frequency" binding:"required"`
+	Weekday        string       `json:"weekday"`
+	DayOfMonth     int          `json:"day_of_month"`
+	StartAt        *time.Time   `json:"start_at"`
+	EndAt          *time.Time   `json:"end_at"`
+	MaxOccurrences *int         `json:"max_occurrences"`
+}
+
+func (h *RecurringTransferHandler) Create(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateRecurringTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := service.RecurringTransferInput{
+		RecipientEmail: req.Recipient,
+		Amount:         req.Amount,
+		Notes:          req.Notes,
+		Frequency:      models.RecurringFrequency(req.Frequency),
+		Weekday:        req.Weekday,
+		DayOfMonth:     req.DayOfMonth,
+		EndAt:          req.EndAt,
+		MaxOccurrences: req.MaxOccurrences,
+	}
+	if req.StartAt != nil {
+		input.StartAt = *req.StartAt
+	}
+
+	recurring, err := h.recurringTransferService.Create(userID.(uint), input)
+	if err != nil {
+		writeRecurringTransferError(c, err, "error creating recurring transfer")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"recurring_transfer": recurring,
+	})
+}
+
+func (h *RecurringTransferHandler) List(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	recurring, err := h.recurringTransferService.List(userID.(uint))
+	if err != nil {
+		writeRecurringTransferError(c, err, "error fetching recurring transfers")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recurring_transfers": recurring,
+	})
+}
+
+func (h *RecurringTransferHandler) Get(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	recurring, err := h.recurringTransferService.Get(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeRecurringTransferError(c, err, "error fetching recurring transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recurring_transfer": recurring,
+	})
+}
+
+func (h *RecurringTransferHandler) Occurrences(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	occurrences, err := h.recurringTransferService.Occurrences(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeRecurringTransferError(c, err, "error fetching occurrences")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"occurrences": occurrences,
+	})
+}
+
+func (h *RecurringTransferHandler) Pause(c *gin.Context) {
+	h.change(c, h.recurringTransferService.Pause, "error pausing recurring transfer")
+}
+
+func (h *RecurringTransferHandler) Resume(c *gin.Context) {
+	h.change(c, h.recurringTransferService.Resume, "error resuming recurring transfer")
+}
+
+func (h *RecurringTransferHandler) Skip(c *gin.Context) {
+	h.change(c, h.recurringTransferService.SkipNext, "error skipping occurrence")
+}
+
+func (h *RecurringTransferHandler) Cancel(c *gin.Context) {
+	h.change(c, h.recurringTransferService.Cancel, "error cancelling recurring transfer")
+}
+
+// change runs one of the service's state changes on the recurring transfer in
+// the path and responds with the result
+func (h *RecurringTransferHandler) change(c *gin.Context, fn func(userID uint, recurringID string) (*models.RecurringTransfer, error), fallback string) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	recurring, err := fn(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeRecurringTransferError(c, err, fallback)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recurring_transfer": recurring,
+	})
+}
+
+func writeRecurringTransferError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRecurringTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRecurringTransferNotActive),
+		errors.Is(err, service.ErrRecurringTransferNotPaused),
+		errors.Is(err, service.ErrRecurringTransferEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRecurrence), errors.Is(err, service.ErrStartAtInPast):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		writeTransferError(c, err, fallback)
+	}
+}
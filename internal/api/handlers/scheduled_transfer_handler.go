@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type ScheduledTransferHandler struct {
+	scheduledTransferService service.ScheduledTransferService
+}
+
+func NewScheduledTransferHandler(scheduledTransferService service.ScheduledTransferService) *ScheduledTransferHandler {
+	return &ScheduledTransferHandler{
+		scheduledTransferService: scheduledTransferService,
+	}
+}
+
+type ScheduleTransferRequest struct {
+	Recipient string       `json:"recipient" binding:"required,email"`
+	Amount    money.Amount `json:"amount" binding:"required,gt=0"`
+	Notes     string       `json:"notes"`
+	ExecuteAt time.Time    `json:"execute_at" binding:"required"`
+}
+
+func (h *ScheduledTransferHandler) Create(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req ScheduleTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduled, err := h.scheduledTransferService.Schedule(userID.(uint), req.Recipient, req.Amount, req.Notes, req.ExecuteAt)
+	if err != nil {
+		writeScheduledTransferError(c, err, "error scheduling transfer")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"scheduled_transfer": scheduled,
+	})
+}
+
+func (h *ScheduledTransferHandler) List(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	scheduled, err := h.scheduledTransferService.List(userID.(uint), models.ScheduledTransferStatus(c.Query("status")))
+	if err != nil {
+		writeScheduledTransferError(c, err, "error fetching scheduled transfers")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scheduled_transfers": scheduled,
+	})
+}
+
+func (h *ScheduledTransferHandler) Get(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	scheduled, err := h.scheduledTransferService.Get(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeScheduledTransferError(c, err, "error fetching scheduled transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scheduled_transfer": scheduled,
+	})
+}
+
+func (h *ScheduledTransferHandler) Cancel(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	scheduled, err := h.scheduledTransferService.Cancel(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeScheduledTransferError(c, err, "error cancelling scheduled transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scheduled_transfer": scheduled,
+	})
+}
+
+func writeScheduledTransferError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrScheduledTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrScheduledTransferNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrExecuteAtInPast), errors.Is(err, service.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		writeTransferError(c, err, fallback)
+	}
+}
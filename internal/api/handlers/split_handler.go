@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type SplitHandler struct {
+	splitService service.SplitService
+}
+
+func NewSplitHandler(splitService service.SplitService) *SplitHandler {
+	return &SplitHandler{
+		splitService: splitService,
+	}
+}
+
+type CreateGroupRequest struct {
+	Name    string   `json:"name" binding:"required"`
+	Members []string `json:"members" binding:"dive,email"`
+}
+
+type AddExpenseRequest struct {
+	Description string         `json:"description"`
+	Total       money.Amount   `json:"total" binding:"required,gt=0"`
+	Split       string         `json:"split" binding:"required"`
+	Settlement  string         `json:"settlement"`
+	Shares      []ShareRequest `json:"shares" binding:"dive"`
+}
+
+// ShareRequest is one participant of an expense. Percentages are parsed
+// exactly like amounts, so they allow up to two decimals.
+type ShareRequest struct {
+	Email      string       `json:"email" binding:"required,email"`
+	Amount     money.Amount `json:"amount"`
+	Percentage money.Amount `json:"percentage"`
+}
+
+func (h *SplitHandler) CreateGroup(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.splitService.CreateGroup(userID.(uint), req.Name, req.Members)
+	if err != nil {
+		writeSplitError(c, err, "error creating group")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"group": group,
+	})
+}
+
+func (h *SplitHandler) ListGroups(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	groups, err := h.splitService.ListGroups(userID.(uint))
+	if err != nil {
+		writeSplitError(c, err, "error fetching groups")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+	})
+}
+
+func (h *SplitHandler) GetGroup(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	group, err := h.splitService.GetGroup(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeSplitError(c, err, "error fetching group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group": group,
+	})
+}
+
+func (h *SplitHandler) AddExpense(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req AddExpenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := service.ExpenseInput{
+		Description: req.Description,
+		Total:       req.Total,
+		Split:       models.SplitType(req.Split),
+		Settlement:  models.SplitSettlement(req.Settlement),
+	}
+	for _, share := range req.Shares {
+		input.Shares = append(input.Shares, service.ShareInput{
+			Email:      share.Email,
+			Amount:     share.Amount,
+			Percentage: share.Percentage,
+		})
+	}
+
+	expense, err := h.splitService.AddExpense(userID.(uint), c.Param("id"), input)
+	if err != nil {
+		writeSplitError(c, err, "error adding expense")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"expense": expense,
+	})
+}
+
+func (h *SplitHandler) ListExpenses(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	expenses, err := h.splitService.ListExpenses(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeSplitError(c, err, "error fetching expenses")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"expenses": expenses,
+	})
+}
+
+func (h *SplitHandler) Settle(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	expense, result, err := h.splitService.Settle(userID.(uint), c.Param("id"), c.Param("expense_id"))
+	if err != nil {
+		writeSplitError(c, err, "error settling share")
+		return
+	}
+
+	if result.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"expense":  expense,
+		"transfer": result.Transfer,
+	})
+}
+
+func (h *SplitHandler) Balances(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	balances, err := h.splitService.Balances(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeSplitError(c, err, "error fetching balances")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balances": balances,
+	})
+}
+
+func writeSplitError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrExpenseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotGroupMember),
+		errors.Is(err, service.ErrInvalidSplit),
+		errors.Is(err, service.ErrSharesDoNotAddUp),
+		errors.Is(err, service.ErrNoShareToSettle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrShareAlreadySettled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeMoneyRequestError(c, err, fallback)
+	}
+}
@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 )
 
 type WalletHandler struct {
@@ -19,12 +25,21 @@ func NewWalletHandler(walletService service.WalletService) *WalletHandler {
 	}
 }
 
+// TransferRequest sends money from the sender's wallet in Currency, or their
+// primary wallet when it is empty
 type TransferRequest struct {
-	Recipient string  `json:"recipient" binding:"required,email"`
-	Amount    float64 `json:"amount" binding:"required,gt=0"`
-	Notes     string  `json:"notes"`
+	Recipient string       `json:"recipient" binding:"required,email"`
+	Amount    money.Amount `json:"amount" binding:"required,gt=0"`
+	Currency  string       `json:"currency"`
+	Notes     string       `json:"notes"`
 }
 
+type OpenWalletRequest struct {
+	Currency string `json:"currency" binding:"required"`
+}
+
+// GetWallet returns the primary wallet with its latest transactions, and
+// every wallet the user has
 func (h *WalletHandler) GetWallet(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -32,7 +47,12 @@ func (h *WalletHandler) GetWallet(c *gin.Context) {
 		return
 	}
 
-	wallet, transactions, err := h.walletService.GetWallet(userID.(uint))
+	wallet, page, err := h.walletService.GetWallet(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching wallet"})
+		return
+	}
+	wallets, err := h.walletService.ListWallets(userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching wallet"})
 		return
@@ -40,52 +60,622 @@ func (h *WalletHandler) GetWallet(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"wallet":       wallet,
-		"transactions": transactions,
+		"wallets":      wallets,
+		"transactions": page.Transactions,
+		"next_cursor":  page.NextCursor,
+		"has_more":     page.HasMore,
 	})
 }
 
-func (h *WalletHandler) Transfer(c *gin.Context) {
+func (h *WalletHandler) ListWallets(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	var req TransferRequest
+	wallets, err := h.walletService.ListWallets(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching wallets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wallets": wallets,
+	})
+}
+
+func (h *WalletHandler) OpenWallet(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req OpenWalletRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate or get idempotency key from header
-	idempotencyKey := c.GetHeader("Idempotency-Key")
-	if idempotencyKey == "" {
-		// Generate one if not provided (for backwards compatibility)
-		idempotencyKey = uuid.New().String()
+	wallet, err := h.walletService.OpenWallet(userID.(uint), req.Currency)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedCurrency):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrWalletExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error opening wallet"})
+		}
+		return
 	}
 
-	err := h.walletService.Transfer(userID.(uint), req.Recipient, req.Amount, req.Notes, idempotencyKey)
+	c.JSON(http.StatusCreated, gin.H{
+		"wallet": wallet,
+	})
+}
+
+func (h *WalletHandler) ListTransactions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	query, err := parseTransactionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.walletService.ListTransactions(userID.(uint), query)
 	if err != nil {
 		switch {
-		case errors.Is(err, service.ErrInsufficientBalance):
+		case errors.Is(err, service.ErrInvalidCursor), errors.Is(err, service.ErrInvalidFilter), errors.Is(err, service.ErrUnsupportedCurrency):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		case errors.Is(err, service.ErrRecipientNotFound):
+		case errors.Is(err, service.ErrWalletNotFound):
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		case errors.Is(err, service.ErrInvalidAmount):
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		case errors.Is(err, service.ErrSelfTransfer):
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing transfer"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching transactions"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseTransactionQuery reads the history filters from the query string.
+// Dates are RFC 3339 timestamps; amounts are decimals like 10.50.
+func parseTransactionQuery(c *gin.Context) (service.TransactionQuery, error) {
+	query := service.TransactionQuery{
+		Currency:     c.Query("currency"),
+		Type:         models.TransactionType(c.Query("type")),
+		Counterparty: c.Query("counterparty"),
+		Notes:        c.Query("notes"),
+		Cursor:       c.Query("cursor"),
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit %q", v)
+		}
+		query.Limit = limit
+	}
+
+	for name, dst := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s %q: expected RFC 3339 timestamp", name, v)
+			}
+			*dst = &t
+		}
+	}
+
+	for name, dst := range map[string]**money.Amount{"min_amount": &query.MinAmount, "max_amount": &query.MaxAmount} {
+		if v := c.Query(name); v != "" {
+			amount, err := money.Parse(v)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = &amount
 		}
+	}
+
+	return query, nil
+}
+
+func (h *WalletHandler) Transfer(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.walletService.Transfer(userID.(uint), req.Recipient, req.Amount, req.Currency, req.Notes, idempotencyKey(c))
+	if err != nil {
+		writeTransferError(c, err, "error processing transfer")
+		return
+	}
+
+	writeTransferResult(c, result)
+}
+
+// QuoteTransfer previews the fee of a transfer with the same body as Transfer;
+// notes are ignored
+func (h *WalletHandler) QuoteTransfer(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote, err := h.walletService.QuoteTransfer(userID.(uint), req.Recipient, req.Amount, req.Currency)
+	if err != nil {
+		writeTransferError(c, err, "error quoting transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quote": quote,
+	})
+}
+
+// ConversionQuoteRequest prices converting Amount from the wallet in From (the
+// primary wallet when empty) into To
+type ConversionQuoteRequest struct {
+	From   string       `json:"from"`
+	To     string       `json:"to" binding:"required"`
+	Amount money.Amount `json:"amount" binding:"required,gt=0"`
+}
+
+// ConvertRequest executes a conversion quote. Without a recipient the money
+// goes to the user's own wallet in the target currency.
+type ConvertRequest struct {
+	QuoteID   string `json:"quote_id" binding:"required"`
+	Recipient string `json:"recipient" binding:"omitempty,email"`
+	Notes     string `json:"notes"`
+}
+
+func (h *WalletHandler) ListRates(c *gin.Context) {
+	rates, err := h.walletService.ListRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching exchange rates"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "transfer successful",
+		"rates": rates,
+	})
+}
+
+func (h *WalletHandler) QuoteConversion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req ConversionQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote, err := h.walletService.QuoteConversion(userID.(uint), req.From, req.To, req.Amount)
+	if err != nil {
+		writeTransferError(c, err, "error quoting conversion")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"quote": quote,
+	})
+}
+
+func (h *WalletHandler) Convert(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req ConvertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.walletService.Convert(userID.(uint), req.QuoteID, req.Recipient, req.Notes, idempotencyKey(c))
+	if err != nil {
+		writeTransferError(c, err, "error processing conversion")
+		return
+	}
+
+	writeTransferResult(c, result)
+}
+
+type BatchTransferRequest struct {
+	Mode  models.TransferBatchMode `json:"mode"`
+	Items []BatchTransferItem      `json:"items" binding:"required,dive"`
+}
+
+// BatchTransferItem is validated by the service so that best-effort batches
+// can report invalid items instead of rejecting the request
+type BatchTransferItem struct {
+	Recipient string       `json:"recipient" binding:"required"`
+	Amount    money.Amount `json:"amount"`
+	Notes     string       `json:"notes"`
+}
+
+func (h *WalletHandler) BatchTransfer(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req BatchTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]service.BatchItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = service.BatchItem{RecipientEmail: item.Recipient, Amount: item.Amount, Notes: item.Notes}
+	}
+
+	result, err := h.walletService.BatchTransfer(userID.(uint), req.Mode, items, idempotencyKey(c))
+	if err != nil {
+		var batchErr *service.BatchError
+		if errors.As(err, &batchErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "items": batchErr.Items})
+			return
+		}
+		writeTransferError(c, err, "error processing batch")
+		return
+	}
+
+	if result.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"batch": result.Batch,
 	})
 }
 
+func (h *WalletHandler) GetBatch(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	batch, err := h.walletService.GetBatch(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeTransferError(c, err, "error fetching batch")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batch": batch,
+	})
+}
+
+func (h *WalletHandler) GetLimits(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	limits, err := h.walletService.GetLimits(userID.(uint))
+	if err != nil {
+		writeTransferError(c, err, "error fetching limits")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limits": limits,
+	})
+}
+
+// RefundRequest returns part of a received transfer; without an amount
+// everything not yet refunded is returned
+type RefundRequest struct {
+	Amount *money.Amount `json:"amount" binding:"omitempty,gt=0"`
+	Notes  string        `json:"notes"`
+}
+
+func (h *WalletHandler) Refund(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.walletService.Refund(userID.(uint), c.Param("id"), req.Amount, req.Notes, idempotencyKey(c))
+	if err != nil {
+		writeTransferError(c, err, "error processing refund")
+		return
+	}
+
+	writeTransferResult(c, result)
+}
+
+// HoldRequest reserves money in the payer's wallet in Currency, or their
+// primary wallet when it is empty
+type HoldRequest struct {
+	Recipient string       `json:"recipient" binding:"required,email"`
+	Amount    money.Amount `json:"amount" binding:"required,gt=0"`
+	Currency  string       `json:"currency"`
+	Notes     string       `json:"notes"`
+}
+
+// CaptureRequest captures part of a hold; without an amount the whole hold
+// is captured
+type CaptureRequest struct {
+	Amount *money.Amount `json:"amount" binding:"omitempty,gt=0"`
+}
+
+func (h *WalletHandler) AuthorizeHold(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req HoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.walletService.AuthorizeHold(userID.(uint), req.Recipient, req.Amount, req.Currency, req.Notes, idempotencyKey(c))
+	if err != nil {
+		writeTransferError(c, err, "error authorizing hold")
+		return
+	}
+
+	if result.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"hold": result.Hold,
+	})
+}
+
+func (h *WalletHandler) CaptureHold(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CaptureRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.walletService.CaptureHold(userID.(uint), c.Param("id"), req.Amount, idempotencyKey(c))
+	if err != nil {
+		writeTransferError(c, err, "error capturing hold")
+		return
+	}
+
+	writeTransferResult(c, result)
+}
+
+func (h *WalletHandler) VoidHold(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	hold, err := h.walletService.VoidHold(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeTransferError(c, err, "error voiding hold")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hold": hold,
+	})
+}
+
+func (h *WalletHandler) GetHold(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	hold, err := h.walletService.GetHold(userID.(uint), c.Param("id"))
+	if err != nil {
+		writeTransferError(c, err, "error fetching hold")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hold": hold,
+	})
+}
+
+// idempotencyKey returns the Idempotency-Key header, or a fresh key when the
+// client did not send one (for backwards compatibility)
+func idempotencyKey(c *gin.Context) string {
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		return key
+	}
+	return uuid.New().String()
+}
+
+// writeTransferError maps the errors of money-moving operations to responses
+func writeTransferError(c *gin.Context, err error, fallback string) {
+	var limitErr *service.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		writeLimitError(c, limitErr)
+	case errors.Is(err, service.ErrLimitUnvalued):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRecipientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrAmountPrecision):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrCurrencyMismatch), errors.Is(err, service.ErrUnsupportedCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWalletNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSameCurrency), errors.Is(err, service.ErrConversionNotRefundable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRateNotFound), errors.Is(err, service.ErrQuoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrQuoteExpired), errors.Is(err, service.ErrQuoteUsed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfTransfer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRefundExceedsTransfer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTransferNotRefundable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRefundNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrHoldNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrHoldNotActive), errors.Is(err, service.ErrHoldExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrCaptureExceedsHold):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrHoldNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrBatchEmpty), errors.Is(err, service.ErrBatchTooLarge), errors.Is(err, service.ErrInvalidBatchMode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrBatchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrIdempotencyInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// writeLimitError reports which limit a transfer exceeded and what is left of it
+func writeLimitError(c *gin.Context, err *service.LimitError) {
+	body := gin.H{
+		"error": err.Error(),
+		"limit": err.Limit,
+	}
+	if err.Limit == service.LimitHourlyCount {
+		body["remaining_transfers"] = 0
+	} else {
+		body["remaining"] = err.Remaining
+		body["currency"] = err.Currency
+	}
+	if err.ResetsAt != nil {
+		body["resets_at"] = err.ResetsAt
+	}
+	c.JSON(http.StatusForbidden, body)
+}
+
+func writeTransferResult(c *gin.Context, result *service.TransferResult) {
+	if result.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"transfer": result.Transfer,
+	})
+}
+
+func (h *WalletHandler) GetTransfer(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	transfer, err := h.walletService.GetTransfer(userID.(uint), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrTransferNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transfer": transfer,
+	})
+}
+
+// GetBalance returns the wallet balance at the time given by the optional
+// RFC 3339 "at" query parameter, defaulting to now. The optional "currency"
+// parameter picks the wallet; the primary wallet is used without it.
+func (h *WalletHandler) GetBalance(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid at %q: expected RFC 3339 timestamp", v)})
+			return
+		}
+		at = parsed
+	}
+
+	balance, err := h.walletService.GetBalanceAt(userID.(uint), c.Query("currency"), at)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedCurrency):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrWalletNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching balance"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
 func (h *WalletHandler) GetMe(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/roychanmeliaz/btechdevcases/internal/service"
+)
+
+type AdminMiddleware struct {
+	authService service.AuthService
+}
+
+func NewAdminMiddleware(authService service.AuthService) *AdminMiddleware {
+	return &AdminMiddleware{
+		authService: authService,
+	}
+}
+
+// RequireAdmin only lets users with the admin role through. It must run after
+// AuthMiddleware.RequireAuth.
+func (m *AdminMiddleware) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
+		isAdmin, err := m.authService.IsAdmin(userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error checking role"})
+			c.Abort()
+			return
+		}
+		if !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -2,26 +2,24 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
+	"github.com/roychanmeliaz/btechdevcases/internal/session"
 	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
 )
 
 type AuthMiddleware struct {
-	jwtManager     *customjwt.Manager
-	redisClient    *redis.Client
-	sessionTimeout time.Duration
+	jwtManager *customjwt.Manager
+	sessions   session.SessionStore
 }
 
-func NewAuthMiddleware(jwtManager *customjwt.Manager, redisClient *redis.Client, sessionTimeout time.Duration) *AuthMiddleware {
+func NewAuthMiddleware(jwtManager *customjwt.Manager, sessions session.SessionStore) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtManager:     jwtManager,
-		redisClient:    redisClient,
-		sessionTimeout: sessionTimeout,
+		jwtManager: jwtManager,
+		sessions:   sessions,
 	}
 }
 
@@ -53,12 +51,12 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		// Check session in Redis
-		ctx := context.Background()
-		sessionKey := "session:" + token
-		userID, err := m.redisClient.Get(ctx, sessionKey).Result()
-		if err == redis.Nil {
-			// Session expired or doesn't exist
+		// Check the session named by the jti claim and record the activity
+		// (resets the expiration timer)
+		sessionID := claims.SessionID()
+		err = m.sessions.Touch(context.Background(), sessionID, claims.UserID)
+		if errors.Is(err, session.ErrNotFound) {
+			// Session expired, was revoked or doesn't exist
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired due to inactivity"})
 			c.Abort()
 			return
@@ -68,17 +66,10 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		// Update session activity (reset expiration timer)
-		err = m.redisClient.Set(ctx, sessionKey, userID, m.sessionTimeout).Err()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating session"})
-			c.Abort()
-			return
-		}
-
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Set("session_id", sessionID)
 
 		c.Next()
 	}
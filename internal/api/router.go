@@ -1,45 +1,66 @@
 package api
 
 import (
-	"time"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 	"github.com/roychanmeliaz/btechdevcases/internal/api/handlers"
 	"github.com/roychanmeliaz/btechdevcases/internal/api/middleware"
 	"github.com/roychanmeliaz/btechdevcases/internal/service"
+	"github.com/roychanmeliaz/btechdevcases/internal/session"
 	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
 )
 
 type Router struct {
-	engine          *gin.Engine
-	authHandler     *handlers.AuthHandler
-	walletHandler   *handlers.WalletHandler
-	authMiddleware  *middleware.AuthMiddleware
+	engine           *gin.Engine
+	authHandler      *handlers.AuthHandler
+	walletHandler    *handlers.WalletHandler
+	adminHandler     *handlers.AdminHandler
+	scheduledHandler *handlers.ScheduledTransferHandler
+	recurringHandler *handlers.RecurringTransferHandler
+	requestHandler   *handlers.MoneyRequestHandler
+	splitHandler     *handlers.SplitHandler
+	authMiddleware   *middleware.AuthMiddleware
+	adminMiddleware  *middleware.AdminMiddleware
 }
 
 func NewRouter(
 	authService service.AuthService,
 	walletService service.WalletService,
+	scheduledTransferService service.ScheduledTransferService,
+	recurringTransferService service.RecurringTransferService,
+	moneyRequestService service.MoneyRequestService,
+	splitService service.SplitService,
 	jwtManager *customjwt.Manager,
-	redisClient *redis.Client,
-	sessionTimeout time.Duration,
+	sessions session.SessionStore,
 ) *Router {
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(authService, redisClient, sessionTimeout)
+	authHandler := handlers.NewAuthHandler(authService, sessions)
 	walletHandler := handlers.NewWalletHandler(walletService)
+	adminHandler := handlers.NewAdminHandler(walletService)
+	scheduledHandler := handlers.NewScheduledTransferHandler(scheduledTransferService)
+	recurringHandler := handlers.NewRecurringTransferHandler(recurringTransferService)
+	requestHandler := handlers.NewMoneyRequestHandler(moneyRequestService)
+	splitHandler := handlers.NewSplitHandler(splitService)
 	
 	// Create middleware
-	authMiddleware := middleware.NewAuthMiddleware(jwtManager, redisClient, sessionTimeout)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, sessions)
+	adminMiddleware := middleware.NewAdminMiddleware(authService)
 
 	// Setup Gin engine
 	engine := gin.Default()
 
 	return &Router{
-		engine:          engine,
-		authHandler:     authHandler,
-		walletHandler:   walletHandler,
-		authMiddleware:  authMiddleware,
+		engine:           engine,
+		authHandler:      authHandler,
+		walletHandler:    walletHandler,
+		adminHandler:     adminHandler,
+		scheduledHandler: scheduledHandler,
+		recurringHandler: recurringHandler,
+		requestHandler:   requestHandler,
+		splitHandler:     splitHandler,
+		authMiddleware:   authMiddleware,
+		adminMiddleware:  adminMiddleware,
 	}
 }
 
@@ -57,6 +78,8 @@ func (r *Router) Setup() {
 		{
 			auth.POST("/register", r.authHandler.Register)
 			auth.POST("/login", r.authHandler.Login)
+			auth.POST("/login/2fa", r.authHandler.VerifyLogin)
+			auth.POST("/refresh", r.authHandler.Refresh)
 		}
 
 		// Protected routes
@@ -66,13 +89,89 @@ func (r *Router) Setup() {
 			// User endpoints
 			protected.GET("/me", r.walletHandler.GetMe)
 
+			// Session endpoints
+			protected.POST("/auth/logout", r.authHandler.Logout)
+			protected.POST("/auth/logout-others", r.authHandler.LogoutOthers)
+			protected.GET("/auth/sessions", r.authHandler.ListSessions)
+			protected.DELETE("/auth/sessions/:id", r.authHandler.RevokeSession)
+
+			// Two-factor authentication endpoints
+			protected.GET("/auth/2fa", r.authHandler.TwoFactorStatus)
+			protected.POST("/auth/2fa/enroll", r.authHandler.EnrollTOTP)
+			protected.POST("/auth/2fa/confirm", r.authHandler.ConfirmTOTP)
+			protected.POST("/auth/2fa/recovery-codes", r.authHandler.RegenerateRecoveryCodes)
+			protected.POST("/auth/2fa/disable", r.authHandler.DisableTOTP)
+
 			// Wallet endpoints
 			protected.GET("/wallet", r.walletHandler.GetWallet)
+			protected.GET("/wallets", r.walletHandler.ListWallets)
+			protected.POST("/wallets", r.walletHandler.OpenWallet)
+			protected.GET("/wallet/transactions", r.walletHandler.ListTransactions)
+			protected.GET("/wallet/balance", r.walletHandler.GetBalance)
 			protected.POST("/wallet/transfer", r.walletHandler.Transfer)
+			protected.POST("/wallet/transfer/quote", r.walletHandler.QuoteTransfer)
+			protected.GET("/wallet/transfers/:id", r.walletHandler.GetTransfer)
+			protected.POST("/wallet/transfers/batch", r.walletHandler.BatchTransfer)
+			protected.GET("/wallet/transfers/batch/:id", r.walletHandler.GetBatch)
+			protected.POST("/wallet/transfers/:id/refund", r.walletHandler.Refund)
+			protected.GET("/wallet/limits", r.walletHandler.GetLimits)
+			protected.GET("/fx/rates", r.walletHandler.ListRates)
+			protected.POST("/wallet/fx/quote", r.walletHandler.QuoteConversion)
+			protected.POST("/wallet/fx/convert", r.walletHandler.Convert)
+			protected.POST("/wallet/holds", r.walletHandler.AuthorizeHold)
+			protected.GET("/wallet/holds/:id", r.walletHandler.GetHold)
+			protected.POST("/wallet/holds/:id/capture", r.walletHandler.CaptureHold)
+			protected.POST("/wallet/holds/:id/void", r.walletHandler.VoidHold)
+
+			// Scheduled transfer endpoints
+			protected.POST("/wallet/scheduled-transfers", r.scheduledHandler.Create)
+			protected.GET("/wallet/scheduled-transfers", r.scheduledHandler.List)
+			protected.GET("/wallet/scheduled-transfers/:id", r.scheduledHandler.Get)
+			protected.POST("/wallet/scheduled-transfers/:id/cancel", r.scheduledHandler.Cancel)
+
+			// Recurring transfer endpoints
+			protected.POST("/wallet/recurring-transfers", r.recurringHandler.Create)
+			protected.GET("/wallet/recurring-transfers", r.recurringHandler.List)
+			protected.GET("/wallet/recurring-transfers/:id", r.recurringHandler.Get)
+			protected.GET("/wallet/recurring-transfers/:id/occurrences", r.recurringHandler.Occurrences)
+			protected.POST("/wallet/recurring-transfers/:id/pause", r.recurringHandler.Pause)
+			protected.POST("/wallet/recurring-transfers/:id/resume", r.recurringHandler.Resume)
+			protected.POST("/wallet/recurring-transfers/:id/skip", r.recurringHandler.Skip)
+			protected.POST("/wallet/recurring-transfers/:id/cancel", r.recurringHandler.Cancel)
+
+			// Money request endpoints
+			protected.POST("/wallet/requests", r.requestHandler.Create)
+			protected.GET("/wallet/requests/incoming", r.requestHandler.ListIncoming)
+			protected.GET("/wallet/requests/outgoing", r.requestHandler.ListOutgoing)
+			protected.GET("/wallet/requests/:id", r.requestHandler.Get)
+			protected.POST("/wallet/requests/:id/accept", r.requestHandler.Accept)
+			protected.POST("/wallet/requests/:id/decline", r.requestHandler.Decline)
+			protected.POST("/wallet/requests/:id/cancel", r.requestHandler.Cancel)
+
+			// Split-bill group endpoints
+			protected.POST("/groups", r.splitHandler.CreateGroup)
+			protected.GET("/groups", r.splitHandler.ListGroups)
+			protected.GET("/groups/:id", r.splitHandler.GetGroup)
+			protected.POST("/groups/:id/expenses", r.splitHandler.AddExpense)
+			protected.GET("/groups/:id/expenses", r.splitHandler.ListExpenses)
+			protected.POST("/groups/:id/expenses/:expense_id/settle", r.splitHandler.Settle)
+			protected.GET("/groups/:id/balances", r.splitHandler.Balances)
+
+			// Admin endpoints
+			admin := protected.Group("/admin")
+			admin.Use(r.adminMiddleware.RequireAdmin())
+			{
+				admin.POST("/transfers/:id/reverse", r.adminHandler.Reverse)
+				admin.PUT("/users/:id/limits", r.adminHandler.SetLimits)
+				admin.PUT("/fx/rates/:from/:to", r.adminHandler.SetRate)
+				admin.DELETE("/fx/rates/:from/:to", r.adminHandler.DeleteRate)
+				admin.POST("/fx/rates/import", r.adminHandler.ImportRates)
+			}
 		}
 	}
 }
 
-func (r *Router) Run(addr string) error {
-	return r.engine.Run(addr)
+// Handler returns the configured engine so it can be served by an http.Server
+func (r *Router) Handler() http.Handler {
+	return r.engine
 }
@@ -5,18 +5,34 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
+	Server         ServerConfig
+	Database       DatabaseConfig
+	Redis          RedisConfig
+	JWT            JWTConfig
+	Session        SessionConfig
+	TwoFactor      TwoFactorConfig
+	Idempotency    IdempotencyConfig
+	Reconciliation ReconciliationConfig
+	Hold           HoldConfig
+	Scheduler      SchedulerConfig
+	MoneyRequest   MoneyRequestConfig
+	Limits         LimitsConfig
+	Fees           FeesConfig
+	FX             FXConfig
 }
 
 type ServerConfig struct {
-	Port string
-	Host string
+	Port            string
+	Host            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
 }
 
 type DatabaseConfig struct {
@@ -36,25 +52,186 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret           string
-	AccessExpiration time.Duration
-	SessionTimeout   time.Duration
+	Secret             string
+	AccessExpiration   time.Duration
+	RefreshExpiration  time.Duration
+	SessionTimeout     time.Duration
+	SessionMaxLifetime time.Duration
+}
+
+// Session store backends
+const (
+	SessionStoreRedis    = "redis"
+	SessionStoreMemory   = "memory"
+	SessionStorePostgres = "postgres"
+)
+
+// SessionConfig selects where sessions are kept: Redis, the process memory
+// (single node only, lost on restart) or a table in the main database
+type SessionConfig struct {
+	Store string
+}
+
+// TwoFactorConfig sets the issuer name authenticator apps show next to the
+// account, how long the second step of a login can be completed, and how
+// often expired login challenges are deleted
+type TwoFactorConfig struct {
+	Issuer                   string
+	ChallengeTTL             time.Duration
+	ChallengeCleanupInterval time.Duration
+}
+
+type IdempotencyConfig struct {
+	TTL             time.Duration
+	CleanupInterval time.Duration
+}
+
+type ReconciliationConfig struct {
+	Interval time.Duration
+	Repair   bool
+}
+
+type HoldConfig struct {
+	TTL            time.Duration
+	ExpiryInterval time.Duration
+}
+
+type SchedulerConfig struct {
+	Interval time.Duration
+}
+
+type MoneyRequestConfig struct {
+	TTL            time.Duration
+	ExpiryInterval time.Duration
+}
+
+// LimitsConfig holds the default outgoing transfer limits in USD; zero means
+// no limit
+type LimitsConfig struct {
+	PerTransaction money.Amount
+	Daily          money.Amount
+	Monthly        money.Amount
+	HourlyCount    int
+}
+
+// FeesConfig prices transfers: Flat plus Percent of the amount, kept between
+// Min and Max (0 means no cap), after FreePerMonth free transfers. Flat, Min
+// and Max are in USD.
+type FeesConfig struct {
+	Flat         money.Amount
+	Percent      money.Amount
+	Min          money.Amount
+	Max          money.Amount
+	FreePerMonth int
+}
+
+// FXConfig sets how long a conversion quote locks its rate, and optionally a
+// CSV file of exchange rates loaded on startup
+type FXConfig struct {
+	QuoteTTL  time.Duration
+	RatesFile string
 }
 
 func Load() (*Config, error) {
-	// JWT Access Token Expiration (default: 24 hours)
-	accessExp, _ := strconv.Atoi(getEnv("JWT_ACCESS_EXPIRATION_HOURS", "24"))
+	// JWT Access Token Expiration (default: 15 minutes; renewed with a refresh token)
+	accessExp, _ := strconv.Atoi(getEnv("JWT_ACCESS_EXPIRATION_MINUTES", "15"))
+
+	// Refresh Token Expiration (default: 24 hours, the maximum session lifetime)
+	refreshExp, _ := strconv.Atoi(getEnv("JWT_REFRESH_EXPIRATION_HOURS", "24"))
 	
 	// Session Timeout (default: 15 minutes as per requirements)
 	sessionTimeout, _ := strconv.Atoi(getEnv("SESSION_TIMEOUT_MINUTES", "15"))
+
+	// Maximum Session Lifetime, however active the session (default: 24 hours)
+	sessionMaxLifetime, _ := strconv.Atoi(getEnv("SESSION_MAX_LIFETIME_HOURS", "24"))
+
+	// Session Store backend (default: redis)
+	sessionStore := getEnv("SESSION_STORE", SessionStoreRedis)
+	switch sessionStore {
+	case SessionStoreRedis, SessionStoreMemory, SessionStorePostgres:
+	default:
+		return nil, fmt.Errorf("invalid SESSION_STORE %q: expected redis, memory or postgres", sessionStore)
+	}
 	
+	// Two-factor login challenges expire after 5 minutes
+	twoFactorChallengeTTL, _ := strconv.Atoi(getEnv("TWO_FACTOR_CHALLENGE_TTL_SECONDS", "300"))
+	// Expired challenges are deleted hourly (0 keeps them)
+	twoFactorChallengeCleanupInterval, _ := strconv.Atoi(getEnv("TWO_FACTOR_CHALLENGE_CLEANUP_INTERVAL_MINUTES", "60"))
+
 	// Redis DB number
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 
+	// How long an Idempotency-Key is remembered (default: 24 hours)
+	idempotencyTTL, _ := strconv.Atoi(getEnv("IDEMPOTENCY_TTL_HOURS", "24"))
+	// Expired keys are deleted hourly (0 keeps them)
+	idempotencyCleanupInterval, _ := strconv.Atoi(getEnv("IDEMPOTENCY_CLEANUP_INTERVAL_MINUTES", "60"))
+
+	// Background reconciliation (default: hourly, report only; 0 disables it)
+	reconciliationInterval, _ := strconv.Atoi(getEnv("RECONCILIATION_INTERVAL_MINUTES", "60"))
+	reconciliationRepair, _ := strconv.ParseBool(getEnv("RECONCILIATION_REPAIR", "false"))
+
+	// Holds expire after a week unless captured or voided; expiry runs every minute
+	holdTTL, _ := strconv.Atoi(getEnv("HOLD_TTL_MINUTES", "10080"))
+	holdExpiryInterval, _ := strconv.Atoi(getEnv("HOLD_EXPIRY_INTERVAL_SECONDS", "60"))
+
+	// How often due scheduled transfers are executed (default: every 30 seconds)
+	schedulerInterval, _ := strconv.Atoi(getEnv("SCHEDULER_INTERVAL_SECONDS", "30"))
+
+	// Money requests expire after a week unless answered; expiry runs every minute
+	moneyRequestTTL, _ := strconv.Atoi(getEnv("MONEY_REQUEST_TTL_HOURS", "168"))
+	moneyRequestExpiryInterval, _ := strconv.Atoi(getEnv("MONEY_REQUEST_EXPIRY_INTERVAL_SECONDS", "60"))
+
+	// Default outgoing transfer limits; users can be given their own by an admin
+	limitPerTransaction, err := getEnvAmount("TRANSFER_LIMIT_PER_TRANSACTION", "5000")
+	if err != nil {
+		return nil, err
+	}
+	limitDaily, err := getEnvAmount("TRANSFER_LIMIT_DAILY", "10000")
+	if err != nil {
+		return nil, err
+	}
+	limitMonthly, err := getEnvAmount("TRANSFER_LIMIT_MONTHLY", "50000")
+	if err != nil {
+		return nil, err
+	}
+	limitHourlyCount, _ := strconv.Atoi(getEnv("TRANSFER_LIMIT_HOURLY_COUNT", "30"))
+
+	// Transfer fees (default: free)
+	feeFlat, err := getEnvAmount("TRANSFER_FEE_FLAT", "0")
+	if err != nil {
+		return nil, err
+	}
+	feePercent, err := getEnvAmount("TRANSFER_FEE_PERCENT", "0")
+	if err != nil {
+		return nil, err
+	}
+	feeMin, err := getEnvAmount("TRANSFER_FEE_MIN", "0")
+	if err != nil {
+		return nil, err
+	}
+	feeMax, err := getEnvAmount("TRANSFER_FEE_MAX", "0")
+	if err != nil {
+		return nil, err
+	}
+	feeFreePerMonth, _ := strconv.Atoi(getEnv("TRANSFER_FEE_FREE_PER_MONTH", "0"))
+
+	// Conversion quotes lock their rate for 30 seconds
+	fxQuoteTTL, _ := strconv.Atoi(getEnv("FX_QUOTE_TTL_SECONDS", "30"))
+
+	// HTTP server timeouts
+	readTimeout, _ := strconv.Atoi(getEnv("SERVER_READ_TIMEOUT_SECONDS", "15"))
+	writeTimeout, _ := strconv.Atoi(getEnv("SERVER_WRITE_TIMEOUT_SECONDS", "15"))
+	idleTimeout, _ := strconv.Atoi(getEnv("SERVER_IDLE_TIMEOUT_SECONDS", "60"))
+	shutdownTimeout, _ := strconv.Atoi(getEnv("SERVER_SHUTDOWN_TIMEOUT_SECONDS", "30"))
+
 	config := &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:            getEnv("SERVER_PORT", "8080"),
+			ReadTimeout:     time.Duration(readTimeout) * time.Second,
+			WriteTimeout:    time.Duration(writeTimeout) * time.Second,
+			IdleTimeout:     time.Duration(idleTimeout) * time.Second,
+			ShutdownTimeout: time.Duration(shutdownTimeout) * time.Second,
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -71,9 +248,55 @@ func Load() (*Config, error) {
 			DB:       redisDB,
 		},
 		JWT: JWTConfig{
-			Secret:           getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-			AccessExpiration: time.Duration(accessExp) * time.Hour,
-			SessionTimeout:   time.Duration(sessionTimeout) * time.Minute,
+			Secret:             getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			AccessExpiration:   time.Duration(accessExp) * time.Minute,
+			RefreshExpiration:  time.Duration(refreshExp) * time.Hour,
+			SessionTimeout:     time.Duration(sessionTimeout) * time.Minute,
+			SessionMaxLifetime: time.Duration(sessionMaxLifetime) * time.Hour,
+		},
+		Session: SessionConfig{
+			Store: sessionStore,
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:                   getEnv("TOTP_ISSUER", "AuthWallet"),
+			ChallengeTTL:             time.Duration(twoFactorChallengeTTL) * time.Second,
+			ChallengeCleanupInterval: time.Duration(twoFactorChallengeCleanupInterval) * time.Minute,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:             time.Duration(idempotencyTTL) * time.Hour,
+			CleanupInterval: time.Duration(idempotencyCleanupInterval) * time.Minute,
+		},
+		Reconciliation: ReconciliationConfig{
+			Interval: time.Duration(reconciliationInterval) * time.Minute,
+			Repair:   reconciliationRepair,
+		},
+		Hold: HoldConfig{
+			TTL:            time.Duration(holdTTL) * time.Minute,
+			ExpiryInterval: time.Duration(holdExpiryInterval) * time.Second,
+		},
+		Scheduler: SchedulerConfig{
+			Interval: time.Duration(schedulerInterval) * time.Second,
+		},
+		MoneyRequest: MoneyRequestConfig{
+			TTL:            time.Duration(moneyRequestTTL) * time.Hour,
+			ExpiryInterval: time.Duration(moneyRequestExpiryInterval) * time.Second,
+		},
+		Limits: LimitsConfig{
+			PerTransaction: limitPerTransaction,
+			Daily:          limitDaily,
+			Monthly:        limitMonthly,
+			HourlyCount:    limitHourlyCount,
+		},
+		Fees: FeesConfig{
+			Flat:         feeFlat,
+			Percent:      feePercent,
+			Min:          feeMin,
+			Max:          feeMax,
+			FreePerMonth: feeFreePerMonth,
+		},
+		FX: FXConfig{
+			QuoteTTL:  time.Duration(fxQuoteTTL) * time.Second,
+			RatesFile: getEnv("FX_RATES_FILE", ""),
 		},
 	}
 
@@ -85,6 +308,10 @@ func Load() (*Config, error) {
 	return config, nil
 }
 
+func (c *ServerConfig) Address() string {
+	return fmt.Sprintf("%s:%s", c.Host, c.Port)
+}
+
 func (c *DatabaseConfig) DSN() string {
 	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -102,3 +329,12 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvAmount reads a decimal amount such as "12.50"
+func getEnvAmount(key, defaultValue string) (money.Amount, error) {
+	amount, err := money.Parse(getEnv(key, defaultValue))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return amount, nil
+}
@@ -0,0 +1,461 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/roychanmeliaz/btechdevcases/internal/config"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Connect opens the PostgreSQL connection used by the repositories
+func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("error getting database handle: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(25)
+	sqlDB.SetMaxIdleConns(25)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+
+	return db, nil
+}
+
+// ConnectRedis opens the Redis connection used for sessions and verifies it is reachable
+func ConnectRedis(ctx context.Context, cfg *config.RedisConfig) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
+	}
+
+	return client, nil
+}
+
+// Migrate creates or updates the schema for all models
+func Migrate(db *gorm.DB) error {
+	// Data migrations that must run before AutoMigrate changes column types
+	if err := convertFloatMoneyColumns(db); err != nil {
+		return err
+	}
+	if err := dropSingleWalletIndex(db); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Wallet{},
+		&models.Transaction{},
+		&models.Transfer{},
+		&models.IdempotencyRecord{},
+		&models.LedgerAccount{},
+		&models.JournalEntry{},
+		&models.Posting{},
+		&models.Hold{},
+		&models.ScheduledTransfer{},
+		&models.RecurringTransfer{},
+		&models.MoneyRequest{},
+		&models.TransferBatch{},
+		&models.TransferBatchItem{},
+		&models.SplitGroup{},
+		&models.SplitGroupMember{},
+		&models.SplitExpense{},
+		&models.SplitShare{},
+		&models.TransferLimit{},
+		&models.ExchangeRate{},
+		&models.FXQuote{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.TOTPCredential{},
+		&models.RecoveryCode{},
+		&models.LoginChallenge{},
+	); err != nil {
+		return fmt.Errorf("error migrating database: %w", err)
+	}
+
+	// Data migrations that need the new schema
+	if err := backfillTransfers(db); err != nil {
+		return err
+	}
+	if err := ensureSystemAccounts(db); err != nil {
+		return err
+	}
+	if err := migrateLegacyLedger(db); err != nil {
+		return err
+	}
+	if err := backfillBalanceAfter(db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// moneyColumns lists the columns that used to be float64 and now hold money.Amount minor units
+var moneyColumns = []struct {
+	table  string
+	column string
+}{
+	{"wallets", "balance"},
+	{"transactions", "amount"},
+}
+
+// convertFloatMoneyColumns converts legacy float money columns to integer minor
+// units. Values are rounded half away from zero to the nearest minor unit.
+// Columns that are already integers are left untouched, so it is safe to run
+// on every start.
+func convertFloatMoneyColumns(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	for _, mc := range moneyColumns {
+		if !db.Migrator().HasTable(mc.table) {
+			continue
+		}
+
+		columnTypes, err := db.Migrator().ColumnTypes(mc.table)
+		if err != nil {
+			return fmt.Errorf("error reading columns of %s: %w", mc.table, err)
+		}
+
+		for _, ct := range columnTypes {
+			if ct.Name() != mc.column || !isFloatType(ct.DatabaseTypeName()) {
+				continue
+			}
+
+			sql := fmt.Sprintf(
+				"ALTER TABLE %s ALTER COLUMN %s TYPE bigint USING ROUND(%s::numeric * %d)::bigint",
+				mc.table, mc.column, mc.column, int64(money.FromMajor(1)),
+			)
+			if err := db.Exec(sql).Error; err != nil {
+				return fmt.Errorf("error converting %s.%s to minor units: %w", mc.table, mc.column, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isFloatType(name string) bool {
+	switch strings.ToLower(name) {
+	case "float4", "float8", "real", "double precision", "numeric", "decimal":
+		return true
+	}
+	return false
+}
+
+// dropSingleWalletIndex drops the unique index on wallets.user_id from when
+// each user had a single wallet. AutoMigrate replaces it with a unique index
+// on (user_id, currency); existing wallets get the default currency.
+func dropSingleWalletIndex(db *gorm.DB) error {
+	const index = "idx_wallets_user_id"
+	if !db.Migrator().HasTable(&models.Wallet{}) || !db.Migrator().HasIndex(&models.Wallet{}, index) {
+		return nil
+	}
+	if err := db.Migrator().DropIndex(&models.Wallet{}, index); err != nil {
+		return fmt.Errorf("error dropping %s: %w", index, err)
+	}
+	return nil
+}
+
+// backfillTransfers creates a Transfer for every legacy debit leg that has none
+// and links it with its credit leg, which was only recognizable by the
+// "-credit" suffix on its idempotency key
+func backfillTransfers(db *gorm.DB) error {
+	var debits []models.Transaction
+	err := db.Where("transfer_id IS NULL AND type = ?", models.TransactionTypeDebit).
+		Order("id ASC").
+		Find(&debits).Error
+	if err != nil {
+		return fmt.Errorf("error finding legacy transactions: %w", err)
+	}
+
+	for _, debit := range debits {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var credit models.Transaction
+			err := tx.Where("idempotency_key = ? AND transfer_id IS NULL", debit.IdempotencyKey+"-credit").
+				First(&credit).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					// Orphaned leg; leave it for reconciliation to report
+					return nil
+				}
+				return err
+			}
+
+			transfer := &models.Transfer{
+				PublicID:          uuid.NewString(),
+				SenderWalletID:    debit.WalletID,
+				RecipientWalletID: credit.WalletID,
+				Amount:            debit.Amount,
+				Notes:             debit.Notes,
+				Status:            models.TransferStatusCompleted,
+				CreatedAt:         debit.CreatedAt,
+				UpdatedAt:         debit.CreatedAt,
+			}
+			if err := tx.Create(transfer).Error; err != nil {
+				return err
+			}
+
+			return tx.Model(&models.Transaction{}).
+				Where("id IN ?", []uint{debit.ID, credit.ID}).
+				Update("transfer_id", transfer.ID).Error
+		})
+		if err != nil {
+			return fmt.Errorf("error backfilling transfer for transaction %d: %w", debit.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureSystemAccounts creates the treasury, fees and suspense ledger accounts
+func ensureSystemAccounts(db *gorm.DB) error {
+	for _, code := range models.SystemAccountCodes {
+		account := models.LedgerAccount{Code: code, Kind: models.AccountKindSystem}
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error
+		if err != nil {
+			return fmt.Errorf("error creating %s account: %w", code, err)
+		}
+	}
+	return nil
+}
+
+// migrateLegacyLedger brings data written before the double-entry ledger into
+// it, in a single transaction:
+//   - every wallet without a ledger account gets one
+//   - each such wallet gets an opening balance entry funded by the treasury,
+//     equal to its balance minus the net of its legacy transactions
+//   - every legacy transfer gets a transfer entry, and orphaned legacy legs get
+//     an entry against the suspense account
+//
+// Afterwards each wallet's postings add up to its cached balance.
+func migrateLegacyLedger(db *gorm.DB) error {
+	var wallets []models.Wallet
+	err := db.Unscoped().
+		Where("id NOT IN (?)", db.Model(&models.LedgerAccount{}).Select("wallet_id").Where("wallet_id IS NOT NULL")).
+		Order("id ASC").
+		Find(&wallets).Error
+	if err != nil {
+		return fmt.Errorf("error finding wallets without ledger account: %w", err)
+	}
+	if len(wallets) == 0 {
+		return nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		systemAccounts := map[string]uint{}
+		for _, code := range []string{models.AccountCodeTreasury, models.AccountCodeSuspense} {
+			var account models.LedgerAccount
+			if err := tx.Where("code = ?", code).First(&account).Error; err != nil {
+				return err
+			}
+			systemAccounts[code] = account.ID
+		}
+
+		accounts := map[uint]uint{}
+		for _, wallet := range wallets {
+			account := &models.LedgerAccount{
+				Code:     models.WalletAccountCode(wallet.ID),
+				Kind:     models.AccountKindWallet,
+				WalletID: &wallet.ID,
+			}
+			if err := tx.Create(account).Error; err != nil {
+				return err
+			}
+			accounts[wallet.ID] = account.ID
+		}
+
+		accountOf := func(walletID uint) (uint, error) {
+			if id, ok := accounts[walletID]; ok {
+				return id, nil
+			}
+			var account models.LedgerAccount
+			if err := tx.Where("wallet_id = ?", walletID).First(&account).Error; err != nil {
+				return 0, err
+			}
+			accounts[walletID] = account.ID
+			return account.ID, nil
+		}
+
+		// Opening balances: whatever the legacy transactions do not explain
+		for _, wallet := range wallets {
+			var net money.Amount
+			err := tx.Model(&models.Transaction{}).
+				Select("COALESCE(SUM(CASE WHEN type = ? THEN amount ELSE -amount END), 0)", models.TransactionTypeCredit).
+				Where("wallet_id = ? AND journal_entry_id IS NULL", wallet.ID).
+				Scan(&net).Error
+			if err != nil {
+				return err
+			}
+
+			opening := wallet.Balance - net
+			if opening == 0 {
+				continue
+			}
+			entry := &models.JournalEntry{
+				Kind:        models.JournalEntryKindOpeningBalance,
+				Description: "Opening balance",
+				CreatedAt:   wallet.CreatedAt,
+				Postings: []models.Posting{
+					{AccountID: accounts[wallet.ID], Amount: opening, CreatedAt: wallet.CreatedAt},
+					{AccountID: systemAccounts[models.AccountCodeTreasury], Amount: -opening, CreatedAt: wallet.CreatedAt},
+				},
+			}
+			if err := tx.Create(entry).Error; err != nil {
+				return err
+			}
+		}
+
+		// Legacy legs, one journal entry per transfer or per orphaned leg
+		var legs []models.Transaction
+		if err := tx.Where("journal_entry_id IS NULL").Order("id ASC").Find(&legs).Error; err != nil {
+			return err
+		}
+
+		transferEntries := map[uint]*models.JournalEntry{}
+		for _, leg := range legs {
+			accountID, err := accountOf(leg.WalletID)
+			if err != nil {
+				return err
+			}
+			amount := leg.Amount
+			if leg.Type == models.TransactionTypeDebit {
+				amount = -amount
+			}
+			posting := models.Posting{AccountID: accountID, Amount: amount, CreatedAt: leg.CreatedAt}
+
+			if leg.TransferID != nil {
+				entry, ok := transferEntries[*leg.TransferID]
+				if !ok {
+					entry = &models.JournalEntry{
+						Kind:        models.JournalEntryKindTransfer,
+						TransferID:  leg.TransferID,
+						Description: leg.Notes,
+						CreatedAt:   leg.CreatedAt,
+					}
+					transferEntries[*leg.TransferID] = entry
+				}
+				entry.Postings = append(entry.Postings, posting)
+				continue
+			}
+
+			entry := &models.JournalEntry{
+				Kind:        models.JournalEntryKindAdjustment,
+				Description: "Legacy transaction without counterpart",
+				CreatedAt:   leg.CreatedAt,
+				Postings: []models.Posting{
+					posting,
+					{AccountID: systemAccounts[models.AccountCodeSuspense], Amount: -amount, CreatedAt: leg.CreatedAt},
+				},
+			}
+			if err := tx.Create(entry).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Transaction{}).Where("id = ?", leg.ID).Update("journal_entry_id", entry.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		for transferID, entry := range transferEntries {
+			if err := tx.Create(entry).Error; err != nil {
+				return err
+			}
+			err := tx.Model(&models.Transaction{}).
+				Where("transfer_id = ? AND journal_entry_id IS NULL", transferID).
+				Update("journal_entry_id", entry.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error migrating legacy wallets to the ledger: %w", err)
+	}
+
+	return nil
+}
+
+// backfillBalanceAfter fills in the running balance of transactions written
+// before balance_after existed. For each affected wallet it replays the
+// wallet's transactions in (created_at, id) order, starting from the wallet's
+// opening balance in the ledger. Soft-deleted transactions are left out, as
+// they are when the opening balance is worked out. Rows that already have a
+// balance_after are left untouched, so it is safe to run on every start.
+func backfillBalanceAfter(db *gorm.DB) error {
+	var walletIDs []uint
+	err := db.Model(&models.Transaction{}).
+		Distinct("wallet_id").
+		Where("balance_after IS NULL").
+		Order("wallet_id ASC").
+		Pluck("wallet_id", &walletIDs).Error
+	if err != nil {
+		return fmt.Errorf("error finding transactions without balance_after: %w", err)
+	}
+
+	for _, walletID := range walletIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var balance money.Amount
+			err := tx.Model(&models.Posting{}).
+				Select("COALESCE(SUM(postings.amount), 0)").
+				Joins("JOIN journal_entries ON journal_entries.id = postings.journal_entry_id").
+				Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+				Where("ledger_accounts.wallet_id = ? AND journal_entries.kind = ?", walletID, models.JournalEntryKindOpeningBalance).
+				Scan(&balance).Error
+			if err != nil {
+				return err
+			}
+
+			var transactions []models.Transaction
+			err = tx.Where("wallet_id = ?", walletID).
+				Order("created_at ASC, id ASC").
+				Find(&transactions).Error
+			if err != nil {
+				return err
+			}
+
+			for _, transaction := range transactions {
+				if transaction.Type == models.TransactionTypeCredit {
+					balance += transaction.Amount
+				} else {
+					balance -= transaction.Amount
+				}
+				if transaction.BalanceAfter != nil {
+					continue
+				}
+				err := tx.Model(&models.Transaction{}).
+					Where("id = ?", transaction.ID).
+					Update("balance_after", balance).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error backfilling balance_after of wallet %d: %w", walletID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrate_LegacyTransactions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:legacy_transactions?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	// A wallet from before the ledger: 50 that no transaction explains, then
+	// a credit of 100, a debit of 30 that was later soft-deleted, and a credit
+	// of 50
+	user := &models.User{Email: "legacy@example.com", Password: "hashedpassword"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	wallet := &models.Wallet{UserID: user.ID, Currency: models.DefaultCurrency, Balance: money.FromMajor(200)}
+	if err := db.Create(wallet).Error; err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	legs := []models.Transaction{
+		{WalletID: wallet.ID, Amount: money.FromMajor(100), Type: models.TransactionTypeCredit, IdempotencyKey: "legacy-1", CreatedAt: start},
+		{WalletID: wallet.ID, Amount: money.FromMajor(30), Type: models.TransactionTypeDebit, IdempotencyKey: "legacy-2", CreatedAt: start.Add(time.Minute)},
+		{WalletID: wallet.ID, Amount: money.FromMajor(50), Type: models.TransactionTypeCredit, IdempotencyKey: "legacy-3", CreatedAt: start.Add(2 * time.Minute)},
+	}
+	if err := db.Create(&legs).Error; err != nil {
+		t.Fatalf("failed to create transactions: %v", err)
+	}
+	if err := db.Delete(&legs[1]).Error; err != nil {
+		t.Fatalf("failed to soft-delete transaction: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("failed to migrate legacy data: %v", err)
+	}
+
+	t.Run("ledger matches the wallet", func(t *testing.T) {
+		var sum money.Amount
+		err := db.Model(&models.Posting{}).
+			Select("COALESCE(SUM(postings.amount), 0)").
+			Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+			Where("ledger_accounts.wallet_id = ?", wallet.ID).
+			Scan(&sum).Error
+		if err != nil {
+			t.Fatalf("failed to sum postings: %v", err)
+		}
+		if sum != wallet.Balance {
+			t.Errorf("expected postings to add up to %s, got %s", wallet.Balance, sum)
+		}
+	})
+
+	t.Run("balance_after skips soft-deleted transactions", func(t *testing.T) {
+		var transactions []models.Transaction
+		if err := db.Where("wallet_id = ?", wallet.ID).Order("id ASC").Find(&transactions).Error; err != nil {
+			t.Fatalf("failed to get transactions: %v", err)
+		}
+		expected := []money.Amount{money.FromMajor(150), money.FromMajor(200)}
+		if len(transactions) != len(expected) {
+			t.Fatalf("expected %d transactions, got %d", len(expected), len(transactions))
+		}
+		for i, transaction := range transactions {
+			if transaction.BalanceAfter == nil || *transaction.BalanceAfter != expected[i] {
+				t.Errorf("transaction %d: expected balance_after %s, got %v", transaction.ID, expected[i], transaction.BalanceAfter)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+// ExchangeRate is the mid-market rate of a currency pair: one unit of
+// FromCurrency buys Rate units of ToCurrency. Conversions are made at Rate
+// reduced by Spread, a percentage with two decimals (e.g. 0.50 for 0.5%).
+type ExchangeRate struct {
+	ID           uint         `gorm:"primarykey" json:"-"`
+	FromCurrency string       `gorm:"type:varchar(3);not null;uniqueIndex:idx_exchange_rates_pair" json:"from"`
+	ToCurrency   string       `gorm:"type:varchar(3);not null;uniqueIndex:idx_exchange_rates_pair" json:"to"`
+	Rate         money.Rate   `gorm:"not null" json:"rate"`
+	Spread       money.Amount `gorm:"not null;default:0" json:"spread"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+func (ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
+
+// FXQuote locks the rate of a conversion until ExpiresAt. Executing it debits
+// Amount in FromCurrency and credits ConvertedAmount in ToCurrency; a quote
+// can be executed once.
+type FXQuote struct {
+	ID              uint         `gorm:"primarykey" json:"-"`
+	PublicID        string       `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	UserID          uint         `gorm:"not null;index" json:"-"`
+	FromCurrency    string       `gorm:"type:varchar(3);not null" json:"from"`
+	ToCurrency      string       `gorm:"type:varchar(3);not null" json:"to"`
+	Amount          money.Amount `gorm:"not null" json:"amount"`
+	ConvertedAmount money.Amount `gorm:"not null" json:"converted_amount"`
+	Rate            money.Rate   `gorm:"not null" json:"rate"`
+	Spread          money.Amount `gorm:"not null;default:0" json:"spread"`
+	EffectiveRate   money.Rate   `gorm:"not null" json:"effective_rate"`
+	ExpiresAt       time.Time    `gorm:"not null" json:"expires_at"`
+	// TransferID is the public ID of the transfer that executed the quote
+	TransferID *string   `gorm:"type:varchar(36)" json:"transfer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (FXQuote) TableName() string {
+	return "fx_quotes"
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type HoldStatus string
+
+const (
+	HoldStatusAuthorized HoldStatus = "authorized"
+	HoldStatusCaptured   HoldStatus = "captured"
+	HoldStatusVoided     HoldStatus = "voided"
+	HoldStatusExpired    HoldStatus = "expired"
+)
+
+// Hold reserves Amount of a wallet's balance for a recipient without moving
+// money. While authorized it is counted in the wallet's HeldAmount; capturing
+// it creates a transfer of up to Amount and releases the rest.
+type Hold struct {
+	ID                uint         `gorm:"primarykey" json:"-"`
+	PublicID          string       `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	WalletID          uint         `gorm:"not null;index" json:"wallet_id"`
+	RecipientWalletID uint         `gorm:"not null;index" json:"recipient_wallet_id"`
+	Amount            money.Amount `gorm:"not null" json:"amount"`
+	CapturedAmount    money.Amount `gorm:"not null;default:0" json:"captured_amount"`
+	Notes             string       `gorm:"type:text" json:"notes,omitempty"`
+	Status            HoldStatus   `gorm:"type:varchar(20);not null;index:idx_holds_status_expires_at" json:"status"`
+	ExpiresAt         time.Time    `gorm:"not null;index:idx_holds_status_expires_at" json:"expires_at"`
+	// TransferID is the public ID of the transfer created by the capture
+	TransferID *string   `gorm:"type:varchar(36)" json:"transfer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (Hold) TableName() string {
+	return "holds"
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyStatusProcessing IdempotencyStatus = "processing"
+	IdempotencyStatusCompleted  IdempotencyStatus = "completed"
+)
+
+// IdempotencyRecord remembers a client-supplied Idempotency-Key for a user
+// together with a fingerprint of the request it was first used with and the
+// response that request produced
+type IdempotencyRecord struct {
+	ID          uint              `gorm:"primarykey" json:"id"`
+	UserID      uint              `gorm:"not null;uniqueIndex:idx_idempotency_user_key" json:"user_id"`
+	Key         string            `gorm:"column:idempotency_key;not null;type:varchar(255);uniqueIndex:idx_idempotency_user_key" json:"key"`
+	Fingerprint string            `gorm:"not null;type:varchar(64)" json:"-"`
+	Status      IdempotencyStatus `gorm:"not null;type:varchar(20)" json:"status"`
+	Response    string            `gorm:"type:text" json:"-"`
+	ExpiresAt   time.Time         `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_records"
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type AccountKind string
+
+const (
+	AccountKindWallet AccountKind = "wallet"
+	AccountKindSystem AccountKind = "system"
+)
+
+// Codes of the system accounts that money enters and leaves the wallets through
+const (
+	AccountCodeTreasury = "treasury"
+	AccountCodeFees     = "fees"
+	AccountCodeSuspense = "suspense"
+)
+
+// SystemAccountCodes lists every system account that must exist
+var SystemAccountCodes = []string{AccountCodeTreasury, AccountCodeFees, AccountCodeSuspense}
+
+// WalletAccountCode returns the ledger account code of a wallet
+func WalletAccountCode(walletID uint) string {
+	return fmt.Sprintf("wallet:%d", walletID)
+}
+
+// FXAccountCode returns the code of the system account that holds the
+// platform's position in a currency. Conversions pay into the account of the
+// source currency and out of the account of the target currency, so every
+// journal entry stays within one currency.
+func FXAccountCode(currency string) string {
+	return "fx:" + currency
+}
+
+// LedgerAccount is an account in the double-entry ledger. Every wallet has one,
+// plus a few system accounts. An account's balance is the sum of its postings;
+// for wallet accounts it is cached in wallets.balance.
+type LedgerAccount struct {
+	ID        uint        `gorm:"primarykey" json:"id"`
+	Code      string      `gorm:"type:varchar(64);uniqueIndex;not null" json:"code"`
+	Kind      AccountKind `gorm:"type:varchar(10);not null" json:"kind"`
+	WalletID  *uint       `gorm:"uniqueIndex" json:"wallet_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+func (LedgerAccount) TableName() string {
+	return "ledger_accounts"
+}
+
+type JournalEntryKind string
+
+const (
+	JournalEntryKindOpeningBalance JournalEntryKind = "opening_balance"
+	JournalEntryKindWelcomeBonus   JournalEntryKind = "welcome_bonus"
+	JournalEntryKindTransfer       JournalEntryKind = "transfer"
+	JournalEntryKindAdjustment     JournalEntryKind = "adjustment"
+	JournalEntryKindRefund         JournalEntryKind = "refund"
+	JournalEntryKindReversal       JournalEntryKind = "reversal"
+	JournalEntryKindFee            JournalEntryKind = "fee"
+)
+
+// JournalEntry is one balanced business event in the ledger: the amounts of
+// its postings always sum to zero
+type JournalEntry struct {
+	ID          uint             `gorm:"primarykey" json:"id"`
+	Kind        JournalEntryKind `gorm:"type:varchar(30);not null;index" json:"kind"`
+	TransferID  *uint            `gorm:"index" json:"-"`
+	Description string           `gorm:"type:text" json:"description,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	Postings    []Posting        `gorm:"foreignKey:JournalEntryID" json:"postings,omitempty"`
+}
+
+func (JournalEntry) TableName() string {
+	return "journal_entries"
+}
+
+// Posting moves Amount into (positive) or out of (negative) an account
+type Posting struct {
+	ID             uint         `gorm:"primarykey" json:"id"`
+	JournalEntryID uint         `gorm:"not null;index" json:"journal_entry_id"`
+	AccountID      uint         `gorm:"not null;index" json:"account_id"`
+	Amount         money.Amount `gorm:"not null" json:"amount"`
+	CreatedAt      time.Time    `gorm:"index" json:"created_at"`
+}
+
+func (Posting) TableName() string {
+	return "postings"
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type MoneyRequestStatus string
+
+const (
+	MoneyRequestStatusPending   MoneyRequestStatus = "pending"
+	MoneyRequestStatusAccepted  MoneyRequestStatus = "accepted"
+	MoneyRequestStatusDeclined  MoneyRequestStatus = "declined"
+	MoneyRequestStatusCancelled MoneyRequestStatus = "cancelled"
+	MoneyRequestStatusExpired   MoneyRequestStatus = "expired"
+)
+
+// MoneyRequest asks the payee to pay the requester. Accepting it transfers the
+// amount from payee to requester; TransferID then holds the public ID of that
+// transfer.
+type MoneyRequest struct {
+	ID             uint               `gorm:"primarykey" json:"-"`
+	PublicID       string             `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	RequesterID    uint               `gorm:"not null;index" json:"-"`
+	PayeeID        uint               `gorm:"not null;index" json:"-"`
+	RequesterEmail string             `gorm:"not null" json:"requester"`
+	PayeeEmail     string             `gorm:"not null" json:"payee"`
+	Amount         money.Amount       `gorm:"not null" json:"amount"`
+	Notes          string             `gorm:"type:text" json:"notes,omitempty"`
+	Status         MoneyRequestStatus `gorm:"type:varchar(20);not null;index:idx_money_requests_status_expires_at" json:"status"`
+	ExpiresAt      time.Time          `gorm:"not null;index:idx_money_requests_status_expires_at" json:"expires_at"`
+	TransferID     *string            `gorm:"type:varchar(36)" json:"transfer_id,omitempty"`
+	RespondedAt    *time.Time         `json:"responded_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+func (MoneyRequest) TableName() string {
+	return "money_requests"
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type RecurringFrequency string
+
+const (
+	RecurringFrequencyDaily   RecurringFrequency = "daily"
+	RecurringFrequencyWeekly  RecurringFrequency = "weekly"
+	RecurringFrequencyMonthly RecurringFrequency = "monthly"
+)
+
+type RecurringTransferStatus string
+
+const (
+	RecurringTransferStatusActive RecurringTransferStatus = "active"
+	RecurringTransferStatusPaused RecurringTransferStatus = "paused"
+	// RecurringTransferStatusCompleted is set once the end date or the maximum
+	// number of occurrences is reached
+	RecurringTransferStatusCompleted RecurringTransferStatus = "completed"
+	RecurringTransferStatusCancelled RecurringTransferStatus = "cancelled"
+)
+
+// RecurringTransfer is a rule that spawns a scheduled transfer (an occurrence)
+// every day, every week on Weekday or every month on DayOfMonth, at the time
+// of day of StartAt in UTC. Monthly rules on a day a month does not have run
+// on that month's last day. NextRunAt is nil once the rule has ended.
+type RecurringTransfer struct {
+	ID              uint                    `gorm:"primarykey" json:"-"`
+	PublicID        string                  `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	UserID          uint                    `gorm:"not null;index" json:"user_id"`
+	RecipientEmail  string                  `gorm:"not null" json:"recipient"`
+	Amount          money.Amount            `gorm:"not null" json:"amount"`
+	Notes           string                  `gorm:"type:text" json:"notes,omitempty"`
+	Frequency       RecurringFrequency      `gorm:"type:varchar(20);not null" json:"frequency"`
+	Weekday         string                  `gorm:"type:varchar(10)" json:"weekday,omitempty"`
+	DayOfMonth      int                     `json:"day_of_month,omitempty"`
+	StartAt         time.Time               `gorm:"not null" json:"start_at"`
+	EndAt           *time.Time              `json:"end_at,omitempty"`
+	MaxOccurrences  *int                    `json:"max_occurrences,omitempty"`
+	OccurrenceCount int                     `gorm:"not null;default:0" json:"occurrence_count"`
+	NextRunAt       *time.Time              `gorm:"index:idx_recurring_transfers_status_next_run_at" json:"next_run_at,omitempty"`
+	Status          RecurringTransferStatus `gorm:"type:varchar(20);not null;index:idx_recurring_transfers_status_next_run_at" json:"status"`
+	CreatedAt       time.Time               `json:"created_at"`
+	UpdatedAt       time.Time               `json:"updated_at"`
+}
+
+func (RecurringTransfer) TableName() string {
+	return "recurring_transfers"
+}
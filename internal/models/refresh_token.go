@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is an opaque token that renews a short-lived access token. Only
+// a SHA-256 hash of the token is stored. Every use rotates it: the token is
+// marked used and a new one is issued in the same family, so the family is the
+// chain of tokens descending from one login.
+type RefreshToken struct {
+	ID        uint       `gorm:"primarykey" json:"-"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	FamilyID  string     `gorm:"not null;type:varchar(36);index" json:"family_id"`
+	TokenHash string     `gorm:"not null;type:varchar(64);uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
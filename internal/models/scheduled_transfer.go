@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type ScheduledTransferStatus string
+
+const (
+	ScheduledTransferStatusPending ScheduledTransferStatus = "pending"
+	// ScheduledTransferStatusProcessing is set while the executor runs it
+	ScheduledTransferStatusProcessing ScheduledTransferStatus = "processing"
+	ScheduledTransferStatusExecuted   ScheduledTransferStatus = "executed"
+	ScheduledTransferStatusFailed     ScheduledTransferStatus = "failed"
+	ScheduledTransferStatusCancelled  ScheduledTransferStatus = "cancelled"
+	// ScheduledTransferStatusSkipped marks an occurrence of a recurring
+	// transfer that was skipped and never ran
+	ScheduledTransferStatusSkipped ScheduledTransferStatus = "skipped"
+)
+
+// ScheduledTransfer is a transfer that executes at ExecuteAt. Once executed,
+// TransferID holds the public ID of the resulting transfer; when it fails,
+// FailureReason says why. Occurrences of a recurring transfer carry its public
+// ID and their 1-based position in the series.
+type ScheduledTransfer struct {
+	ID                  uint                    `gorm:"primarykey" json:"-"`
+	PublicID            string                  `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	UserID              uint                    `gorm:"not null;index" json:"user_id"`
+	RecipientEmail      string                  `gorm:"not null" json:"recipient"`
+	Amount              money.Amount            `gorm:"not null" json:"amount"`
+	Notes               string                  `gorm:"type:text" json:"notes,omitempty"`
+	ExecuteAt           time.Time               `gorm:"not null;index:idx_scheduled_transfers_status_execute_at" json:"execute_at"`
+	Status              ScheduledTransferStatus `gorm:"type:varchar(20);not null;index:idx_scheduled_transfers_status_execute_at" json:"status"`
+	FailureReason       string                  `gorm:"type:text" json:"failure_reason,omitempty"`
+	TransferID          *string                 `gorm:"type:varchar(36)" json:"transfer_id,omitempty"`
+	ExecutedAt          *time.Time              `json:"executed_at,omitempty"`
+	RecurringTransferID *string                 `gorm:"type:varchar(36);uniqueIndex:idx_scheduled_transfers_occurrence" json:"recurring_transfer_id,omitempty"`
+	Occurrence          int                     `gorm:"uniqueIndex:idx_scheduled_transfers_occurrence" json:"occurrence,omitempty"`
+	CreatedAt           time.Time               `json:"created_at"`
+	UpdatedAt           time.Time               `json:"updated_at"`
+}
+
+func (ScheduledTransfer) TableName() string {
+	return "scheduled_transfers"
+}
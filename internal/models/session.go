@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one login of a user on a device. Its ID is the ID of the refresh
+// token family started by the login, so it survives token refreshes, and is
+// carried in the jti claim of every access token issued for it. A session
+// ends after a period of inactivity (IdleExpiresAt moves forward with every
+// use) and at the latest at ExpiresAt, however active it is.
+type Session struct {
+	ID            string    `gorm:"primarykey;type:varchar(36)" json:"id"`
+	UserID        uint      `gorm:"not null;index" json:"-"`
+	UserAgent     string    `gorm:"type:text" json:"user_agent"`
+	IP            string    `gorm:"type:varchar(45)" json:"ip"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastSeenAt    time.Time `gorm:"not null" json:"last_seen_at"`
+	IdleExpiresAt time.Time `gorm:"not null;index" json:"-"`
+	ExpiresAt     time.Time `gorm:"not null" json:"expires_at"`
+	// Current is set when listing sessions for the one making the request
+	Current bool `gorm:"-" json:"current"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
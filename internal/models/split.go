@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type SplitType string
+
+const (
+	SplitTypeEqual      SplitType = "equal"
+	SplitTypeExact      SplitType = "exact"
+	SplitTypePercentage SplitType = "percentage"
+)
+
+type SplitSettlement string
+
+const (
+	// SplitSettlementRequest sends each participant a money request
+	SplitSettlementRequest SplitSettlement = "request"
+	// SplitSettlementTransfer lets each participant pay their share directly
+	SplitSettlementTransfer SplitSettlement = "transfer"
+)
+
+type SplitShareStatus string
+
+const (
+	SplitShareStatusPending SplitShareStatus = "pending"
+	SplitShareStatusPaid    SplitShareStatus = "paid"
+)
+
+// SplitGroup is a set of users who share expenses
+type SplitGroup struct {
+	ID          uint               `gorm:"primarykey" json:"-"`
+	PublicID    string             `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	Name        string             `gorm:"not null" json:"name"`
+	CreatedByID uint               `gorm:"not null" json:"-"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Members     []SplitGroupMember `gorm:"foreignKey:GroupID" json:"members"`
+}
+
+func (SplitGroup) TableName() string {
+	return "split_groups"
+}
+
+type SplitGroupMember struct {
+	ID      uint   `gorm:"primarykey" json:"-"`
+	GroupID uint   `gorm:"not null;uniqueIndex:idx_split_group_members_user" json:"-"`
+	UserID  uint   `gorm:"not null;uniqueIndex:idx_split_group_members_user;index" json:"-"`
+	Email   string `gorm:"not null" json:"email"`
+}
+
+func (SplitGroupMember) TableName() string {
+	return "split_group_members"
+}
+
+// SplitExpense is a bill one member paid for several participants. Each
+// participant owes the payer their share; the payer's own share is paid from
+// the start.
+type SplitExpense struct {
+	ID          uint            `gorm:"primarykey" json:"-"`
+	PublicID    string          `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	GroupID     uint            `gorm:"not null;index" json:"-"`
+	PayerID     uint            `gorm:"not null" json:"-"`
+	PayerEmail  string          `gorm:"not null" json:"paid_by"`
+	Description string          `gorm:"type:text" json:"description,omitempty"`
+	Total       money.Amount    `gorm:"not null" json:"total"`
+	Split       SplitType       `gorm:"type:varchar(20);not null" json:"split"`
+	Settlement  SplitSettlement `gorm:"type:varchar(20);not null" json:"settlement"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Shares      []SplitShare    `gorm:"foreignKey:ExpenseID" json:"shares"`
+}
+
+func (SplitExpense) TableName() string {
+	return "split_expenses"
+}
+
+// SplitShare is what one participant owes for an expense. With request
+// settlement MoneyRequestID links to the money request sent for it; once paid,
+// TransferID holds the transfer that settled it.
+type SplitShare struct {
+	ID             uint             `gorm:"primarykey" json:"-"`
+	ExpenseID      uint             `gorm:"not null;uniqueIndex:idx_split_shares_user" json:"-"`
+	UserID         uint             `gorm:"not null;uniqueIndex:idx_split_shares_user" json:"-"`
+	Email          string           `gorm:"not null" json:"email"`
+	Amount         money.Amount     `gorm:"not null" json:"amount"`
+	Status         SplitShareStatus `gorm:"type:varchar(20);not null" json:"status"`
+	MoneyRequestID *string          `gorm:"type:varchar(36)" json:"money_request_id,omitempty"`
+	TransferID     *string          `gorm:"type:varchar(36)" json:"transfer_id,omitempty"`
+	PaidAt         *time.Time       `json:"paid_at,omitempty"`
+}
+
+func (SplitShare) TableName() string {
+	return "split_shares"
+}
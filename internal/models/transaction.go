@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -16,7 +17,13 @@ const (
 type Transaction struct {
 	ID             uint            `gorm:"primarykey" json:"id"`
 	WalletID       uint            `gorm:"not null;index" json:"wallet_id"`
-	Amount         float64         `gorm:"not null" json:"amount"`
+	TransferID     *uint           `gorm:"index" json:"-"`
+	JournalEntryID *uint           `gorm:"index" json:"-"`
+	Amount         money.Amount    `gorm:"not null" json:"amount"`
+	Fee            money.Amount    `gorm:"not null;default:0" json:"fee,omitempty"`
+	ExchangeRate   *money.Rate     `json:"exchange_rate,omitempty"`
+	Spread         *money.Amount   `json:"spread,omitempty"`
+	BalanceAfter   *money.Amount   `json:"balance_after"`
 	Type           TransactionType `gorm:"not null;type:varchar(10)" json:"type"`
 	RelatedUserID  *uint           `gorm:"index" json:"related_user_id,omitempty"`
 	Notes          string          `gorm:"type:text" json:"notes,omitempty"`
@@ -26,6 +33,7 @@ type Transaction struct {
 	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"-"`
 	Wallet         *Wallet         `gorm:"foreignKey:WalletID" json:"wallet,omitempty"`
 	RelatedUser    *User           `gorm:"foreignKey:RelatedUserID" json:"related_user,omitempty"`
+	Transfer       *Transfer       `gorm:"foreignKey:TransferID" json:"transfer,omitempty"`
 }
 
 func (Transaction) TableName() string {
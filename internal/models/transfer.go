@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type TransferStatus string
+
+const (
+	TransferStatusCompleted         TransferStatus = "completed"
+	TransferStatusPartiallyRefunded TransferStatus = "partially_refunded"
+	TransferStatusRefunded          TransferStatus = "refunded"
+)
+
+type TransferKind string
+
+const (
+	TransferKindTransfer TransferKind = "transfer"
+	// TransferKindRefund returns money of a received transfer to its sender
+	TransferKindRefund TransferKind = "refund"
+	// TransferKindReversal is a refund made by an admin
+	TransferKindReversal TransferKind = "reversal"
+)
+
+// Transfer groups the debit and credit ledger legs of one movement of money
+// between two wallets. It is exposed to clients by its PublicID.
+//
+// Refunds and reversals are transfers in the opposite direction that point to
+// the original transfer by its PublicID; the original keeps the running total
+// in RefundedAmount, which can never exceed its Amount. Transfers made as part
+// of a batch carry the batch's PublicID. Fee is charged to the sender on top of
+// Amount and is not returned by refunds.
+//
+// A transfer that converts between currencies debits Amount in the sender's
+// currency and credits ConvertedAmount in the recipient's, at ExchangeRate
+// reduced by Spread; both legs record the rate and spread.
+type Transfer struct {
+	ID                 uint           `gorm:"primarykey" json:"-"`
+	PublicID           string         `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	Kind               TransferKind   `gorm:"type:varchar(20);not null;default:transfer" json:"kind"`
+	OriginalTransferID *string        `gorm:"type:varchar(36);index" json:"original_transfer_id,omitempty"`
+	BatchID            *string        `gorm:"type:varchar(36);index" json:"batch_id,omitempty"`
+	SenderWalletID     uint           `gorm:"not null;index" json:"sender_wallet_id"`
+	RecipientWalletID  uint           `gorm:"not null;index" json:"recipient_wallet_id"`
+	Amount             money.Amount   `gorm:"not null" json:"amount"`
+	RefundedAmount     money.Amount   `gorm:"not null;default:0" json:"refunded_amount"`
+	Fee                money.Amount   `gorm:"not null;default:0" json:"fee"`
+	ConvertedAmount    *money.Amount  `json:"converted_amount,omitempty"`
+	ExchangeRate       *money.Rate    `json:"exchange_rate,omitempty"`
+	Spread             *money.Amount  `json:"spread,omitempty"`
+	Notes              string         `gorm:"type:text" json:"notes,omitempty"`
+	Status             TransferStatus `gorm:"not null;type:varchar(20)" json:"status"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	SenderWallet       *Wallet        `gorm:"foreignKey:SenderWalletID" json:"-"`
+	RecipientWallet    *Wallet        `gorm:"foreignKey:RecipientWalletID" json:"-"`
+	Legs               []Transaction  `gorm:"foreignKey:TransferID" json:"legs,omitempty"`
+}
+
+func (Transfer) TableName() string {
+	return "transfers"
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+type TransferBatchMode string
+
+const (
+	// TransferBatchModeAtomic executes every item or none of them
+	TransferBatchModeAtomic TransferBatchMode = "all_or_nothing"
+	// TransferBatchModeBestEffort executes the valid items and reports the rest
+	TransferBatchModeBestEffort TransferBatchMode = "best_effort"
+)
+
+type TransferBatchStatus string
+
+const (
+	TransferBatchStatusCompleted          TransferBatchStatus = "completed"
+	TransferBatchStatusPartiallyCompleted TransferBatchStatus = "partially_completed"
+	TransferBatchStatusFailed             TransferBatchStatus = "failed"
+)
+
+type TransferBatchItemStatus string
+
+const (
+	TransferBatchItemStatusSucceeded TransferBatchItemStatus = "succeeded"
+	TransferBatchItemStatusFailed    TransferBatchItemStatus = "failed"
+)
+
+// TransferBatch is a set of transfers from one wallet executed in a single
+// database transaction. TotalAmount is the sum of the items that succeeded.
+type TransferBatch struct {
+	ID             uint                `gorm:"primarykey" json:"-"`
+	PublicID       string              `gorm:"type:varchar(36);uniqueIndex;not null" json:"id"`
+	SenderWalletID uint                `gorm:"not null;index" json:"sender_wallet_id"`
+	Mode           TransferBatchMode   `gorm:"type:varchar(20);not null" json:"mode"`
+	Status         TransferBatchStatus `gorm:"type:varchar(20);not null" json:"status"`
+	TotalAmount    money.Amount        `gorm:"not null" json:"total_amount"`
+	CreatedAt      time.Time           `json:"created_at"`
+	Items          []TransferBatchItem `gorm:"foreignKey:BatchID" json:"items"`
+}
+
+func (TransferBatch) TableName() string {
+	return "transfer_batches"
+}
+
+// TransferBatchItem is one line of a batch. Succeeded items link to their
+// transfer; failed ones say why in Error.
+type TransferBatchItem struct {
+	ID             uint                    `gorm:"primarykey" json:"-"`
+	BatchID        uint                    `gorm:"not null;uniqueIndex:idx_transfer_batch_items_position" json:"-"`
+	Position       int                     `gorm:"not null;uniqueIndex:idx_transfer_batch_items_position" json:"index"`
+	RecipientEmail string                  `gorm:"not null" json:"recipient"`
+	Amount         money.Amount            `gorm:"not null" json:"amount"`
+	Notes          string                  `gorm:"type:text" json:"notes,omitempty"`
+	Status         TransferBatchItemStatus `gorm:"type:varchar(20);not null" json:"status"`
+	Error          string                  `gorm:"type:text" json:"error,omitempty"`
+	TransferID     *string                 `gorm:"type:varchar(36)" json:"transfer_id,omitempty"`
+}
+
+func (TransferBatchItem) TableName() string {
+	return "transfer_batch_items"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+// TransferLimit overrides the default outgoing transfer limits of one user. A
+// nil field falls back to the default; zero means no limit.
+type TransferLimit struct {
+	ID             uint          `gorm:"primarykey" json:"-"`
+	UserID         uint          `gorm:"uniqueIndex;not null" json:"user_id"`
+	PerTransaction *money.Amount `json:"per_transaction"`
+	Daily          *money.Amount `json:"daily"`
+	Monthly        *money.Amount `json:"monthly"`
+	HourlyCount    *int          `json:"hourly_count"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+func (TransferLimit) TableName() string {
+	return "transfer_limits"
+}
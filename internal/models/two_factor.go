@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// TOTPCredential is a user's authenticator app secret. It is pending until the
+// user proves the app is set up by entering a code; only then does login ask
+// for one. LastCounter is the time step of the last accepted code, so a code
+// cannot be replayed. FailedAttempts counts wrong codes in a row, across login
+// challenges and settings changes, and LockedUntil is set once there are too
+// many.
+type TOTPCredential struct {
+	ID             uint       `gorm:"primarykey" json:"-"`
+	UserID         uint       `gorm:"not null;uniqueIndex" json:"-"`
+	Secret         string     `gorm:"not null;type:varchar(64)" json:"-"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+	LastCounter    int64      `gorm:"not null;default:0" json:"-"`
+	FailedAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil    *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (TOTPCredential) TableName() string {
+	return "totp_credentials"
+}
+
+// Confirmed reports whether two-factor authentication is enabled
+func (c *TOTPCredential) Confirmed() bool {
+	return c.ConfirmedAt != nil
+}
+
+// Locked reports whether codes are refused at now after too many wrong ones
+func (c *TOTPCredential) Locked(now time.Time) bool {
+	return c.LockedUntil != nil && now.Before(*c.LockedUntil)
+}
+
+// RecoveryCode lets a user who lost their authenticator log in once. Only a
+// SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;type:varchar(64);uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// LoginChallenge is the second step of a login with two-factor
+// authentication: the password was right, and the opaque challenge token
+// returned for it can be exchanged once, with a valid code, for a session.
+// Only a SHA-256 hash of the token is stored.
+type LoginChallenge struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;type:varchar(64);uniqueIndex"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (LoginChallenge) TableName() string {
+	return "login_challenges"
+}
@@ -1,19 +1,44 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"gorm.io/gorm"
 )
 
+// DefaultCurrency is the currency of a user's first wallet
+const DefaultCurrency = "USD"
+
+// Wallet holds a user's money in one currency. A user has at most one wallet
+// per currency; their oldest wallet is their primary one.
 type Wallet struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	UserID    uint           `gorm:"uniqueIndex;not null" json:"user_id"`
-	Balance   float64        `gorm:"not null;default:0" json:"balance"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	User      *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	ID     uint `gorm:"primarykey" json:"id"`
+	UserID uint `gorm:"not null;uniqueIndex:idx_wallets_user_currency" json:"user_id"`
+	// Currency is an ISO 4217 code, e.g. USD
+	Currency string       `gorm:"type:varchar(3);not null;default:USD;uniqueIndex:idx_wallets_user_currency" json:"currency"`
+	Balance  money.Amount `gorm:"not null;default:0" json:"balance"`
+	// HeldAmount is the sum of the wallet's authorized holds
+	HeldAmount money.Amount   `gorm:"not null;default:0" json:"held_amount"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	User       *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// AvailableBalance is what the wallet can spend: its balance minus its holds
+func (w Wallet) AvailableBalance() money.Amount {
+	return w.Balance - w.HeldAmount
+}
+
+// MarshalJSON adds available_balance to the wallet's fields
+func (w Wallet) MarshalJSON() ([]byte, error) {
+	type wallet Wallet
+	return json.Marshal(struct {
+		wallet
+		AvailableBalance money.Amount `json:"available_balance"`
+	}{wallet(w), w.AvailableBalance()})
 }
 
 func (Wallet) TableName() string {
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FXRepository interface {
+	ListRates() ([]models.ExchangeRate, error)
+	FindRate(tx *gorm.DB, from, to string) (*models.ExchangeRate, error)
+	SaveRate(tx *gorm.DB, rate *models.ExchangeRate) error
+	DeleteRate(from, to string) (bool, error)
+	CreateQuote(quote *models.FXQuote) error
+	FindQuoteByPublicID(publicID string) (*models.FXQuote, error)
+	FindQuoteByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.FXQuote, error)
+	MarkQuoteExecuted(tx *gorm.DB, id uint, transferID string) error
+}
+
+type fxRepository struct {
+	db *gorm.DB
+}
+
+func NewFXRepository(db *gorm.DB) FXRepository {
+	return &fxRepository{db: db}
+}
+
+func (r *fxRepository) ListRates() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.db.Order("from_currency ASC, to_currency ASC").Find(&rates).Error
+	return rates, err
+}
+
+func (r *fxRepository) FindRate(tx *gorm.DB, from, to string) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := tx.Where("from_currency = ? AND to_currency = ?", from, to).First(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// SaveRate creates or replaces the rate of a currency pair
+func (r *fxRepository) SaveRate(tx *gorm.DB, rate *models.ExchangeRate) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "from_currency"}, {Name: "to_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "spread", "updated_at"}),
+	}).Create(rate).Error
+}
+
+// DeleteRate removes the rate of a currency pair and reports whether it existed
+func (r *fxRepository) DeleteRate(from, to string) (bool, error) {
+	result := r.db.Where("from_currency = ? AND to_currency = ?", from, to).Delete(&models.ExchangeRate{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *fxRepository) CreateQuote(quote *models.FXQuote) error {
+	return r.db.Create(quote).Error
+}
+
+func (r *fxRepository) FindQuoteByPublicID(publicID string) (*models.FXQuote, error) {
+	var quote models.FXQuote
+	err := r.db.Where("public_id = ?", publicID).First(&quote).Error
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// FindQuoteByPublicIDForUpdate loads a quote and locks its row until tx ends
+func (r *fxRepository) FindQuoteByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.FXQuote, error) {
+	var quote models.FXQuote
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("public_id = ?", publicID).
+		First(&quote).Error
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// MarkQuoteExecuted links a quote to the transfer that used it
+func (r *fxRepository) MarkQuoteExecuted(tx *gorm.DB, id uint, transferID string) error {
+	return tx.Model(&models.FXQuote{}).
+		Where("id = ?", id).
+		Update("transfer_id", transferID).Error
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type HoldRepository interface {
+	Create(tx *gorm.DB, hold *models.Hold) error
+	Update(tx *gorm.DB, hold *models.Hold) error
+	FindByPublicID(publicID string) (*models.Hold, error)
+	FindByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.Hold, error)
+	FindExpired(now time.Time, limit int) ([]models.Hold, error)
+}
+
+type holdRepository struct {
+	db *gorm.DB
+}
+
+func NewHoldRepository(db *gorm.DB) HoldRepository {
+	return &holdRepository{db: db}
+}
+
+func (r *holdRepository) Create(tx *gorm.DB, hold *models.Hold) error {
+	return tx.Create(hold).Error
+}
+
+func (r *holdRepository) Update(tx *gorm.DB, hold *models.Hold) error {
+	return tx.Save(hold).Error
+}
+
+func (r *holdRepository) FindByPublicID(publicID string) (*models.Hold, error) {
+	var hold models.Hold
+	err := r.db.Where("public_id = ?", publicID).First(&hold).Error
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// FindByPublicIDForUpdate loads a hold and locks its row until tx ends
+func (r *holdRepository) FindByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.Hold, error) {
+	var hold models.Hold
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("public_id = ?", publicID).
+		First(&hold).Error
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// FindExpired returns authorized holds whose expiry has passed, oldest first
+func (r *holdRepository) FindExpired(now time.Time, limit int) ([]models.Hold, error) {
+	var holds []models.Hold
+	err := r.db.Where("status = ? AND expires_at <= ?", models.HoldStatusAuthorized, now).
+		Order("expires_at ASC, id ASC").
+		Limit(limit).
+		Find(&holds).Error
+	return holds, err
+}
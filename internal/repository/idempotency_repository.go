@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepository interface {
+	Reserve(record *models.IdempotencyRecord) (bool, error)
+	FindByUserAndKey(userID uint, key string) (*models.IdempotencyRecord, error)
+	Complete(tx *gorm.DB, id uint, response string, expiresAt time.Time) (bool, error)
+	Delete(id uint) error
+	DeleteExpiredByID(id uint, now time.Time) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve inserts the record unless one already exists for the same user and
+// key. It reports whether the record was inserted, without relying on a
+// unique-violation error.
+func (r *idempotencyRepository) Reserve(record *models.IdempotencyRecord) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *idempotencyRepository) FindByUserAndKey(userID uint, key string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	err := r.db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Complete stores the response of a record that is still processing and
+// reports whether it was there to complete
+func (r *idempotencyRepository) Complete(tx *gorm.DB, id uint, response string, expiresAt time.Time) (bool, error) {
+	result := tx.Model(&models.IdempotencyRecord{}).
+		Where("id = ? AND status = ?", id, models.IdempotencyStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":     models.IdempotencyStatusCompleted,
+			"response":   response,
+			"expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *idempotencyRepository) Delete(id uint) error {
+	return r.db.Delete(&models.IdempotencyRecord{}, id).Error
+}
+
+func (r *idempotencyRepository) DeleteExpiredByID(id uint, now time.Time) error {
+	return r.db.Where("id = ? AND expires_at <= ?", id, now).
+		Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (r *idempotencyRepository) DeleteExpired(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&models.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
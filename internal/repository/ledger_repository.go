@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WalletProjectionDrift is a wallet whose cached balance differs from the sum
+// of its ledger postings
+type WalletProjectionDrift struct {
+	WalletID      uint
+	Balance       money.Amount
+	LedgerBalance money.Amount
+}
+
+type LedgerRepository interface {
+	CreateAccount(tx *gorm.DB, account *models.LedgerAccount) error
+	EnsureSystemAccount(tx *gorm.DB, code string) error
+	FindAccountByCode(tx *gorm.DB, code string) (*models.LedgerAccount, error)
+	FindAccountByWalletID(tx *gorm.DB, walletID uint) (*models.LedgerAccount, error)
+	CreateEntry(tx *gorm.DB, entry *models.JournalEntry) error
+	SumAllPostings() (money.Amount, error)
+	SumPostingsByAccount(tx *gorm.DB, accountID uint) (money.Amount, error)
+	SumPostingsByAccountAt(accountID uint, at time.Time) (money.Amount, error)
+	FindUnbalancedEntryIDs() ([]uint, error)
+	FindWalletProjectionDrift() ([]WalletProjectionDrift, error)
+}
+
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+func (r *ledgerRepository) CreateAccount(tx *gorm.DB, account *models.LedgerAccount) error {
+	return tx.Create(account).Error
+}
+
+// EnsureSystemAccount creates the system account unless it already exists
+func (r *ledgerRepository) EnsureSystemAccount(tx *gorm.DB, code string) error {
+	account := models.LedgerAccount{Code: code, Kind: models.AccountKindSystem}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error
+}
+
+func (r *ledgerRepository) FindAccountByCode(tx *gorm.DB, code string) (*models.LedgerAccount, error) {
+	var account models.LedgerAccount
+	err := tx.Where("code = ?", code).First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) FindAccountByWalletID(tx *gorm.DB, walletID uint) (*models.LedgerAccount, error) {
+	var account models.LedgerAccount
+	err := tx.Where("wallet_id = ?", walletID).First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateEntry inserts the journal entry together with its postings
+func (r *ledgerRepository) CreateEntry(tx *gorm.DB, entry *models.JournalEntry) error {
+	return tx.Create(entry).Error
+}
+
+func (r *ledgerRepository) SumAllPostings() (money.Amount, error) {
+	var sum money.Amount
+	err := r.db.Model(&models.Posting{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&sum).Error
+	return sum, err
+}
+
+func (r *ledgerRepository) SumPostingsByAccount(tx *gorm.DB, accountID uint) (money.Amount, error) {
+	var sum money.Amount
+	err := tx.Model(&models.Posting{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ?", accountID).
+		Scan(&sum).Error
+	return sum, err
+}
+
+// SumPostingsByAccountAt returns the balance of an account at the given time,
+// counting postings made at or before it
+func (r *ledgerRepository) SumPostingsByAccountAt(accountID uint, at time.Time) (money.Amount, error) {
+	var sum money.Amount
+	err := r.db.Model(&models.Posting{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND created_at <= ?", accountID, at).
+		Scan(&sum).Error
+	return sum, err
+}
+
+func (r *ledgerRepository) FindUnbalancedEntryIDs() ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.Posting{}).
+		Select("journal_entry_id").
+		Group("journal_entry_id").
+		Having("SUM(amount) <> 0").
+		Scan(&ids).Error
+	return ids, err
+}
+
+func (r *ledgerRepository) FindWalletProjectionDrift() ([]WalletProjectionDrift, error) {
+	var drift []WalletProjectionDrift
+	err := r.db.Table("wallets").
+		Select("wallets.id AS wallet_id, wallets.balance AS balance, COALESCE(SUM(postings.amount), 0) AS ledger_balance").
+		Joins("JOIN ledger_accounts ON ledger_accounts.wallet_id = wallets.id").
+		Joins("LEFT JOIN postings ON postings.account_id = ledger_accounts.id").
+		Where("wallets.deleted_at IS NULL").
+		Group("wallets.id, wallets.balance").
+		Having("wallets.balance <> COALESCE(SUM(postings.amount), 0)").
+		Scan(&drift).Error
+	return drift, err
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LimitRepository interface {
+	FindByUserID(tx *gorm.DB, userID uint) (*models.TransferLimit, error)
+	Save(limit *models.TransferLimit) error
+	OutgoingSince(tx *gorm.DB, userID uint, since time.Time) ([]OutgoingTotal, error)
+}
+
+// OutgoingTotal is what a user committed to pay from their wallet in one
+// currency, in that currency
+type OutgoingTotal struct {
+	Currency string
+	Total    money.Amount
+	Count    int64
+}
+
+type limitRepository struct {
+	db *gorm.DB
+}
+
+func NewLimitRepository(db *gorm.DB) LimitRepository {
+	return &limitRepository{db: db}
+}
+
+// FindByUserID returns the user's own limits, or nil if they have none. Most
+// users have none, so it does not treat that as an error.
+func (r *limitRepository) FindByUserID(tx *gorm.DB, userID uint) (*models.TransferLimit, error) {
+	var limit models.TransferLimit
+	result := tx.Where("user_id = ?", userID).Limit(1).Find(&limit)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &limit, nil
+}
+
+// Save creates or replaces the user's limits
+func (r *limitRepository) Save(limit *models.TransferLimit) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"per_transaction", "daily", "monthly", "hourly_count", "updated_at"}),
+	}).Create(limit).Error
+}
+
+// OutgoingSince sums and counts, per currency, what a user committed to pay
+// from any of their wallets since the given time: the transfers they sent plus
+// their holds that are still authorized. Transfers and holds in the same
+// currency come as separate totals. Refunds, reversals and conversions between
+// the user's own wallets are not counted.
+func (r *limitRepository) OutgoingSince(tx *gorm.DB, userID uint, since time.Time) ([]OutgoingTotal, error) {
+	var transfers, holds []OutgoingTotal
+
+	err := tx.Model(&models.Transfer{}).
+		Select("wallets.currency AS currency, COALESCE(SUM(transfers.amount), 0) AS total, COUNT(*) AS count").
+		Joins("JOIN wallets ON wallets.id = transfers.sender_wallet_id").
+		Joins("JOIN wallets AS recipient_wallets ON recipient_wallets.id = transfers.recipient_wallet_id").
+		Where("wallets.user_id = ? AND recipient_wallets.user_id <> ? AND transfers.kind = ? AND transfers.created_at >= ?", userID, userID, models.TransferKindTransfer, since).
+		Group("wallets.currency").
+		Scan(&transfers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Model(&models.Hold{}).
+		Select("wallets.currency AS currency, COALESCE(SUM(holds.amount), 0) AS total, COUNT(*) AS count").
+		Joins("JOIN wallets ON wallets.id = holds.wallet_id").
+		Where("wallets.user_id = ? AND holds.status = ? AND holds.created_at >= ?", userID, models.HoldStatusAuthorized, since).
+		Group("wallets.currency").
+		Scan(&holds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return append(transfers, holds...), nil
+}
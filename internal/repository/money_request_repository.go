@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+)
+
+type MoneyRequestRepository interface {
+	Create(tx *gorm.DB, request *models.MoneyRequest) error
+	FindByPublicID(publicID string) (*models.MoneyRequest, error)
+	FindByPayeeID(payeeID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error)
+	FindByRequesterID(requesterID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error)
+	UpdateStatus(id uint, from []models.MoneyRequestStatus, to models.MoneyRequestStatus, updates map[string]interface{}) (bool, error)
+	ExpirePending(now time.Time) (int64, error)
+}
+
+type moneyRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewMoneyRequestRepository(db *gorm.DB) MoneyRequestRepository {
+	return &moneyRequestRepository{db: db}
+}
+
+func (r *moneyRequestRepository) Create(tx *gorm.DB, request *models.MoneyRequest) error {
+	return tx.Create(request).Error
+}
+
+func (r *moneyRequestRepository) FindByPublicID(publicID string) (*models.MoneyRequest, error) {
+	var request models.MoneyRequest
+	err := r.db.Where("public_id = ?", publicID).First(&request).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// FindByPayeeID lists requests addressed to a user, newest first; an empty
+// status matches every status
+func (r *moneyRequestRepository) FindByPayeeID(payeeID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error) {
+	return r.find(r.db.Where("payee_id = ?", payeeID), status)
+}
+
+// FindByRequesterID lists requests a user sent, newest first; an empty status
+// matches every status
+func (r *moneyRequestRepository) FindByRequesterID(requesterID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error) {
+	return r.find(r.db.Where("requester_id = ?", requesterID), status)
+}
+
+func (r *moneyRequestRepository) find(query *gorm.DB, status models.MoneyRequestStatus) ([]models.MoneyRequest, error) {
+	var requests []models.MoneyRequest
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC, id DESC").Find(&requests).Error
+	return requests, err
+}
+
+// UpdateStatus moves a request to status to, with any extra column updates,
+// only if its current status is one of from. It reports whether the row was
+// updated.
+func (r *moneyRequestRepository) UpdateStatus(id uint, from []models.MoneyRequestStatus, to models.MoneyRequestStatus, updates map[string]interface{}) (bool, error) {
+	values := map[string]interface{}{"status": to}
+	for column, value := range updates {
+		values[column] = value
+	}
+
+	result := r.db.Model(&models.MoneyRequest{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(values)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ExpirePending marks every pending request whose expiry is at or before now
+// as expired and returns how many were
+func (r *moneyRequestRepository) ExpirePending(now time.Time) (int64, error) {
+	result := r.db.Model(&models.MoneyRequest{}).
+		Where("status = ? AND expires_at <= ?", models.MoneyRequestStatusPending, now).
+		Update("status", models.MoneyRequestStatusExpired)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+// StatementTotals are the sums of a wallet's transactions by type
+type StatementTotals struct {
+	Credits money.Amount
+	Debits  money.Amount
+}
+
+// DuplicateIdempotencyKey is an idempotency key shared by several transactions
+type DuplicateIdempotencyKey struct {
+	IdempotencyKey string `json:"idempotency_key"`
+	Count          int64  `json:"count"`
+}
+
+type ReconciliationRepository interface {
+	FindWalletsAfter(afterID uint, limit int) ([]models.Wallet, error)
+	SumStatement(tx *gorm.DB, walletID uint) (StatementTotals, error)
+	SumOpeningBalance(tx *gorm.DB, walletID uint) (money.Amount, error)
+	FindIncompleteTransferLegs() ([]models.Transaction, error)
+	FindUnlinkedTransactions() ([]models.Transaction, error)
+	FindDuplicateIdempotencyKeys() ([]DuplicateIdempotencyKey, error)
+	FindTransactionsOfDeletedWallets() ([]models.Transaction, error)
+	SetBalance(tx *gorm.DB, walletID uint, balance money.Amount) error
+}
+
+type reconciliationRepository struct {
+	db *gorm.DB
+}
+
+func NewReconciliationRepository(db *gorm.DB) ReconciliationRepository {
+	return &reconciliationRepository{db: db}
+}
+
+func (r *reconciliationRepository) FindWalletsAfter(afterID uint, limit int) ([]models.Wallet, error) {
+	var wallets []models.Wallet
+	err := r.db.Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&wallets).Error
+	return wallets, err
+}
+
+func (r *reconciliationRepository) SumStatement(tx *gorm.DB, walletID uint) (StatementTotals, error) {
+	var totals StatementTotals
+	err := tx.Model(&models.Transaction{}).
+		Select(
+			"COALESCE(SUM(CASE WHEN type = ? THEN amount ELSE 0 END), 0) AS credits, "+
+				"COALESCE(SUM(CASE WHEN type = ? THEN amount ELSE 0 END), 0) AS debits",
+			models.TransactionTypeCredit, models.TransactionTypeDebit,
+		).
+		Where("wallet_id = ?", walletID).
+		Scan(&totals).Error
+	return totals, err
+}
+
+// SumOpeningBalance returns what the wallet held before its first recorded
+// transaction, as posted by opening balance journal entries
+func (r *reconciliationRepository) SumOpeningBalance(tx *gorm.DB, walletID uint) (money.Amount, error) {
+	var sum money.Amount
+	err := tx.Model(&models.Posting{}).
+		Select("COALESCE(SUM(postings.amount), 0)").
+		Joins("JOIN journal_entries ON journal_entries.id = postings.journal_entry_id").
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+		Where("ledger_accounts.wallet_id = ? AND journal_entries.kind = ?", walletID, models.JournalEntryKindOpeningBalance).
+		Scan(&sum).Error
+	return sum, err
+}
+
+// FindIncompleteTransferLegs returns the legs of transfers that do not have
+// exactly one debit and one credit leg
+func (r *reconciliationRepository) FindIncompleteTransferLegs() ([]models.Transaction, error) {
+	incomplete := r.db.Model(&models.Transaction{}).
+		Select("transfer_id").
+		Where("transfer_id IS NOT NULL").
+		Group("transfer_id").
+		Having(
+			"SUM(CASE WHEN type = ? THEN 1 ELSE 0 END) <> 1 OR SUM(CASE WHEN type = ? THEN 1 ELSE 0 END) <> 1",
+			models.TransactionTypeDebit, models.TransactionTypeCredit,
+		)
+
+	var legs []models.Transaction
+	err := r.db.Where("transfer_id IN (?)", incomplete).Order("id ASC").Find(&legs).Error
+	return legs, err
+}
+
+// FindUnlinkedTransactions returns transactions that belong neither to a
+// transfer nor to a journal entry
+func (r *reconciliationRepository) FindUnlinkedTransactions() ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := r.db.Where("transfer_id IS NULL AND journal_entry_id IS NULL").
+		Order("id ASC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
+func (r *reconciliationRepository) FindDuplicateIdempotencyKeys() ([]DuplicateIdempotencyKey, error) {
+	var duplicates []DuplicateIdempotencyKey
+	err := r.db.Unscoped().Model(&models.Transaction{}).
+		Select("idempotency_key, COUNT(*) AS count").
+		Where("idempotency_key <> ''").
+		Group("idempotency_key").
+		Having("COUNT(*) > 1").
+		Scan(&duplicates).Error
+	return duplicates, err
+}
+
+// FindTransactionsOfDeletedWallets returns live transactions whose wallet is
+// soft-deleted or missing
+func (r *reconciliationRepository) FindTransactionsOfDeletedWallets() ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := r.db.Joins("LEFT JOIN wallets ON wallets.id = transactions.wallet_id").
+		Where("wallets.id IS NULL OR wallets.deleted_at IS NOT NULL").
+		Order("transactions.id ASC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
+func (r *reconciliationRepository) SetBalance(tx *gorm.DB, walletID uint, balance money.Amount) error {
+	return tx.Model(&models.Wallet{}).
+		Where("id = ?", walletID).
+		Update("balance", balance).Error
+}
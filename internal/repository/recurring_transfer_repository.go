@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RecurringTransferRepository interface {
+	Create(tx *gorm.DB, recurring *models.RecurringTransfer) error
+	Update(tx *gorm.DB, recurring *models.RecurringTransfer) error
+	FindByPublicID(publicID string) (*models.RecurringTransfer, error)
+	FindByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.RecurringTransfer, error)
+	FindByUserID(userID uint) ([]models.RecurringTransfer, error)
+	FindDue(now time.Time, limit int) ([]models.RecurringTransfer, error)
+}
+
+type recurringTransferRepository struct {
+	db *gorm.DB
+}
+
+func NewRecurringTransferRepository(db *gorm.DB) RecurringTransferRepository {
+	return &recurringTransferRepository{db: db}
+}
+
+func (r *recurringTransferRepository) Create(tx *gorm.DB, recurring *models.RecurringTransfer) error {
+	return tx.Create(recurring).Error
+}
+
+func (r *recurringTransferRepository) Update(tx *gorm.DB, recurring *models.RecurringTransfer) error {
+	return tx.Save(recurring).Error
+}
+
+func (r *recurringTransferRepository) FindByPublicID(publicID string) (*models.RecurringTransfer, error) {
+	var recurring models.RecurringTransfer
+	err := r.db.Where("public_id = ?", publicID).First(&recurring).Error
+	if err != nil {
+		return nil, err
+	}
+	return &recurring, nil
+}
+
+// FindByPublicIDForUpdate loads a recurring transfer and locks its row until
+// tx ends
+func (r *recurringTransferRepository) FindByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.RecurringTransfer, error) {
+	var recurring models.RecurringTransfer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("public_id = ?", publicID).
+		First(&recurring).Error
+	if err != nil {
+		return nil, err
+	}
+	return &recurring, nil
+}
+
+func (r *recurringTransferRepository) FindByUserID(userID uint) ([]models.RecurringTransfer, error) {
+	var recurring []models.RecurringTransfer
+	err := r.db.Where("user_id = ?", userID).
+		Order("created_at ASC, id ASC").
+		Find(&recurring).Error
+	return recurring, err
+}
+
+// FindDue returns active recurring transfers with an occurrence due by now
+func (r *recurringTransferRepository) FindDue(now time.Time, limit int) ([]models.RecurringTransfer, error) {
+	var recurring []models.RecurringTransfer
+	err := r.db.Where("status = ? AND next_run_at <= ?", models.RecurringTransferStatusActive, now).
+		Order("next_run_at ASC, id ASC").
+		Limit(limit).
+		Find(&recurring).Error
+	return recurring, err
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefreshTokenRepository interface {
+	Create(tx *gorm.DB, token *models.RefreshToken) error
+	FindByHashForUpdate(tx *gorm.DB, hash string) (*models.RefreshToken, error)
+	MarkUsed(tx *gorm.DB, id uint, at time.Time) error
+	RevokeFamily(tx *gorm.DB, familyID string, at time.Time) error
+}
+
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) Create(tx *gorm.DB, token *models.RefreshToken) error {
+	return tx.Create(token).Error
+}
+
+// FindByHashForUpdate loads a refresh token and locks its row until tx ends
+func (r *refreshTokenRepository) FindByHashForUpdate(tx *gorm.DB, hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", hash).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *refreshTokenRepository) MarkUsed(tx *gorm.DB, id uint, at time.Time) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("id = ?", id).
+		Update("used_at", at).Error
+}
+
+// RevokeFamily revokes every token of the family that is not revoked yet
+func (r *refreshTokenRepository) RevokeFamily(tx *gorm.DB, familyID string, at time.Time) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+)
+
+type ScheduledTransferRepository interface {
+	Create(tx *gorm.DB, scheduled *models.ScheduledTransfer) error
+	FindByPublicID(publicID string) (*models.ScheduledTransfer, error)
+	FindByUserID(userID uint, status models.ScheduledTransferStatus) ([]models.ScheduledTransfer, error)
+	FindByRecurringTransferID(recurringID string) ([]models.ScheduledTransfer, error)
+	FindDue(now time.Time, limit int) ([]models.ScheduledTransfer, error)
+	UpdateStatus(id uint, from []models.ScheduledTransferStatus, to models.ScheduledTransferStatus, updates map[string]interface{}) (bool, error)
+}
+
+type scheduledTransferRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledTransferRepository(db *gorm.DB) ScheduledTransferRepository {
+	return &scheduledTransferRepository{db: db}
+}
+
+func (r *scheduledTransferRepository) Create(tx *gorm.DB, scheduled *models.ScheduledTransfer) error {
+	return tx.Create(scheduled).Error
+}
+
+func (r *scheduledTransferRepository) FindByPublicID(publicID string) (*models.ScheduledTransfer, error) {
+	var scheduled models.ScheduledTransfer
+	err := r.db.Where("public_id = ?", publicID).First(&scheduled).Error
+	if err != nil {
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+// FindByUserID lists a user's scheduled transfers by execution time; an empty
+// status matches every status
+func (r *scheduledTransferRepository) FindByUserID(userID uint, status models.ScheduledTransferStatus) ([]models.ScheduledTransfer, error) {
+	var scheduled []models.ScheduledTransfer
+	query := r.db.Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("execute_at ASC, id ASC").Find(&scheduled).Error
+	return scheduled, err
+}
+
+// FindByRecurringTransferID lists the occurrences of a recurring transfer,
+// newest first
+func (r *scheduledTransferRepository) FindByRecurringTransferID(recurringID string) ([]models.ScheduledTransfer, error) {
+	var scheduled []models.ScheduledTransfer
+	err := r.db.Where("recurring_transfer_id = ?", recurringID).
+		Order("occurrence DESC").
+		Find(&scheduled).Error
+	return scheduled, err
+}
+
+// FindDue returns scheduled transfers that should run by now, including ones
+// left processing by an executor that stopped halfway
+func (r *scheduledTransferRepository) FindDue(now time.Time, limit int) ([]models.ScheduledTransfer, error) {
+	var scheduled []models.ScheduledTransfer
+	err := r.db.Where("status IN ? AND execute_at <= ?",
+		[]models.ScheduledTransferStatus{models.ScheduledTransferStatusPending, models.ScheduledTransferStatusProcessing}, now).
+		Order("execute_at ASC, id ASC").
+		Limit(limit).
+		Find(&scheduled).Error
+	return scheduled, err
+}
+
+// UpdateStatus moves a scheduled transfer to status to, with any extra column
+// updates, only if its current status is one of from. It reports whether the
+// row was updated.
+func (r *scheduledTransferRepository) UpdateStatus(id uint, from []models.ScheduledTransferStatus, to models.ScheduledTransferStatus, updates map[string]interface{}) (bool, error) {
+	values := map[string]interface{}{"status": to}
+	for column, value := range updates {
+		values[column] = value
+	}
+
+	result := r.db.Model(&models.ScheduledTransfer{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(values)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SplitRepository interface {
+	CreateGroup(tx *gorm.DB, group *models.SplitGroup) error
+	FindGroupByPublicID(publicID string) (*models.SplitGroup, error)
+	FindGroupsByUserID(userID uint) ([]models.SplitGroup, error)
+	CreateExpense(tx *gorm.DB, expense *models.SplitExpense) error
+	FindExpenseByPublicID(publicID string) (*models.SplitExpense, error)
+	FindExpensesByGroupID(groupID uint) ([]models.SplitExpense, error)
+	SetShareMoneyRequest(tx *gorm.DB, shareID uint, requestID string) error
+	FindShareForUpdate(tx *gorm.DB, shareID uint) (*models.SplitShare, error)
+	MarkSharePaid(tx *gorm.DB, shareID uint, transferID string, paidAt time.Time) error
+}
+
+type splitRepository struct {
+	db *gorm.DB
+}
+
+func NewSplitRepository(db *gorm.DB) SplitRepository {
+	return &splitRepository{db: db}
+}
+
+// CreateGroup stores a group together with its members
+func (r *splitRepository) CreateGroup(tx *gorm.DB, group *models.SplitGroup) error {
+	return tx.Create(group).Error
+}
+
+func (r *splitRepository) FindGroupByPublicID(publicID string) (*models.SplitGroup, error) {
+	var group models.SplitGroup
+	err := r.db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("public_id = ?", publicID).First(&group).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// FindGroupsByUserID lists the groups a user is a member of
+func (r *splitRepository) FindGroupsByUserID(userID uint) ([]models.SplitGroup, error) {
+	var groups []models.SplitGroup
+	err := r.db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).
+		Where("id IN (?)", r.db.Model(&models.SplitGroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Order("created_at ASC, id ASC").
+		Find(&groups).Error
+	return groups, err
+}
+
+// CreateExpense stores an expense together with its shares
+func (r *splitRepository) CreateExpense(tx *gorm.DB, expense *models.SplitExpense) error {
+	return tx.Create(expense).Error
+}
+
+func (r *splitRepository) FindExpenseByPublicID(publicID string) (*models.SplitExpense, error) {
+	var expense models.SplitExpense
+	err := r.db.Preload("Shares", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("public_id = ?", publicID).First(&expense).Error
+	if err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+func (r *splitRepository) FindExpensesByGroupID(groupID uint) ([]models.SplitExpense, error) {
+	var expenses []models.SplitExpense
+	err := r.db.Preload("Shares", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).
+		Where("group_id = ?", groupID).
+		Order("created_at ASC, id ASC").
+		Find(&expenses).Error
+	return expenses, err
+}
+
+func (r *splitRepository) SetShareMoneyRequest(tx *gorm.DB, shareID uint, requestID string) error {
+	return tx.Model(&models.SplitShare{}).
+		Where("id = ?", shareID).
+		Update("money_request_id", requestID).Error
+}
+
+// FindShareForUpdate loads a share and locks its row until tx ends
+func (r *splitRepository) FindShareForUpdate(tx *gorm.DB, shareID uint) (*models.SplitShare, error) {
+	var share models.SplitShare
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&share, shareID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// MarkSharePaid records the transfer that settled a pending share
+func (r *splitRepository) MarkSharePaid(tx *gorm.DB, shareID uint, transferID string, paidAt time.Time) error {
+	return tx.Model(&models.SplitShare{}).
+		Where("id = ? AND status = ?", shareID, models.SplitShareStatusPending).
+		Updates(map[string]interface{}{
+			"status":      models.SplitShareStatusPaid,
+			"transfer_id": transferID,
+			"paid_at":     paidAt,
+		}).Error
+}
@@ -1,13 +1,35 @@
 package repository
 
 import (
+	"strings"
+	"time"
+
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"gorm.io/gorm"
 )
 
+// TransactionFilter narrows a wallet's history; zero values match everything
+type TransactionFilter struct {
+	Type          models.TransactionType
+	From          *time.Time // inclusive
+	To            *time.Time // exclusive
+	MinAmount     *money.Amount
+	MaxAmount     *money.Amount
+	RelatedUserID *uint
+	Notes         string // case-insensitive substring
+}
+
+// TransactionCursor is the position of the last transaction of a page
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
 type TransactionRepository interface {
 	Create(tx *gorm.DB, transaction *models.Transaction) error
 	FindByWalletID(walletID uint, limit int) ([]models.Transaction, error)
+	FindPage(walletID uint, filter TransactionFilter, after *TransactionCursor, limit int) ([]models.Transaction, error)
 	FindByIdempotencyKey(idempotencyKey string) (*models.Transaction, error)
 }
 
@@ -26,7 +48,7 @@ func (r *transactionRepository) Create(tx *gorm.DB, transaction *models.Transact
 func (r *transactionRepository) FindByWalletID(walletID uint, limit int) ([]models.Transaction, error) {
 	var transactions []models.Transaction
 	query := r.db.Where("wallet_id = ?", walletID).
-		Order("created_at DESC")
+		Order("created_at DESC, id DESC")
 	
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -36,6 +58,44 @@ func (r *transactionRepository) FindByWalletID(walletID uint, limit int) ([]mode
 	return transactions, err
 }
 
+// FindPage returns up to limit transactions of a wallet matching filter, newest
+// first, starting after the given cursor. Ordering on (created_at, id) keeps
+// pages stable when several transactions share a timestamp.
+func (r *transactionRepository) FindPage(walletID uint, filter TransactionFilter, after *TransactionCursor, limit int) ([]models.Transaction, error) {
+	query := r.db.Where("wallet_id = ?", walletID)
+
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.RelatedUserID != nil {
+		query = query.Where("related_user_id = ?", *filter.RelatedUserID)
+	}
+	if filter.Notes != "" {
+		query = query.Where(`LOWER(notes) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.Notes))+"%")
+	}
+	if after != nil {
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	var transactions []models.Transaction
+	err := query.Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&transactions).Error
+	return transactions, err
+}
+
 func (r *transactionRepository) FindByIdempotencyKey(idempotencyKey string) (*models.Transaction, error) {
 	var transaction models.Transaction
 	err := r.db.Where("idempotency_key = ?", idempotencyKey).First(&transaction).Error
@@ -44,3 +104,8 @@ func (r *transactionRepository) FindByIdempotencyKey(idempotencyKey string) (*mo
 	}
 	return &transaction, nil
 }
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TransferRepository interface {
+	Create(tx *gorm.DB, transfer *models.Transfer) error
+	FindByPublicID(publicID string) (*models.Transfer, error)
+	FindByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.Transfer, error)
+	UpdateRefund(tx *gorm.DB, id uint, refundedAmount money.Amount, status models.TransferStatus) error
+	CountSent(tx *gorm.DB, userID uint, since time.Time) (int64, error)
+	CreateBatch(tx *gorm.DB, batch *models.TransferBatch) error
+	FindBatchByPublicID(publicID string) (*models.TransferBatch, error)
+}
+
+type transferRepository struct {
+	db *gorm.DB
+}
+
+func NewTransferRepository(db *gorm.DB) TransferRepository {
+	return &transferRepository{db: db}
+}
+
+func (r *transferRepository) Create(tx *gorm.DB, transfer *models.Transfer) error {
+	return tx.Create(transfer).Error
+}
+
+func (r *transferRepository) FindByPublicID(publicID string) (*models.Transfer, error) {
+	var transfer models.Transfer
+	err := r.db.Preload("Legs", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("public_id = ?", publicID).First(&transfer).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// FindByPublicIDForUpdate loads a transfer and locks its row until tx ends
+func (r *transferRepository) FindByPublicIDForUpdate(tx *gorm.DB, publicID string) (*models.Transfer, error) {
+	var transfer models.Transfer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("public_id = ?", publicID).
+		First(&transfer).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (r *transferRepository) UpdateRefund(tx *gorm.DB, id uint, refundedAmount money.Amount, status models.TransferStatus) error {
+	return tx.Model(&models.Transfer{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"refunded_amount": refundedAmount,
+			"status":          status,
+		}).Error
+}
+
+// CountSent counts the transfers a user sent from any of their wallets since
+// the given time, leaving out refunds, reversals and conversions between the
+// user's own wallets
+func (r *transferRepository) CountSent(tx *gorm.DB, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := tx.Model(&models.Transfer{}).
+		Joins("JOIN wallets ON wallets.id = transfers.sender_wallet_id").
+		Joins("JOIN wallets AS recipient_wallets ON recipient_wallets.id = transfers.recipient_wallet_id").
+		Where("wallets.user_id = ? AND recipient_wallets.user_id <> ? AND transfers.kind = ? AND transfers.created_at >= ?", userID, userID, models.TransferKindTransfer, since).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateBatch stores a batch together with its items
+func (r *transferRepository) CreateBatch(tx *gorm.DB, batch *models.TransferBatch) error {
+	return tx.Create(batch).Error
+}
+
+func (r *transferRepository) FindBatchByPublicID(publicID string) (*models.TransferBatch, error) {
+	var batch models.TransferBatch
+	err := r.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("public_id = ?", publicID).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TwoFactorRepository interface {
+	FindCredential(userID uint) (*models.TOTPCredential, error)
+	FindCredentialForUpdate(tx *gorm.DB, userID uint) (*models.TOTPCredential, error)
+	SaveCredential(tx *gorm.DB, credential *models.TOTPCredential) error
+	DeleteCredential(tx *gorm.DB, userID uint) error
+	CreateRecoveryCodes(tx *gorm.DB, codes []models.RecoveryCode) error
+	UseRecoveryCode(tx *gorm.DB, userID uint, hash string, at time.Time) (bool, error)
+	CountUnusedRecoveryCodes(userID uint) (int64, error)
+	DeleteRecoveryCodes(tx *gorm.DB, userID uint) error
+	CreateChallenge(challenge *models.LoginChallenge) error
+	FindChallengeByHashForUpdate(tx *gorm.DB, hash string) (*models.LoginChallenge, error)
+	SaveChallenge(tx *gorm.DB, challenge *models.LoginChallenge) error
+	DeleteExpiredChallenges(now time.Time) (int64, error)
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) FindCredential(userID uint) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	err := r.db.Where("user_id = ?", userID).First(&credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// FindCredentialForUpdate loads the user's credential and locks its row until
+// tx ends
+func (r *twoFactorRepository) FindCredentialForUpdate(tx *gorm.DB, userID uint) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *twoFactorRepository) SaveCredential(tx *gorm.DB, credential *models.TOTPCredential) error {
+	return tx.Save(credential).Error
+}
+
+func (r *twoFactorRepository) DeleteCredential(tx *gorm.DB, userID uint) error {
+	return tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error
+}
+
+func (r *twoFactorRepository) CreateRecoveryCodes(tx *gorm.DB, codes []models.RecoveryCode) error {
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode marks the user's recovery code used and reports whether it
+// was there to use
+func (r *twoFactorRepository) UseRecoveryCode(tx *gorm.DB, userID uint, hash string, at time.Time) (bool, error) {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *twoFactorRepository) CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *twoFactorRepository) DeleteRecoveryCodes(tx *gorm.DB, userID uint) error {
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+func (r *twoFactorRepository) CreateChallenge(challenge *models.LoginChallenge) error {
+	return r.db.Create(challenge).Error
+}
+
+// FindChallengeByHashForUpdate loads a login challenge and locks its row until
+// tx ends
+func (r *twoFactorRepository) FindChallengeByHashForUpdate(tx *gorm.DB, hash string) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", hash).
+		First(&challenge).Error
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *twoFactorRepository) SaveChallenge(tx *gorm.DB, challenge *models.LoginChallenge) error {
+	return tx.Save(challenge).Error
+}
+
+// DeleteExpiredChallenges deletes the login challenges that expired at or
+// before now, used or not, and returns how many were deleted
+func (r *twoFactorRepository) DeleteExpiredChallenges(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&models.LoginChallenge{})
+	return result.RowsAffected, result.Error
+}
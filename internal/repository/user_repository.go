@@ -3,12 +3,14 @@ package repository
 import (
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
-	Create(user *models.User) error
+	Create(tx *gorm.DB, user *models.User) error
 	FindByEmail(email string) (*models.User, error)
 	FindByID(id uint) (*models.User, error)
+	FindByIDForUpdate(tx *gorm.DB, id uint) (*models.User, error)
 }
 
 type userRepository struct {
@@ -19,8 +21,8 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *userRepository) Create(tx *gorm.DB, user *models.User) error {
+	return tx.Create(user).Error
 }
 
 func (r *userRepository) FindByEmail(email string) (*models.User, error) {
@@ -40,3 +42,13 @@ func (r *userRepository) FindByID(id uint) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+// FindByIDForUpdate loads a user and locks their row until tx ends
+func (r *userRepository) FindByIDForUpdate(tx *gorm.DB, id uint) (*models.User, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -2,14 +2,20 @@ package repository
 
 import (
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type WalletRepository interface {
-	Create(wallet *models.Wallet) error
+	Create(tx *gorm.DB, wallet *models.Wallet) error
 	FindByUserID(userID uint) (*models.Wallet, error)
-	UpdateBalance(tx *gorm.DB, walletID uint, newBalance float64) error
-	GetBalanceForUpdate(tx *gorm.DB, walletID uint) (float64, error)
+	FindByUserIDAndCurrency(userID uint, currency string) (*models.Wallet, error)
+	FindAllByUserID(userID uint) ([]models.Wallet, error)
+	FindByID(id uint) (*models.Wallet, error)
+	AdjustBalance(tx *gorm.DB, walletID uint, delta money.Amount) error
+	AdjustHeld(tx *gorm.DB, walletID uint, delta money.Amount) error
+	FindByIDForUpdate(tx *gorm.DB, walletID uint) (*models.Wallet, error)
 }
 
 type walletRepository struct {
@@ -20,32 +26,70 @@ func NewWalletRepository(db *gorm.DB) WalletRepository {
 	return &walletRepository{db: db}
 }
 
-func (r *walletRepository) Create(wallet *models.Wallet) error {
-	return r.db.Create(wallet).Error
+func (r *walletRepository) Create(tx *gorm.DB, wallet *models.Wallet) error {
+	return tx.Create(wallet).Error
 }
 
+// FindByUserID returns the user's primary wallet, the first one they opened
 func (r *walletRepository) FindByUserID(userID uint) (*models.Wallet, error) {
 	var wallet models.Wallet
-	err := r.db.Where("user_id = ?", userID).First(&wallet).Error
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").First(&wallet).Error
 	if err != nil {
 		return nil, err
 	}
 	return &wallet, nil
 }
 
-func (r *walletRepository) UpdateBalance(tx *gorm.DB, walletID uint, newBalance float64) error {
+func (r *walletRepository) FindByUserIDAndCurrency(userID uint, currency string) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := r.db.Where("user_id = ? AND currency = ?", userID, currency).First(&wallet).Error
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// FindAllByUserID returns the user's wallets, primary first
+func (r *walletRepository) FindAllByUserID(userID uint) ([]models.Wallet, error) {
+	var wallets []models.Wallet
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").Find(&wallets).Error
+	return wallets, err
+}
+
+func (r *walletRepository) FindByID(id uint) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := r.db.First(&wallet, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// AdjustBalance adds delta to the cached wallet balance. Only the ledger
+// should call it, in the same transaction as the postings it mirrors.
+func (r *walletRepository) AdjustBalance(tx *gorm.DB, walletID uint, delta money.Amount) error {
 	return tx.Model(&models.Wallet{}).
 		Where("id = ?", walletID).
-		Update("balance", newBalance).Error
+		Update("balance", gorm.Expr("balance + ?", delta)).Error
 }
 
-func (r *walletRepository) GetBalanceForUpdate(tx *gorm.DB, walletID uint) (float64, error) {
+// AdjustHeld adds delta to the amount held on a wallet. Callers must hold the
+// wallet's row lock.
+func (r *walletRepository) AdjustHeld(tx *gorm.DB, walletID uint, delta money.Amount) error {
+	return tx.Model(&models.Wallet{}).
+		Where("id = ?", walletID).
+		Update("held_amount", gorm.Expr("held_amount + ?", delta)).Error
+}
+
+// FindByIDForUpdate loads a wallet inside tx and holds a row lock (SELECT ... FOR UPDATE)
+// until the transaction ends
+func (r *walletRepository) FindByIDForUpdate(tx *gorm.DB, walletID uint) (*models.Wallet, error) {
 	var wallet models.Wallet
-	err := tx.Clauses().
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 		Where("id = ?", walletID).
 		First(&wallet).Error
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return wallet.Balance, nil
+	return &wallet, nil
 }
@@ -3,44 +3,80 @@ package service
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"github.com/roychanmeliaz/btechdevcases/internal/repository"
 	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 var (
-	ErrEmailExists       = errors.New("email already exists")
+	ErrEmailExists        = errors.New("email already exists")
 	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrPasswordMismatch  = errors.New("passwords do not match")
-	ErrWeakPassword      = errors.New("password must be at least 8 characters")
+	ErrPasswordMismatch   = errors.New("passwords do not match")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
 )
 
+// InitialBalance is credited to every new wallet as a welcome bonus from the treasury
+var InitialBalance = money.FromMajor(1000)
+
 type AuthService interface {
 	Register(email, password, confirmPassword string) (*models.User, error)
-	Login(email, password string) (string, *models.User, error)
+	Login(email, password string) (*LoginResult, error)
+	VerifyLogin(challengeToken, code string) (*TokenPair, *models.User, error)
+	Refresh(refreshToken string) (*TokenPair, *models.User, error)
+	RevokeRefreshTokens(familyID string) error
+	EnrollTOTP(userID uint) (*TOTPEnrollment, error)
+	ConfirmTOTP(userID uint, code string) ([]string, error)
+	RegenerateRecoveryCodes(userID uint, code string) ([]string, error)
+	DisableTOTP(userID uint, code string) error
+	TwoFactorStatus(userID uint) (*TwoFactorStatus, error)
+	DeleteExpiredLoginChallenges(now time.Time) (int64, error)
+	IsAdmin(userID uint) (bool, error)
 }
 
 type authService struct {
-	userRepo   repository.UserRepository
-	walletRepo repository.WalletRepository
-	jwtManager *customjwt.Manager
-	db         *gorm.DB
+	userRepo         repository.UserRepository
+	walletRepo       repository.WalletRepository
+	transactionRepo  repository.TransactionRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	twoFactorRepo    repository.TwoFactorRepository
+	ledger           *ledger
+	jwtManager       *customjwt.Manager
+	db               *gorm.DB
+	refreshTTL       time.Duration
+	totpIssuer       string
+	challengeTTL     time.Duration
 }
 
 func NewAuthService(
 	userRepo repository.UserRepository,
 	walletRepo repository.WalletRepository,
+	transactionRepo repository.TransactionRepository,
+	ledgerRepo repository.LedgerRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	twoFactorRepo repository.TwoFactorRepository,
 	jwtManager *customjwt.Manager,
 	db *gorm.DB,
+	refreshTTL time.Duration,
+	totpIssuer string,
+	challengeTTL time.Duration,
 ) AuthService {
 	return &authService{
-		userRepo:   userRepo,
-		walletRepo: walletRepo,
-		jwtManager: jwtManager,
-		db:         db,
+		userRepo:         userRepo,
+		walletRepo:       walletRepo,
+		transactionRepo:  transactionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		twoFactorRepo:    twoFactorRepo,
+		ledger:           newLedger(ledgerRepo, walletRepo),
+		jwtManager:       jwtManager,
+		db:               db,
+		refreshTTL:       refreshTTL,
+		totpIssuer:       totpIssuer,
+		challengeTTL:     challengeTTL,
 	}
 }
 
@@ -77,21 +113,26 @@ func (s *authService) Register(email, password, confirmPassword string) (*models
 		user = &models.User{
 			Email:    email,
 			Password: string(hashedPassword),
+			Role:     models.UserRoleUser,
 		}
-		if err := s.userRepo.Create(user); err != nil {
+		if err := s.userRepo.Create(tx, user); err != nil {
 			return fmt.Errorf("error creating user: %w", err)
 		}
 
-		// Create wallet for user with initial balance of 1000
+		// Create an empty wallet with its ledger account
 		wallet := &models.Wallet{
-			UserID:  user.ID,
-			Balance: 1000.0, // Initial balance
+			UserID:   user.ID,
+			Currency: models.DefaultCurrency,
 		}
-		if err := s.walletRepo.Create(wallet); err != nil {
+		if err := s.walletRepo.Create(tx, wallet); err != nil {
 			return fmt.Errorf("error creating wallet: %w", err)
 		}
+		if err := s.ledger.openWallet(tx, wallet); err != nil {
+			return err
+		}
 
-		return nil
+		// Fund the welcome bonus from the treasury
+		return s.creditWelcomeBonus(tx, wallet)
 	})
 
 	if err != nil {
@@ -101,26 +142,78 @@ func (s *authService) Register(email, password, confirmPassword string) (*models
 	return user, nil
 }
 
-func (s *authService) Login(email, password string) (string, *models.User, error) {
+func (s *authService) Login(email, password string) (*LoginResult, error) {
 	// Find user by email
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", nil, ErrInvalidCredentials
+			return nil, ErrInvalidCredentials
 		}
-		return "", nil, fmt.Errorf("error finding user: %w", err)
+		return nil, fmt.Errorf("error finding user: %w", err)
 	}
 
 	// Compare password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", nil, ErrInvalidCredentials
+		return nil, ErrInvalidCredentials
 	}
 
-	// Generate JWT token
-	token, err := s.jwtManager.GenerateToken(user.ID, user.Email)
+	// With two-factor authentication the password only earns a challenge
+	challenge, err := s.startChallenge(user)
 	if err != nil {
-		return "", nil, fmt.Errorf("error generating token: %w", err)
+		return nil, err
+	}
+	if challenge != nil {
+		return &LoginResult{User: user, Challenge: challenge}, nil
 	}
 
-	return token, user, nil
+	// Generate the access token and start a refresh token family
+	tokens, err := s.issueTokens(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{Tokens: tokens, User: user}, nil
+}
+
+func (s *authService) creditWelcomeBonus(tx *gorm.DB, wallet *models.Wallet) error {
+	walletLine, err := s.ledger.walletLine(tx, wallet.ID, InitialBalance)
+	if err != nil {
+		return err
+	}
+	treasuryLine, err := s.ledger.systemLine(tx, models.AccountCodeTreasury, -InitialBalance)
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.ledger.post(tx, models.JournalEntryKindWelcomeBonus, nil, "Welcome bonus", walletLine, treasuryLine)
+	if err != nil {
+		return err
+	}
+
+	balanceAfter := wallet.Balance + InitialBalance
+	credit := &models.Transaction{
+		WalletID:       wallet.ID,
+		JournalEntryID: &entry.ID,
+		Amount:         InitialBalance,
+		BalanceAfter:   &balanceAfter,
+		Type:           models.TransactionTypeCredit,
+		Notes:          "Welcome bonus",
+		IdempotencyKey: fmt.Sprintf("journal:%d", entry.ID),
+	}
+	if err := s.transactionRepo.Create(tx, credit); err != nil {
+		return fmt.Errorf("error creating welcome bonus transaction: %w", err)
+	}
+
+	wallet.Balance = balanceAfter
+	return nil
+}
+
+// IsAdmin reports whether the user has the admin role. It reads the role from
+// the database on every call so revoking it takes effect immediately.
+func (s *authService) IsAdmin(userID uint) (bool, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return false, fmt.Errorf("error finding user: %w", err)
+	}
+	return user.Role == models.UserRoleAdmin, nil
 }
@@ -2,12 +2,16 @@ package service
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"github.com/roychanmeliaz/btechdevcases/internal/repository"
 	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"github.com/roychanmeliaz/btechdevcases/pkg/totp"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,7 +24,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	}
 
 	// Auto migrate tables
-	err = db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{})
+	err = database.Migrate(db)
 	if err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
@@ -28,14 +32,17 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	return db
 }
 
-
 func TestAuthService_Register(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repository.NewUserRepository(db)
 	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
 	jwtManager := customjwt.NewManager("test-secret", 24*time.Hour)
 
-	authService := NewAuthService(userRepo, walletRepo, jwtManager, db)
+	authService := NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, time.Hour, "AuthWallet", time.Minute)
 
 	t.Run("successful registration", func(t *testing.T) {
 		user, err := authService.Register("test@example.com", "password123", "password123")
@@ -54,8 +61,8 @@ func TestAuthService_Register(t *testing.T) {
 		if err != nil {
 			t.Errorf("expected wallet to be created, got error: %v", err)
 		}
-		if wallet.Balance != 1000.0 {
-			t.Errorf("expected initial balance 1000, got %f", wallet.Balance)
+		if wallet.Balance != money.FromMajor(1000) {
+			t.Errorf("expected initial balance 1000, got %s", wallet.Balance)
 		}
 	})
 
@@ -85,9 +92,13 @@ func TestAuthService_Login(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repository.NewUserRepository(db)
 	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
 	jwtManager := customjwt.NewManager("test-secret", 24*time.Hour)
 
-	authService := NewAuthService(userRepo, walletRepo, jwtManager, db)
+	authService := NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, time.Hour, "AuthWallet", time.Minute)
 
 	// Create a test user
 	email := "login@example.com"
@@ -98,12 +109,16 @@ func TestAuthService_Login(t *testing.T) {
 	}
 
 	t.Run("successful login", func(t *testing.T) {
-		token, user, err := authService.Login(email, password)
+		result, err := authService.Login(email, password)
 		if err != nil {
-			t.Errorf("expected no error, got %v", err)
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Challenge != nil {
+			t.Fatal("expected no two-factor challenge")
 		}
-		if token == "" {
-			t.Error("expected token, got empty string")
+		tokens, user := result.Tokens, result.User
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+			t.Error("expected access and refresh tokens, got empty string")
 		}
 		if user == nil {
 			t.Error("expected user, got nil")
@@ -113,33 +128,387 @@ func TestAuthService_Login(t *testing.T) {
 		}
 
 		// Verify token can be validated
-		claims, err := jwtManager.ValidateToken(token)
+		claims, err := jwtManager.ValidateToken(tokens.AccessToken)
 		if err != nil {
 			t.Errorf("expected valid token, got error: %v", err)
 		}
 		if claims.Email != email {
 			t.Errorf("expected email %s in token, got %s", email, claims.Email)
 		}
+		if claims.SessionID() != tokens.FamilyID {
+			t.Errorf("expected session %s in token, got %s", tokens.FamilyID, claims.SessionID())
+		}
 	})
 
 	t.Run("invalid email", func(t *testing.T) {
-		_, _, err := authService.Login("nonexistent@example.com", password)
+		_, err := authService.Login("nonexistent@example.com", password)
 		if !errors.Is(err, ErrInvalidCredentials) {
 			t.Errorf("expected ErrInvalidCredentials, got %v", err)
 		}
 	})
 
 	t.Run("invalid password", func(t *testing.T) {
-		_, _, err := authService.Login(email, "wrongpassword")
+		_, err := authService.Login(email, "wrongpassword")
 		if !errors.Is(err, ErrInvalidCredentials) {
 			t.Errorf("expected ErrInvalidCredentials, got %v", err)
 		}
 	})
 }
 
+func TestAuthService_IsAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	jwtManager := customjwt.NewManager("test-secret", 24*time.Hour)
+
+	authService := NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, time.Hour, "AuthWallet", time.Minute)
+
+	user, err := authService.Register("role@example.com", "password123", "password123")
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	t.Run("new users are not admins", func(t *testing.T) {
+		isAdmin, err := authService.IsAdmin(user.ID)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if isAdmin {
+			t.Error("expected regular user")
+		}
+	})
+
+	t.Run("promoted users are admins", func(t *testing.T) {
+		db.Model(user).Update("role", models.UserRoleAdmin)
+
+		isAdmin, err := authService.IsAdmin(user.ID)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if !isAdmin {
+			t.Error("expected admin")
+		}
+	})
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	db := setupLedgerTestDB(t, "auth_refresh")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	jwtManager := customjwt.NewManager("test-secret", 15*time.Minute)
+
+	authService := NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, time.Hour, "AuthWallet", time.Minute)
+
+	email := "refresh@example.com"
+	password := "password123"
+	if _, err := authService.Register(email, password, password); err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		login := mustLogin(t, authService, email, password)
+
+		refreshed, user, err := authService.Refresh(login.RefreshToken)
+		if err != nil {
+			t.Fatalf("failed to refresh: %v", err)
+		}
+		if user.Email != email {
+			t.Errorf("expected %s, got %s", email, user.Email)
+		}
+		if refreshed.RefreshToken == login.RefreshToken || refreshed.FamilyID != login.FamilyID {
+			t.Error("expected a new refresh token in the same family")
+		}
+		claims, err := jwtManager.ValidateToken(refreshed.AccessToken)
+		if err != nil {
+			t.Fatalf("expected a valid access token, got %v", err)
+		}
+		if claims.SessionID() != login.FamilyID {
+			t.Errorf("expected the access token to stay in session %s, got %s", login.FamilyID, claims.SessionID())
+		}
+
+		// The new token can be rotated in turn
+		if _, _, err := authService.Refresh(refreshed.RefreshToken); err != nil {
+			t.Errorf("expected the new token to work, got %v", err)
+		}
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		login := mustLogin(t, authService, email, password)
+		refreshed, _, err := authService.Refresh(login.RefreshToken)
+		if err != nil {
+			t.Fatalf("failed to refresh: %v", err)
+		}
+
+		_, _, err = authService.Refresh(login.RefreshToken)
+		var reuseErr *RefreshReuseError
+		if !errors.As(err, &reuseErr) || !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+		}
+		if reuseErr.FamilyID != login.FamilyID {
+			t.Errorf("expected the session %s to be reported, got %s", login.FamilyID, reuseErr.FamilyID)
+		}
+		if _, _, err := authService.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("expected the latest token to be revoked too, got %v", err)
+		}
+
+		// Other logins are not affected
+		other := mustLogin(t, authService, email, password)
+		if _, _, err := authService.Refresh(other.RefreshToken); err != nil {
+			t.Errorf("expected another login to keep working, got %v", err)
+		}
+	})
+
+	t.Run("revoked, expired and unknown tokens", func(t *testing.T) {
+		login := mustLogin(t, authService, email, password)
+		if err := authService.RevokeRefreshTokens(login.FamilyID); err != nil {
+			t.Fatalf("failed to revoke: %v", err)
+		}
+		if _, _, err := authService.Refresh(login.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("expected ErrInvalidRefreshToken for a revoked token, got %v", err)
+		}
+
+		login = mustLogin(t, authService, email, password)
+		db.Model(&models.RefreshToken{}).Where("family_id = ?", login.FamilyID).Update("expires_at", time.Now().Add(-time.Second))
+		if _, _, err := authService.Refresh(login.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("expected ErrInvalidRefreshToken for an expired token, got %v", err)
+		}
+
+		if _, _, err := authService.Refresh("not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+}
+
+func TestAuthService_TwoFactor(t *testing.T) {
+	db := setupLedgerTestDB(t, "auth_two_factor")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	jwtManager := customjwt.NewManager("test-secret", 15*time.Minute)
+
+	authService := NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, time.Hour, "AuthWallet", time.Minute)
+
+	email := "2fa@example.com"
+	password := "password123"
+	user, err := authService.Register(email, password, password)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	challenge := func(t *testing.T) string {
+		t.Helper()
+		result, err := authService.Login(email, password)
+		if err != nil {
+			t.Fatalf("failed to login: %v", err)
+		}
+		if result.Challenge == nil || result.Tokens != nil {
+			t.Fatalf("expected a challenge instead of tokens, got %+v", result)
+		}
+		return result.Challenge.Token
+	}
+
+	enrollment, err := authService.EnrollTOTP(user.ID)
+	if err != nil {
+		t.Fatalf("failed to enroll: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/AuthWallet:2fa@example.com?") ||
+		!strings.Contains(enrollment.ProvisioningURI, "secret="+enrollment.Secret) {
+		t.Errorf("unexpected provisioning URI %s", enrollment.ProvisioningURI)
+	}
+
+	// Until it is confirmed, the enrollment does not change the login
+	mustLogin(t, authService, email, password)
+
+	now := time.Now()
+	wrong, _ := totp.Code(enrollment.Secret, now.Add(10*totp.Period))
+	if _, err := authService.ConfirmTOTP(user.ID, wrong); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+	confirmCode, _ := totp.Code(enrollment.Secret, now)
+	recoveryCodes, err := authService.ConfirmTOTP(user.ID, confirmCode)
+	if err != nil {
+		t.Fatalf("failed to confirm: %v", err)
+	}
+	if len(recoveryCodes) != RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", RecoveryCodeCount, len(recoveryCodes))
+	}
+	if _, err := authService.EnrollTOTP(user.ID); !errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+		t.Errorf("expected ErrTwoFactorAlreadyEnabled, got %v", err)
+	}
+
+	t.Run("login with an authenticator code", func(t *testing.T) {
+		token := challenge(t)
+
+		// The code used to confirm cannot be replayed
+		if _, _, err := authService.VerifyLogin(token, confirmCode); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected a replayed code to be rejected, got %v", err)
+		}
+
+		code, _ := totp.Code(enrollment.Secret, now.Add(totp.Period))
+		tokens, loggedIn, err := authService.VerifyLogin(token, code)
+		if err != nil {
+			t.Fatalf("failed to verify login: %v", err)
+		}
+		if loggedIn.ID != user.ID || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+			t.Errorf("expected the user's tokens, got %+v for %+v", tokens, loggedIn)
+		}
+
+		if _, _, err := authService.VerifyLogin(token, recoveryCodes[0]); !errors.Is(err, ErrInvalidLoginChallenge) {
+			t.Errorf("expected a used challenge to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("recovery codes work once", func(t *testing.T) {
+		if _, _, err := authService.VerifyLogin(challenge(t), strings.ToUpper(recoveryCodes[0])); err != nil {
+			t.Fatalf("failed to verify login with a recovery code: %v", err)
+		}
+		if _, _, err := authService.VerifyLogin(challenge(t), recoveryCodes[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected a used recovery code to be rejected, got %v", err)
+		}
+
+		status, err := authService.TwoFactorStatus(user.ID)
+		if err != nil {
+			t.Fatalf("failed to get status: %v", err)
+		}
+		if !status.Enabled || status.RecoveryCodesLeft != RecoveryCodeCount-1 {
+			t.Errorf("expected 2FA enabled with %d codes left, got %+v", RecoveryCodeCount-1, status)
+		}
+	})
+
+	t.Run("challenges allow a few attempts and expire", func(t *testing.T) {
+		token := challenge(t)
+		for i := 0; i < MaxChallengeAttempts; i++ {
+			if _, _, err := authService.VerifyLogin(token, "not-a-code"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+			}
+		}
+		if _, _, err := authService.VerifyLogin(token, recoveryCodes[1]); !errors.Is(err, ErrInvalidLoginChallenge) {
+			t.Errorf("expected the challenge to stop working, got %v", err)
+		}
+
+		token = challenge(t)
+		db.Model(&models.LoginChallenge{}).Where("token_hash = ?", hashToken(token)).Update("expires_at", time.Now().Add(-time.Second))
+		if _, _, err := authService.VerifyLogin(token, recoveryCodes[1]); !errors.Is(err, ErrInvalidLoginChallenge) {
+			t.Errorf("expected an expired challenge to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("regenerate recovery codes", func(t *testing.T) {
+		if _, err := authService.RegenerateRecoveryCodes(user.ID, "not-a-code"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected ErrInvalidTwoFactorCode, got %v", err)
+		}
+		fresh, err := authService.RegenerateRecoveryCodes(user.ID, recoveryCodes[1])
+		if err != nil {
+			t.Fatalf("failed to regenerate recovery codes: %v", err)
+		}
+		if _, _, err := authService.VerifyLogin(challenge(t), recoveryCodes[2]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected the old codes to be replaced, got %v", err)
+		}
+		recoveryCodes = fresh
+	})
+
+	t.Run("wrong codes lock the second factor across challenges", func(t *testing.T) {
+		// Start from the wrong codes earlier subtests left
+		credential, _ := twoFactorRepo.FindCredential(user.ID)
+		for i := credential.FailedAttempts; i < MaxTwoFactorFailures-1; i++ {
+			if _, _, err := authService.VerifyLogin(challenge(t), "not-a-code"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+			}
+		}
+		// Wrong codes for settings count too
+		if err := authService.DisableTOTP(user.ID, "not-a-code"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+		}
+
+		if _, _, err := authService.VerifyLogin(challenge(t), recoveryCodes[2]); !errors.Is(err, ErrTwoFactorLocked) {
+			t.Errorf("expected a right code to be refused while locked, got %v", err)
+		}
+		if _, err := authService.RegenerateRecoveryCodes(user.ID, recoveryCodes[2]); !errors.Is(err, ErrTwoFactorLocked) {
+			t.Errorf("expected ErrTwoFactorLocked, got %v", err)
+		}
+		if err := authService.DisableTOTP(user.ID, recoveryCodes[2]); !errors.Is(err, ErrTwoFactorLocked) {
+			t.Errorf("expected ErrTwoFactorLocked, got %v", err)
+		}
+
+		// The lockout ends, and a right code resets the count
+		db.Model(&models.TOTPCredential{}).Where("user_id = ?", user.ID).Update("locked_until", time.Now().Add(-time.Second))
+		if _, _, err := authService.VerifyLogin(challenge(t), recoveryCodes[2]); err != nil {
+			t.Fatalf("failed to verify login after the lockout: %v", err)
+		}
+		credential, _ = twoFactorRepo.FindCredential(user.ID)
+		if credential.FailedAttempts != 0 || credential.LockedUntil != nil {
+			t.Errorf("expected the failed attempts to be reset, got %d locked until %v", credential.FailedAttempts, credential.LockedUntil)
+		}
+	})
+
+	t.Run("expired challenges are deleted", func(t *testing.T) {
+		token := challenge(t)
+		db.Model(&models.LoginChallenge{}).Where("token_hash <> ?", hashToken(token)).Update("expires_at", time.Now().Add(-time.Second))
+
+		var total int64
+		db.Model(&models.LoginChallenge{}).Count(&total)
+		deleted, err := authService.DeleteExpiredLoginChallenges(time.Now())
+		if err != nil {
+			t.Fatalf("failed to delete expired challenges: %v", err)
+		}
+		if deleted != total-1 {
+			t.Errorf("expected %d challenges deleted, got %d", total-1, deleted)
+		}
+
+		if _, _, err := authService.VerifyLogin(token, recoveryCodes[3]); err != nil {
+			t.Errorf("expected the live challenge to be kept, got %v", err)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		if err := authService.DisableTOTP(user.ID, "not-a-code"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected ErrInvalidTwoFactorCode, got %v", err)
+		}
+		if err := authService.DisableTOTP(user.ID, recoveryCodes[0]); err != nil {
+			t.Fatalf("failed to disable: %v", err)
+		}
+		if err := authService.DisableTOTP(user.ID, recoveryCodes[1]); !errors.Is(err, ErrTwoFactorNotEnabled) {
+			t.Errorf("expected ErrTwoFactorNotEnabled, got %v", err)
+		}
+
+		mustLogin(t, authService, email, password)
+		status, err := authService.TwoFactorStatus(user.ID)
+		if err != nil {
+			t.Fatalf("failed to get status: %v", err)
+		}
+		if status.Enabled || status.RecoveryCodesLeft != 0 {
+			t.Errorf("expected 2FA disabled, got %+v", status)
+		}
+	})
+}
+
+// mustLogin logs in a user without two-factor authentication
+func mustLogin(t *testing.T, authService AuthService, email, password string) *TokenPair {
+	t.Helper()
+	result, err := authService.Login(email, password)
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+	if result.Tokens == nil {
+		t.Fatal("expected tokens, got a two-factor challenge")
+	}
+	return result.Tokens
+}
+
 func TestPasswordHashing(t *testing.T) {
 	password := "testpassword123"
-	
+
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
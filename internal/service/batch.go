@@ -0,0 +1,344 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+// MaxBatchSize is the largest number of items a batch may have
+const MaxBatchSize = 100
+
+var (
+	ErrBatchEmpty       = errors.New("a batch needs at least one item")
+	ErrBatchTooLarge    = fmt.Errorf("a batch can have at most %d items", MaxBatchSize)
+	ErrInvalidBatchMode = errors.New("mode must be all_or_nothing or best_effort")
+	ErrBatchRejected    = errors.New("batch rejected, no transfer was made")
+	ErrBatchNotFound    = errors.New("batch not found")
+)
+
+// BatchItem is one transfer of a batch
+type BatchItem struct {
+	RecipientEmail string
+	Amount         money.Amount
+	Notes          string
+}
+
+// BatchResult wraps the batch created by WalletService.BatchTransfer.
+// Replayed is set when the batch was returned for a repeated idempotency key.
+type BatchResult struct {
+	Batch    *models.TransferBatch
+	Replayed bool
+}
+
+// BatchError rejects an all-or-nothing batch with invalid items. Items holds
+// the invalid items with the reason each one failed.
+type BatchError struct {
+	Items []models.TransferBatchItem
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%s: %d invalid item(s)", ErrBatchRejected, len(e.Items))
+}
+
+func (e *BatchError) Unwrap() error {
+	return ErrBatchRejected
+}
+
+// batchLine is a batch item resolved to its recipient before execution
+type batchLine struct {
+	item              models.TransferBatchItem
+	recipientID       uint
+	recipientWalletID uint
+}
+
+// BatchTransfer pays the items from the sender's wallet in one database
+// transaction.
+//
+// In all_or_nothing mode (the default) an invalid item rejects the whole batch
+// with a *BatchError, a balance that does not cover the items and their fees
+// rejects it up front, and an item over one of the sender's transfer limits
+// fails it. In best_effort mode invalid items, items the balance no longer
+// covers and items over a limit are reported as failed, and the others are
+// executed in order.
+func (s *walletService) BatchTransfer(senderID uint, mode models.TransferBatchMode, items []BatchItem, idempotencyKey string) (*BatchResult, error) {
+	if mode == "" {
+		mode = models.TransferBatchModeAtomic
+	}
+	if mode != models.TransferBatchModeAtomic && mode != models.TransferBatchModeBestEffort {
+		return nil, ErrInvalidBatchMode
+	}
+	if len(items) == 0 {
+		return nil, ErrBatchEmpty
+	}
+	if len(items) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	fields := []interface{}{senderID, mode}
+	for _, item := range items {
+		fields = append(fields, strings.ToLower(item.RecipientEmail), item.Amount, item.Notes)
+	}
+
+	var replay models.TransferBatch
+	record, replayed, err := s.idempotency.begin(senderID, idempotencyKey, fingerprint("batch", fields...), &replay)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &BatchResult{Batch: &replay, Replayed: true}, nil
+	}
+
+	batch, err := s.batchTransfer(senderID, mode, items, record)
+	if err != nil {
+		s.idempotency.release(record)
+		return nil, err
+	}
+	return &BatchResult{Batch: batch}, nil
+}
+
+func (s *walletService) batchTransfer(senderID uint, mode models.TransferBatchMode, items []BatchItem, record *models.IdempotencyRecord) (*models.TransferBatch, error) {
+	senderWallet, err := s.walletRepo.FindByUserID(senderID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding sender wallet: %w", err)
+	}
+
+	lines, err := s.resolveBatch(senderWallet, items)
+	if err != nil {
+		return nil, err
+	}
+
+	var invalid []models.TransferBatchItem
+	walletIDs := []uint{senderWallet.ID}
+	for _, line := range lines {
+		if line.item.Status == models.TransferBatchItemStatusFailed {
+			invalid = append(invalid, line.item)
+			continue
+		}
+		walletIDs = append(walletIDs, line.recipientWalletID)
+	}
+	if len(invalid) > 0 && mode == models.TransferBatchModeAtomic {
+		return nil, &BatchError{Items: invalid}
+	}
+
+	batchID := uuid.NewString()
+	var batch *models.TransferBatch
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			wallets, err := s.lockWallets(tx, walletIDs...)
+			if err != nil {
+				return err
+			}
+			sender := wallets[senderWallet.ID]
+			if mode == models.TransferBatchModeAtomic {
+				if err := s.lockSender(tx, senderID); err != nil {
+					return err
+				}
+				cost, err := s.batchCost(tx, sender, lines)
+				if err != nil {
+					return err
+				}
+				if sender.AvailableBalance() < cost {
+					return ErrInsufficientBalance
+				}
+			}
+
+			batch = &models.TransferBatch{
+				PublicID:       batchID,
+				SenderWalletID: senderWallet.ID,
+				Mode:           mode,
+			}
+			succeeded := 0
+			for _, line := range lines {
+				item := line.item
+				if item.Status != models.TransferBatchItemStatusFailed {
+					p := transferParams{
+						senderWalletID:    senderWallet.ID,
+						recipientWalletID: line.recipientWalletID,
+						senderID:          senderID,
+						recipientID:       line.recipientID,
+						amount:            item.Amount,
+						notes:             item.Notes,
+						kind:              models.TransferKindTransfer,
+						entryKind:         models.JournalEntryKindTransfer,
+						batchID:           &batchID,
+						initiated:         true,
+					}
+					if key := s.idempotency.ledgerKey("batch", record); key != "" {
+						p.ledgerKey = fmt.Sprintf("%s:%d", key, item.Position)
+					}
+
+					recipient := wallets[line.recipientWalletID]
+					transfer, err := s.recordTransfer(tx, sender, recipient, p)
+					var limitErr *LimitError
+					switch {
+					case err == nil:
+						// Later items see the balances this one left behind
+						sender.Balance -= item.Amount + transfer.Fee
+						recipient.Balance += item.Amount
+
+						item.Status = models.TransferBatchItemStatusSucceeded
+						item.TransferID = &transfer.PublicID
+						batch.TotalAmount += item.Amount
+						succeeded++
+					case mode == models.TransferBatchModeBestEffort &&
+						(errors.As(err, &limitErr) || errors.Is(err, ErrInsufficientBalance)):
+						// Refused before anything was written
+						item.Status = models.TransferBatchItemStatusFailed
+						item.Error = err.Error()
+					default:
+						return err
+					}
+				}
+				batch.Items = append(batch.Items, item)
+			}
+
+			switch succeeded {
+			case len(lines):
+				batch.Status = models.TransferBatchStatusCompleted
+			case 0:
+				batch.Status = models.TransferBatchStatusFailed
+			default:
+				batch.Status = models.TransferBatchStatusPartiallyCompleted
+			}
+			if err := s.transferRepo.CreateBatch(tx, batch); err != nil {
+				return fmt.Errorf("error creating batch: %w", err)
+			}
+
+			return s.idempotency.complete(tx, record, batch)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// batchCost is what the valid items of a batch take from the sender's wallet,
+// fees included. Each item is priced as if the ones before it were sent, so
+// only the first ones use up the free tier. Call it with the sender locked by
+// lockSender.
+func (s *walletService) batchCost(tx *gorm.DB, wallet *models.Wallet, lines []batchLine) (money.Amount, error) {
+	charged := s.fees != (FeePolicy{})
+	var sent int64
+	if charged {
+		var err error
+		if sent, err = s.sentThisMonth(tx, wallet.UserID); err != nil {
+			return 0, err
+		}
+	}
+
+	var cost money.Amount
+	for _, line := range lines {
+		if line.item.Status == models.TransferBatchItemStatusFailed {
+			continue
+		}
+		cost += line.item.Amount
+		if charged {
+			fee, err := s.priceInCurrency(tx, wallet, line.item.Amount, sent)
+			if err != nil {
+				return 0, err
+			}
+			cost += fee
+			sent++
+		}
+	}
+	return cost, nil
+}
+
+// resolveBatch validates each item and finds its recipient's wallet in the
+// sender's currency. Invalid items come back marked as failed with the reason.
+func (s *walletService) resolveBatch(senderWallet *models.Wallet, items []BatchItem) ([]batchLine, error) {
+	senderID := senderWallet.UserID
+
+	recipients := make(map[string]*models.User)
+	wallets := make(map[uint]uint)
+
+	lines := make([]batchLine, len(items))
+	for i, item := range items {
+		line := &lines[i]
+		line.item = models.TransferBatchItem{
+			Position:       i,
+			RecipientEmail: item.RecipientEmail,
+			Amount:         item.Amount,
+			Notes:          item.Notes,
+		}
+		fail := func(err error) {
+			line.item.Status = models.TransferBatchItemStatusFailed
+			line.item.Error = err.Error()
+		}
+
+		if item.Amount <= 0 {
+			fail(ErrInvalidAmount)
+			continue
+		}
+		if err := checkAmount(senderWallet, item.Amount); err != nil {
+			fail(err)
+			continue
+		}
+
+		email := strings.ToLower(item.RecipientEmail)
+		recipient, ok := recipients[email]
+		if !ok {
+			var err error
+			recipient, err = s.userRepo.FindByEmail(item.RecipientEmail)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("error finding recipient: %w", err)
+			}
+			recipients[email] = recipient
+		}
+		if recipient == nil {
+			fail(ErrRecipientNotFound)
+			continue
+		}
+		if recipient.ID == senderID {
+			fail(ErrSelfTransfer)
+			continue
+		}
+
+		walletID, ok := wallets[recipient.ID]
+		if !ok {
+			wallet, err := s.recipientWallet(recipient.ID, senderWallet.Currency)
+			if errors.Is(err, ErrCurrencyMismatch) {
+				fail(err)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			walletID = wallet.ID
+			wallets[recipient.ID] = walletID
+		}
+		line.recipientID = recipient.ID
+		line.recipientWalletID = walletID
+	}
+
+	return lines, nil
+}
+
+// GetBatch returns a batch with its items to the user who sent it
+func (s *walletService) GetBatch(userID uint, batchID string) (*models.TransferBatch, error) {
+	wallet, err := s.walletRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding wallet: %w", err)
+	}
+
+	batch, err := s.transferRepo.FindBatchByPublicID(batchID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBatchNotFound
+		}
+		return nil, fmt.Errorf("error finding batch: %w", err)
+	}
+	if batch.SenderWalletID != wallet.ID {
+		return nil, ErrBatchNotFound
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_BatchTransfer(t *testing.T) {
+	db := setupLedgerTestDB(t, "batches")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	transferRepo := repository.NewTransferRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	walletService := newTestWalletService(db)
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	employer := createTestUser(t, db, "batch-employer@example.com")
+	alice := createTestUser(t, db, "batch-alice@example.com")
+	bob := createTestUser(t, db, "batch-bob@example.com")
+
+	balanceOf := func(user *models.User) money.Amount {
+		wallet, _ := walletRepo.FindByUserID(user.ID)
+		return wallet.Balance
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		if _, err := walletService.BatchTransfer(employer.ID, "", nil, ""); !errors.Is(err, ErrBatchEmpty) {
+			t.Errorf("expected ErrBatchEmpty, got %v", err)
+		}
+		if _, err := walletService.BatchTransfer(employer.ID, "", make([]BatchItem, MaxBatchSize+1), ""); !errors.Is(err, ErrBatchTooLarge) {
+			t.Errorf("expected ErrBatchTooLarge, got %v", err)
+		}
+		items := []BatchItem{{RecipientEmail: alice.Email, Amount: money.FromMajor(1)}}
+		if _, err := walletService.BatchTransfer(employer.ID, "sometimes", items, ""); !errors.Is(err, ErrInvalidBatchMode) {
+			t.Errorf("expected ErrInvalidBatchMode, got %v", err)
+		}
+	})
+
+	t.Run("all or nothing pays everyone in one go", func(t *testing.T) {
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(100), Notes: "Salary"},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(150), Notes: "Salary"},
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(50), Notes: "Bonus"},
+		}
+		result, err := walletService.BatchTransfer(employer.ID, "", items, "payroll-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		batch := result.Batch
+		if batch.Mode != models.TransferBatchModeAtomic || batch.Status != models.TransferBatchStatusCompleted || batch.TotalAmount != money.FromMajor(300) {
+			t.Errorf("unexpected batch %+v", batch)
+		}
+		if len(batch.Items) != 3 {
+			t.Fatalf("expected 3 items, got %d", len(batch.Items))
+		}
+		for _, item := range batch.Items {
+			if item.Status != models.TransferBatchItemStatusSucceeded || item.TransferID == nil {
+				t.Errorf("expected a succeeded item with a transfer, got %+v", item)
+			}
+		}
+
+		if balanceOf(employer) != money.FromMajor(700) || balanceOf(alice) != money.FromMajor(1150) || balanceOf(bob) != money.FromMajor(1150) {
+			t.Errorf("unexpected balances %s, %s, %s", balanceOf(employer), balanceOf(alice), balanceOf(bob))
+		}
+
+		// Running balances follow the order of the items
+		transfer, _ := transferRepo.FindByPublicID(*batch.Items[2].TransferID)
+		if *transfer.BatchID != batch.PublicID || *transfer.Legs[0].BalanceAfter != money.FromMajor(700) || *transfer.Legs[1].BalanceAfter != money.FromMajor(1150) {
+			t.Errorf("unexpected last transfer %+v", transfer)
+		}
+
+		stored, err := walletService.GetBatch(employer.ID, batch.PublicID)
+		if err != nil || len(stored.Items) != 3 || stored.Items[1].RecipientEmail != bob.Email {
+			t.Errorf("expected the stored batch, got %+v, %v", stored, err)
+		}
+		if _, err := walletService.GetBatch(alice.ID, batch.PublicID); !errors.Is(err, ErrBatchNotFound) {
+			t.Errorf("expected ErrBatchNotFound, got %v", err)
+		}
+	})
+
+	t.Run("resubmitting replays the batch", func(t *testing.T) {
+		items := []BatchItem{{RecipientEmail: alice.Email, Amount: money.FromMajor(10)}}
+		first, err := walletService.BatchTransfer(employer.ID, "", items, "payroll-2")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		second, err := walletService.BatchTransfer(employer.ID, "", items, "payroll-2")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !second.Replayed || second.Batch.PublicID != first.Batch.PublicID {
+			t.Errorf("expected a replay of %s, got %+v", first.Batch.PublicID, second)
+		}
+		if balanceOf(employer) != money.FromMajor(690) {
+			t.Errorf("expected balance 690, got %s", balanceOf(employer))
+		}
+
+		items[0].Amount = money.FromMajor(20)
+		if _, err := walletService.BatchTransfer(employer.ID, "", items, "payroll-2"); !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Errorf("expected ErrIdempotencyKeyReused, got %v", err)
+		}
+	})
+
+	t.Run("an invalid item rejects an all or nothing batch", func(t *testing.T) {
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(10)},
+			{RecipientEmail: "nobody@example.com", Amount: money.FromMajor(10)},
+			{RecipientEmail: employer.Email, Amount: money.FromMajor(10)},
+		}
+		_, err := walletService.BatchTransfer(employer.ID, models.TransferBatchModeAtomic, items, "payroll-3")
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) || !errors.Is(err, ErrBatchRejected) {
+			t.Fatalf("expected a BatchError, got %v", err)
+		}
+		if len(batchErr.Items) != 2 || batchErr.Items[0].Position != 1 || batchErr.Items[1].Error != ErrSelfTransfer.Error() {
+			t.Errorf("unexpected invalid items %+v", batchErr.Items)
+		}
+		if balanceOf(employer) != money.FromMajor(690) {
+			t.Errorf("expected no money to move, got %s", balanceOf(employer))
+		}
+	})
+
+	t.Run("best effort skips invalid items", func(t *testing.T) {
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(10)},
+			{RecipientEmail: "nobody@example.com", Amount: money.FromMajor(10)},
+			{RecipientEmail: bob.Email, Amount: 0},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(20)},
+		}
+		result, err := walletService.BatchTransfer(employer.ID, models.TransferBatchModeBestEffort, items, "payroll-4")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		batch := result.Batch
+		if batch.Status != models.TransferBatchStatusPartiallyCompleted || batch.TotalAmount != money.FromMajor(30) {
+			t.Errorf("unexpected batch %+v", batch)
+		}
+		want := []models.TransferBatchItemStatus{
+			models.TransferBatchItemStatusSucceeded,
+			models.TransferBatchItemStatusFailed,
+			models.TransferBatchItemStatusFailed,
+			models.TransferBatchItemStatusSucceeded,
+		}
+		for i, item := range batch.Items {
+			if item.Status != want[i] {
+				t.Errorf("item %d: expected %s, got %s", i, want[i], item.Status)
+			}
+		}
+		if batch.Items[1].Error != ErrRecipientNotFound.Error() || batch.Items[2].Error != ErrInvalidAmount.Error() {
+			t.Errorf("unexpected item errors %+v", batch.Items)
+		}
+		if balanceOf(employer) != money.FromMajor(660) {
+			t.Errorf("expected balance 660, got %s", balanceOf(employer))
+		}
+	})
+
+	t.Run("the sum must be covered", func(t *testing.T) {
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(400)},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(400)},
+		}
+		if _, err := walletService.BatchTransfer(employer.ID, models.TransferBatchModeAtomic, items, ""); !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+		if balanceOf(employer) != money.FromMajor(660) {
+			t.Errorf("expected no money to move, got %s", balanceOf(employer))
+		}
+	})
+
+	t.Run("the sum must cover the fees too", func(t *testing.T) {
+		charging := newTestWalletService(db, WalletOptions{Fees: FeePolicy{Flat: money.FromMajor(1)}})
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(330)},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(329)},
+		}
+		if _, err := charging.BatchTransfer(employer.ID, models.TransferBatchModeAtomic, items, ""); !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+		if balanceOf(employer) != money.FromMajor(660) {
+			t.Errorf("expected no money to move, got %s", balanceOf(employer))
+		}
+	})
+
+	t.Run("best effort pays the items the balance covers", func(t *testing.T) {
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(400)},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(400)},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(100)},
+		}
+		result, err := walletService.BatchTransfer(employer.ID, models.TransferBatchModeBestEffort, items, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		batch := result.Batch
+		if batch.Status != models.TransferBatchStatusPartiallyCompleted || batch.TotalAmount != money.FromMajor(500) {
+			t.Errorf("unexpected batch %+v", batch)
+		}
+		if batch.Items[1].Status != models.TransferBatchItemStatusFailed || batch.Items[1].Error != ErrInsufficientBalance.Error() {
+			t.Errorf("expected the second item to fail for the balance, got %+v", batch.Items[1])
+		}
+		if balanceOf(employer) != money.FromMajor(160) {
+			t.Errorf("expected balance 160, got %s", balanceOf(employer))
+		}
+	})
+
+	t.Run("best effort skips items over a limit", func(t *testing.T) {
+		limited := newTestWalletService(db, WalletOptions{Limits: Limits{PerTransaction: money.FromMajor(50)}})
+		items := []BatchItem{
+			{RecipientEmail: alice.Email, Amount: money.FromMajor(60)},
+			{RecipientEmail: bob.Email, Amount: money.FromMajor(10)},
+		}
+		if _, err := limited.BatchTransfer(employer.ID, models.TransferBatchModeAtomic, items, ""); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+
+		result, err := limited.BatchTransfer(employer.ID, models.TransferBatchModeBestEffort, items, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		batch := result.Batch
+		if batch.Items[0].Status != models.TransferBatchItemStatusFailed || batch.Items[1].Status != models.TransferBatchItemStatusSucceeded {
+			t.Errorf("expected only the second item to succeed, got %+v", batch.Items)
+		}
+		if balanceOf(employer) != money.FromMajor(150) {
+			t.Errorf("expected balance 150, got %s", balanceOf(employer))
+		}
+	})
+
+	t.Run("ledger keys do not collide with a transfer's", func(t *testing.T) {
+		// A transfer whose key looks like the key of a batch item
+		result, err := walletService.Transfer(employer.ID, alice.Email, money.FromMajor(1), "", "", "payroll-1:0")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Replayed {
+			t.Error("expected a new transfer, got a replay")
+		}
+	})
+
+	if err := ledgerService.CheckInvariant(); err != nil {
+		t.Errorf("ledger invariant broken: %v", err)
+	}
+}
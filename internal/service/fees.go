@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+// FeePolicy prices the transfers users make. The fee is Flat plus Percent of
+// the amount, rounded half up to the cent, then raised to Min and capped at
+// Max. The first FreePerMonth transfers a user sends in a calendar month (UTC)
+// are free. The zero value charges nothing.
+//
+// Flat, Min and Max are in the base currency. A wallet in another currency is
+// charged them converted at the mid-market rate, and the fee is rounded half
+// up to its currency's smallest unit. The free tier counts the transfers from
+// all of a user's wallets.
+type FeePolicy struct {
+	Flat money.Amount
+	// Percent is a percentage with two decimals, e.g. 1.50 for 1.5%
+	Percent      money.Amount
+	Min          money.Amount
+	Max          money.Amount
+	FreePerMonth int
+}
+
+// FeeQuote is what a transfer would cost. FreeTransfersRemaining is nil when
+// there is no free tier.
+type FeeQuote struct {
+	Currency               string       `json:"currency"`
+	Amount                 money.Amount `json:"amount"`
+	Fee                    money.Amount `json:"fee"`
+	Total                  money.Amount `json:"total"`
+	FreeTransfersRemaining *int         `json:"free_transfers_remaining"`
+}
+
+// fee prices a transfer of amount by a user who already sent sentThisMonth
+// transfers this month
+func (p FeePolicy) fee(amount money.Amount, sentThisMonth int64) (money.Amount, error) {
+	if sentThisMonth < int64(p.FreePerMonth) {
+		return 0, nil
+	}
+
+	percentage, err := amount.MulRatio(p.Percent.Minor(), 100*100, money.RoundHalfUp)
+	if err != nil {
+		return 0, fmt.Errorf("%w: the fee is too large", ErrInvalidAmount)
+	}
+	fee := p.Flat + percentage
+	if fee < p.Min {
+		fee = p.Min
+	}
+	if p.Max > 0 && fee > p.Max {
+		fee = p.Max
+	}
+	return fee, nil
+}
+
+// QuoteTransfer previews the fee of a transfer without making it
+func (s *walletService) QuoteTransfer(senderID uint, recipientEmail string, amount money.Amount, currency string) (*FeeQuote, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	recipient, err := s.userRepo.FindByEmail(recipientEmail)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecipientNotFound
+		}
+		return nil, fmt.Errorf("error finding recipient: %w", err)
+	}
+	if recipient.ID == senderID {
+		return nil, ErrSelfTransfer
+	}
+
+	wallet, err := s.findWallet(senderID, currency)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.recipientWallet(recipient.ID, wallet.Currency); err != nil {
+		return nil, err
+	}
+	if err := checkAmount(wallet, amount); err != nil {
+		return nil, err
+	}
+	sent, err := s.sentThisMonth(s.db, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := s.priceInCurrency(s.db, wallet, amount, sent)
+	if err != nil {
+		return nil, err
+	}
+	quote := &FeeQuote{Currency: wallet.Currency, Amount: amount, Fee: fee, Total: amount + fee}
+	if s.fees.FreePerMonth > 0 {
+		free := max(s.fees.FreePerMonth-int(sent), 0)
+		quote.FreeTransfersRemaining = &free
+	}
+	return quote, nil
+}
+
+// transferFee prices a transfer from the wallet. Call it with the sender
+// locked by lockSender so concurrent transfers cannot both use the last free
+// transfer.
+func (s *walletService) transferFee(tx *gorm.DB, wallet *models.Wallet, amount money.Amount) (money.Amount, error) {
+	if s.fees == (FeePolicy{}) {
+		return 0, nil
+	}
+	sent, err := s.sentThisMonth(tx, wallet.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return s.priceInCurrency(tx, wallet, amount, sent)
+}
+
+// priceInCurrency prices a transfer from the wallet in its currency
+func (s *walletService) priceInCurrency(tx *gorm.DB, wallet *models.Wallet, amount money.Amount, sentThisMonth int64) (money.Amount, error) {
+	c, err := currencyOf(wallet)
+	if err != nil {
+		return 0, err
+	}
+	if sentThisMonth < int64(s.fees.FreePerMonth) {
+		return 0, nil
+	}
+
+	// Percent applies as it is; the fixed amounts are converted
+	policy := s.fees
+	for _, figure := range []*money.Amount{&policy.Flat, &policy.Min, &policy.Max} {
+		if *figure, err = s.fromBase(tx, c.Code, *figure); err != nil {
+			return 0, err
+		}
+	}
+	fee, err := policy.fee(amount, sentThisMonth)
+	if err != nil {
+		return 0, err
+	}
+	fee, err = c.Round(fee, money.RoundHalfUp)
+	if err != nil {
+		return 0, fmt.Errorf("%w: the fee is too large", ErrInvalidAmount)
+	}
+	return fee, nil
+}
+
+func (s *walletService) sentThisMonth(tx *gorm.DB, userID uint) (int64, error) {
+	sent, err := s.transferRepo.CountSent(tx, userID, startOfMonth(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("error counting transfers: %w", err)
+	}
+	return sent, nil
+}
+
+// chargeFee moves the fee of a transfer from the sender's wallet to the fees
+// account, as its own journal entry and wallet transaction. balance is the
+// sender's balance before the fee.
+func (s *walletService) chargeFee(tx *gorm.DB, walletID uint, transfer *models.Transfer, balance money.Amount, ledgerKey string) (*models.Transaction, error) {
+	description := fmt.Sprintf("Fee for transfer %s", transfer.PublicID)
+
+	walletLine, err := s.ledger.walletLine(tx, walletID, -transfer.Fee)
+	if err != nil {
+		return nil, err
+	}
+	feesLine, err := s.ledger.systemLine(tx, models.AccountCodeFees, transfer.Fee)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.ledger.post(tx, models.JournalEntryKindFee, &transfer.ID, description, walletLine, feesLine)
+	if err != nil {
+		return nil, err
+	}
+
+	// Not linked to the transfer, which keeps exactly one debit and one credit leg
+	balanceAfter := balance - transfer.Fee
+	feeTx := &models.Transaction{
+		WalletID:       walletID,
+		JournalEntryID: &entry.ID,
+		Amount:         transfer.Fee,
+		BalanceAfter:   &balanceAfter,
+		Type:           models.TransactionTypeDebit,
+		Notes:          description,
+		IdempotencyKey: ledgerKey + "-fee",
+	}
+	if err := s.transactionRepo.Create(tx, feeTx); err != nil {
+		return nil, fmt.Errorf("error creating fee transaction: %w", err)
+	}
+	return feeTx, nil
+}
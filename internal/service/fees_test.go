@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestFeePolicy_Fee(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy FeePolicy
+		amount string
+		sent   int64
+		want   string
+	}{
+		{"no policy", FeePolicy{}, "100.00", 0, "0.00"},
+		{"flat", FeePolicy{Flat: money.MustParse("0.50")}, "100.00", 0, "0.50"},
+		{"percentage rounds half up", FeePolicy{Percent: money.MustParse("1.5")}, "10.10", 0, "0.15"},
+		{"percentage half cent", FeePolicy{Percent: money.MustParse("0.5")}, "1.00", 0, "0.01"},
+		{"flat plus percentage", FeePolicy{Flat: money.MustParse("0.30"), Percent: money.MustParse("2.9")}, "100.00", 0, "3.20"},
+		{"raised to the minimum", FeePolicy{Percent: money.MustParse("1"), Min: money.MustParse("1.00")}, "20.00", 0, "1.00"},
+		{"capped at the maximum", FeePolicy{Percent: money.MustParse("1"), Max: money.MustParse("5.00")}, "2000.00", 0, "5.00"},
+		{"free tier", FeePolicy{Flat: money.MustParse("1.00"), FreePerMonth: 3}, "100.00", 2, "0.00"},
+		{"after the free tier", FeePolicy{Flat: money.MustParse("1.00"), FreePerMonth: 3}, "100.00", 3, "1.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.fee(money.MustParse(tt.amount), tt.sent)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != money.MustParse(tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWalletService_Fees(t *testing.T) {
+	db := setupLedgerTestDB(t, "fees")
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	fees := FeePolicy{
+		Flat:         money.MustParse("0.50"),
+		Percent:      money.MustParse("1"),
+		Min:          money.MustParse("1.00"),
+		Max:          money.MustParse("5.00"),
+		FreePerMonth: 1,
+	}
+	walletService := newTestWalletService(db, WalletOptions{Fees: fees})
+	reconciliationService := newTestReconciliationService(db)
+
+	sender := createTestUser(t, db, "fee-sender@example.com")
+	recipient := createTestUser(t, db, "fee-recipient@example.com")
+
+	balanceOf := func(user *models.User) money.Amount {
+		wallet, _ := walletRepo.FindByUserID(user.ID)
+		return wallet.Balance
+	}
+
+	t.Run("first transfer of the month is free", func(t *testing.T) {
+		quote, err := walletService.QuoteTransfer(sender.ID, recipient.Email, money.FromMajor(100), "")
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		if quote.Fee != 0 || *quote.FreeTransfersRemaining != 1 {
+			t.Errorf("expected a free transfer, got %+v", quote)
+		}
+
+		result, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(100), "", "", "")
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		if result.Transfer.Fee != 0 {
+			t.Errorf("expected no fee, got %s", result.Transfer.Fee)
+		}
+	})
+
+	var charged *models.Transfer
+	t.Run("quote matches the charged fee", func(t *testing.T) {
+		quote, err := walletService.QuoteTransfer(sender.ID, recipient.Email, money.FromMajor(100), "")
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		if quote.Fee != money.MustParse("1.50") || quote.Total != money.MustParse("101.50") || *quote.FreeTransfersRemaining != 0 {
+			t.Errorf("expected a fee of 1.50, got %+v", quote)
+		}
+
+		result, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(100), "", "", "fee-key")
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		charged = result.Transfer
+		if charged.Fee != quote.Fee || charged.Legs[0].Fee != quote.Fee {
+			t.Errorf("expected the fee on the transfer and its debit leg, got %s and %s", charged.Fee, charged.Legs[0].Fee)
+		}
+		if balanceOf(sender) != money.MustParse("798.50") || balanceOf(recipient) != money.FromMajor(1200) {
+			t.Errorf("expected balances 798.50 and 1200, got %s and %s", balanceOf(sender), balanceOf(recipient))
+		}
+	})
+
+	t.Run("fee is posted to the fees account", func(t *testing.T) {
+		account, err := ledgerRepo.FindAccountByCode(db, models.AccountCodeFees)
+		if err != nil {
+			t.Fatalf("failed to find fees account: %v", err)
+		}
+		collected, _ := ledgerRepo.SumPostingsByAccount(db, account.ID)
+		if collected != money.MustParse("1.50") {
+			t.Errorf("expected 1.50 collected, got %s", collected)
+		}
+
+		page, err := walletService.ListTransactions(sender.ID, TransactionQuery{})
+		if err != nil {
+			t.Fatalf("failed to list transactions: %v", err)
+		}
+		feeTx := page.Transactions[0]
+		if feeTx.Amount != money.MustParse("1.50") || feeTx.Type != models.TransactionTypeDebit || *feeTx.BalanceAfter != money.MustParse("798.50") {
+			t.Errorf("expected the fee as the latest debit, got %+v", feeTx)
+		}
+
+		report, err := reconciliationService.Run(false)
+		if err != nil {
+			t.Fatalf("failed to reconcile: %v", err)
+		}
+		if !report.OK {
+			t.Errorf("expected a clean reconciliation, got %+v", report)
+		}
+	})
+
+	t.Run("balance check includes the fee", func(t *testing.T) {
+		// 798.50 plus a capped fee of 5.00 is more than the balance
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("798.50"), "", "", "")
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+		if balanceOf(sender) != money.MustParse("798.50") {
+			t.Errorf("expected the balance to be unchanged, got %s", balanceOf(sender))
+		}
+	})
+
+	t.Run("fixed fees are converted from the base currency", func(t *testing.T) {
+		senderJPY, err := walletService.OpenWallet(sender.ID, "JPY")
+		if err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+		fundWallet(t, db, senderJPY, money.FromMajor(100000))
+		if _, err := walletService.OpenWallet(recipient.ID, "JPY"); err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+		if _, err := walletService.SetRate("USD", "JPY", money.MustParseRate("150"), 0); err != nil {
+			t.Fatalf("failed to set rate: %v", err)
+		}
+
+		// The free transfer was used from the USD wallet. 0.50 USD + 1% of
+		// 10000 is 175 JPY, within the 150 to 750 JPY of the minimum and maximum.
+		quote, err := walletService.QuoteTransfer(sender.ID, recipient.Email, money.FromMajor(10000), "JPY")
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		if quote.Currency != "JPY" || quote.Fee != money.FromMajor(175) || *quote.FreeTransfersRemaining != 0 {
+			t.Errorf("expected a fee of 175 JPY, got %+v", quote)
+		}
+
+		// 75 JPY + 1% of 90000 is 975 JPY, capped at 5 USD
+		quote, _ = walletService.QuoteTransfer(sender.ID, recipient.Email, money.FromMajor(90000), "JPY")
+		if quote.Fee != money.FromMajor(750) {
+			t.Errorf("expected the fee capped at 750 JPY, got %s", quote.Fee)
+		}
+
+		result, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(10000), "JPY", "", "")
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		if result.Transfer.Fee != money.FromMajor(175) {
+			t.Errorf("expected a fee of 175 JPY, got %s", result.Transfer.Fee)
+		}
+	})
+
+	t.Run("refunds do not return the fee", func(t *testing.T) {
+		result, err := walletService.Refund(recipient.ID, charged.PublicID, nil, "", "")
+		if err != nil {
+			t.Fatalf("failed to refund: %v", err)
+		}
+		if result.Transfer.Fee != 0 {
+			t.Errorf("expected refunds to be free, got %s", result.Transfer.Fee)
+		}
+		if balanceOf(sender) != money.MustParse("898.50") {
+			t.Errorf("expected 898.50 after the refund, got %s", balanceOf(sender))
+		}
+	})
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRateNotFound            = errors.New("no exchange rate for this currency pair")
+	ErrInvalidRate             = errors.New("rate must be greater than 0")
+	ErrInvalidSpread           = errors.New("spread must be at least 0 and below 100 percent")
+	ErrSameCurrency            = errors.New("a conversion needs two different currencies")
+	ErrInvalidRateFile         = errors.New("invalid exchange rate file")
+	ErrQuoteNotFound           = errors.New("quote not found")
+	ErrQuoteExpired            = errors.New("quote has expired")
+	ErrQuoteUsed               = errors.New("quote has already been used")
+	ErrConversionNotRefundable = errors.New("transfers that converted currencies cannot be refunded")
+)
+
+// ListRates returns every exchange rate, ordered by currency pair
+func (s *walletService) ListRates() ([]models.ExchangeRate, error) {
+	rates, err := s.fxRepo.ListRates()
+	if err != nil {
+		return nil, fmt.Errorf("error finding exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// SetRate creates or replaces the rate from one currency to another. Each
+// direction of a pair has its own rate.
+func (s *walletService) SetRate(from, to string, rate money.Rate, spread money.Amount) (*models.ExchangeRate, error) {
+	exchangeRate, err := newExchangeRate(from, to, rate, spread)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveRates(exchangeRate); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.fxRepo.FindRate(s.db, exchangeRate.FromCurrency, exchangeRate.ToCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("error finding exchange rate: %w", err)
+	}
+	return saved, nil
+}
+
+// DeleteRate removes the rate from one currency to another; quotes already
+// given at that rate can still be executed until they expire
+func (s *walletService) DeleteRate(from, to string) error {
+	deleted, err := s.fxRepo.DeleteRate(strings.ToUpper(from), strings.ToUpper(to))
+	if err != nil {
+		return fmt.Errorf("error deleting exchange rate: %w", err)
+	}
+	if !deleted {
+		return ErrRateNotFound
+	}
+	return nil
+}
+
+// ImportRates loads rates from CSV records of from,to,rate[,spread], e.g.
+// "USD,JPY,151.2345,0.50". A header row and lines starting with # are
+// skipped. Either every rate is saved or, if a record is invalid, none is.
+func (s *walletService) ImportRates(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rates []*models.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidRateFile, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(rates) == 0 && strings.EqualFold(record[0], "from") {
+			continue
+		}
+
+		rate, err := parseRateRecord(record)
+		if err != nil {
+			return 0, fmt.Errorf("%w: line %d: %v", ErrInvalidRateFile, line, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := s.saveRates(rates...); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+func parseRateRecord(record []string) (*models.ExchangeRate, error) {
+	if len(record) != 3 && len(record) != 4 {
+		return nil, fmt.Errorf("expected from,to,rate[,spread], got %d fields", len(record))
+	}
+
+	rate, err := money.ParseRate(record[2])
+	if err != nil {
+		return nil, err
+	}
+	var spread money.Amount
+	if len(record) == 4 {
+		if spread, err = money.Parse(record[3]); err != nil {
+			return nil, fmt.Errorf("invalid spread %q: %w", record[3], err)
+		}
+	}
+
+	return newExchangeRate(record[0], record[1], rate, spread)
+}
+
+// newExchangeRate validates a rate and normalizes its currency codes
+func newExchangeRate(from, to string, rate money.Rate, spread money.Amount) (*models.ExchangeRate, error) {
+	source, err := money.LookupCurrency(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, from)
+	}
+	target, err := money.LookupCurrency(to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, to)
+	}
+	if source == target {
+		return nil, ErrSameCurrency
+	}
+	if rate <= 0 {
+		return nil, ErrInvalidRate
+	}
+	if spread < 0 || spread >= money.FromMajor(100) {
+		return nil, ErrInvalidSpread
+	}
+
+	return &models.ExchangeRate{
+		FromCurrency: source.Code,
+		ToCurrency:   target.Code,
+		Rate:         rate,
+		Spread:       spread,
+	}, nil
+}
+
+// saveRates saves the rates in one transaction, together with the FX ledger
+// accounts of their currencies
+func (s *walletService) saveRates(rates ...*models.ExchangeRate) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, rate := range rates {
+			for _, currency := range []string{rate.FromCurrency, rate.ToCurrency} {
+				if err := s.ledger.openFXAccount(tx, currency); err != nil {
+					return err
+				}
+			}
+			if err := s.fxRepo.SaveRate(tx, rate); err != nil {
+				return fmt.Errorf("error saving exchange rate: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// QuoteConversion prices converting amount from the user's wallet in from (or
+// their primary wallet when from is empty) into to, and locks the rate for a
+// short while. The converted amount is rounded down to the target currency's
+// smallest unit.
+func (s *walletService) QuoteConversion(userID uint, from, to string, amount money.Amount) (*models.FXQuote, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	wallet, err := s.findWallet(userID, from)
+	if err != nil {
+		return nil, err
+	}
+	target, err := money.LookupCurrency(to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, to)
+	}
+	if target.Code == wallet.Currency {
+		return nil, ErrSameCurrency
+	}
+	if err := checkAmount(wallet, amount); err != nil {
+		return nil, err
+	}
+
+	rate, err := s.fxRepo.FindRate(s.db, wallet.Currency, target.Code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s to %s", ErrRateNotFound, wallet.Currency, target.Code)
+		}
+		return nil, fmt.Errorf("error finding exchange rate: %w", err)
+	}
+
+	effective := rate.Rate.Less(rate.Spread)
+	converted, err := effective.Convert(amount, target, money.RoundDown)
+	if err != nil {
+		return nil, fmt.Errorf("%w: too large to convert to %s", ErrInvalidAmount, target.Code)
+	}
+	if converted <= 0 {
+		return nil, fmt.Errorf("%w: converts to less than one %s unit", ErrInvalidAmount, target.Code)
+	}
+
+	quote := &models.FXQuote{
+		PublicID:        uuid.NewString(),
+		UserID:          userID,
+		FromCurrency:    wallet.Currency,
+		ToCurrency:      target.Code,
+		Amount:          amount,
+		ConvertedAmount: converted,
+		Rate:            rate.Rate,
+		Spread:          rate.Spread,
+		EffectiveRate:   effective,
+		ExpiresAt:       time.Now().Add(s.fxQuoteTTL),
+	}
+	if err := s.fxRepo.CreateQuote(quote); err != nil {
+		return nil, fmt.Errorf("error creating quote: %w", err)
+	}
+	return quote, nil
+}
+
+// Convert executes a quote: it debits the quoted amount from the user's wallet
+// in the source currency and credits the converted amount to the recipient's
+// wallet in the target currency. Without a recipient the money goes to the
+// user's own wallet in that currency.
+func (s *walletService) Convert(userID uint, quoteID string, recipientEmail string, notes string, idempotencyKey string) (*TransferResult, error) {
+	var replay models.Transfer
+	record, replayed, err := s.idempotency.begin(
+		userID,
+		idempotencyKey,
+		fingerprint("convert", userID, quoteID, strings.ToLower(recipientEmail), notes),
+		&replay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &TransferResult{Transfer: &replay, Replayed: true}, nil
+	}
+
+	transfer, err := s.convert(userID, quoteID, recipientEmail, notes, record)
+	if err != nil {
+		s.idempotency.release(record)
+		return nil, err
+	}
+	return &TransferResult{Transfer: transfer}, nil
+}
+
+func (s *walletService) convert(userID uint, quoteID string, recipientEmail string, notes string, record *models.IdempotencyRecord) (*models.Transfer, error) {
+	quote, err := s.fxRepo.FindQuoteByPublicID(quoteID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQuoteNotFound
+		}
+		return nil, fmt.Errorf("error finding quote: %w", err)
+	}
+	if quote.UserID != userID {
+		return nil, ErrQuoteNotFound
+	}
+
+	senderWallet, err := s.findWallet(userID, quote.FromCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientID := userID
+	if recipientEmail != "" {
+		recipient, err := s.userRepo.FindByEmail(recipientEmail)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrRecipientNotFound
+			}
+			return nil, fmt.Errorf("error finding recipient: %w", err)
+		}
+		recipientID = recipient.ID
+	}
+	var recipientWallet *models.Wallet
+	if recipientID == userID {
+		recipientWallet, err = s.findWallet(userID, quote.ToCurrency)
+	} else {
+		recipientWallet, err = s.recipientWallet(recipientID, quote.ToCurrency)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params := transferParams{
+		senderWalletID:    senderWallet.ID,
+		recipientWalletID: recipientWallet.ID,
+		senderID:          userID,
+		recipientID:       recipientID,
+		amount:            quote.Amount,
+		notes:             notes,
+		kind:              models.TransferKindTransfer,
+		entryKind:         models.JournalEntryKindTransfer,
+		// Moving money between the user's own wallets is neither charged nor
+		// limited; the money does not leave them
+		initiated: recipientID != userID,
+	}
+	params.ledgerKey = s.idempotency.ledgerKey("convert", record)
+
+	var transfer *models.Transfer
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			wallets, err := s.lockWallets(tx, params.senderWalletID, params.recipientWalletID)
+			if err != nil {
+				return err
+			}
+
+			// Lock the quote after the wallets, so it is executed at most once
+			locked, err := s.fxRepo.FindQuoteByPublicIDForUpdate(tx, quote.PublicID)
+			if err != nil {
+				return fmt.Errorf("error locking quote: %w", err)
+			}
+			if locked.TransferID != nil {
+				return ErrQuoteUsed
+			}
+			if !time.Now().Before(locked.ExpiresAt) {
+				return ErrQuoteExpired
+			}
+
+			p := params
+			p.conversion = locked
+			transfer, err = s.recordTransfer(tx, wallets[p.senderWalletID], wallets[p.recipientWalletID], p)
+			if err != nil {
+				return err
+			}
+			if err := s.fxRepo.MarkQuoteExecuted(tx, locked.ID, transfer.PublicID); err != nil {
+				return fmt.Errorf("error updating quote: %w", err)
+			}
+
+			return s.idempotency.complete(tx, record, transfer)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// toBase values amount in currency in the base currency, at the mid-market
+// rate from currency to it
+func (s *walletService) toBase(tx *gorm.DB, currency string, amount money.Amount) (money.Amount, error) {
+	return s.atMidRate(tx, currency, baseCurrency, amount)
+}
+
+// fromBase converts amount in the base currency into currency, at the
+// mid-market rate from the base currency to it
+func (s *walletService) fromBase(tx *gorm.DB, currency string, amount money.Amount) (money.Amount, error) {
+	return s.atMidRate(tx, baseCurrency, currency, amount)
+}
+
+// atMidRate converts amount without the spread, rounding half up. Nothing is
+// looked up for a zero amount or the same currency.
+func (s *walletService) atMidRate(tx *gorm.DB, from, to string, amount money.Amount) (money.Amount, error) {
+	if amount == 0 || from == to {
+		return amount, nil
+	}
+	target, err := money.LookupCurrency(to)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, to)
+	}
+
+	rate, err := s.fxRepo.FindRate(tx, from, to)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from, to)
+		}
+		return 0, fmt.Errorf("error finding exchange rate: %w", err)
+	}
+	converted, err := rate.Rate.Convert(amount, target, money.RoundHalfUp)
+	if err != nil {
+		return 0, fmt.Errorf("%w: too large to convert to %s", ErrInvalidAmount, to)
+	}
+	return converted, nil
+}
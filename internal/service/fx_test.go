@@ -0,0 +1,233 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_CurrencyConversion(t *testing.T) {
+	db := setupLedgerTestDB(t, "currency_conversion")
+	walletRepo := repository.NewWalletRepository(db)
+	fxRepo := repository.NewFXRepository(db)
+
+	walletService := newTestWalletService(db)
+	reconciliationService := newTestReconciliationService(db)
+
+	alice := createTestUser(t, db, "alice-convert@example.com")
+	bob := createTestUser(t, db, "bob-convert@example.com")
+	aliceJPY, err := walletService.OpenWallet(alice.ID, "JPY")
+	if err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	bobEUR, err := walletService.OpenWallet(bob.ID, "EUR")
+	if err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+
+	t.Run("set and import rates", func(t *testing.T) {
+		rate, err := walletService.SetRate("usd", "eur", money.MustParseRate("0.92"), money.MustParse("0.50"))
+		if err != nil {
+			t.Fatalf("failed to set rate: %v", err)
+		}
+		if rate.FromCurrency != "USD" || rate.ToCurrency != "EUR" || rate.Rate != money.MustParseRate("0.92") {
+			t.Errorf("unexpected rate: %+v", rate)
+		}
+
+		if _, err := walletService.SetRate("USD", "USD", money.MustParseRate("1"), 0); !errors.Is(err, ErrSameCurrency) {
+			t.Errorf("expected ErrSameCurrency, got %v", err)
+		}
+		if _, err := walletService.SetRate("USD", "EUR", money.MustParseRate("1"), money.FromMajor(100)); !errors.Is(err, ErrInvalidSpread) {
+			t.Errorf("expected ErrInvalidSpread, got %v", err)
+		}
+
+		// An invalid record rejects the whole file
+		_, err = walletService.ImportRates(strings.NewReader("USD,GBP,0.79\nUSD,XYZ,1.5\n"))
+		if !errors.Is(err, ErrInvalidRateFile) {
+			t.Errorf("expected ErrInvalidRateFile, got %v", err)
+		}
+		if _, err := fxRepo.FindRate(db, "USD", "GBP"); err == nil {
+			t.Error("expected no rate to be saved from an invalid file")
+		}
+
+		imported, err := walletService.ImportRates(strings.NewReader("from,to,rate,spread\n# daily rates\nUSD,JPY,151.2345,1\nEUR,USD,1.087\n"))
+		if err != nil {
+			t.Fatalf("failed to import rates: %v", err)
+		}
+		if imported != 2 {
+			t.Errorf("expected 2 rates, got %d", imported)
+		}
+
+		rates, err := walletService.ListRates()
+		if err != nil {
+			t.Fatalf("failed to list rates: %v", err)
+		}
+		if len(rates) != 3 {
+			t.Errorf("expected 3 rates, got %d", len(rates))
+		}
+	})
+
+	t.Run("quote", func(t *testing.T) {
+		if _, err := walletService.QuoteConversion(alice.ID, "", "USD", money.FromMajor(10)); !errors.Is(err, ErrSameCurrency) {
+			t.Errorf("expected ErrSameCurrency, got %v", err)
+		}
+		if _, err := walletService.QuoteConversion(alice.ID, "", "GBP", money.FromMajor(10)); !errors.Is(err, ErrRateNotFound) {
+			t.Errorf("expected ErrRateNotFound, got %v", err)
+		}
+
+		// 151.2345 less a 1% spread is 149.722155 yen per dollar, rounded down
+		quote, err := walletService.QuoteConversion(alice.ID, "", "JPY", money.FromMajor(10))
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		if quote.FromCurrency != "USD" || quote.EffectiveRate != money.MustParseRate("149.722155") || quote.ConvertedAmount != money.FromMajor(1497) {
+			t.Errorf("unexpected quote: %+v", quote)
+		}
+	})
+
+	t.Run("convert into the user's own wallet", func(t *testing.T) {
+		quote, err := walletService.QuoteConversion(alice.ID, "USD", "JPY", money.FromMajor(10))
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+
+		if _, err := walletService.Convert(bob.ID, quote.PublicID, "", "", ""); !errors.Is(err, ErrQuoteNotFound) {
+			t.Errorf("expected another user's quote to be hidden, got %v", err)
+		}
+
+		result, err := walletService.Convert(alice.ID, quote.PublicID, "", "Travel money", "")
+		if err != nil {
+			t.Fatalf("failed to convert: %v", err)
+		}
+		if result.Transfer.ConvertedAmount == nil || *result.Transfer.ConvertedAmount != money.FromMajor(1497) {
+			t.Errorf("expected 1497 yen to be credited, got %+v", result.Transfer)
+		}
+
+		alicePrimary, _ := walletRepo.FindByUserID(alice.ID)
+		aliceYen, _ := walletRepo.FindByID(aliceJPY.ID)
+		if alicePrimary.Balance != money.FromMajor(990) || aliceYen.Balance != money.FromMajor(1497) {
+			t.Errorf("expected 990 USD and 1497 JPY, got %s and %s", alicePrimary.Balance, aliceYen.Balance)
+		}
+
+		if _, err := walletService.Convert(alice.ID, quote.PublicID, "", "", ""); !errors.Is(err, ErrQuoteUsed) {
+			t.Errorf("expected ErrQuoteUsed, got %v", err)
+		}
+	})
+
+	t.Run("convert into another user's wallet", func(t *testing.T) {
+		quote, err := walletService.QuoteConversion(alice.ID, "", "JPY", money.FromMajor(10))
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		if _, err := walletService.Convert(alice.ID, quote.PublicID, bob.Email, "", ""); !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("expected ErrCurrencyMismatch for a recipient without a JPY wallet, got %v", err)
+		}
+
+		// 0.92 less a 0.5% spread is 0.9154 euro per dollar
+		quote, err = walletService.QuoteConversion(alice.ID, "", "EUR", money.FromMajor(100))
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		result, err := walletService.Convert(alice.ID, quote.PublicID, bob.Email, "Rent", "")
+		if err != nil {
+			t.Fatalf("failed to convert: %v", err)
+		}
+
+		bobEuro, _ := walletRepo.FindByID(bobEUR.ID)
+		bobPrimary, _ := walletRepo.FindByUserID(bob.ID)
+		if bobEuro.Balance != money.MustParse("91.54") || bobPrimary.Balance != money.FromMajor(1000) {
+			t.Errorf("expected 91.54 EUR and an untouched USD wallet, got %s and %s", bobEuro.Balance, bobPrimary.Balance)
+		}
+
+		if _, err := walletService.Refund(bob.ID, result.Transfer.PublicID, nil, "", ""); !errors.Is(err, ErrConversionNotRefundable) {
+			t.Errorf("expected ErrConversionNotRefundable, got %v", err)
+		}
+	})
+
+	t.Run("expired quote", func(t *testing.T) {
+		quote, err := walletService.QuoteConversion(alice.ID, "", "EUR", money.FromMajor(5))
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		db.Model(&models.FXQuote{}).Where("id = ?", quote.ID).Update("expires_at", time.Now().Add(-time.Second))
+
+		if _, err := walletService.Convert(alice.ID, quote.PublicID, bob.Email, "", ""); !errors.Is(err, ErrQuoteExpired) {
+			t.Errorf("expected ErrQuoteExpired, got %v", err)
+		}
+	})
+
+	t.Run("ledger reconciles", func(t *testing.T) {
+		report, err := reconciliationService.Run(false)
+		if err != nil {
+			t.Fatalf("failed to reconcile: %v", err)
+		}
+		if !report.OK {
+			t.Errorf("expected a clean reconciliation, got %+v", report)
+		}
+	})
+}
+
+func TestWalletService_OwnConversionsAreFreeAndUnlimited(t *testing.T) {
+	db := setupLedgerTestDB(t, "own_conversions")
+	walletRepo := repository.NewWalletRepository(db)
+
+	walletService := newTestWalletService(db, WalletOptions{
+		Limits: Limits{Daily: money.FromMajor(100), HourlyCount: 2},
+		Fees:   FeePolicy{Flat: money.FromMajor(1)},
+	})
+
+	carol := createTestUser(t, db, "carol-convert@example.com")
+	dave := createTestUser(t, db, "dave-convert@example.com")
+	walletService.OpenWallet(carol.ID, "JPY")
+	walletService.OpenWallet(dave.ID, "JPY")
+	if _, err := walletService.SetRate("USD", "JPY", money.MustParseRate("150"), 0); err != nil {
+		t.Fatalf("failed to set rate: %v", err)
+	}
+
+	convert := func(amount money.Amount, recipientEmail string) (*TransferResult, error) {
+		quote, err := walletService.QuoteConversion(carol.ID, "USD", "JPY", amount)
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		return walletService.Convert(carol.ID, quote.PublicID, recipientEmail, "", "")
+	}
+
+	// Over the daily limit, but into carol's own wallet
+	result, err := convert(money.FromMajor(200), "")
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if result.Transfer.Fee != 0 {
+		t.Errorf("expected no fee, got %s", result.Transfer.Fee)
+	}
+	carolUSD, _ := walletRepo.FindByUserID(carol.ID)
+	if carolUSD.Balance != money.FromMajor(800) {
+		t.Errorf("expected 800 USD left, got %s", carolUSD.Balance)
+	}
+	status, err := walletService.GetLimits(carol.ID)
+	if err != nil {
+		t.Fatalf("failed to get limits: %v", err)
+	}
+	if *status.DailyRemaining != money.FromMajor(100) || *status.HourlyRemaining != 2 {
+		t.Errorf("expected the conversion not to count, got %+v", status)
+	}
+
+	// Into someone else's wallet it is charged and limited like any transfer
+	result, err = convert(money.FromMajor(60), dave.Email)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if result.Transfer.Fee != money.FromMajor(1) {
+		t.Errorf("expected a fee of 1, got %s", result.Transfer.Fee)
+	}
+	_, err = convert(money.FromMajor(60), dave.Email)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitDaily {
+		t.Errorf("expected the daily limit, got %v", err)
+	}
+}
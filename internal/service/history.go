@@ -0,0 +1,167 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+// TransactionQuery selects a page of a wallet's history. Zero values mean
+// "no filter"; Counterparty is the email of the other party. Currency picks
+// the wallet and defaults to the primary one.
+type TransactionQuery struct {
+	Currency     string
+	Type         models.TransactionType
+	From         *time.Time
+	To           *time.Time
+	MinAmount    *money.Amount
+	MaxAmount    *money.Amount
+	Counterparty string
+	Notes        string
+	Cursor       string
+	Limit        int
+}
+
+// TransactionPage is one page of history, newest first. NextCursor fetches
+// the following (older) page and is empty when HasMore is false.
+type TransactionPage struct {
+	Transactions []models.Transaction `json:"transactions"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+	HasMore      bool                 `json:"has_more"`
+}
+
+func (s *walletService) ListTransactions(userID uint, query TransactionQuery) (*TransactionPage, error) {
+	wallet, err := s.findWallet(userID, query.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return s.listTransactions(wallet.ID, query)
+}
+
+func (s *walletService) listTransactions(walletID uint, query TransactionQuery) (*TransactionPage, error) {
+	filter, err := s.transactionFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	page := &TransactionPage{Transactions: []models.Transaction{}}
+	if filter == nil {
+		// The counterparty does not exist, so nothing can match
+		return page, nil
+	}
+
+	var after *repository.TransactionCursor
+	if query.Cursor != "" {
+		after, err = decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	transactions, err := s.transactionRepo.FindPage(walletID, *filter, after, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error finding transactions: %w", err)
+	}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(repository.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	page.Transactions = append(page.Transactions, transactions...)
+
+	return page, nil
+}
+
+// transactionFilter validates query and resolves its counterparty. It returns
+// nil without an error when the counterparty is unknown.
+func (s *walletService) transactionFilter(query TransactionQuery) (*repository.TransactionFilter, error) {
+	switch query.Type {
+	case "", models.TransactionTypeDebit, models.TransactionTypeCredit:
+	default:
+		return nil, fmt.Errorf("%w: type must be debit or credit", ErrInvalidFilter)
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+	if query.MinAmount != nil && query.MaxAmount != nil && *query.MinAmount > *query.MaxAmount {
+		return nil, fmt.Errorf("%w: min_amount must not exceed max_amount", ErrInvalidFilter)
+	}
+
+	filter := &repository.TransactionFilter{
+		Type:      query.Type,
+		From:      query.From,
+		To:        query.To,
+		MinAmount: query.MinAmount,
+		MaxAmount: query.MaxAmount,
+		Notes:     query.Notes,
+	}
+
+	if query.Counterparty != "" {
+		counterparty, err := s.userRepo.FindByEmail(query.Counterparty)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("error finding counterparty: %w", err)
+		}
+		filter.RelatedUserID = &counterparty.ID
+	}
+
+	return filter, nil
+}
+
+// encodeCursor makes an opaque cursor from the position of a transaction
+func encodeCursor(c repository.TransactionCursor) string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*repository.TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	transactionID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &repository.TransactionCursor{
+		CreatedAt: time.Unix(0, unixNano).UTC(),
+		ID:        uint(transactionID),
+	}, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_ListTransactions(t *testing.T) {
+	db := setupLedgerTestDB(t, "history")
+
+	walletService := newTestWalletService(db)
+
+	user := createTestUser(t, db, "history@example.com")
+	alice := createTestUser(t, db, "history-alice@example.com")
+	bob := createTestUser(t, db, "history-bob@example.com")
+
+	// Five debits to alice and bob, then one credit from bob
+	for i, amount := range []string{"10.00", "20.00", "30.00", "40.00", "50.00"} {
+		recipient := alice
+		if i%2 == 1 {
+			recipient = bob
+		}
+		notes := "Coffee"
+		if i == 4 {
+			notes = "Dinner 100%"
+		}
+		if _, err := walletService.Transfer(user.ID, recipient.Email, money.MustParse(amount), "", notes, ""); err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+	}
+	if _, err := walletService.Transfer(bob.ID, user.Email, money.MustParse("5.00"), "", "Refund coffee", ""); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	t.Run("pages are stable and complete", func(t *testing.T) {
+		var seen []models.Transaction
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("expected paging to end after 3 pages")
+			}
+			page, err := walletService.ListTransactions(user.ID, TransactionQuery{Limit: 2, Cursor: cursor})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			seen = append(seen, page.Transactions...)
+			if !page.HasMore {
+				if page.NextCursor != "" {
+					t.Error("expected no cursor on the last page")
+				}
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		if len(seen) != 6 {
+			t.Fatalf("expected 6 transactions, got %d", len(seen))
+		}
+		for i := 1; i < len(seen); i++ {
+			prev, cur := seen[i-1], seen[i]
+			if cur.CreatedAt.After(prev.CreatedAt) || (cur.CreatedAt.Equal(prev.CreatedAt) && cur.ID >= prev.ID) {
+				t.Errorf("expected newest first, got %d before %d", prev.ID, cur.ID)
+			}
+		}
+		if seen[0].Type != models.TransactionTypeCredit {
+			t.Errorf("expected the latest transaction first, got %+v", seen[0])
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		min, max := money.MustParse("20.00"), money.MustParse("40.00")
+		future := time.Now().Add(time.Hour)
+		past := time.Now().Add(-time.Hour)
+
+		tests := []struct {
+			name  string
+			query TransactionQuery
+			want  int
+		}{
+			{"type", TransactionQuery{Type: models.TransactionTypeCredit}, 1},
+			{"counterparty", TransactionQuery{Counterparty: bob.Email}, 3},
+			{"unknown counterparty", TransactionQuery{Counterparty: "nobody@example.com"}, 0},
+			{"notes substring is case-insensitive", TransactionQuery{Notes: "COFFEE"}, 5},
+			{"notes wildcards are literal", TransactionQuery{Notes: "100%"}, 1},
+			{"amount range", TransactionQuery{MinAmount: &min, MaxAmount: &max}, 3},
+			{"date range", TransactionQuery{From: &past, To: &future}, 6},
+			{"future dates", TransactionQuery{From: &future}, 0},
+			{"combined", TransactionQuery{Type: models.TransactionTypeDebit, Counterparty: bob.Email}, 2},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := walletService.ListTransactions(user.ID, tt.query)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if len(page.Transactions) != tt.want {
+					t.Errorf("expected %d transactions, got %d", tt.want, len(page.Transactions))
+				}
+			})
+		}
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		min, max := money.MustParse("40.00"), money.MustParse("20.00")
+
+		_, err := walletService.ListTransactions(user.ID, TransactionQuery{Cursor: "not a cursor"})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+		_, err = walletService.ListTransactions(user.ID, TransactionQuery{Type: "refund"})
+		if !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected ErrInvalidFilter for type, got %v", err)
+		}
+		_, err = walletService.ListTransactions(user.ID, TransactionQuery{MinAmount: &min, MaxAmount: &max})
+		if !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected ErrInvalidFilter for amount range, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+const holdExpiryBatchSize = 100
+
+var (
+	ErrHoldNotFound       = errors.New("hold not found")
+	ErrHoldNotActive      = errors.New("hold is no longer authorized")
+	ErrHoldExpired        = errors.New("hold has expired")
+	ErrCaptureExceedsHold = errors.New("capture exceeds the held amount")
+	ErrHoldNotAllowed     = errors.New("only the recipient of a hold can capture or void it")
+)
+
+// HoldResult wraps the hold created by WalletService.AuthorizeHold.
+// Replayed is set when the hold was returned for a repeated idempotency key.
+type HoldResult struct {
+	Hold     *models.Hold
+	Replayed bool
+}
+
+// AuthorizeHold reserves amount of the available balance of the user's wallet
+// in currency, or their primary wallet when it is empty, for the recipient. No
+// money moves until the recipient captures the hold.
+func (s *walletService) AuthorizeHold(userID uint, recipientEmail string, amount money.Amount, currency string, notes string, idempotencyKey string) (*HoldResult, error) {
+	var replay models.Hold
+	record, replayed, err := s.idempotency.begin(
+		userID,
+		idempotencyKey,
+		fingerprint("hold", userID, strings.ToLower(recipientEmail), amount, strings.ToUpper(currency), notes),
+		&replay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &HoldResult{Hold: &replay, Replayed: true}, nil
+	}
+
+	hold, err := s.authorizeHold(userID, recipientEmail, amount, currency, notes, record)
+	if err != nil {
+		s.idempotency.release(record)
+		return nil, err
+	}
+	return &HoldResult{Hold: hold}, nil
+}
+
+func (s *walletService) authorizeHold(userID uint, recipientEmail string, amount money.Amount, currency string, notes string, record *models.IdempotencyRecord) (*models.Hold, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	recipient, err := s.userRepo.FindByEmail(recipientEmail)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecipientNotFound
+		}
+		return nil, fmt.Errorf("error finding recipient: %w", err)
+	}
+	if recipient.ID == userID {
+		return nil, ErrSelfTransfer
+	}
+
+	wallet, err := s.findWallet(userID, currency)
+	if err != nil {
+		return nil, err
+	}
+	recipientWallet, err := s.recipientWallet(recipient.ID, wallet.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAmount(wallet, amount); err != nil {
+		return nil, err
+	}
+
+	var hold *models.Hold
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			locked, err := s.walletRepo.FindByIDForUpdate(tx, wallet.ID)
+			if err != nil {
+				return fmt.Errorf("error locking wallet %d: %w", wallet.ID, err)
+			}
+			if locked.AvailableBalance() < amount {
+				return ErrInsufficientBalance
+			}
+			// Limits apply when the hold is authorized, not when it is captured
+			if err := s.lockSender(tx, userID); err != nil {
+				return err
+			}
+			if err := s.checkLimits(tx, userID, wallet.Currency, amount); err != nil {
+				return err
+			}
+
+			hold = &models.Hold{
+				PublicID:          uuid.NewString(),
+				WalletID:          wallet.ID,
+				RecipientWalletID: recipientWallet.ID,
+				Amount:            amount,
+				Notes:             notes,
+				Status:            models.HoldStatusAuthorized,
+				ExpiresAt:         time.Now().Add(s.holdTTL),
+			}
+			if err := s.holdRepo.Create(tx, hold); err != nil {
+				return fmt.Errorf("error creating hold: %w", err)
+			}
+			if err := s.walletRepo.AdjustHeld(tx, wallet.ID, amount); err != nil {
+				return fmt.Errorf("error updating held amount: %w", err)
+			}
+
+			return s.idempotency.complete(tx, record, hold)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// CaptureHold turns an authorized hold into a transfer to its recipient. A
+// nil amount captures the whole hold; a smaller amount releases the rest.
+func (s *walletService) CaptureHold(userID uint, holdID string, amount *money.Amount, idempotencyKey string) (*TransferResult, error) {
+	var captured money.Amount
+	if amount != nil {
+		captured = *amount
+	}
+
+	var replay models.Transfer
+	record, replayed, err := s.idempotency.begin(
+		userID,
+		idempotencyKey,
+		fingerprint("capture", userID, holdID, amount != nil, captured),
+		&replay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &TransferResult{Transfer: &replay, Replayed: true}, nil
+	}
+
+	transfer, err := s.captureHold(userID, holdID, amount, record)
+	if err != nil {
+		s.idempotency.release(record)
+		return nil, err
+	}
+	return &TransferResult{Transfer: transfer}, nil
+}
+
+func (s *walletService) captureHold(userID uint, holdID string, amount *money.Amount, record *models.IdempotencyRecord) (*models.Transfer, error) {
+	if amount != nil && *amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	hold, payerWallet, err := s.findHoldForRecipient(userID, holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := transferParams{
+		senderWalletID:    hold.WalletID,
+		recipientWalletID: hold.RecipientWalletID,
+		senderID:          payerWallet.UserID,
+		recipientID:       userID,
+		notes:             hold.Notes,
+		kind:              models.TransferKindTransfer,
+		entryKind:         models.JournalEntryKindTransfer,
+	}
+	params.ledgerKey = s.idempotency.ledgerKey("capture", record)
+
+	var transfer *models.Transfer
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			wallets, err := s.lockWallets(tx, params.senderWalletID, params.recipientWalletID)
+			if err != nil {
+				return err
+			}
+			locked, err := s.lockActiveHold(tx, holdID)
+			if err != nil {
+				return err
+			}
+
+			p := params
+			p.amount = locked.Amount
+			if amount != nil {
+				p.amount = *amount
+			}
+			if p.amount > locked.Amount {
+				return ErrCaptureExceedsHold
+			}
+
+			// Release the whole hold, then move the captured part like any transfer
+			payer := wallets[p.senderWalletID]
+			if err := s.walletRepo.AdjustHeld(tx, payer.ID, -locked.Amount); err != nil {
+				return fmt.Errorf("error updating held amount: %w", err)
+			}
+			payer.HeldAmount -= locked.Amount
+
+			transfer, err = s.recordTransfer(tx, payer, wallets[p.recipientWalletID], p)
+			if err != nil {
+				return err
+			}
+
+			locked.Status = models.HoldStatusCaptured
+			locked.CapturedAmount = p.amount
+			locked.TransferID = &transfer.PublicID
+			if err := s.holdRepo.Update(tx, locked); err != nil {
+				return fmt.Errorf("error updating hold: %w", err)
+			}
+
+			return s.idempotency.complete(tx, record, transfer)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// VoidHold releases an authorized hold without moving money
+func (s *walletService) VoidHold(userID uint, holdID string) (*models.Hold, error) {
+	hold, _, err := s.findHoldForRecipient(userID, holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	var voided *models.Hold
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			voided, err = s.releaseHold(tx, hold.WalletID, holdID, models.HoldStatusVoided, time.Now())
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return voided, nil
+}
+
+// GetHold returns a hold to its payer or recipient
+func (s *walletService) GetHold(userID uint, holdID string) (*models.Hold, error) {
+	hold, payerWallet, recipientWallet, err := s.findHold(holdID)
+	if err != nil {
+		return nil, err
+	}
+	if payerWallet.UserID != userID && recipientWallet.UserID != userID {
+		return nil, ErrHoldNotFound
+	}
+
+	return hold, nil
+}
+
+// ExpireHolds releases every authorized hold whose expiry is at or before now
+// and returns how many were expired
+func (s *walletService) ExpireHolds(now time.Time) (int, error) {
+	expired := 0
+	for {
+		holds, err := s.holdRepo.FindExpired(now, holdExpiryBatchSize)
+		if err != nil {
+			return expired, fmt.Errorf("error finding expired holds: %w", err)
+		}
+
+		for _, hold := range holds {
+			err := withRetry(func() error {
+				return s.db.Transaction(func(tx *gorm.DB) error {
+					_, err := s.releaseHold(tx, hold.WalletID, hold.PublicID, models.HoldStatusExpired, now)
+					return err
+				})
+			})
+			// Captured or voided since it was listed; nothing to do
+			if errors.Is(err, ErrHoldNotActive) {
+				continue
+			}
+			if err != nil {
+				return expired, fmt.Errorf("error expiring hold %s: %w", hold.PublicID, err)
+			}
+			expired++
+		}
+
+		if len(holds) < holdExpiryBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// findHold loads a hold with the wallets it is paid from and to. The hold's
+// own wallets decide who may see it, whichever currency they are in.
+func (s *walletService) findHold(holdID string) (*models.Hold, *models.Wallet, *models.Wallet, error) {
+	hold, err := s.holdRepo.FindByPublicID(holdID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil, ErrHoldNotFound
+		}
+		return nil, nil, nil, fmt.Errorf("error finding hold: %w", err)
+	}
+
+	payerWallet, err := s.walletRepo.FindByID(hold.WalletID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error finding payer wallet: %w", err)
+	}
+	recipientWallet, err := s.walletRepo.FindByID(hold.RecipientWalletID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error finding recipient wallet: %w", err)
+	}
+
+	return hold, payerWallet, recipientWallet, nil
+}
+
+// findHoldForRecipient loads a hold the user may capture or void, and the
+// wallet it is paid from
+func (s *walletService) findHoldForRecipient(userID uint, holdID string) (*models.Hold, *models.Wallet, error) {
+	hold, payerWallet, recipientWallet, err := s.findHold(holdID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if recipientWallet.UserID != userID {
+		if payerWallet.UserID == userID {
+			return nil, nil, ErrHoldNotAllowed
+		}
+		return nil, nil, ErrHoldNotFound
+	}
+
+	return hold, payerWallet, nil
+}
+
+// lockActiveHold locks a hold that must still be authorized and unexpired.
+// Callers lock the hold's wallets first.
+func (s *walletService) lockActiveHold(tx *gorm.DB, holdID string) (*models.Hold, error) {
+	hold, err := s.holdRepo.FindByPublicIDForUpdate(tx, holdID)
+	if err != nil {
+		return nil, fmt.Errorf("error locking hold: %w", err)
+	}
+	if hold.Status != models.HoldStatusAuthorized {
+		return nil, ErrHoldNotActive
+	}
+	if !time.Now().Before(hold.ExpiresAt) {
+		return nil, ErrHoldExpired
+	}
+	return hold, nil
+}
+
+// releaseHold ends an authorized hold with the given status and gives its
+// amount back to the wallet's available balance
+func (s *walletService) releaseHold(tx *gorm.DB, walletID uint, holdID string, status models.HoldStatus, now time.Time) (*models.Hold, error) {
+	if _, err := s.walletRepo.FindByIDForUpdate(tx, walletID); err != nil {
+		return nil, fmt.Errorf("error locking wallet %d: %w", walletID, err)
+	}
+	hold, err := s.holdRepo.FindByPublicIDForUpdate(tx, holdID)
+	if err != nil {
+		return nil, fmt.Errorf("error locking hold: %w", err)
+	}
+	if hold.Status != models.HoldStatusAuthorized {
+		return nil, ErrHoldNotActive
+	}
+	if status == models.HoldStatusExpired && now.Before(hold.ExpiresAt) {
+		return nil, ErrHoldNotActive
+	}
+
+	if err := s.walletRepo.AdjustHeld(tx, walletID, -hold.Amount); err != nil {
+		return nil, fmt.Errorf("error updating held amount: %w", err)
+	}
+	hold.Status = status
+	if err := s.holdRepo.Update(tx, hold); err != nil {
+		return nil, fmt.Errorf("error updating hold: %w", err)
+	}
+	return hold, nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_Holds(t *testing.T) {
+	db := setupLedgerTestDB(t, "holds")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	walletService := newTestWalletService(db)
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	buyer := createTestUser(t, db, "hold-buyer@example.com")
+	merchant := createTestUser(t, db, "hold-merchant@example.com")
+	stranger := createTestUser(t, db, "hold-stranger@example.com")
+
+	amountOf := func(s string) *money.Amount {
+		amount := money.MustParse(s)
+		return &amount
+	}
+	walletOf := func(user *models.User) *models.Wallet {
+		wallet, err := walletRepo.FindByUserID(user.ID)
+		if err != nil {
+			t.Fatalf("failed to find wallet: %v", err)
+		}
+		return wallet
+	}
+
+	t.Run("authorize reduces the available balance only", func(t *testing.T) {
+		result, err := walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(600), "", "Order #1", "hold-key-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Hold.Status != models.HoldStatusAuthorized {
+			t.Errorf("expected authorized hold, got %s", result.Hold.Status)
+		}
+
+		wallet := walletOf(buyer)
+		if wallet.Balance != money.FromMajor(1000) || wallet.AvailableBalance() != money.FromMajor(400) {
+			t.Errorf("expected balance 1000 and available 400, got %s and %s", wallet.Balance, wallet.AvailableBalance())
+		}
+
+		data, _ := json.Marshal(wallet)
+		if !strings.Contains(string(data), `"available_balance":400.00`) {
+			t.Errorf("expected available_balance in wallet JSON, got %s", data)
+		}
+
+		replay, err := walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(600), "", "Order #1", "hold-key-1")
+		if err != nil || !replay.Replayed || replay.Hold.PublicID != result.Hold.PublicID {
+			t.Errorf("expected replayed hold, got %+v, %v", replay, err)
+		}
+	})
+
+	t.Run("held funds cannot be spent", func(t *testing.T) {
+		_, err := walletService.Transfer(buyer.ID, stranger.Email, money.FromMajor(500), "", "", "")
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+		_, err = walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(500), "", "Order #2", "")
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+	})
+
+	t.Run("partial capture by the recipient", func(t *testing.T) {
+		hold, _ := walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(100), "", "Order #3", "")
+		holdID := hold.Hold.PublicID
+
+		_, err := walletService.CaptureHold(buyer.ID, holdID, nil, "")
+		if !errors.Is(err, ErrHoldNotAllowed) {
+			t.Errorf("expected ErrHoldNotAllowed, got %v", err)
+		}
+		_, err = walletService.CaptureHold(stranger.ID, holdID, nil, "")
+		if !errors.Is(err, ErrHoldNotFound) {
+			t.Errorf("expected ErrHoldNotFound, got %v", err)
+		}
+		_, err = walletService.CaptureHold(merchant.ID, holdID, amountOf("100.01"), "")
+		if !errors.Is(err, ErrCaptureExceedsHold) {
+			t.Errorf("expected ErrCaptureExceedsHold, got %v", err)
+		}
+
+		result, err := walletService.CaptureHold(merchant.ID, holdID, amountOf("75.25"), "capture-key")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Transfer.Amount != money.MustParse("75.25") || result.Transfer.SenderWalletID != walletOf(buyer).ID {
+			t.Errorf("unexpected capture transfer: %+v", result.Transfer)
+		}
+
+		captured, _ := walletService.GetHold(buyer.ID, holdID)
+		if captured.Status != models.HoldStatusCaptured || captured.CapturedAmount != money.MustParse("75.25") ||
+			captured.TransferID == nil || *captured.TransferID != result.Transfer.PublicID {
+			t.Errorf("expected captured hold linked to its transfer, got %+v", captured)
+		}
+
+		// Only the first hold of 600 remains
+		wallet := walletOf(buyer)
+		if wallet.Balance != money.MustParse("924.75") || wallet.HeldAmount != money.FromMajor(600) {
+			t.Errorf("expected balance 924.75 with 600 held, got %s with %s held", wallet.Balance, wallet.HeldAmount)
+		}
+		if walletOf(merchant).Balance != money.MustParse("1075.25") {
+			t.Errorf("expected merchant balance 1075.25, got %s", walletOf(merchant).Balance)
+		}
+
+		_, err = walletService.CaptureHold(merchant.ID, holdID, nil, "")
+		if !errors.Is(err, ErrHoldNotActive) {
+			t.Errorf("expected ErrHoldNotActive, got %v", err)
+		}
+	})
+
+	t.Run("void releases the hold", func(t *testing.T) {
+		hold, _ := walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(50), "", "Order #4", "")
+
+		voided, err := walletService.VoidHold(merchant.ID, hold.Hold.PublicID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if voided.Status != models.HoldStatusVoided {
+			t.Errorf("expected voided hold, got %s", voided.Status)
+		}
+		if walletOf(buyer).HeldAmount != money.FromMajor(600) {
+			t.Errorf("expected 600 held after void, got %s", walletOf(buyer).HeldAmount)
+		}
+
+		_, err = walletService.VoidHold(merchant.ID, hold.Hold.PublicID)
+		if !errors.Is(err, ErrHoldNotActive) {
+			t.Errorf("expected ErrHoldNotActive, got %v", err)
+		}
+	})
+
+	t.Run("stale holds expire", func(t *testing.T) {
+		var hold models.Hold
+		db.Where("notes = ?", "Order #1").First(&hold)
+		db.Model(&hold).Update("expires_at", time.Now().Add(-time.Minute))
+
+		_, err := walletService.CaptureHold(merchant.ID, hold.PublicID, nil, "")
+		if !errors.Is(err, ErrHoldExpired) {
+			t.Errorf("expected ErrHoldExpired, got %v", err)
+		}
+
+		expired, err := walletService.ExpireHolds(time.Now())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expired != 1 {
+			t.Errorf("expected 1 expired hold, got %d", expired)
+		}
+
+		expiredHold, _ := walletService.GetHold(buyer.ID, hold.PublicID)
+		if expiredHold.Status != models.HoldStatusExpired {
+			t.Errorf("expected expired hold, got %s", expiredHold.Status)
+		}
+		wallet := walletOf(buyer)
+		if wallet.HeldAmount != 0 || wallet.AvailableBalance() != wallet.Balance {
+			t.Errorf("expected nothing held, got %s", wallet.HeldAmount)
+		}
+	})
+
+	t.Run("holds in another currency", func(t *testing.T) {
+		buyerEUR, err := walletService.OpenWallet(buyer.ID, "EUR")
+		if err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+		fundWallet(t, db, buyerEUR, money.FromMajor(100))
+
+		_, err = walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(40), "eur", "Order #5", "")
+		if !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("expected ErrCurrencyMismatch, got %v", err)
+		}
+		merchantEUR, err := walletService.OpenWallet(merchant.ID, "EUR")
+		if err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+
+		primaryHeld := walletOf(buyer).HeldAmount
+		result, err := walletService.AuthorizeHold(buyer.ID, merchant.Email, money.FromMajor(40), "eur", "Order #5", "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		holdID := result.Hold.PublicID
+		if result.Hold.WalletID != buyerEUR.ID || result.Hold.RecipientWalletID != merchantEUR.ID {
+			t.Errorf("expected a hold between the EUR wallets, got %+v", result.Hold)
+		}
+		held, _ := walletRepo.FindByID(buyerEUR.ID)
+		if held.HeldAmount != money.FromMajor(40) || walletOf(buyer).HeldAmount != primaryHeld {
+			t.Errorf("expected 40 held in EUR only, got %s", held.HeldAmount)
+		}
+
+		// Both parties see the hold even though it is not in their primary wallets
+		if _, err := walletService.GetHold(buyer.ID, holdID); err != nil {
+			t.Errorf("expected the payer to see the hold, got %v", err)
+		}
+		if _, err := walletService.GetHold(merchant.ID, holdID); err != nil {
+			t.Errorf("expected the recipient to see the hold, got %v", err)
+		}
+		if _, err := walletService.GetHold(stranger.ID, holdID); !errors.Is(err, ErrHoldNotFound) {
+			t.Errorf("expected ErrHoldNotFound, got %v", err)
+		}
+
+		if _, err := walletService.CaptureHold(merchant.ID, holdID, nil, ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		captured, _ := walletRepo.FindByID(buyerEUR.ID)
+		if captured.Balance != money.FromMajor(60) || captured.HeldAmount != 0 {
+			t.Errorf("expected 60 EUR with nothing held, got %s with %s held", captured.Balance, captured.HeldAmount)
+		}
+		if received, _ := walletRepo.FindByID(merchantEUR.ID); received.Balance != money.FromMajor(40) {
+			t.Errorf("expected the merchant to receive 40 EUR, got %s", received.Balance)
+		}
+	})
+
+	t.Run("invariant holds", func(t *testing.T) {
+		if err := ledgerService.CheckInvariant(); err != nil {
+			t.Errorf("expected balanced ledger, got %v", err)
+		}
+	})
+}
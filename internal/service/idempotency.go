@@ -0,0 +1,161 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is already being processed")
+)
+
+// idempotencyLease is how long a key stays reserved for an operation that has
+// not completed. A reservation left behind by a crash blocks retries only this
+// long, not for the whole TTL.
+const idempotencyLease = time.Minute
+
+// idempotencyStore makes an operation run at most once per user and key.
+// A key is reserved before the operation starts, completed with the serialized
+// response in the operation's own database transaction, and released again if
+// the operation fails so the client can retry. A completed key is remembered
+// for the TTL.
+type idempotencyStore struct {
+	repo repository.IdempotencyRepository
+	ttl  time.Duration
+}
+
+func newIdempotencyStore(repo repository.IdempotencyRepository, ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{repo: repo, ttl: ttl}
+}
+
+// begin reserves key for userID. When the key was already completed with the
+// same fingerprint, the stored response is decoded into replay and the returned
+// record is nil. An empty key disables idempotency and returns a nil record.
+func (s *idempotencyStore) begin(userID uint, key, fingerprint string, replay interface{}) (record *models.IdempotencyRecord, replayed bool, err error) {
+	if key == "" {
+		return nil, false, nil
+	}
+
+	// Two passes at most: the second one runs after an expired record was removed
+	for i := 0; i < 2; i++ {
+		now := time.Now()
+		record = &models.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			Status:      models.IdempotencyStatusProcessing,
+			ExpiresAt:   now.Add(idempotencyLease),
+		}
+		created, err := s.repo.Reserve(record)
+		if err != nil {
+			return nil, false, fmt.Errorf("error reserving idempotency key: %w", err)
+		}
+		if created {
+			return record, false, nil
+		}
+
+		existing, err := s.repo.FindByUserAndKey(userID, key)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Released between our insert and lookup; try again
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("error checking idempotency: %w", err)
+		}
+
+		if !existing.ExpiresAt.After(now) {
+			if err := s.repo.DeleteExpiredByID(existing.ID, now); err != nil {
+				return nil, false, fmt.Errorf("error removing expired idempotency key: %w", err)
+			}
+			continue
+		}
+		if existing.Fingerprint != fingerprint {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		if existing.Status != models.IdempotencyStatusCompleted {
+			return nil, false, ErrIdempotencyInProgress
+		}
+
+		if err := json.Unmarshal([]byte(existing.Response), replay); err != nil {
+			return nil, false, fmt.Errorf("error decoding stored response: %w", err)
+		}
+		return nil, true, nil
+	}
+
+	return nil, false, ErrIdempotencyInProgress
+}
+
+// complete stores the response for record inside tx and keeps the key for the
+// TTL. If the lease ran out and another request took the key over, the
+// operation must not commit, so ErrIdempotencyInProgress is returned.
+func (s *idempotencyStore) complete(tx *gorm.DB, record *models.IdempotencyRecord, response interface{}) error {
+	if record == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("error encoding response: %w", err)
+	}
+	completed, err := s.repo.Complete(tx, record.ID, string(data), time.Now().Add(s.ttl))
+	if err != nil {
+		return fmt.Errorf("error completing idempotency key: %w", err)
+	}
+	if !completed {
+		return ErrIdempotencyInProgress
+	}
+	return nil
+}
+
+// ledgerKey is the value an operation writes to the unique idempotency_key
+// column of its ledger legs, e.g. "transfer:42". It comes from the record
+// rather than the client's key, so a key reused after its record expired gets
+// new ledger keys, and starts with the operation, so the keys of different
+// operations never look alike. It is empty without a record.
+func (s *idempotencyStore) ledgerKey(operation string, record *models.IdempotencyRecord) string {
+	if record == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", operation, record.ID)
+}
+
+// deleteExpired removes the records whose TTL or lease has passed
+func (s *idempotencyStore) deleteExpired(now time.Time) (int64, error) {
+	deleted, err := s.repo.DeleteExpired(now)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+	return deleted, nil
+}
+
+// release frees a reserved key after the operation failed
+func (s *idempotencyStore) release(record *models.IdempotencyRecord) {
+	if record == nil {
+		return
+	}
+	// Best effort: an unreleased key only blocks retries until it expires
+	_ = s.repo.Delete(record.ID)
+}
+
+// fingerprint hashes the fields that identify a request. Keys reused with any
+// different field produce a different fingerprint.
+func fingerprint(operation string, fields ...interface{}) string {
+	parts := make([]string, 0, len(fields)+1)
+	parts = append(parts, operation)
+	for _, field := range fields {
+		parts = append(parts, fmt.Sprint(field))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnbalancedEntry  = errors.New("journal entry postings do not sum to zero")
+	ErrLedgerImbalanced = errors.New("ledger is out of balance")
+)
+
+type LedgerService interface {
+	Adjust(walletID uint, amount money.Amount, description string) (*models.JournalEntry, error)
+	CheckInvariant() error
+}
+
+type ledgerService struct {
+	ledger          *ledger
+	ledgerRepo      repository.LedgerRepository
+	walletRepo      repository.WalletRepository
+	transactionRepo repository.TransactionRepository
+	db              *gorm.DB
+}
+
+func NewLedgerService(
+	ledgerRepo repository.LedgerRepository,
+	walletRepo repository.WalletRepository,
+	transactionRepo repository.TransactionRepository,
+	db *gorm.DB,
+) LedgerService {
+	return &ledgerService{
+		ledger:          newLedger(ledgerRepo, walletRepo),
+		ledgerRepo:      ledgerRepo,
+		walletRepo:      walletRepo,
+		transactionRepo: transactionRepo,
+		db:              db,
+	}
+}
+
+// Adjust corrects a wallet balance by amount (positive or negative). The
+// counterpart is the suspense account, so the books stay balanced.
+func (s *ledgerService) Adjust(walletID uint, amount money.Amount, description string) (*models.JournalEntry, error) {
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	var entry *models.JournalEntry
+	err := withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			wallet, err := s.walletRepo.FindByIDForUpdate(tx, walletID)
+			if err != nil {
+				return fmt.Errorf("error locking wallet %d: %w", walletID, err)
+			}
+			if wallet.Balance+amount < 0 {
+				return ErrInsufficientBalance
+			}
+
+			walletLine, err := s.ledger.walletLine(tx, walletID, amount)
+			if err != nil {
+				return err
+			}
+			suspenseLine, err := s.ledger.systemLine(tx, models.AccountCodeSuspense, -amount)
+			if err != nil {
+				return err
+			}
+
+			entry, err = s.ledger.post(tx, models.JournalEntryKindAdjustment, nil, description, walletLine, suspenseLine)
+			if err != nil {
+				return err
+			}
+
+			balanceAfter := wallet.Balance + amount
+			statementLine := &models.Transaction{
+				WalletID:       walletID,
+				JournalEntryID: &entry.ID,
+				Amount:         amount,
+				BalanceAfter:   &balanceAfter,
+				Type:           models.TransactionTypeCredit,
+				Notes:          description,
+				IdempotencyKey: fmt.Sprintf("journal:%d", entry.ID),
+			}
+			if amount < 0 {
+				statementLine.Amount = -amount
+				statementLine.Type = models.TransactionTypeDebit
+			}
+			if err := s.transactionRepo.Create(tx, statementLine); err != nil {
+				return fmt.Errorf("error creating adjustment transaction: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// CheckInvariant verifies that every journal entry is balanced, that all
+// account balances sum to zero and that every cached wallet balance matches
+// its postings
+func (s *ledgerService) CheckInvariant() error {
+	total, err := s.ledgerRepo.SumAllPostings()
+	if err != nil {
+		return fmt.Errorf("error summing postings: %w", err)
+	}
+	if total != 0 {
+		return fmt.Errorf("%w: account balances sum to %s", ErrLedgerImbalanced, total)
+	}
+
+	unbalanced, err := s.ledgerRepo.FindUnbalancedEntryIDs()
+	if err != nil {
+		return fmt.Errorf("error checking journal entries: %w", err)
+	}
+	if len(unbalanced) > 0 {
+		return fmt.Errorf("%w: unbalanced journal entries %v", ErrLedgerImbalanced, unbalanced)
+	}
+
+	drift, err := s.ledgerRepo.FindWalletProjectionDrift()
+	if err != nil {
+		return fmt.Errorf("error checking wallet balances: %w", err)
+	}
+	if len(drift) > 0 {
+		d := drift[0]
+		return fmt.Errorf("%w: %d wallet balance(s) differ from the ledger, e.g. wallet %d has %s but postings sum to %s",
+			ErrLedgerImbalanced, len(drift), d.WalletID, d.Balance, d.LedgerBalance)
+	}
+
+	return nil
+}
+
+// ledger posts balanced journal entries and keeps the cached wallet balances
+// in sync with them. All methods run inside the caller's transaction; callers
+// must already hold the row locks of the wallets they post to.
+type ledger struct {
+	ledgerRepo repository.LedgerRepository
+	walletRepo repository.WalletRepository
+}
+
+func newLedger(ledgerRepo repository.LedgerRepository, walletRepo repository.WalletRepository) *ledger {
+	return &ledger{ledgerRepo: ledgerRepo, walletRepo: walletRepo}
+}
+
+// walletBalanceAt returns what a wallet held at the given time according to
+// its postings
+func (l *ledger) walletBalanceAt(tx *gorm.DB, walletID uint, at time.Time) (money.Amount, error) {
+	account, err := l.ledgerRepo.FindAccountByWalletID(tx, walletID)
+	if err != nil {
+		return 0, fmt.Errorf("error finding ledger account of wallet %d: %w", walletID, err)
+	}
+	balance, err := l.ledgerRepo.SumPostingsByAccountAt(account.ID, at)
+	if err != nil {
+		return 0, fmt.Errorf("error summing postings of wallet %d: %w", walletID, err)
+	}
+	return balance, nil
+}
+
+// ledgerLine is one side of a journal entry
+type ledgerLine struct {
+	accountID uint
+	walletID  *uint
+	amount    money.Amount
+}
+
+// openWallet creates the ledger account of a new wallet
+func (l *ledger) openWallet(tx *gorm.DB, wallet *models.Wallet) error {
+	account := &models.LedgerAccount{
+		Code:     models.WalletAccountCode(wallet.ID),
+		Kind:     models.AccountKindWallet,
+		WalletID: &wallet.ID,
+	}
+	if err := l.ledgerRepo.CreateAccount(tx, account); err != nil {
+		return fmt.Errorf("error creating ledger account: %w", err)
+	}
+	return nil
+}
+
+// openFXAccount creates the FX account of a currency unless it exists
+func (l *ledger) openFXAccount(tx *gorm.DB, currency string) error {
+	if err := l.ledgerRepo.EnsureSystemAccount(tx, models.FXAccountCode(currency)); err != nil {
+		return fmt.Errorf("error creating %s account: %w", models.FXAccountCode(currency), err)
+	}
+	return nil
+}
+
+func (l *ledger) walletLine(tx *gorm.DB, walletID uint, amount money.Amount) (ledgerLine, error) {
+	account, err := l.ledgerRepo.FindAccountByWalletID(tx, walletID)
+	if err != nil {
+		return ledgerLine{}, fmt.Errorf("error finding ledger account of wallet %d: %w", walletID, err)
+	}
+	return ledgerLine{accountID: account.ID, walletID: &walletID, amount: amount}, nil
+}
+
+func (l *ledger) systemLine(tx *gorm.DB, code string, amount money.Amount) (ledgerLine, error) {
+	account, err := l.ledgerRepo.FindAccountByCode(tx, code)
+	if err != nil {
+		return ledgerLine{}, fmt.Errorf("error finding %s account: %w", code, err)
+	}
+	return ledgerLine{accountID: account.ID, amount: amount}, nil
+}
+
+// post records a journal entry made of lines, which must sum to zero, and
+// applies the wallet lines to the cached wallet balances
+func (l *ledger) post(tx *gorm.DB, kind models.JournalEntryKind, transferID *uint, description string, lines ...ledgerLine) (*models.JournalEntry, error) {
+	var sum money.Amount
+	postings := make([]models.Posting, 0, len(lines))
+	for _, line := range lines {
+		if line.amount == 0 {
+			continue
+		}
+		sum += line.amount
+		postings = append(postings, models.Posting{AccountID: line.accountID, Amount: line.amount})
+	}
+	if sum != 0 || len(postings) < 2 {
+		return nil, ErrUnbalancedEntry
+	}
+
+	entry := &models.JournalEntry{
+		Kind:        kind,
+		TransferID:  transferID,
+		Description: description,
+		Postings:    postings,
+	}
+	if err := l.ledgerRepo.CreateEntry(tx, entry); err != nil {
+		return nil, fmt.Errorf("error creating journal entry: %w", err)
+	}
+
+	for _, line := range lines {
+		if line.walletID == nil || line.amount == 0 {
+			continue
+		}
+		if err := l.walletRepo.AdjustBalance(tx, *line.walletID, line.amount); err != nil {
+			return nil, fmt.Errorf("error updating wallet %d balance: %w", *line.walletID, err)
+		}
+	}
+
+	return entry, nil
+}
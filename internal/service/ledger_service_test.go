@@ -0,0 +1,291 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	customjwt "github.com/roychanmeliaz/btechdevcases/pkg/jwt"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupLedgerTestDB opens a private database so tests that break the ledger
+// on purpose do not affect the shared one
+func setupLedgerTestDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func TestLedgerService_WelcomeBonus(t *testing.T) {
+	db := setupLedgerTestDB(t, "ledger_welcome_bonus")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	jwtManager := customjwt.NewManager("test-secret", 24*time.Hour)
+
+	authService := NewAuthService(userRepo, walletRepo, transactionRepo, ledgerRepo, refreshTokenRepo, twoFactorRepo, jwtManager, db, time.Hour, "AuthWallet", time.Minute)
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	user, err := authService.Register("bonus@example.com", "password123", "password123")
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	wallet, _ := walletRepo.FindByUserID(user.ID)
+
+	t.Run("bonus is funded by the treasury", func(t *testing.T) {
+		treasury, err := ledgerRepo.FindAccountByCode(db, models.AccountCodeTreasury)
+		if err != nil {
+			t.Fatalf("failed to find treasury: %v", err)
+		}
+		treasuryBalance, _ := ledgerRepo.SumPostingsByAccount(db, treasury.ID)
+		if treasuryBalance != -InitialBalance {
+			t.Errorf("expected treasury balance %s, got %s", -InitialBalance, treasuryBalance)
+		}
+
+		account, err := ledgerRepo.FindAccountByWalletID(db, wallet.ID)
+		if err != nil {
+			t.Fatalf("failed to find wallet account: %v", err)
+		}
+		walletBalance, _ := ledgerRepo.SumPostingsByAccount(db, account.ID)
+		if walletBalance != wallet.Balance {
+			t.Errorf("expected wallet postings to sum to %s, got %s", wallet.Balance, walletBalance)
+		}
+	})
+
+	t.Run("bonus appears in the wallet history", func(t *testing.T) {
+		transactions, _ := transactionRepo.FindByWalletID(wallet.ID, 10)
+		if len(transactions) != 1 {
+			t.Fatalf("expected 1 transaction, got %d", len(transactions))
+		}
+		if transactions[0].Type != models.TransactionTypeCredit || transactions[0].Amount != InitialBalance {
+			t.Errorf("unexpected welcome bonus transaction: %+v", transactions[0])
+		}
+		if transactions[0].JournalEntryID == nil {
+			t.Error("expected welcome bonus transaction to reference its journal entry")
+		}
+	})
+
+	t.Run("invariant holds", func(t *testing.T) {
+		if err := ledgerService.CheckInvariant(); err != nil {
+			t.Errorf("expected balanced ledger, got %v", err)
+		}
+	})
+}
+
+func TestLedgerService_TransfersKeepLedgerBalanced(t *testing.T) {
+	db := setupLedgerTestDB(t, "ledger_transfers")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	walletService := newTestWalletService(db)
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	sender := createTestUser(t, db, "ledger-sender@example.com")
+	recipient := createTestUser(t, db, "ledger-recipient@example.com")
+
+	result, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("123.45"), "", "Ledger", "ledger-key")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	t.Run("transfer posts one balanced entry", func(t *testing.T) {
+		var entries []models.JournalEntry
+		db.Preload("Postings").Where("transfer_id = ?", result.Transfer.ID).Find(&entries)
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 journal entry, got %d", len(entries))
+		}
+		if len(entries[0].Postings) != 2 {
+			t.Fatalf("expected 2 postings, got %d", len(entries[0].Postings))
+		}
+		if entries[0].Postings[0].Amount+entries[0].Postings[1].Amount != 0 {
+			t.Errorf("expected postings to sum to zero, got %+v", entries[0].Postings)
+		}
+	})
+
+	t.Run("invariant holds", func(t *testing.T) {
+		if err := ledgerService.CheckInvariant(); err != nil {
+			t.Errorf("expected balanced ledger, got %v", err)
+		}
+	})
+}
+
+func TestLedgerService_Adjust(t *testing.T) {
+	db := setupLedgerTestDB(t, "ledger_adjust")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	user := createTestUser(t, db, "adjust@example.com")
+	wallet, _ := walletRepo.FindByUserID(user.ID)
+
+	t.Run("credit and debit adjustments", func(t *testing.T) {
+		if _, err := ledgerService.Adjust(wallet.ID, money.FromMajor(50), "Goodwill credit"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := ledgerService.Adjust(wallet.ID, -money.FromMajor(20), "Correction"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		wallet, _ = walletRepo.FindByUserID(user.ID)
+		if wallet.Balance != money.FromMajor(1030) {
+			t.Errorf("expected balance 1030, got %s", wallet.Balance)
+		}
+
+		suspense, _ := ledgerRepo.FindAccountByCode(db, models.AccountCodeSuspense)
+		suspenseBalance, _ := ledgerRepo.SumPostingsByAccount(db, suspense.ID)
+		if suspenseBalance != -money.FromMajor(30) {
+			t.Errorf("expected suspense balance -30, got %s", suspenseBalance)
+		}
+
+		transactions, _ := transactionRepo.FindByWalletID(wallet.ID, 10)
+		if len(transactions) != 2 {
+			t.Errorf("expected 2 adjustment transactions, got %d", len(transactions))
+		}
+	})
+
+	t.Run("cannot adjust below zero", func(t *testing.T) {
+		_, err := ledgerService.Adjust(wallet.ID, -money.FromMajor(5000), "Too much")
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+	})
+
+	t.Run("invariant holds", func(t *testing.T) {
+		if err := ledgerService.CheckInvariant(); err != nil {
+			t.Errorf("expected balanced ledger, got %v", err)
+		}
+	})
+}
+
+func TestLedgerService_CheckInvariantDetectsDrift(t *testing.T) {
+	db := setupLedgerTestDB(t, "ledger_drift")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	user := createTestUser(t, db, "drift@example.com")
+	wallet, _ := walletRepo.FindByUserID(user.ID)
+
+	// Change the cached balance behind the ledger's back
+	db.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Update("balance", money.FromMajor(5000))
+
+	err := ledgerService.CheckInvariant()
+	if !errors.Is(err, ErrLedgerImbalanced) {
+		t.Errorf("expected ErrLedgerImbalanced, got %v", err)
+	}
+}
+
+func TestLedger_RejectsUnbalancedEntries(t *testing.T) {
+	db := setupLedgerTestDB(t, "ledger_unbalanced")
+	walletRepo := repository.NewWalletRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	ledger := newLedger(ledgerRepo, walletRepo)
+
+	user := createTestUser(t, db, "unbalanced@example.com")
+	wallet, _ := walletRepo.FindByUserID(user.ID)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		walletLine, err := ledger.walletLine(tx, wallet.ID, money.FromMajor(10))
+		if err != nil {
+			return err
+		}
+		treasuryLine, err := ledger.systemLine(tx, models.AccountCodeTreasury, -money.FromMajor(9))
+		if err != nil {
+			return err
+		}
+		_, err = ledger.post(tx, models.JournalEntryKindAdjustment, nil, "Unbalanced", walletLine, treasuryLine)
+		return err
+	})
+	if !errors.Is(err, ErrUnbalancedEntry) {
+		t.Errorf("expected ErrUnbalancedEntry, got %v", err)
+	}
+}
+
+func TestLedger_LegacyDataMigratesBalanced(t *testing.T) {
+	db := setupLedgerTestDB(t, "ledger_legacy")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	// Data as written before the ledger existed: minted balances and a transfer
+	// whose legs are only linked by the "-credit" key suffix
+	alice := &models.User{Email: "legacy-alice@example.com", Password: "x"}
+	bob := &models.User{Email: "legacy-bob@example.com", Password: "x"}
+	db.Create(alice)
+	db.Create(bob)
+	aliceWallet := &models.Wallet{UserID: alice.ID, Balance: money.FromMajor(900)}
+	bobWallet := &models.Wallet{UserID: bob.ID, Balance: money.FromMajor(1100)}
+	db.Create(aliceWallet)
+	db.Create(bobWallet)
+	db.Create(&models.Transaction{WalletID: aliceWallet.ID, Amount: money.FromMajor(100), Type: models.TransactionTypeDebit, IdempotencyKey: "legacy"})
+	db.Create(&models.Transaction{WalletID: bobWallet.ID, Amount: money.FromMajor(100), Type: models.TransactionTypeCredit, IdempotencyKey: "legacy-credit"})
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	t.Run("legacy transfer is linked and posted", func(t *testing.T) {
+		var legs []models.Transaction
+		db.Where("wallet_id IN ?", []uint{aliceWallet.ID, bobWallet.ID}).Find(&legs)
+		for _, leg := range legs {
+			if leg.TransferID == nil || leg.JournalEntryID == nil {
+				t.Errorf("expected leg %d to be linked to a transfer and journal entry", leg.ID)
+			}
+		}
+	})
+
+	t.Run("legacy legs get a running balance", func(t *testing.T) {
+		want := map[uint]money.Amount{aliceWallet.ID: money.FromMajor(900), bobWallet.ID: money.FromMajor(1100)}
+		var legs []models.Transaction
+		db.Where("wallet_id IN ?", []uint{aliceWallet.ID, bobWallet.ID}).Find(&legs)
+		for _, leg := range legs {
+			if leg.BalanceAfter == nil || *leg.BalanceAfter != want[leg.WalletID] {
+				t.Errorf("expected leg %d balance_after %s, got %v", leg.ID, want[leg.WalletID], leg.BalanceAfter)
+			}
+		}
+	})
+
+	t.Run("opening balances explain the rest", func(t *testing.T) {
+		var openings []models.JournalEntry
+		db.Preload("Postings").Where("kind = ?", models.JournalEntryKindOpeningBalance).Find(&openings)
+		if len(openings) != 2 {
+			t.Fatalf("expected 2 opening balance entries, got %d", len(openings))
+		}
+		for _, entry := range openings {
+			for _, posting := range entry.Postings {
+				if posting.Amount > 0 && posting.Amount != money.FromMajor(1000) {
+					t.Errorf("expected opening balance 1000, got %s", posting.Amount)
+				}
+			}
+		}
+	})
+
+	t.Run("invariant holds", func(t *testing.T) {
+		if err := ledgerService.CheckInvariant(); err != nil {
+			t.Errorf("expected balanced ledger, got %v", err)
+		}
+	})
+}
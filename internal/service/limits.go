@@ -0,0 +1,263 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLimitExceeded = errors.New("transfer limit exceeded")
+	ErrLimitUnvalued = errors.New("transfer limits cannot be checked in this currency")
+	ErrInvalidLimit  = errors.New("limits cannot be negative")
+	ErrUserNotFound  = errors.New("user not found")
+)
+
+// Names of the limits reported by LimitError
+const (
+	LimitPerTransaction = "per_transaction"
+	LimitDaily          = "daily"
+	LimitMonthly        = "monthly"
+	LimitHourlyCount    = "hourly_count"
+)
+
+// baseCurrency is the currency limits and fees are set in. Amounts in other
+// currencies are valued in it at the mid-market rate.
+const baseCurrency = models.DefaultCurrency
+
+// Limits caps what a user can send from all of their wallets together, in
+// the base currency. A zero field means no limit.
+type Limits struct {
+	PerTransaction money.Amount `json:"per_transaction"`
+	Daily          money.Amount `json:"daily"`
+	Monthly        money.Amount `json:"monthly"`
+	HourlyCount    int          `json:"hourly_count"`
+}
+
+// LimitStatus is a user's effective limits with what is left of each, in
+// Currency. The remaining field of a disabled limit is nil. Unvalued lists the
+// currencies sent in that have no rate to Currency; what was sent in them is
+// left out of the remaining amounts.
+type LimitStatus struct {
+	Currency string `json:"currency"`
+	Limits
+	DailyRemaining   *money.Amount `json:"daily_remaining"`
+	MonthlyRemaining *money.Amount `json:"monthly_remaining"`
+	HourlyRemaining  *int          `json:"hourly_remaining"`
+	Unvalued         []string      `json:"unvalued_currencies,omitempty"`
+}
+
+// LimitError rejects a transfer that would exceed one of the sender's limits.
+// Remaining is what the sender can still send under that limit, in Currency;
+// it is not set for the hourly count, which has no transfers left. ResetsAt is
+// when a daily or monthly allowance starts over.
+type LimitError struct {
+	Limit     string
+	Currency  string
+	Max       money.Amount
+	MaxCount  int
+	Remaining money.Amount
+	ResetsAt  *time.Time
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitPerTransaction:
+		return fmt.Sprintf("%s: at most %s %s per transfer", ErrLimitExceeded, e.Max, e.Currency)
+	case LimitHourlyCount:
+		return fmt.Sprintf("%s: at most %d transfers per hour", ErrLimitExceeded, e.MaxCount)
+	default:
+		return fmt.Sprintf("%s: %s limit is %s %s, %s remaining", ErrLimitExceeded, e.Limit, e.Max, e.Currency, e.Remaining)
+	}
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// GetLimits returns the user's limits and what is left of them
+func (s *walletService) GetLimits(userID uint) (*LimitStatus, error) {
+	return s.limitStatus(s.db, userID, time.Now())
+}
+
+// SetLimits replaces the user's own limits. Fields left nil fall back to the
+// defaults.
+func (s *walletService) SetLimits(userID uint, override *models.TransferLimit) (*LimitStatus, error) {
+	for _, amount := range []*money.Amount{override.PerTransaction, override.Daily, override.Monthly} {
+		if amount != nil && *amount < 0 {
+			return nil, ErrInvalidLimit
+		}
+	}
+	if override.HourlyCount != nil && *override.HourlyCount < 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+
+	override.UserID = userID
+	if err := s.limitRepo.Save(override); err != nil {
+		return nil, fmt.Errorf("error saving limits: %w", err)
+	}
+
+	return s.GetLimits(userID)
+}
+
+// limitsFor applies the user's own limits over the defaults
+func (s *walletService) limitsFor(tx *gorm.DB, userID uint) (Limits, error) {
+	limits := s.limits
+
+	override, err := s.limitRepo.FindByUserID(tx, userID)
+	if err != nil {
+		return limits, fmt.Errorf("error finding limits: %w", err)
+	}
+	if override == nil {
+		return limits, nil
+	}
+
+	if override.PerTransaction != nil {
+		limits.PerTransaction = *override.PerTransaction
+	}
+	if override.Daily != nil {
+		limits.Daily = *override.Daily
+	}
+	if override.Monthly != nil {
+		limits.Monthly = *override.Monthly
+	}
+	if override.HourlyCount != nil {
+		limits.HourlyCount = *override.HourlyCount
+	}
+	return limits, nil
+}
+
+// limitStatus works out what is left of the user's limits at now, counting
+// what they sent from every wallet. Days and months are calendar days and
+// months in UTC; the hourly count is over the last 60 minutes. What was sent
+// in a currency without a rate to the base currency, e.g. after an admin
+// deleted it, cannot be valued and is skipped rather than blocking every
+// transfer.
+func (s *walletService) limitStatus(tx *gorm.DB, userID uint, now time.Time) (*LimitStatus, error) {
+	limits, err := s.limitsFor(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &LimitStatus{Currency: baseCurrency, Limits: limits}
+
+	remaining := func(limit money.Amount, since time.Time) (*money.Amount, error) {
+		totals, err := s.limitRepo.OutgoingSince(tx, userID, since)
+		if err != nil {
+			return nil, fmt.Errorf("error summing outgoing transfers: %w", err)
+		}
+		var sent money.Amount
+		for _, total := range totals {
+			value, err := s.toBase(tx, total.Currency, total.Total)
+			if errors.Is(err, ErrRateNotFound) {
+				if !slices.Contains(status.Unvalued, total.Currency) {
+					status.Unvalued = append(status.Unvalued, total.Currency)
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			sent += value
+		}
+		left := max(limit-sent, 0)
+		return &left, nil
+	}
+
+	if limits.Daily > 0 {
+		if status.DailyRemaining, err = remaining(limits.Daily, startOfDay(now)); err != nil {
+			return nil, err
+		}
+	}
+	if limits.Monthly > 0 {
+		if status.MonthlyRemaining, err = remaining(limits.Monthly, startOfMonth(now)); err != nil {
+			return nil, err
+		}
+	}
+	if limits.HourlyCount > 0 {
+		totals, err := s.limitRepo.OutgoingSince(tx, userID, now.Add(-time.Hour))
+		if err != nil {
+			return nil, fmt.Errorf("error counting outgoing transfers: %w", err)
+		}
+		count := 0
+		for _, total := range totals {
+			count += int(total.Count)
+		}
+		left := max(limits.HourlyCount-count, 0)
+		status.HourlyRemaining = &left
+	}
+
+	return status, nil
+}
+
+// checkLimits fails with a *LimitError if sending amount in currency would
+// exceed one of the user's limits, and with ErrLimitUnvalued if an amount
+// limit applies but the currency has no rate to the base currency. Call it
+// with the sender locked by lockSender so concurrent transfers from any of
+// their wallets are counted.
+func (s *walletService) checkLimits(tx *gorm.DB, userID uint, currency string, amount money.Amount) error {
+	now := time.Now()
+	status, err := s.limitStatus(tx, userID, now)
+	if err != nil {
+		return err
+	}
+
+	// Only the amount limits need the amount in the base currency
+	if status.PerTransaction > 0 || status.DailyRemaining != nil || status.MonthlyRemaining != nil {
+		amount, err = s.toBase(tx, currency, amount)
+		if errors.Is(err, ErrRateNotFound) {
+			return fmt.Errorf("%w: there is no rate from %s to %s", ErrLimitUnvalued, currency, status.Currency)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if status.PerTransaction > 0 && amount > status.PerTransaction {
+		return &LimitError{Limit: LimitPerTransaction, Currency: status.Currency, Max: status.PerTransaction, Remaining: status.PerTransaction}
+	}
+	if status.HourlyRemaining != nil && *status.HourlyRemaining == 0 {
+		return &LimitError{Limit: LimitHourlyCount, MaxCount: status.HourlyCount}
+	}
+	if status.DailyRemaining != nil && amount > *status.DailyRemaining {
+		resetsAt := startOfDay(now).AddDate(0, 0, 1)
+		return &LimitError{Limit: LimitDaily, Currency: status.Currency, Max: status.Daily, Remaining: *status.DailyRemaining, ResetsAt: &resetsAt}
+	}
+	if status.MonthlyRemaining != nil && amount > *status.MonthlyRemaining {
+		resetsAt := startOfMonth(now).AddDate(0, 1, 0)
+		return &LimitError{Limit: LimitMonthly, Currency: status.Currency, Max: status.Monthly, Remaining: *status.MonthlyRemaining, ResetsAt: &resetsAt}
+	}
+	return nil
+}
+
+// lockSender locks the user whose transfer is checked against their limits
+// and priced, until tx ends. Limits and the free tier cover all of a user's
+// wallets, so locking the sending wallet alone would not serialize them. Call
+// it after locking the wallets.
+func (s *walletService) lockSender(tx *gorm.DB, userID uint) error {
+	if _, err := s.userRepo.FindByIDForUpdate(tx, userID); err != nil {
+		return fmt.Errorf("error locking user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
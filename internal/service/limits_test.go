@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_Limits(t *testing.T) {
+	db := setupLedgerTestDB(t, "limits")
+	walletRepo := repository.NewWalletRepository(db)
+
+	limits := Limits{
+		PerTransaction: money.FromMajor(300),
+		Daily:          money.FromMajor(500),
+		HourlyCount:    3,
+	}
+	walletService := newTestWalletService(db, WalletOptions{Limits: limits})
+
+	sender := createTestUser(t, db, "limit-sender@example.com")
+	recipient := createTestUser(t, db, "limit-recipient@example.com")
+	trusted := createTestUser(t, db, "limit-trusted@example.com")
+	shopper := createTestUser(t, db, "limit-shopper@example.com")
+
+	amountOf := func(major int64) *money.Amount {
+		amount := money.FromMajor(major)
+		return &amount
+	}
+	limitError := func(t *testing.T, err error, limit string) *LimitError {
+		t.Helper()
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+			t.Fatalf("expected a LimitError, got %v", err)
+		}
+		if limitErr.Limit != limit {
+			t.Fatalf("expected the %s limit, got %s", limit, limitErr.Limit)
+		}
+		return limitErr
+	}
+
+	t.Run("per transaction limit", func(t *testing.T) {
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("300.01"), "", "", "")
+		limitErr := limitError(t, err, LimitPerTransaction)
+		if limitErr.Remaining != money.FromMajor(300) {
+			t.Errorf("expected 300 allowed, got %s", limitErr.Remaining)
+		}
+	})
+
+	t.Run("daily limit reports the remaining allowance", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(200), "", "", ""); err != nil {
+				t.Fatalf("transfer %d failed: %v", i, err)
+			}
+		}
+
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(150), "", "", "")
+		limitErr := limitError(t, err, LimitDaily)
+		if limitErr.Remaining != money.FromMajor(100) {
+			t.Errorf("expected 100 remaining, got %s", limitErr.Remaining)
+		}
+		if limitErr.ResetsAt == nil || !limitErr.ResetsAt.Equal(startOfDay(time.Now()).AddDate(0, 0, 1)) {
+			t.Errorf("expected the limit to reset at midnight UTC, got %v", limitErr.ResetsAt)
+		}
+
+		status, err := walletService.GetLimits(sender.ID)
+		if err != nil {
+			t.Fatalf("failed to get limits: %v", err)
+		}
+		if *status.DailyRemaining != money.FromMajor(100) || *status.HourlyRemaining != 1 || status.MonthlyRemaining != nil {
+			t.Errorf("expected 100 left today, 1 transfer left this hour and no monthly limit, got %+v", status)
+		}
+	})
+
+	t.Run("hourly count", func(t *testing.T) {
+		if _, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(50), "", "", ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(1), "", "", "")
+		limitError(t, err, LimitHourlyCount)
+	})
+
+	t.Run("refunds are not limited", func(t *testing.T) {
+		result, err := walletService.Transfer(recipient.ID, sender.Email, money.FromMajor(10), "", "", "")
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		if _, err := walletService.Refund(sender.ID, result.Transfer.PublicID, nil, "", ""); err != nil {
+			t.Errorf("expected the refund to ignore the sender's limits, got %v", err)
+		}
+	})
+
+	t.Run("batch items count towards the limits", func(t *testing.T) {
+		_, err := walletService.BatchTransfer(shopper.ID, models.TransferBatchModeAtomic, []BatchItem{
+			{RecipientEmail: recipient.Email, Amount: money.FromMajor(300)},
+			{RecipientEmail: recipient.Email, Amount: money.FromMajor(300)},
+		}, "")
+		limitError(t, err, LimitDaily)
+
+		wallet, _ := walletRepo.FindByUserID(shopper.ID)
+		if wallet.Balance != money.FromMajor(1000) {
+			t.Errorf("expected no item to be paid, got balance %s", wallet.Balance)
+		}
+	})
+
+	t.Run("authorized holds count towards the limits", func(t *testing.T) {
+		hold, err := walletService.AuthorizeHold(shopper.ID, recipient.Email, money.FromMajor(300), "", "", "")
+		if err != nil {
+			t.Fatalf("failed to authorize hold: %v", err)
+		}
+		_, err = walletService.Transfer(shopper.ID, recipient.Email, money.FromMajor(250), "", "", "")
+		limitError(t, err, LimitDaily)
+
+		// Capturing is not checked again, and the capture replaces the hold in the usage
+		if _, err := walletService.CaptureHold(recipient.ID, hold.Hold.PublicID, nil, ""); err != nil {
+			t.Fatalf("failed to capture: %v", err)
+		}
+		status, _ := walletService.GetLimits(shopper.ID)
+		if *status.DailyRemaining != money.FromMajor(200) {
+			t.Errorf("expected 200 left today, got %s", status.DailyRemaining)
+		}
+	})
+
+	t.Run("per user overrides", func(t *testing.T) {
+		status, err := walletService.SetLimits(trusted.ID, &models.TransferLimit{
+			PerTransaction: amountOf(1000),
+			Daily:          amountOf(0),
+		})
+		if err != nil {
+			t.Fatalf("failed to set limits: %v", err)
+		}
+		if status.PerTransaction != money.FromMajor(1000) || status.DailyRemaining != nil || status.HourlyCount != 3 {
+			t.Errorf("expected the override over the defaults, got %+v", status)
+		}
+
+		if _, err := walletService.Transfer(trusted.ID, recipient.Email, money.FromMajor(800), "", "", ""); err != nil {
+			t.Errorf("expected the override to allow 800, got %v", err)
+		}
+
+		// Clearing the override restores the defaults
+		if _, err := walletService.SetLimits(trusted.ID, &models.TransferLimit{}); err != nil {
+			t.Fatalf("failed to clear limits: %v", err)
+		}
+		_, err = walletService.Transfer(trusted.ID, recipient.Email, money.FromMajor(100), "", "", "")
+		limitError(t, err, LimitDaily)
+	})
+
+	t.Run("limits cover every wallet in the base currency", func(t *testing.T) {
+		traveller := createTestUser(t, db, "limit-traveller@example.com")
+		travellerJPY, err := walletService.OpenWallet(traveller.ID, "JPY")
+		if err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+		fundWallet(t, db, travellerJPY, money.FromMajor(100000))
+		travellerEUR, _ := walletService.OpenWallet(traveller.ID, "EUR")
+		fundWallet(t, db, travellerEUR, money.FromMajor(100))
+		walletService.OpenWallet(recipient.ID, "JPY")
+		walletService.OpenWallet(recipient.ID, "EUR")
+		if _, err := walletService.SetRate("JPY", "USD", money.MustParseRate("0.0065"), 0); err != nil {
+			t.Fatalf("failed to set rate: %v", err)
+		}
+
+		if _, err := walletService.Transfer(traveller.ID, recipient.Email, money.FromMajor(200), "", "", ""); err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+
+		// 50000 JPY is worth 325 USD
+		_, err = walletService.Transfer(traveller.ID, recipient.Email, money.FromMajor(50000), "JPY", "", "")
+		limitErr := limitError(t, err, LimitPerTransaction)
+		if limitErr.Currency != "USD" || limitErr.Max != money.FromMajor(300) {
+			t.Errorf("expected a limit of 300 USD, got %s %s", limitErr.Max, limitErr.Currency)
+		}
+
+		// 40000 JPY is worth 260 USD, which with the 200 USD sent leaves 40
+		if _, err := walletService.Transfer(traveller.ID, recipient.Email, money.FromMajor(40000), "JPY", "", ""); err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		_, err = walletService.Transfer(traveller.ID, recipient.Email, money.FromMajor(10000), "JPY", "", "")
+		limitErr = limitError(t, err, LimitDaily)
+		if limitErr.Remaining != money.FromMajor(40) {
+			t.Errorf("expected 40 USD remaining, got %s", limitErr.Remaining)
+		}
+
+		status, err := walletService.GetLimits(traveller.ID)
+		if err != nil {
+			t.Fatalf("failed to get limits: %v", err)
+		}
+		if status.Currency != "USD" || *status.DailyRemaining != money.FromMajor(40) || *status.HourlyRemaining != 1 {
+			t.Errorf("expected 40 USD and 1 transfer left across both wallets, got %+v", status)
+		}
+
+		// Without a rate to the base currency the transfer cannot be checked
+		_, err = walletService.Transfer(traveller.ID, recipient.Email, money.FromMajor(1), "EUR", "", "")
+		if !errors.Is(err, ErrLimitUnvalued) || errors.Is(err, ErrRateNotFound) {
+			t.Errorf("expected ErrLimitUnvalued, got %v", err)
+		}
+
+		// Once the rate is gone, what was sent in JPY is skipped instead of
+		// blocking transfers in other currencies
+		if err := walletService.DeleteRate("JPY", "USD"); err != nil {
+			t.Fatalf("failed to delete rate: %v", err)
+		}
+		status, err = walletService.GetLimits(traveller.ID)
+		if err != nil {
+			t.Fatalf("failed to get limits: %v", err)
+		}
+		if *status.DailyRemaining != money.FromMajor(300) || len(status.Unvalued) != 1 || status.Unvalued[0] != "JPY" {
+			t.Errorf("expected 300 USD left with JPY unvalued, got %+v", status)
+		}
+		if _, err := walletService.Transfer(traveller.ID, recipient.Email, money.FromMajor(1), "", "", ""); err != nil {
+			t.Errorf("expected a USD transfer to pass, got %v", err)
+		}
+	})
+
+	t.Run("invalid overrides", func(t *testing.T) {
+		if _, err := walletService.SetLimits(trusted.ID, &models.TransferLimit{Daily: amountOf(-1)}); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("expected ErrInvalidLimit, got %v", err)
+		}
+		if _, err := walletService.SetLimits(999999, &models.TransferLimit{}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMoneyRequestNotFound   = errors.New("money request not found")
+	ErrMoneyRequestNotPending = errors.New("money request is no longer pending")
+	ErrMoneyRequestExpired    = errors.New("money request has expired")
+	ErrMoneyRequestNotAllowed = errors.New("only the payee can accept or decline a money request, and only the requester can cancel it")
+	ErrSelfRequest            = errors.New("cannot request money from yourself")
+)
+
+type MoneyRequestService interface {
+	Create(userID uint, payeeEmail string, amount money.Amount, notes string) (*models.MoneyRequest, error)
+	CreateTx(tx *gorm.DB, userID uint, payeeEmail string, amount money.Amount, notes string) (*models.MoneyRequest, error)
+	Get(userID uint, requestID string) (*models.MoneyRequest, error)
+	ListIncoming(userID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error)
+	ListOutgoing(userID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error)
+	Accept(userID uint, requestID string) (*models.MoneyRequest, *TransferResult, error)
+	Decline(userID uint, requestID string) (*models.MoneyRequest, error)
+	Cancel(userID uint, requestID string) (*models.MoneyRequest, error)
+	ExpireDue(now time.Time) (int, error)
+}
+
+type moneyRequestService struct {
+	moneyRequestRepo repository.MoneyRequestRepository
+	userRepo         repository.UserRepository
+	walletService    WalletService
+	db               *gorm.DB
+	ttl              time.Duration
+}
+
+func NewMoneyRequestService(
+	moneyRequestRepo repository.MoneyRequestRepository,
+	userRepo repository.UserRepository,
+	walletService WalletService,
+	db *gorm.DB,
+	ttl time.Duration,
+) MoneyRequestService {
+	return &moneyRequestService{
+		moneyRequestRepo: moneyRequestRepo,
+		userRepo:         userRepo,
+		walletService:    walletService,
+		db:               db,
+		ttl:              ttl,
+	}
+}
+
+// Create asks the user with payeeEmail to pay amount to the requester
+func (s *moneyRequestService) Create(userID uint, payeeEmail string, amount money.Amount, notes string) (*models.MoneyRequest, error) {
+	return s.CreateTx(s.db, userID, payeeEmail, amount, notes)
+}
+
+// CreateTx is Create within tx, for callers that store the request together
+// with records of their own
+func (s *moneyRequestService) CreateTx(tx *gorm.DB, userID uint, payeeEmail string, amount money.Amount, notes string) (*models.MoneyRequest, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	requester, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	payee, err := s.userRepo.FindByEmail(payeeEmail)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecipientNotFound
+		}
+		return nil, fmt.Errorf("error finding payee: %w", err)
+	}
+	if payee.ID == userID {
+		return nil, ErrSelfRequest
+	}
+
+	request := &models.MoneyRequest{
+		PublicID:       uuid.NewString(),
+		RequesterID:    requester.ID,
+		PayeeID:        payee.ID,
+		RequesterEmail: requester.Email,
+		PayeeEmail:     payee.Email,
+		Amount:         amount,
+		Notes:          notes,
+		Status:         models.MoneyRequestStatusPending,
+		ExpiresAt:      time.Now().Add(s.ttl),
+	}
+	if err := s.moneyRequestRepo.Create(tx, request); err != nil {
+		return nil, fmt.Errorf("error creating money request: %w", err)
+	}
+
+	return request, nil
+}
+
+// Get returns a money request to its requester or payee
+func (s *moneyRequestService) Get(userID uint, requestID string) (*models.MoneyRequest, error) {
+	request, err := s.moneyRequestRepo.FindByPublicID(requestID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMoneyRequestNotFound
+		}
+		return nil, fmt.Errorf("error finding money request: %w", err)
+	}
+	if request.RequesterID != userID && request.PayeeID != userID {
+		return nil, ErrMoneyRequestNotFound
+	}
+	return request, nil
+}
+
+// ListIncoming lists the requests addressed to the user
+func (s *moneyRequestService) ListIncoming(userID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error) {
+	if err := validateMoneyRequestStatus(status); err != nil {
+		return nil, err
+	}
+
+	requests, err := s.moneyRequestRepo.FindByPayeeID(userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("error finding money requests: %w", err)
+	}
+	return requests, nil
+}
+
+// ListOutgoing lists the requests the user sent
+func (s *moneyRequestService) ListOutgoing(userID uint, status models.MoneyRequestStatus) ([]models.MoneyRequest, error) {
+	if err := validateMoneyRequestStatus(status); err != nil {
+		return nil, err
+	}
+
+	requests, err := s.moneyRequestRepo.FindByRequesterID(userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("error finding money requests: %w", err)
+	}
+	return requests, nil
+}
+
+// Accept pays a pending request: the payee transfers the amount to the
+// requester with an idempotency key derived from the request ID, so the
+// request is paid at most once. If the transfer fails for a business reason (e.g. insufficient
+// balance) the request stays pending; if it fails unexpectedly, accepting
+// again resumes it.
+func (s *moneyRequestService) Accept(userID uint, requestID string) (*models.MoneyRequest, *TransferResult, error) {
+	request, err := s.Get(userID, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request.PayeeID != userID {
+		return nil, nil, ErrMoneyRequestNotAllowed
+	}
+
+	// An accepted request without a transfer was interrupted halfway
+	resuming := request.Status == models.MoneyRequestStatusAccepted && request.TransferID == nil
+	if !resuming {
+		if err := checkPending(request); err != nil {
+			return nil, nil, err
+		}
+		respondedAt := time.Now()
+		claimed, err := s.moneyRequestRepo.UpdateStatus(
+			request.ID,
+			[]models.MoneyRequestStatus{models.MoneyRequestStatusPending},
+			models.MoneyRequestStatusAccepted,
+			map[string]interface{}{"responded_at": respondedAt},
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error accepting money request: %w", err)
+		}
+		if !claimed {
+			return nil, nil, ErrMoneyRequestNotPending
+		}
+		request.Status = models.MoneyRequestStatusAccepted
+		request.RespondedAt = &respondedAt
+	}
+
+	result, err := s.walletService.Transfer(userID, request.RequesterEmail, request.Amount, "", request.Notes, moneyRequestKey(request.PublicID))
+	if err != nil {
+		if isTransferFailure(err) {
+			_, revertErr := s.moneyRequestRepo.UpdateStatus(
+				request.ID,
+				[]models.MoneyRequestStatus{models.MoneyRequestStatusAccepted},
+				models.MoneyRequestStatusPending,
+				map[string]interface{}{"responded_at": nil},
+			)
+			if revertErr != nil {
+				return nil, nil, fmt.Errorf("error reopening money request: %w", revertErr)
+			}
+		}
+		return nil, nil, err
+	}
+
+	_, err = s.moneyRequestRepo.UpdateStatus(
+		request.ID,
+		[]models.MoneyRequestStatus{models.MoneyRequestStatusAccepted},
+		models.MoneyRequestStatusAccepted,
+		map[string]interface{}{"transfer_id": result.Transfer.PublicID},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error updating money request: %w", err)
+	}
+	request.TransferID = &result.Transfer.PublicID
+
+	return request, result, nil
+}
+
+// Decline refuses a pending request (payee)
+func (s *moneyRequestService) Decline(userID uint, requestID string) (*models.MoneyRequest, error) {
+	return s.close(userID, requestID, models.MoneyRequestStatusDeclined)
+}
+
+// Cancel withdraws a pending request (requester)
+func (s *moneyRequestService) Cancel(userID uint, requestID string) (*models.MoneyRequest, error) {
+	return s.close(userID, requestID, models.MoneyRequestStatusCancelled)
+}
+
+// ExpireDue marks every pending request past its expiry as expired and
+// returns how many were
+func (s *moneyRequestService) ExpireDue(now time.Time) (int, error) {
+	expired, err := s.moneyRequestRepo.ExpirePending(now)
+	if err != nil {
+		return 0, fmt.Errorf("error expiring money requests: %w", err)
+	}
+	return int(expired), nil
+}
+
+// close ends a pending request without paying it
+func (s *moneyRequestService) close(userID uint, requestID string, status models.MoneyRequestStatus) (*models.MoneyRequest, error) {
+	request, err := s.Get(userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if status == models.MoneyRequestStatusDeclined && request.PayeeID != userID ||
+		status == models.MoneyRequestStatusCancelled && request.RequesterID != userID {
+		return nil, ErrMoneyRequestNotAllowed
+	}
+	if err := checkPending(request); err != nil {
+		return nil, err
+	}
+
+	respondedAt := time.Now()
+	updated, err := s.moneyRequestRepo.UpdateStatus(
+		request.ID,
+		[]models.MoneyRequestStatus{models.MoneyRequestStatusPending},
+		status,
+		map[string]interface{}{"responded_at": respondedAt},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating money request: %w", err)
+	}
+	if !updated {
+		return nil, ErrMoneyRequestNotPending
+	}
+
+	request.Status = status
+	request.RespondedAt = &respondedAt
+	return request, nil
+}
+
+// moneyRequestKey is the idempotency key an accepted request is paid with
+func moneyRequestKey(requestID string) string {
+	return "money-request:" + requestID
+}
+
+// checkPending reports whether a request can still be answered. Requests past
+// their expiry count as expired even before the expiry job marks them.
+func checkPending(request *models.MoneyRequest) error {
+	if request.Status == models.MoneyRequestStatusExpired ||
+		request.Status == models.MoneyRequestStatusPending && !time.Now().Before(request.ExpiresAt) {
+		return ErrMoneyRequestExpired
+	}
+	if request.Status != models.MoneyRequestStatusPending {
+		return ErrMoneyRequestNotPending
+	}
+	return nil
+}
+
+func validateMoneyRequestStatus(status models.MoneyRequestStatus) error {
+	switch status {
+	case "", models.MoneyRequestStatusPending, models.MoneyRequestStatusAccepted, models.MoneyRequestStatusDeclined,
+		models.MoneyRequestStatusCancelled, models.MoneyRequestStatusExpired:
+		return nil
+	}
+	return ErrInvalidStatus
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestMoneyRequestService(t *testing.T) {
+	db := setupLedgerTestDB(t, "money_requests")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	moneyRequestRepo := repository.NewMoneyRequestRepository(db)
+
+	walletService := newTestWalletService(db)
+	requestService := NewMoneyRequestService(moneyRequestRepo, userRepo, walletService, db, time.Hour)
+
+	requester := createTestUser(t, db, "request-requester@example.com")
+	payee := createTestUser(t, db, "request-payee@example.com")
+
+	balanceOf := func(user *models.User) money.Amount {
+		wallet, _ := walletRepo.FindByUserID(user.ID)
+		return wallet.Balance
+	}
+
+	t.Run("create validation", func(t *testing.T) {
+		if _, err := requestService.Create(requester.ID, requester.Email, money.FromMajor(1), ""); !errors.Is(err, ErrSelfRequest) {
+			t.Errorf("expected ErrSelfRequest, got %v", err)
+		}
+		if _, err := requestService.Create(requester.ID, "nobody@example.com", money.FromMajor(1), ""); !errors.Is(err, ErrRecipientNotFound) {
+			t.Errorf("expected ErrRecipientNotFound, got %v", err)
+		}
+		if _, err := requestService.Create(requester.ID, payee.Email, 0, ""); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("expected ErrInvalidAmount, got %v", err)
+		}
+	})
+
+	t.Run("accept pays the requester once", func(t *testing.T) {
+		request, err := requestService.Create(requester.ID, payee.Email, money.FromMajor(40), "Dinner")
+		if err != nil {
+			t.Fatalf("failed to create: %v", err)
+		}
+
+		incoming, _ := requestService.ListIncoming(payee.ID, models.MoneyRequestStatusPending)
+		if len(incoming) != 1 || incoming[0].PublicID != request.PublicID {
+			t.Fatalf("expected the request in the payee's pending list, got %+v", incoming)
+		}
+
+		if _, _, err := requestService.Accept(requester.ID, request.PublicID); !errors.Is(err, ErrMoneyRequestNotAllowed) {
+			t.Errorf("expected ErrMoneyRequestNotAllowed, got %v", err)
+		}
+
+		accepted, result, err := requestService.Accept(payee.ID, request.PublicID)
+		if err != nil {
+			t.Fatalf("failed to accept: %v", err)
+		}
+		if accepted.Status != models.MoneyRequestStatusAccepted || *accepted.TransferID != result.Transfer.PublicID {
+			t.Errorf("expected an accepted request linked to the transfer, got %+v", accepted)
+		}
+		if result.Transfer.Amount != money.FromMajor(40) || result.Transfer.Notes != "Dinner" {
+			t.Errorf("unexpected transfer %+v", result.Transfer)
+		}
+		if balanceOf(payee) != money.FromMajor(960) || balanceOf(requester) != money.FromMajor(1040) {
+			t.Errorf("expected balances 960 and 1040, got %s and %s", balanceOf(payee), balanceOf(requester))
+		}
+
+		if _, _, err := requestService.Accept(payee.ID, request.PublicID); !errors.Is(err, ErrMoneyRequestNotPending) {
+			t.Errorf("expected ErrMoneyRequestNotPending, got %v", err)
+		}
+		if balanceOf(payee) != money.FromMajor(960) {
+			t.Errorf("expected a second accept not to pay again, got %s", balanceOf(payee))
+		}
+	})
+
+	t.Run("an interrupted accept resumes with the same transfer", func(t *testing.T) {
+		request, _ := requestService.Create(requester.ID, payee.Email, money.FromMajor(10), "")
+
+		// The transfer went through but the request was never updated
+		first, err := walletService.Transfer(payee.ID, requester.Email, request.Amount, "", request.Notes, moneyRequestKey(request.PublicID))
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		db.Model(&models.MoneyRequest{}).Where("id = ?", request.ID).Update("status", models.MoneyRequestStatusAccepted)
+
+		accepted, result, err := requestService.Accept(payee.ID, request.PublicID)
+		if err != nil {
+			t.Fatalf("failed to resume: %v", err)
+		}
+		if !result.Replayed || *accepted.TransferID != first.Transfer.PublicID {
+			t.Errorf("expected the original transfer to be replayed, got %+v", result)
+		}
+		if balanceOf(payee) != money.FromMajor(950) {
+			t.Errorf("expected balance 950, got %s", balanceOf(payee))
+		}
+	})
+
+	t.Run("a client key equal to the request ID does not collide", func(t *testing.T) {
+		request, _ := requestService.Create(requester.ID, payee.Email, money.FromMajor(10), "")
+		before := balanceOf(payee)
+
+		if _, err := walletService.Transfer(payee.ID, requester.Email, money.FromMajor(3), "", "", request.PublicID); err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		accepted, _, err := requestService.Accept(payee.ID, request.PublicID)
+		if err != nil {
+			t.Fatalf("failed to accept: %v", err)
+		}
+		if accepted.Status != models.MoneyRequestStatusAccepted {
+			t.Errorf("expected the request to be accepted, got %s", accepted.Status)
+		}
+		if balanceOf(payee) != before-money.FromMajor(13) {
+			t.Errorf("expected balance %s, got %s", before-money.FromMajor(13), balanceOf(payee))
+		}
+	})
+
+	t.Run("insufficient balance keeps the request pending", func(t *testing.T) {
+		request, _ := requestService.Create(requester.ID, payee.Email, money.FromMajor(5000), "")
+
+		if _, _, err := requestService.Accept(payee.ID, request.PublicID); !errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+		}
+		reopened, _ := requestService.Get(payee.ID, request.PublicID)
+		if reopened.Status != models.MoneyRequestStatusPending || reopened.RespondedAt != nil {
+			t.Errorf("expected the request to stay pending, got %s", reopened.Status)
+		}
+	})
+
+	t.Run("decline and cancel", func(t *testing.T) {
+		declined, _ := requestService.Create(requester.ID, payee.Email, money.FromMajor(5), "")
+		if _, err := requestService.Decline(requester.ID, declined.PublicID); !errors.Is(err, ErrMoneyRequestNotAllowed) {
+			t.Errorf("expected ErrMoneyRequestNotAllowed, got %v", err)
+		}
+		result, err := requestService.Decline(payee.ID, declined.PublicID)
+		if err != nil || result.Status != models.MoneyRequestStatusDeclined {
+			t.Fatalf("failed to decline: %v", err)
+		}
+		if _, _, err := requestService.Accept(payee.ID, declined.PublicID); !errors.Is(err, ErrMoneyRequestNotPending) {
+			t.Errorf("expected ErrMoneyRequestNotPending, got %v", err)
+		}
+
+		cancelled, _ := requestService.Create(requester.ID, payee.Email, money.FromMajor(5), "")
+		if _, err := requestService.Cancel(payee.ID, cancelled.PublicID); !errors.Is(err, ErrMoneyRequestNotAllowed) {
+			t.Errorf("expected ErrMoneyRequestNotAllowed, got %v", err)
+		}
+		result, err = requestService.Cancel(requester.ID, cancelled.PublicID)
+		if err != nil || result.Status != models.MoneyRequestStatusCancelled {
+			t.Fatalf("failed to cancel: %v", err)
+		}
+
+		outsider := createTestUser(t, db, "request-outsider@example.com")
+		if _, err := requestService.Get(outsider.ID, cancelled.PublicID); !errors.Is(err, ErrMoneyRequestNotFound) {
+			t.Errorf("expected ErrMoneyRequestNotFound, got %v", err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		request, _ := requestService.Create(requester.ID, payee.Email, money.FromMajor(5), "")
+		db.Model(&models.MoneyRequest{}).Where("id = ?", request.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+		if _, _, err := requestService.Accept(payee.ID, request.PublicID); !errors.Is(err, ErrMoneyRequestExpired) {
+			t.Errorf("expected ErrMoneyRequestExpired before the job runs, got %v", err)
+		}
+
+		expired, err := requestService.ExpireDue(time.Now())
+		if err != nil || expired != 1 {
+			t.Fatalf("expected 1 expired, got %d, %v", expired, err)
+		}
+		result, _ := requestService.Get(requester.ID, request.PublicID)
+		if result.Status != models.MoneyRequestStatusExpired {
+			t.Errorf("expected expired, got %s", result.Status)
+		}
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		outgoing, _ := requestService.ListOutgoing(requester.ID, "")
+		if len(outgoing) != 7 {
+			t.Errorf("expected 7 outgoing requests, got %d", len(outgoing))
+		}
+		pending, _ := requestService.ListIncoming(payee.ID, models.MoneyRequestStatusPending)
+		if len(pending) != 1 {
+			t.Errorf("expected 1 pending incoming request, got %d", len(pending))
+		}
+		none, _ := requestService.ListIncoming(requester.ID, "")
+		if len(none) != 0 {
+			t.Errorf("expected no incoming requests for the requester, got %d", len(none))
+		}
+		if _, err := requestService.ListOutgoing(requester.ID, "bogus"); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("expected ErrInvalidStatus, got %v", err)
+		}
+	})
+}
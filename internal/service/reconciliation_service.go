@@ -0,0 +1,273 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+const reconciliationBatchSize = 500
+
+// ReconciliationReport is the machine-readable outcome of a reconciliation run
+type ReconciliationReport struct {
+	StartedAt                 time.Time                            `json:"started_at"`
+	FinishedAt                time.Time                            `json:"finished_at"`
+	Repair                    bool                                 `json:"repair"`
+	WalletsChecked            int                                  `json:"wallets_checked"`
+	Drift                     []WalletDrift                        `json:"drift"`
+	OrphanedLegs              []OrphanedLeg                        `json:"orphaned_legs"`
+	DuplicateIdempotencyKeys  []repository.DuplicateIdempotencyKey `json:"duplicate_idempotency_keys"`
+	DeletedWalletTransactions []uint                               `json:"deleted_wallet_transactions"`
+	LedgerError               string                               `json:"ledger_error,omitempty"`
+	OK                        bool                                 `json:"ok"`
+}
+
+// WalletDrift is a wallet whose stored balance does not match the balance
+// recomputed from its transactions
+type WalletDrift struct {
+	WalletID        uint         `json:"wallet_id"`
+	Balance         money.Amount `json:"balance"`
+	ExpectedBalance money.Amount `json:"expected_balance"`
+	LedgerBalance   money.Amount `json:"ledger_balance"`
+	Difference      money.Amount `json:"difference"`
+	Repaired        bool         `json:"repaired"`
+	Note            string       `json:"note,omitempty"`
+}
+
+// OrphanedLeg is a transaction whose counterpart is missing
+type OrphanedLeg struct {
+	TransactionID uint                   `json:"transaction_id"`
+	WalletID      uint                   `json:"wallet_id"`
+	Type          models.TransactionType `json:"type"`
+	Amount        money.Amount           `json:"amount"`
+	Reason        string                 `json:"reason"`
+}
+
+type ReconciliationService interface {
+	Run(repair bool) (*ReconciliationReport, error)
+}
+
+type reconciliationService struct {
+	reconciliationRepo repository.ReconciliationRepository
+	ledgerRepo         repository.LedgerRepository
+	walletRepo         repository.WalletRepository
+	ledgerService      LedgerService
+	db                 *gorm.DB
+}
+
+func NewReconciliationService(
+	reconciliationRepo repository.ReconciliationRepository,
+	ledgerRepo repository.LedgerRepository,
+	walletRepo repository.WalletRepository,
+	ledgerService LedgerService,
+	db *gorm.DB,
+) ReconciliationService {
+	return &reconciliationService{
+		reconciliationRepo: reconciliationRepo,
+		ledgerRepo:         ledgerRepo,
+		walletRepo:         walletRepo,
+		ledgerService:      ledgerService,
+		db:                 db,
+	}
+}
+
+// Run checks every wallet's balance against its opening balance plus credits
+// minus debits, and looks for orphaned legs, duplicated idempotency keys and
+// transactions of deleted wallets. With repair set, a drifted cached balance
+// is rewritten when the transactions and the ledger agree on the correct value.
+func (s *reconciliationService) Run(repair bool) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{
+		StartedAt:                 time.Now(),
+		Repair:                    repair,
+		Drift:                     []WalletDrift{},
+		OrphanedLegs:              []OrphanedLeg{},
+		DuplicateIdempotencyKeys:  []repository.DuplicateIdempotencyKey{},
+		DeletedWalletTransactions: []uint{},
+	}
+
+	if err := s.checkWallets(report, repair); err != nil {
+		return nil, err
+	}
+	if err := s.checkOrphanedLegs(report); err != nil {
+		return nil, err
+	}
+
+	duplicates, err := s.reconciliationRepo.FindDuplicateIdempotencyKeys()
+	if err != nil {
+		return nil, fmt.Errorf("error finding duplicate idempotency keys: %w", err)
+	}
+	report.DuplicateIdempotencyKeys = append(report.DuplicateIdempotencyKeys, duplicates...)
+
+	deleted, err := s.reconciliationRepo.FindTransactionsOfDeletedWallets()
+	if err != nil {
+		return nil, fmt.Errorf("error finding transactions of deleted wallets: %w", err)
+	}
+	for _, transaction := range deleted {
+		report.DeletedWalletTransactions = append(report.DeletedWalletTransactions, transaction.ID)
+	}
+
+	// Run the ledger check last so it sees any repairs made above
+	if err := s.ledgerService.CheckInvariant(); err != nil {
+		if !errors.Is(err, ErrLedgerImbalanced) {
+			return nil, err
+		}
+		report.LedgerError = err.Error()
+	}
+
+	report.OK = report.LedgerError == "" &&
+		len(report.OrphanedLegs) == 0 &&
+		len(report.DuplicateIdempotencyKeys) == 0 &&
+		len(report.DeletedWalletTransactions) == 0
+	for _, drift := range report.Drift {
+		if !drift.Repaired {
+			report.OK = false
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	return report, nil
+}
+
+func (s *reconciliationService) checkWallets(report *ReconciliationReport, repair bool) error {
+	var afterID uint
+	for {
+		wallets, err := s.reconciliationRepo.FindWalletsAfter(afterID, reconciliationBatchSize)
+		if err != nil {
+			return fmt.Errorf("error listing wallets: %w", err)
+		}
+		if len(wallets) == 0 {
+			return nil
+		}
+
+		for _, wallet := range wallets {
+			drift, err := s.checkWallet(wallet, repair)
+			if err != nil {
+				return err
+			}
+			if drift != nil {
+				report.Drift = append(report.Drift, *drift)
+			}
+			report.WalletsChecked++
+		}
+		afterID = wallets[len(wallets)-1].ID
+	}
+}
+
+func (s *reconciliationService) checkWallet(wallet models.Wallet, repair bool) (*WalletDrift, error) {
+	drift, err := s.measureDrift(s.db, wallet)
+	if err != nil || drift == nil || drift.Note != "" {
+		return drift, err
+	}
+	if !repair {
+		drift.Note = "cached balance differs from ledger"
+		return drift, nil
+	}
+
+	// Transactions and postings agree, so only the cached projection is wrong.
+	// Measure again under the wallet's lock: a transfer may have committed
+	// since the read above, and the repair must not overwrite its change.
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		locked, err := s.walletRepo.FindByIDForUpdate(tx, wallet.ID)
+		if err != nil {
+			return err
+		}
+		drift, err = s.measureDrift(tx, *locked)
+		if err != nil || drift == nil || drift.Note != "" {
+			return err
+		}
+
+		if err := s.reconciliationRepo.SetBalance(tx, wallet.ID, drift.ExpectedBalance); err != nil {
+			return err
+		}
+		drift.Repaired = true
+		drift.Note = "cached balance rebuilt from ledger"
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error repairing wallet %d: %w", wallet.ID, err)
+	}
+
+	return drift, nil
+}
+
+// measureDrift compares the wallet's cached balance with the one its
+// transactions add up to, reading through db. It returns nil if they match,
+// and a drift without a note if the ledger agrees with the transactions so
+// the cached balance can be rebuilt.
+func (s *reconciliationService) measureDrift(db *gorm.DB, wallet models.Wallet) (*WalletDrift, error) {
+	opening, err := s.reconciliationRepo.SumOpeningBalance(db, wallet.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error summing opening balance of wallet %d: %w", wallet.ID, err)
+	}
+	totals, err := s.reconciliationRepo.SumStatement(db, wallet.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error summing transactions of wallet %d: %w", wallet.ID, err)
+	}
+
+	expected := opening + totals.Credits - totals.Debits
+	if expected == wallet.Balance {
+		return nil, nil
+	}
+
+	drift := &WalletDrift{
+		WalletID:        wallet.ID,
+		Balance:         wallet.Balance,
+		ExpectedBalance: expected,
+		Difference:      wallet.Balance - expected,
+	}
+
+	account, err := s.ledgerRepo.FindAccountByWalletID(db, wallet.ID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("error finding ledger account of wallet %d: %w", wallet.ID, err)
+		}
+		drift.Note = "wallet has no ledger account"
+		return drift, nil
+	}
+	drift.LedgerBalance, err = s.ledgerRepo.SumPostingsByAccount(db, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error summing postings of wallet %d: %w", wallet.ID, err)
+	}
+
+	if drift.LedgerBalance != expected {
+		drift.Note = "transactions and ledger disagree; manual review required"
+	}
+	return drift, nil
+}
+
+func (s *reconciliationService) checkOrphanedLegs(report *ReconciliationReport) error {
+	incomplete, err := s.reconciliationRepo.FindIncompleteTransferLegs()
+	if err != nil {
+		return fmt.Errorf("error finding incomplete transfers: %w", err)
+	}
+	for _, leg := range incomplete {
+		report.OrphanedLegs = append(report.OrphanedLegs, OrphanedLeg{
+			TransactionID: leg.ID,
+			WalletID:      leg.WalletID,
+			Type:          leg.Type,
+			Amount:        leg.Amount,
+			Reason:        "transfer does not have exactly one debit and one credit leg",
+		})
+	}
+
+	unlinked, err := s.reconciliationRepo.FindUnlinkedTransactions()
+	if err != nil {
+		return fmt.Errorf("error finding unlinked transactions: %w", err)
+	}
+	for _, leg := range unlinked {
+		report.OrphanedLegs = append(report.OrphanedLegs, OrphanedLeg{
+			TransactionID: leg.ID,
+			WalletID:      leg.WalletID,
+			Type:          leg.Type,
+			Amount:        leg.Amount,
+			Reason:        "transaction belongs to no transfer or journal entry",
+		})
+	}
+
+	return nil
+}
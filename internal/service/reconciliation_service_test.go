@@ -0,0 +1,199 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+func newTestReconciliationService(db *gorm.DB) ReconciliationService {
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+	return NewReconciliationService(repository.NewReconciliationRepository(db), ledgerRepo, walletRepo, ledgerService, db)
+}
+
+func TestReconciliationService_CleanRun(t *testing.T) {
+	db := setupLedgerTestDB(t, "reconcile_clean")
+
+	walletService := newTestWalletService(db)
+	reconciliationService := newTestReconciliationService(db)
+
+	sender := createTestUser(t, db, "reconcile-sender@example.com")
+	recipient := createTestUser(t, db, "reconcile-recipient@example.com")
+	if _, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("250.75"), "", "Rent", ""); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	report, err := reconciliationService.Run(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !report.OK {
+		t.Errorf("expected clean report, got %+v", report)
+	}
+	if report.WalletsChecked != 2 {
+		t.Errorf("expected 2 wallets checked, got %d", report.WalletsChecked)
+	}
+}
+
+func TestReconciliationService_DriftIsReportedAndRepaired(t *testing.T) {
+	db := setupLedgerTestDB(t, "reconcile_drift")
+	walletRepo := repository.NewWalletRepository(db)
+	reconciliationService := newTestReconciliationService(db)
+
+	user := createTestUser(t, db, "reconcile-drift@example.com")
+	wallet, _ := walletRepo.FindByUserID(user.ID)
+
+	// Change the cached balance behind the ledger's back
+	db.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Update("balance", money.FromMajor(5000))
+
+	t.Run("report only", func(t *testing.T) {
+		report, err := reconciliationService.Run(false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if report.OK {
+			t.Error("expected report to flag drift")
+		}
+		if len(report.Drift) != 1 {
+			t.Fatalf("expected 1 drifted wallet, got %d", len(report.Drift))
+		}
+		drift := report.Drift[0]
+		if drift.ExpectedBalance != money.FromMajor(1000) || drift.Difference != money.FromMajor(4000) || drift.Repaired {
+			t.Errorf("unexpected drift: %+v", drift)
+		}
+
+		wallet, _ = walletRepo.FindByUserID(user.ID)
+		if wallet.Balance != money.FromMajor(5000) {
+			t.Errorf("expected balance to be left alone, got %s", wallet.Balance)
+		}
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		report, err := reconciliationService.Run(true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !report.OK {
+			t.Errorf("expected repaired report to be OK, got %+v", report)
+		}
+		if len(report.Drift) != 1 || !report.Drift[0].Repaired {
+			t.Errorf("expected drift to be repaired, got %+v", report.Drift)
+		}
+
+		wallet, _ = walletRepo.FindByUserID(user.ID)
+		if wallet.Balance != money.FromMajor(1000) {
+			t.Errorf("expected balance 1000 after repair, got %s", wallet.Balance)
+		}
+
+		report, _ = reconciliationService.Run(false)
+		if !report.OK || len(report.Drift) != 0 {
+			t.Errorf("expected clean report after repair, got %+v", report)
+		}
+	})
+}
+
+// interleavingLedgerRepo runs a hook after the first sum of postings, the last
+// read of the unlocked check, to commit a transfer before the repair
+type interleavingLedgerRepo struct {
+	repository.LedgerRepository
+	afterFirstSum func()
+}
+
+func (r *interleavingLedgerRepo) SumPostingsByAccount(tx *gorm.DB, accountID uint) (money.Amount, error) {
+	sum, err := r.LedgerRepository.SumPostingsByAccount(tx, accountID)
+	if hook := r.afterFirstSum; hook != nil {
+		r.afterFirstSum = nil
+		hook()
+	}
+	return sum, err
+}
+
+func TestReconciliationService_RepairKeepsConcurrentTransfers(t *testing.T) {
+	db := setupLedgerTestDB(t, "reconcile_concurrent")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	walletService := newTestWalletService(db)
+
+	sender := createTestUser(t, db, "reconcile-concurrent-sender@example.com")
+	recipient := createTestUser(t, db, "reconcile-concurrent-recipient@example.com")
+	wallet, _ := walletRepo.FindByUserID(sender.ID)
+
+	// The cached balance is 5 too high, and a transfer of 10 commits after the
+	// drift was measured but before it is repaired
+	db.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Update("balance", money.FromMajor(1005))
+	interleaving := &interleavingLedgerRepo{
+		LedgerRepository: ledgerRepo,
+		afterFirstSum: func() {
+			if _, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(10), "", "", ""); err != nil {
+				t.Errorf("failed to transfer: %v", err)
+			}
+		},
+	}
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+	reconciliationService := NewReconciliationService(repository.NewReconciliationRepository(db), interleaving, walletRepo, ledgerService, db)
+
+	if _, err := reconciliationService.Run(true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	wallet, _ = walletRepo.FindByUserID(sender.ID)
+	if wallet.Balance != money.FromMajor(990) {
+		t.Errorf("expected the repair to keep the transfer and leave 990, got %s", wallet.Balance)
+	}
+}
+
+func TestReconciliationService_DetectsOrphansAndDeletedWallets(t *testing.T) {
+	db := setupLedgerTestDB(t, "reconcile_orphans")
+	walletRepo := repository.NewWalletRepository(db)
+	reconciliationService := newTestReconciliationService(db)
+
+	user := createTestUser(t, db, "reconcile-orphan@example.com")
+	wallet, _ := walletRepo.FindByUserID(user.ID)
+
+	// A transfer that lost its credit leg
+	transfer := &models.Transfer{
+		PublicID:          "orphan-transfer",
+		SenderWalletID:    wallet.ID,
+		RecipientWalletID: wallet.ID,
+		Amount:            money.FromMajor(10),
+		Status:            models.TransferStatusCompleted,
+	}
+	db.Create(transfer)
+	db.Create(&models.Transaction{
+		WalletID:       wallet.ID,
+		TransferID:     &transfer.ID,
+		Amount:         money.FromMajor(10),
+		Type:           models.TransactionTypeDebit,
+		IdempotencyKey: "orphan-debit",
+	})
+
+	report, err := reconciliationService.Run(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if report.OK {
+		t.Error("expected report to flag the orphaned leg")
+	}
+	if len(report.OrphanedLegs) != 1 || report.OrphanedLegs[0].Type != models.TransactionTypeDebit {
+		t.Errorf("expected 1 orphaned debit leg, got %+v", report.OrphanedLegs)
+	}
+
+	// Soft delete the wallet; its history must be flagged
+	db.Delete(&models.Wallet{}, wallet.ID)
+
+	report, err = reconciliationService.Run(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(report.DeletedWalletTransactions) != 1 {
+		t.Errorf("expected 1 transaction of a deleted wallet, got %v", report.DeletedWalletTransactions)
+	}
+}
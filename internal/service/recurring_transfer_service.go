@@ -0,0 +1,446 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+const recurringTransferBatchSize = 100
+
+var (
+	ErrRecurringTransferNotFound  = errors.New("recurring transfer not found")
+	ErrRecurringTransferNotActive = errors.New("recurring transfer is not active")
+	ErrRecurringTransferNotPaused = errors.New("recurring transfer is not paused")
+	ErrRecurringTransferEnded     = errors.New("recurring transfer has ended")
+	ErrInvalidRecurrence          = errors.New("invalid recurrence")
+	ErrStartAtInPast              = errors.New("start_at must not be in the past")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// RecurringTransferInput describes a new recurring transfer. Weekday defaults
+// to the weekday of StartAt for weekly rules and DayOfMonth to its day for
+// monthly rules; a zero StartAt starts now.
+type RecurringTransferInput struct {
+	RecipientEmail string
+	Amount         money.Amount
+	Notes          string
+	Frequency      models.RecurringFrequency
+	Weekday        string
+	DayOfMonth     int
+	StartAt        time.Time
+	EndAt          *time.Time
+	MaxOccurrences *int
+}
+
+type RecurringTransferService interface {
+	Create(userID uint, input RecurringTransferInput) (*models.RecurringTransfer, error)
+	List(userID uint) ([]models.RecurringTransfer, error)
+	Get(userID uint, recurringID string) (*models.RecurringTransfer, error)
+	Occurrences(userID uint, recurringID string) ([]models.ScheduledTransfer, error)
+	Pause(userID uint, recurringID string) (*models.RecurringTransfer, error)
+	Resume(userID uint, recurringID string) (*models.RecurringTransfer, error)
+	SkipNext(userID uint, recurringID string) (*models.RecurringTransfer, error)
+	Cancel(userID uint, recurringID string) (*models.RecurringTransfer, error)
+	SpawnDue(now time.Time) (int, error)
+}
+
+type recurringTransferService struct {
+	recurringRepo repository.RecurringTransferRepository
+	scheduledRepo repository.ScheduledTransferRepository
+	userRepo      repository.UserRepository
+	db            *gorm.DB
+}
+
+func NewRecurringTransferService(
+	recurringRepo repository.RecurringTransferRepository,
+	scheduledRepo repository.ScheduledTransferRepository,
+	userRepo repository.UserRepository,
+	db *gorm.DB,
+) RecurringTransferService {
+	return &recurringTransferService{
+		recurringRepo: recurringRepo,
+		scheduledRepo: scheduledRepo,
+		userRepo:      userRepo,
+		db:            db,
+	}
+}
+
+// Create stores a recurring transfer whose first occurrence is the first time
+// on or after StartAt that matches the rule
+func (s *recurringTransferService) Create(userID uint, input RecurringTransferInput) (*models.RecurringTransfer, error) {
+	if input.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	now := time.Now()
+	startAt := input.StartAt
+	if startAt.IsZero() {
+		startAt = now
+	}
+	if startAt.Before(now.Add(-time.Minute)) {
+		return nil, ErrStartAtInPast
+	}
+	startAt = startAt.UTC().Truncate(time.Second)
+
+	recurring := &models.RecurringTransfer{
+		PublicID:       uuid.NewString(),
+		UserID:         userID,
+		Amount:         input.Amount,
+		Notes:          input.Notes,
+		Frequency:      input.Frequency,
+		StartAt:        startAt,
+		EndAt:          input.EndAt,
+		MaxOccurrences: input.MaxOccurrences,
+		Status:         models.RecurringTransferStatusActive,
+	}
+
+	switch input.Frequency {
+	case models.RecurringFrequencyDaily:
+		if input.Weekday != "" || input.DayOfMonth != 0 {
+			return nil, fmt.Errorf("%w: daily transfers take no weekday or day_of_month", ErrInvalidRecurrence)
+		}
+	case models.RecurringFrequencyWeekly:
+		if input.DayOfMonth != 0 {
+			return nil, fmt.Errorf("%w: weekly transfers take no day_of_month", ErrInvalidRecurrence)
+		}
+		recurring.Weekday = strings.ToLower(startAt.Weekday().String())
+		if input.Weekday != "" {
+			recurring.Weekday = strings.ToLower(input.Weekday)
+		}
+		if _, ok := weekdays[recurring.Weekday]; !ok {
+			return nil, fmt.Errorf("%w: unknown weekday %q", ErrInvalidRecurrence, input.Weekday)
+		}
+	case models.RecurringFrequencyMonthly:
+		if input.Weekday != "" {
+			return nil, fmt.Errorf("%w: monthly transfers take no weekday", ErrInvalidRecurrence)
+		}
+		recurring.DayOfMonth = startAt.Day()
+		if input.DayOfMonth != 0 {
+			recurring.DayOfMonth = input.DayOfMonth
+		}
+		if recurring.DayOfMonth < 1 || recurring.DayOfMonth > 31 {
+			return nil, fmt.Errorf("%w: day_of_month must be between 1 and 31", ErrInvalidRecurrence)
+		}
+	default:
+		return nil, fmt.Errorf("%w: frequency must be daily, weekly or monthly", ErrInvalidRecurrence)
+	}
+
+	if input.MaxOccurrences != nil && *input.MaxOccurrences < 1 {
+		return nil, fmt.Errorf("%w: max_occurrences must be at least 1", ErrInvalidRecurrence)
+	}
+	first := nextOccurrence(recurring, startAt)
+	if input.EndAt != nil && first.After(*input.EndAt) {
+		return nil, fmt.Errorf("%w: end_at is before the first occurrence", ErrInvalidRecurrence)
+	}
+	recurring.NextRunAt = &first
+
+	recipient, err := s.userRepo.FindByEmail(input.RecipientEmail)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecipientNotFound
+		}
+		return nil, fmt.Errorf("error finding recipient: %w", err)
+	}
+	if recipient.ID == userID {
+		return nil, ErrSelfTransfer
+	}
+	recurring.RecipientEmail = recipient.Email
+
+	if err := s.recurringRepo.Create(s.db, recurring); err != nil {
+		return nil, fmt.Errorf("error creating recurring transfer: %w", err)
+	}
+
+	return recurring, nil
+}
+
+func (s *recurringTransferService) List(userID uint) ([]models.RecurringTransfer, error) {
+	recurring, err := s.recurringRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding recurring transfers: %w", err)
+	}
+	return recurring, nil
+}
+
+func (s *recurringTransferService) Get(userID uint, recurringID string) (*models.RecurringTransfer, error) {
+	recurring, err := s.recurringRepo.FindByPublicID(recurringID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecurringTransferNotFound
+		}
+		return nil, fmt.Errorf("error finding recurring transfer: %w", err)
+	}
+	if recurring.UserID != userID {
+		return nil, ErrRecurringTransferNotFound
+	}
+	return recurring, nil
+}
+
+// Occurrences returns the history of a recurring transfer: every occurrence
+// spawned or skipped so far with its outcome, newest first
+func (s *recurringTransferService) Occurrences(userID uint, recurringID string) ([]models.ScheduledTransfer, error) {
+	recurring, err := s.Get(userID, recurringID)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences, err := s.scheduledRepo.FindByRecurringTransferID(recurring.PublicID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding occurrences: %w", err)
+	}
+	return occurrences, nil
+}
+
+// Pause stops spawning occurrences until the recurring transfer is resumed
+func (s *recurringTransferService) Pause(userID uint, recurringID string) (*models.RecurringTransfer, error) {
+	return s.update(userID, recurringID, func(tx *gorm.DB, recurring *models.RecurringTransfer) error {
+		if recurring.Status != models.RecurringTransferStatusActive {
+			return ErrRecurringTransferNotActive
+		}
+		recurring.Status = models.RecurringTransferStatusPaused
+		return nil
+	})
+}
+
+// Resume restarts a paused recurring transfer. Occurrences that fell due while
+// it was paused are caught up like those missed while the server was down:
+// the latest is spawned and the rest are recorded as skipped.
+func (s *recurringTransferService) Resume(userID uint, recurringID string) (*models.RecurringTransfer, error) {
+	return s.update(userID, recurringID, func(tx *gorm.DB, recurring *models.RecurringTransfer) error {
+		if recurring.Status != models.RecurringTransferStatusPaused {
+			return ErrRecurringTransferNotPaused
+		}
+		recurring.Status = models.RecurringTransferStatusActive
+
+		_, err := s.catchUp(tx, recurring, time.Now())
+		return err
+	})
+}
+
+// SkipNext records the next occurrence as skipped without running it. Skipped
+// occurrences count towards max_occurrences.
+func (s *recurringTransferService) SkipNext(userID uint, recurringID string) (*models.RecurringTransfer, error) {
+	return s.update(userID, recurringID, func(tx *gorm.DB, recurring *models.RecurringTransfer) error {
+		if recurring.Status != models.RecurringTransferStatusActive && recurring.Status != models.RecurringTransferStatusPaused {
+			return ErrRecurringTransferEnded
+		}
+		return s.spawnOccurrence(tx, recurring, models.ScheduledTransferStatusSkipped)
+	})
+}
+
+// Cancel ends a recurring transfer for good. Occurrences already spawned are
+// not affected.
+func (s *recurringTransferService) Cancel(userID uint, recurringID string) (*models.RecurringTransfer, error) {
+	return s.update(userID, recurringID, func(tx *gorm.DB, recurring *models.RecurringTransfer) error {
+		if recurring.Status != models.RecurringTransferStatusActive && recurring.Status != models.RecurringTransferStatusPaused {
+			return ErrRecurringTransferEnded
+		}
+		recurring.Status = models.RecurringTransferStatusCancelled
+		recurring.NextRunAt = nil
+		return nil
+	})
+}
+
+// SpawnDue creates a pending scheduled transfer for the occurrences due by now
+// and returns how many were spawned. The scheduled transfer executor runs them
+// like any other scheduled transfer.
+//
+// Of the occurrences missed while the server was down only the latest is
+// spawned; the earlier ones are recorded as skipped.
+func (s *recurringTransferService) SpawnDue(now time.Time) (int, error) {
+	spawned := 0
+	for {
+		due, err := s.recurringRepo.FindDue(now, recurringTransferBatchSize)
+		if err != nil {
+			return spawned, fmt.Errorf("error finding due recurring transfers: %w", err)
+		}
+
+		for _, recurring := range due {
+			ok, err := s.spawnDue(recurring.PublicID, now)
+			if err != nil {
+				return spawned, fmt.Errorf("error spawning occurrence of recurring transfer %s: %w", recurring.PublicID, err)
+			}
+			if ok {
+				spawned++
+			}
+		}
+
+		if len(due) < recurringTransferBatchSize {
+			return spawned, nil
+		}
+	}
+}
+
+// spawnDue catches up a recurring transfer if it is still active and due, and
+// reports whether it spawned an occurrence
+func (s *recurringTransferService) spawnDue(recurringID string, now time.Time) (bool, error) {
+	spawned := false
+	err := withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			recurring, err := s.recurringRepo.FindByPublicIDForUpdate(tx, recurringID)
+			if err != nil {
+				return fmt.Errorf("error locking recurring transfer: %w", err)
+			}
+
+			// Nothing happens if it was paused, ended or spawned by another
+			// server since it was listed
+			spawned, err = s.catchUp(tx, recurring, now)
+			if err != nil || !spawned {
+				return err
+			}
+			if err := s.recurringRepo.Update(tx, recurring); err != nil {
+				return fmt.Errorf("error updating recurring transfer: %w", err)
+			}
+			return nil
+		})
+	})
+	return spawned, err
+}
+
+// catchUp records the occurrences of an active recurring transfer that are due
+// by now and reports whether it spawned one. Only the latest is spawned to
+// run; any earlier ones were missed and are recorded as skipped, so a rule
+// never pays out several occurrences at once. Callers hold the rule's lock and
+// save it afterwards.
+func (s *recurringTransferService) catchUp(tx *gorm.DB, recurring *models.RecurringTransfer, now time.Time) (bool, error) {
+	spawned := false
+	for recurring.Status == models.RecurringTransferStatusActive && recurring.NextRunAt != nil && !recurring.NextRunAt.After(now) {
+		status := models.ScheduledTransferStatusPending
+		next := nextOccurrence(recurring, recurring.NextRunAt.Add(time.Second))
+		if !next.After(now) && !lastOccurrence(recurring, recurring.OccurrenceCount+1, next) {
+			status = models.ScheduledTransferStatusSkipped
+		}
+		if err := s.spawnOccurrence(tx, recurring, status); err != nil {
+			return false, err
+		}
+		spawned = spawned || status == models.ScheduledTransferStatusPending
+	}
+	return spawned, nil
+}
+
+// update locks a user's recurring transfer, applies change and saves it
+func (s *recurringTransferService) update(userID uint, recurringID string, change func(tx *gorm.DB, recurring *models.RecurringTransfer) error) (*models.RecurringTransfer, error) {
+	if _, err := s.Get(userID, recurringID); err != nil {
+		return nil, err
+	}
+
+	var recurring *models.RecurringTransfer
+	err := withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			recurring, err = s.recurringRepo.FindByPublicIDForUpdate(tx, recurringID)
+			if err != nil {
+				return fmt.Errorf("error locking recurring transfer: %w", err)
+			}
+			if err := change(tx, recurring); err != nil {
+				return err
+			}
+			if err := s.recurringRepo.Update(tx, recurring); err != nil {
+				return fmt.Errorf("error updating recurring transfer: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recurring, nil
+}
+
+// spawnOccurrence records the next occurrence of a recurring transfer with the
+// given status and moves the rule on to the following one. Callers hold the
+// rule's lock and save it afterwards.
+func (s *recurringTransferService) spawnOccurrence(tx *gorm.DB, recurring *models.RecurringTransfer, status models.ScheduledTransferStatus) error {
+	if recurring.NextRunAt == nil {
+		return ErrRecurringTransferEnded
+	}
+
+	recurring.OccurrenceCount++
+	occurrence := &models.ScheduledTransfer{
+		PublicID:            uuid.NewString(),
+		UserID:              recurring.UserID,
+		RecipientEmail:      recurring.RecipientEmail,
+		Amount:              recurring.Amount,
+		Notes:               recurring.Notes,
+		ExecuteAt:           *recurring.NextRunAt,
+		Status:              status,
+		RecurringTransferID: &recurring.PublicID,
+		Occurrence:          recurring.OccurrenceCount,
+	}
+	if err := s.scheduledRepo.Create(tx, occurrence); err != nil {
+		return fmt.Errorf("error creating occurrence: %w", err)
+	}
+
+	next := nextOccurrence(recurring, recurring.NextRunAt.Add(time.Second))
+	if lastOccurrence(recurring, recurring.OccurrenceCount, next) {
+		recurring.Status = models.RecurringTransferStatusCompleted
+		recurring.NextRunAt = nil
+	} else {
+		recurring.NextRunAt = &next
+	}
+	return nil
+}
+
+// lastOccurrence reports whether a rule ends after its count-th occurrence
+// instead of running again at next
+func lastOccurrence(recurring *models.RecurringTransfer, count int, next time.Time) bool {
+	return recurring.MaxOccurrences != nil && count >= *recurring.MaxOccurrences ||
+		recurring.EndAt != nil && next.After(*recurring.EndAt)
+}
+
+// nextOccurrence returns the first time on or after t that matches the rule.
+// Occurrences fall at the time of day of StartAt in UTC; monthly rules on a
+// day the month does not have fall on its last day.
+func nextOccurrence(recurring *models.RecurringTransfer, t time.Time) time.Time {
+	t = t.UTC()
+	start := recurring.StartAt.UTC()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+	}
+
+	switch recurring.Frequency {
+	case models.RecurringFrequencyWeekly:
+		next := at(t.Year(), t.Month(), t.Day())
+		next = next.AddDate(0, 0, (int(weekdays[recurring.Weekday])-int(next.Weekday())+7)%7)
+		if next.Before(t) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	case models.RecurringFrequencyMonthly:
+		for months := 0; ; months++ {
+			first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+			next := at(first.Year(), first.Month(), min(recurring.DayOfMonth, daysIn(first)))
+			if !next.Before(t) {
+				return next
+			}
+		}
+	default:
+		next := at(t.Year(), t.Month(), t.Day())
+		if next.Before(t) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
+
+// daysIn returns the number of days in the month of t
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		recurring models.RecurringTransfer
+		from      time.Time
+		want      []time.Time
+	}{
+		{
+			name:      "daily",
+			recurring: models.RecurringTransfer{Frequency: models.RecurringFrequencyDaily, StartAt: date(2026, 3, 30, 9)},
+			from:      date(2026, 3, 30, 9),
+			want:      []time.Time{date(2026, 3, 30, 9), date(2026, 3, 31, 9), date(2026, 4, 1, 9)},
+		},
+		{
+			name:      "weekly on another weekday",
+			recurring: models.RecurringTransfer{Frequency: models.RecurringFrequencyWeekly, Weekday: "friday", StartAt: date(2026, 3, 2, 8)},
+			from:      date(2026, 3, 2, 8),
+			want:      []time.Time{date(2026, 3, 6, 8), date(2026, 3, 13, 8), date(2026, 3, 20, 8)},
+		},
+		{
+			name:      "monthly at the end of the month",
+			recurring: models.RecurringTransfer{Frequency: models.RecurringFrequencyMonthly, DayOfMonth: 31, StartAt: date(2026, 1, 31, 12)},
+			from:      date(2026, 1, 31, 12),
+			want:      []time.Time{date(2026, 1, 31, 12), date(2026, 2, 28, 12), date(2026, 3, 31, 12), date(2026, 4, 30, 12)},
+		},
+		{
+			name:      "monthly on the 29th through a leap year",
+			recurring: models.RecurringTransfer{Frequency: models.RecurringFrequencyMonthly, DayOfMonth: 29, StartAt: date(2028, 1, 30, 0)},
+			from:      date(2028, 1, 30, 0),
+			want:      []time.Time{date(2028, 2, 29, 0), date(2028, 3, 29, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := nextOccurrence(&tt.recurring, tt.from)
+			for i, want := range tt.want {
+				if !next.Equal(want) {
+					t.Fatalf("occurrence %d: expected %s, got %s", i+1, want, next)
+				}
+				next = nextOccurrence(&tt.recurring, next.Add(time.Second))
+			}
+		})
+	}
+}
+
+func TestRecurringTransferService(t *testing.T) {
+	db := setupLedgerTestDB(t, "recurring_transfers")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	scheduledRepo := repository.NewScheduledTransferRepository(db)
+	recurringRepo := repository.NewRecurringTransferRepository(db)
+
+	walletService := newTestWalletService(db)
+	scheduledService := NewScheduledTransferService(scheduledRepo, userRepo, walletService, db)
+	recurringService := NewRecurringTransferService(recurringRepo, scheduledRepo, userRepo, db)
+
+	payer := createTestUser(t, db, "recurring-payer@example.com")
+	landlord := createTestUser(t, db, "recurring-landlord@example.com")
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	three := 3
+
+	t.Run("validation", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			input RecurringTransferInput
+			want  error
+		}{
+			{"unknown frequency", RecurringTransferInput{RecipientEmail: landlord.Email, Amount: money.FromMajor(1), Frequency: "yearly"}, ErrInvalidRecurrence},
+			{"unknown weekday", RecurringTransferInput{RecipientEmail: landlord.Email, Amount: money.FromMajor(1), Frequency: models.RecurringFrequencyWeekly, Weekday: "someday"}, ErrInvalidRecurrence},
+			{"day out of range", RecurringTransferInput{RecipientEmail: landlord.Email, Amount: money.FromMajor(1), Frequency: models.RecurringFrequencyMonthly, DayOfMonth: 32}, ErrInvalidRecurrence},
+			{"start in the past", RecurringTransferInput{RecipientEmail: landlord.Email, Amount: money.FromMajor(1), Frequency: models.RecurringFrequencyDaily, StartAt: time.Now().Add(-time.Hour)}, ErrStartAtInPast},
+			{"self", RecurringTransferInput{RecipientEmail: payer.Email, Amount: money.FromMajor(1), Frequency: models.RecurringFrequencyDaily}, ErrSelfTransfer},
+			{"zero amount", RecurringTransferInput{RecipientEmail: landlord.Email, Frequency: models.RecurringFrequencyDaily}, ErrInvalidAmount},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := recurringService.Create(payer.ID, tt.input)
+				if !errors.Is(err, tt.want) {
+					t.Errorf("expected %v, got %v", tt.want, err)
+				}
+			})
+		}
+	})
+
+	t.Run("occurrences run until the count is reached", func(t *testing.T) {
+		recurring, err := recurringService.Create(payer.ID, RecurringTransferInput{
+			RecipientEmail: landlord.Email,
+			Amount:         money.FromMajor(100),
+			Notes:          "Allowance",
+			Frequency:      models.RecurringFrequencyDaily,
+			StartAt:        start,
+			MaxOccurrences: &three,
+		})
+		if err != nil {
+			t.Fatalf("failed to create: %v", err)
+		}
+		if !recurring.NextRunAt.Equal(start) {
+			t.Errorf("expected first run at %s, got %s", start, recurring.NextRunAt)
+		}
+
+		spawned, err := recurringService.SpawnDue(start.Add(time.Minute))
+		if err != nil || spawned != 1 {
+			t.Fatalf("expected 1 spawned, got %d, %v", spawned, err)
+		}
+		if _, err := scheduledService.ExecuteDue(start.Add(time.Minute)); err != nil {
+			t.Fatalf("failed to execute: %v", err)
+		}
+
+		// The executor was down for two days; only the latest missed
+		// occurrence runs
+		spawned, _ = recurringService.SpawnDue(start.Add(50 * time.Hour))
+		if spawned != 1 {
+			t.Errorf("expected 1 spawned, got %d", spawned)
+		}
+		scheduledService.ExecuteDue(start.Add(50 * time.Hour))
+
+		recurring, _ = recurringService.Get(payer.ID, recurring.PublicID)
+		if recurring.Status != models.RecurringTransferStatusCompleted || recurring.NextRunAt != nil {
+			t.Errorf("expected completed, got %s", recurring.Status)
+		}
+
+		occurrences, _ := recurringService.Occurrences(payer.ID, recurring.PublicID)
+		if len(occurrences) != 3 {
+			t.Fatalf("expected 3 occurrences, got %d", len(occurrences))
+		}
+		statuses := []models.ScheduledTransferStatus{
+			models.ScheduledTransferStatusExecuted,
+			models.ScheduledTransferStatusSkipped,
+			models.ScheduledTransferStatusExecuted,
+		}
+		for i, occurrence := range occurrences {
+			if occurrence.Occurrence != 3-i || occurrence.Status != statuses[i] {
+				t.Errorf("unexpected occurrence %+v", occurrence)
+			}
+		}
+		if !occurrences[0].ExecuteAt.Equal(start.AddDate(0, 0, 2)) {
+			t.Errorf("expected last occurrence at %s, got %s", start.AddDate(0, 0, 2), occurrences[0].ExecuteAt)
+		}
+
+		wallet, _ := walletRepo.FindByUserID(payer.ID)
+		if wallet.Balance != money.FromMajor(800) {
+			t.Errorf("expected balance 800, got %s", wallet.Balance)
+		}
+
+		spawned, _ = recurringService.SpawnDue(start.Add(100 * time.Hour))
+		if spawned != 0 {
+			t.Errorf("expected a completed rule to spawn nothing, got %d", spawned)
+		}
+	})
+
+	t.Run("skip, pause, resume and cancel", func(t *testing.T) {
+		recurring, err := recurringService.Create(payer.ID, RecurringTransferInput{
+			RecipientEmail: landlord.Email,
+			Amount:         money.FromMajor(10),
+			Frequency:      models.RecurringFrequencyWeekly,
+			StartAt:        start,
+		})
+		if err != nil {
+			t.Fatalf("failed to create: %v", err)
+		}
+		if weekdays[recurring.Weekday] != start.Weekday() {
+			t.Errorf("expected weekday to default to %s, got %s", start.Weekday(), recurring.Weekday)
+		}
+
+		skipped, err := recurringService.SkipNext(payer.ID, recurring.PublicID)
+		if err != nil {
+			t.Fatalf("failed to skip: %v", err)
+		}
+		if !skipped.NextRunAt.Equal(start.AddDate(0, 0, 7)) || skipped.OccurrenceCount != 1 {
+			t.Errorf("expected next run a week later, got %s", skipped.NextRunAt)
+		}
+		occurrences, _ := recurringService.Occurrences(payer.ID, recurring.PublicID)
+		if len(occurrences) != 1 || occurrences[0].Status != models.ScheduledTransferStatusSkipped {
+			t.Errorf("expected one skipped occurrence, got %+v", occurrences)
+		}
+
+		if _, err := recurringService.Pause(payer.ID, recurring.PublicID); err != nil {
+			t.Fatalf("failed to pause: %v", err)
+		}
+		if _, err := recurringService.Pause(payer.ID, recurring.PublicID); !errors.Is(err, ErrRecurringTransferNotActive) {
+			t.Errorf("expected ErrRecurringTransferNotActive, got %v", err)
+		}
+		spawned, _ := recurringService.SpawnDue(start.AddDate(0, 0, 30))
+		if spawned != 0 {
+			t.Errorf("expected a paused rule to spawn nothing, got %d", spawned)
+		}
+
+		// Of the occurrences that fell due while paused, the latest is spawned
+		// on resume and the rest are skipped
+		missed := start.AddDate(0, 0, -14)
+		db.Model(&models.RecurringTransfer{}).Where("public_id = ?", recurring.PublicID).Update("next_run_at", missed)
+		resumed, err := recurringService.Resume(payer.ID, recurring.PublicID)
+		if err != nil {
+			t.Fatalf("failed to resume: %v", err)
+		}
+		if resumed.Status != models.RecurringTransferStatusActive || resumed.NextRunAt.Before(time.Now()) {
+			t.Errorf("expected an active rule with a future run, got %s at %s", resumed.Status, resumed.NextRunAt)
+		}
+		if resumed.NextRunAt.Weekday() != start.Weekday() {
+			t.Errorf("expected the next run on a %s, got %s", start.Weekday(), resumed.NextRunAt.Weekday())
+		}
+		occurrences, _ = recurringService.Occurrences(payer.ID, recurring.PublicID)
+		if len(occurrences) != 3 {
+			t.Fatalf("expected 3 occurrences, got %d", len(occurrences))
+		}
+		if occurrences[0].Status != models.ScheduledTransferStatusPending || !occurrences[0].ExecuteAt.Equal(missed.AddDate(0, 0, 7)) {
+			t.Errorf("expected the latest missed occurrence to be pending, got %+v", occurrences[0])
+		}
+		if occurrences[1].Status != models.ScheduledTransferStatusSkipped || !occurrences[1].ExecuteAt.Equal(missed) {
+			t.Errorf("expected the earlier missed occurrence to be skipped, got %+v", occurrences[1])
+		}
+		if _, err := recurringService.Resume(payer.ID, recurring.PublicID); !errors.Is(err, ErrRecurringTransferNotPaused) {
+			t.Errorf("expected ErrRecurringTransferNotPaused, got %v", err)
+		}
+
+		if _, err := recurringService.Cancel(landlord.ID, recurring.PublicID); !errors.Is(err, ErrRecurringTransferNotFound) {
+			t.Errorf("expected ErrRecurringTransferNotFound, got %v", err)
+		}
+		cancelled, err := recurringService.Cancel(payer.ID, recurring.PublicID)
+		if err != nil || cancelled.Status != models.RecurringTransferStatusCancelled {
+			t.Fatalf("failed to cancel: %v", err)
+		}
+		if _, err := recurringService.SkipNext(payer.ID, recurring.PublicID); !errors.Is(err, ErrRecurringTransferEnded) {
+			t.Errorf("expected ErrRecurringTransferEnded, got %v", err)
+		}
+	})
+
+	t.Run("end date completes the rule", func(t *testing.T) {
+		endAt := start.AddDate(0, 0, 1)
+		recurring, err := recurringService.Create(payer.ID, RecurringTransferInput{
+			RecipientEmail: landlord.Email,
+			Amount:         money.FromMajor(1),
+			Frequency:      models.RecurringFrequencyDaily,
+			StartAt:        start,
+			EndAt:          &endAt,
+		})
+		if err != nil {
+			t.Fatalf("failed to create: %v", err)
+		}
+
+		// The first occurrence was missed; the last one before the end date
+		// runs
+		spawned, _ := recurringService.SpawnDue(start.AddDate(0, 0, 10))
+		if spawned != 1 {
+			t.Errorf("expected 1 spawned, got %d", spawned)
+		}
+		occurrences, _ := recurringService.Occurrences(payer.ID, recurring.PublicID)
+		if len(occurrences) != 2 || occurrences[0].Status != models.ScheduledTransferStatusPending || !occurrences[0].ExecuteAt.Equal(endAt) ||
+			occurrences[1].Status != models.ScheduledTransferStatusSkipped {
+			t.Errorf("expected a skipped and a pending occurrence, got %+v", occurrences)
+		}
+		recurring, _ = recurringService.Get(payer.ID, recurring.PublicID)
+		if recurring.Status != models.RecurringTransferStatusCompleted {
+			t.Errorf("expected completed, got %s", recurring.Status)
+		}
+
+		_, err = recurringService.Create(payer.ID, RecurringTransferInput{
+			RecipientEmail: landlord.Email,
+			Amount:         money.FromMajor(1),
+			Frequency:      models.RecurringFrequencyMonthly,
+			DayOfMonth:     start.AddDate(0, 0, -1).Day(),
+			StartAt:        start,
+			EndAt:          &endAt,
+		})
+		if !errors.Is(err, ErrInvalidRecurrence) {
+			t.Errorf("expected ErrInvalidRecurrence for an end before the first occurrence, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used; the session has been revoked")
+)
+
+// RefreshReuseError reports a refresh token presented again after it was
+// used. The token's family has been revoked; FamilyID is also the session the
+// caller should end, so the access tokens already issued stop working too.
+type RefreshReuseError struct {
+	FamilyID string
+}
+
+func (e *RefreshReuseError) Error() string {
+	return ErrRefreshTokenReused.Error()
+}
+
+func (e *RefreshReuseError) Unwrap() error {
+	return ErrRefreshTokenReused
+}
+
+// TokenPair is a short-lived access token together with the refresh token
+// that renews it
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	// FamilyID identifies the chain of refresh tokens issued since the login.
+	// It is also the ID of the session, carried in the access token's jti.
+	FamilyID string
+}
+
+// Refresh exchanges a refresh token for a new token pair. The refresh token is
+// rotated: it can be used once, and using it again revokes its whole family,
+// since either the client or someone who stole the token is replaying it. The
+// reuse is reported as a *RefreshReuseError.
+func (s *authService) Refresh(refreshToken string) (*TokenPair, *models.User, error) {
+	var issued *TokenPair
+	var userID uint
+	var reusedFamily string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		token, err := s.refreshTokenRepo.FindByHashForUpdate(tx, hashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("error finding refresh token: %w", err)
+		}
+
+		now := time.Now()
+		if token.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		if token.UsedAt != nil {
+			// Commit the revocation, then report the reuse
+			reusedFamily = token.FamilyID
+			if err := s.refreshTokenRepo.RevokeFamily(tx, token.FamilyID, now); err != nil {
+				return fmt.Errorf("error revoking refresh tokens: %w", err)
+			}
+			return nil
+		}
+		if !now.Before(token.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := s.refreshTokenRepo.MarkUsed(tx, token.ID, now); err != nil {
+			return fmt.Errorf("error updating refresh token: %w", err)
+		}
+		userID = token.UserID
+		issued, err = s.issueRefreshToken(tx, token.UserID, token.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if reusedFamily != "" {
+		return nil, nil, &RefreshReuseError{FamilyID: reusedFamily}
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, fmt.Errorf("error finding user: %w", err)
+	}
+	if issued.AccessToken, err = s.jwtManager.GenerateToken(user.ID, user.Email, issued.FamilyID); err != nil {
+		return nil, nil, fmt.Errorf("error generating token: %w", err)
+	}
+
+	return issued, user, nil
+}
+
+// RevokeRefreshTokens revokes every refresh token issued since the login that
+// started the family
+func (s *authService) RevokeRefreshTokens(familyID string) error {
+	if err := s.refreshTokenRepo.RevokeFamily(s.db, familyID, time.Now()); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// issueTokens starts a new refresh token family for the user and signs an
+// access token
+func (s *authService) issueTokens(user *models.User) (*TokenPair, error) {
+	pair, err := s.issueRefreshToken(s.db, user.ID, uuid.NewString())
+	if err != nil {
+		return nil, err
+	}
+	if pair.AccessToken, err = s.jwtManager.GenerateToken(user.ID, user.Email, pair.FamilyID); err != nil {
+		return nil, fmt.Errorf("error generating token: %w", err)
+	}
+	return pair, nil
+}
+
+// issueRefreshToken stores a new refresh token in the family and returns it
+// without an access token
+func (s *authService) issueRefreshToken(tx *gorm.DB, userID uint, familyID string) (*TokenPair, error) {
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	token := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	}
+	if err := s.refreshTokenRepo.Create(tx, token); err != nil {
+		return nil, fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: token.ExpiresAt,
+		FamilyID:         familyID,
+	}, nil
+}
+
+// newOpaqueToken returns 32 random bytes, base64url-encoded
+func newOpaqueToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken is how opaque tokens are stored: they are random enough that a
+// plain SHA-256 hash cannot be reversed
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefundExceedsTransfer = errors.New("refund exceeds the amount left to refund on the transfer")
+	ErrTransferNotRefundable = errors.New("only transfers can be refunded")
+	ErrRefundNotAllowed      = errors.New("only the recipient of a transfer can refund it")
+)
+
+// refundRequest describes a refund or reversal of an existing transfer
+type refundRequest struct {
+	userID     uint
+	transferID string
+	// amount is the amount to return; nil returns everything not yet refunded
+	amount         *money.Amount
+	notes          string
+	idempotencyKey string
+	kind           models.TransferKind
+	entryKind      models.JournalEntryKind
+}
+
+// Refund returns all or part of a received transfer to its sender. Only the
+// recipient may refund, and all refunds and reversals of a transfer together
+// never exceed its amount.
+func (s *walletService) Refund(userID uint, transferID string, amount *money.Amount, notes string, idempotencyKey string) (*TransferResult, error) {
+	return s.refund(refundRequest{
+		userID:         userID,
+		transferID:     transferID,
+		amount:         amount,
+		notes:          notes,
+		idempotencyKey: idempotencyKey,
+		kind:           models.TransferKindRefund,
+		entryKind:      models.JournalEntryKindRefund,
+	})
+}
+
+// Reverse is the admin counterpart of Refund: it returns money of any
+// transfer to its sender without the recipient's consent. The recipient must
+// still hold enough balance.
+func (s *walletService) Reverse(adminID uint, transferID string, amount *money.Amount, reason string, idempotencyKey string) (*TransferResult, error) {
+	return s.refund(refundRequest{
+		userID:         adminID,
+		transferID:     transferID,
+		amount:         amount,
+		notes:          reason,
+		idempotencyKey: idempotencyKey,
+		kind:           models.TransferKindReversal,
+		entryKind:      models.JournalEntryKindReversal,
+	})
+}
+
+func (s *walletService) refund(req refundRequest) (*TransferResult, error) {
+	var requested money.Amount
+	if req.amount != nil {
+		requested = *req.amount
+	}
+
+	var replay models.Transfer
+	record, replayed, err := s.idempotency.begin(
+		req.userID,
+		req.idempotencyKey,
+		fingerprint(string(req.kind), req.userID, req.transferID, req.amount != nil, requested, req.notes),
+		&replay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &TransferResult{Transfer: &replay, Replayed: true}, nil
+	}
+
+	transfer, err := s.executeRefund(req, record)
+	if err != nil {
+		s.idempotency.release(record)
+		return nil, err
+	}
+	return &TransferResult{Transfer: transfer}, nil
+}
+
+func (s *walletService) executeRefund(req refundRequest, record *models.IdempotencyRecord) (*models.Transfer, error) {
+	if req.amount != nil && *req.amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	original, err := s.transferRepo.FindByPublicID(req.transferID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransferNotFound
+		}
+		return nil, fmt.Errorf("error finding transfer: %w", err)
+	}
+
+	// Refunds are made by the recipient; admins may reverse any transfer
+	if req.kind == models.TransferKindRefund {
+		sent, err := s.ownsWallet(req.userID, original.SenderWalletID)
+		if err != nil {
+			return nil, err
+		}
+		if sent {
+			return nil, ErrRefundNotAllowed
+		}
+		received, err := s.ownsWallet(req.userID, original.RecipientWalletID)
+		if err != nil {
+			return nil, err
+		}
+		if !received {
+			return nil, ErrTransferNotFound
+		}
+	}
+	if original.Kind != models.TransferKindTransfer {
+		return nil, ErrTransferNotRefundable
+	}
+	// Returning a conversion would need a rate for the way back
+	if original.ConvertedAmount != nil {
+		return nil, ErrConversionNotRefundable
+	}
+
+	recipientWallet, err := s.walletRepo.FindByID(original.RecipientWalletID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding recipient wallet: %w", err)
+	}
+	senderWallet, err := s.walletRepo.FindByID(original.SenderWalletID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding sender wallet: %w", err)
+	}
+
+	// Money flows back from the original recipient to the original sender
+	params := transferParams{
+		senderWalletID:     original.RecipientWalletID,
+		recipientWalletID:  original.SenderWalletID,
+		senderID:           recipientWallet.UserID,
+		recipientID:        senderWallet.UserID,
+		notes:              req.notes,
+		kind:               req.kind,
+		entryKind:          req.entryKind,
+		originalTransferID: &original.PublicID,
+	}
+	params.ledgerKey = s.idempotency.ledgerKey(string(req.kind), record)
+
+	var transfer *models.Transfer
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			wallets, err := s.lockWallets(tx, params.senderWalletID, params.recipientWalletID)
+			if err != nil {
+				return err
+			}
+
+			// Lock the original after the wallets, so concurrent refunds of the
+			// same transfer see each other's refunded amount
+			locked, err := s.transferRepo.FindByPublicIDForUpdate(tx, original.PublicID)
+			if err != nil {
+				return fmt.Errorf("error locking transfer: %w", err)
+			}
+			remaining := locked.Amount - locked.RefundedAmount
+
+			p := params
+			p.amount = remaining
+			if req.amount != nil {
+				p.amount = *req.amount
+			}
+			if p.amount <= 0 || p.amount > remaining {
+				return ErrRefundExceedsTransfer
+			}
+
+			transfer, err = s.recordTransfer(tx, wallets[p.senderWalletID], wallets[p.recipientWalletID], p)
+			if err != nil {
+				return err
+			}
+
+			refunded := locked.RefundedAmount + p.amount
+			status := models.TransferStatusPartiallyRefunded
+			if refunded == locked.Amount {
+				status = models.TransferStatusRefunded
+			}
+			if err := s.transferRepo.UpdateRefund(tx, locked.ID, refunded, status); err != nil {
+				return fmt.Errorf("error updating refunded transfer: %w", err)
+			}
+
+			return s.idempotency.complete(tx, record, transfer)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
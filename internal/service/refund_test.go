@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_Refund(t *testing.T) {
+	db := setupLedgerTestDB(t, "refund")
+	walletRepo := repository.NewWalletRepository(db)
+	transactionRepo := repository.NewTransactionRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+
+	walletService := newTestWalletService(db)
+	ledgerService := NewLedgerService(ledgerRepo, walletRepo, transactionRepo, db)
+
+	sender := createTestUser(t, db, "refund-sender@example.com")
+	recipient := createTestUser(t, db, "refund-recipient@example.com")
+	stranger := createTestUser(t, db, "refund-stranger@example.com")
+
+	original, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(100), "", "Dinner", "")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	transferID := original.Transfer.PublicID
+
+	amountOf := func(s string) *money.Amount {
+		amount := money.MustParse(s)
+		return &amount
+	}
+
+	t.Run("only the recipient can refund", func(t *testing.T) {
+		_, err := walletService.Refund(sender.ID, transferID, nil, "", "")
+		if !errors.Is(err, ErrRefundNotAllowed) {
+			t.Errorf("expected ErrRefundNotAllowed, got %v", err)
+		}
+		_, err = walletService.Refund(stranger.ID, transferID, nil, "", "")
+		if !errors.Is(err, ErrTransferNotFound) {
+			t.Errorf("expected ErrTransferNotFound, got %v", err)
+		}
+	})
+
+	t.Run("partial refund", func(t *testing.T) {
+		result, err := walletService.Refund(recipient.ID, transferID, amountOf("30.50"), "Split the bill", "refund-key-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		refund := result.Transfer
+		if refund.Kind != models.TransferKindRefund || refund.OriginalTransferID == nil || *refund.OriginalTransferID != transferID {
+			t.Errorf("expected refund linked to %s, got %+v", transferID, refund)
+		}
+		if refund.SenderWalletID != original.Transfer.RecipientWalletID || refund.Amount != money.MustParse("30.50") {
+			t.Errorf("expected 30.50 back from the recipient, got %+v", refund)
+		}
+
+		updated, _ := walletService.GetTransfer(sender.ID, transferID)
+		if updated.RefundedAmount != money.MustParse("30.50") || updated.Status != models.TransferStatusPartiallyRefunded {
+			t.Errorf("expected partially refunded transfer, got %+v", updated)
+		}
+
+		senderWallet, _ := walletRepo.FindByUserID(sender.ID)
+		if senderWallet.Balance != money.MustParse("930.50") {
+			t.Errorf("expected sender balance 930.50, got %s", senderWallet.Balance)
+		}
+	})
+
+	t.Run("refund is idempotent", func(t *testing.T) {
+		result, err := walletService.Refund(recipient.ID, transferID, amountOf("30.50"), "Split the bill", "refund-key-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !result.Replayed {
+			t.Error("expected replayed refund")
+		}
+
+		_, err = walletService.Refund(recipient.ID, transferID, amountOf("10.00"), "Split the bill", "refund-key-1")
+		if !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Errorf("expected ErrIdempotencyKeyReused, got %v", err)
+		}
+	})
+
+	t.Run("refunds never exceed the transfer", func(t *testing.T) {
+		_, err := walletService.Refund(recipient.ID, transferID, amountOf("69.51"), "", "")
+		if !errors.Is(err, ErrRefundExceedsTransfer) {
+			t.Errorf("expected ErrRefundExceedsTransfer, got %v", err)
+		}
+	})
+
+	t.Run("refunds of refunds are rejected", func(t *testing.T) {
+		var refund models.Transfer
+		db.Where("original_transfer_id = ?", transferID).First(&refund)
+		_, err := walletService.Refund(sender.ID, refund.PublicID, nil, "", "")
+		if !errors.Is(err, ErrTransferNotRefundable) {
+			t.Errorf("expected ErrTransferNotRefundable, got %v", err)
+		}
+	})
+
+	t.Run("admin reversal refunds the rest", func(t *testing.T) {
+		result, err := walletService.Reverse(stranger.ID, transferID, nil, "Sent by mistake", "reverse-key")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Transfer.Kind != models.TransferKindReversal || result.Transfer.Amount != money.MustParse("69.50") {
+			t.Errorf("expected reversal of 69.50, got %+v", result.Transfer)
+		}
+
+		updated, _ := walletService.GetTransfer(sender.ID, transferID)
+		if updated.RefundedAmount != updated.Amount || updated.Status != models.TransferStatusRefunded {
+			t.Errorf("expected fully refunded transfer, got %+v", updated)
+		}
+
+		_, err = walletService.Reverse(stranger.ID, transferID, nil, "Again", "")
+		if !errors.Is(err, ErrRefundExceedsTransfer) {
+			t.Errorf("expected ErrRefundExceedsTransfer, got %v", err)
+		}
+
+		senderWallet, _ := walletRepo.FindByUserID(sender.ID)
+		recipientWallet, _ := walletRepo.FindByUserID(recipient.ID)
+		if senderWallet.Balance != money.FromMajor(1000) || recipientWallet.Balance != money.FromMajor(1000) {
+			t.Errorf("expected both balances back at 1000, got %s and %s", senderWallet.Balance, recipientWallet.Balance)
+		}
+	})
+
+	t.Run("compensating entries keep the ledger balanced", func(t *testing.T) {
+		var count int64
+		db.Model(&models.JournalEntry{}).
+			Where("kind IN ?", []models.JournalEntryKind{models.JournalEntryKindRefund, models.JournalEntryKindReversal}).
+			Count(&count)
+		if count != 2 {
+			t.Errorf("expected 2 compensating journal entries, got %d", count)
+		}
+		if err := ledgerService.CheckInvariant(); err != nil {
+			t.Errorf("expected balanced ledger, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	retryMaxAttempts = 5
+	retryBaseDelay   = 10 * time.Millisecond
+	retryMaxDelay    = 200 * time.Millisecond
+)
+
+// PostgreSQL error codes that mean the transaction can safely be run again
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// withRetry runs fn and re-runs it with exponential backoff and jitter when it
+// fails with a serialization failure or deadlock, up to retryMaxAttempts times.
+// fn must be a complete database transaction so every attempt starts clean.
+func withRetry(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < retryMaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay(attempt))
+		}
+
+		err = fn()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	// Full jitter keeps competing transactions from retrying in lockstep
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+	}
+	return false
+}
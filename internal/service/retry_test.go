@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestWithRetry(t *testing.T) {
+	t.Run("retries serialization failures until success", func(t *testing.T) {
+		attempts := 0
+		err := withRetry(func() error {
+			attempts++
+			if attempts < 3 {
+				return fmt.Errorf("error updating balance: %w", &pgconn.PgError{Code: pgSerializationFailure})
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("gives up after max attempts on deadlocks", func(t *testing.T) {
+		attempts := 0
+		err := withRetry(func() error {
+			attempts++
+			return &pgconn.PgError{Code: pgDeadlockDetected}
+		})
+		if !isRetryable(err) {
+			t.Errorf("expected deadlock error, got %v", err)
+		}
+		if attempts != retryMaxAttempts {
+			t.Errorf("expected %d attempts, got %d", retryMaxAttempts, attempts)
+		}
+	})
+
+	t.Run("does not retry business errors", func(t *testing.T) {
+		attempts := 0
+		err := withRetry(func() error {
+			attempts++
+			return ErrInsufficientBalance
+		})
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+	})
+}
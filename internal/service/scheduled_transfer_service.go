@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+const scheduledTransferBatchSize = 100
+
+var (
+	ErrScheduledTransferNotFound   = errors.New("scheduled transfer not found")
+	ErrScheduledTransferNotPending = errors.New("scheduled transfer is no longer pending")
+	ErrExecuteAtInPast             = errors.New("execute_at must be in the future")
+	ErrInvalidStatus               = errors.New("invalid status")
+)
+
+// transferFailures are the errors that make a scheduled transfer fail for
+// good; any other error is retried on the executor's next run
+var transferFailures = []error{
+	ErrInsufficientBalance,
+	ErrRecipientNotFound,
+	ErrInvalidAmount,
+	ErrSelfTransfer,
+	ErrIdempotencyKeyReused,
+	ErrLimitExceeded,
+	ErrCurrencyMismatch,
+	ErrAmountPrecision,
+	ErrRateNotFound,
+	ErrWalletNotFound,
+	ErrUnsupportedCurrency,
+	ErrUserNotFound,
+	ErrLimitUnvalued,
+}
+
+type ScheduledTransferService interface {
+	Schedule(userID uint, recipientEmail string, amount money.Amount, notes string, executeAt time.Time) (*models.ScheduledTransfer, error)
+	List(userID uint, status models.ScheduledTransferStatus) ([]models.ScheduledTransfer, error)
+	Get(userID uint, scheduledID string) (*models.ScheduledTransfer, error)
+	Cancel(userID uint, scheduledID string) (*models.ScheduledTransfer, error)
+	ExecuteDue(now time.Time) (int, error)
+}
+
+type scheduledTransferService struct {
+	scheduledRepo repository.ScheduledTransferRepository
+	userRepo      repository.UserRepository
+	walletService WalletService
+	db            *gorm.DB
+}
+
+func NewScheduledTransferService(
+	scheduledRepo repository.ScheduledTransferRepository,
+	userRepo repository.UserRepository,
+	walletService WalletService,
+	db *gorm.DB,
+) ScheduledTransferService {
+	return &scheduledTransferService{
+		scheduledRepo: scheduledRepo,
+		userRepo:      userRepo,
+		walletService: walletService,
+		db:            db,
+	}
+}
+
+// Schedule stores a transfer to execute at executeAt. The recipient is checked
+// now so obvious mistakes fail early; the balance is only checked on execution.
+func (s *scheduledTransferService) Schedule(userID uint, recipientEmail string, amount money.Amount, notes string, executeAt time.Time) (*models.ScheduledTransfer, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if !executeAt.After(time.Now()) {
+		return nil, ErrExecuteAtInPast
+	}
+
+	recipient, err := s.userRepo.FindByEmail(recipientEmail)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecipientNotFound
+		}
+		return nil, fmt.Errorf("error finding recipient: %w", err)
+	}
+	if recipient.ID == userID {
+		return nil, ErrSelfTransfer
+	}
+
+	scheduled := &models.ScheduledTransfer{
+		PublicID:       uuid.NewString(),
+		UserID:         userID,
+		RecipientEmail: recipient.Email,
+		Amount:         amount,
+		Notes:          notes,
+		ExecuteAt:      executeAt,
+		Status:         models.ScheduledTransferStatusPending,
+	}
+	if err := s.scheduledRepo.Create(s.db, scheduled); err != nil {
+		return nil, fmt.Errorf("error creating scheduled transfer: %w", err)
+	}
+
+	return scheduled, nil
+}
+
+func (s *scheduledTransferService) List(userID uint, status models.ScheduledTransferStatus) ([]models.ScheduledTransfer, error) {
+	switch status {
+	case "", models.ScheduledTransferStatusPending, models.ScheduledTransferStatusProcessing,
+		models.ScheduledTransferStatusExecuted, models.ScheduledTransferStatusFailed,
+		models.ScheduledTransferStatusCancelled, models.ScheduledTransferStatusSkipped:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	scheduled, err := s.scheduledRepo.FindByUserID(userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("error finding scheduled transfers: %w", err)
+	}
+	return scheduled, nil
+}
+
+func (s *scheduledTransferService) Get(userID uint, scheduledID string) (*models.ScheduledTransfer, error) {
+	scheduled, err := s.scheduledRepo.FindByPublicID(scheduledID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScheduledTransferNotFound
+		}
+		return nil, fmt.Errorf("error finding scheduled transfer: %w", err)
+	}
+	if scheduled.UserID != userID {
+		return nil, ErrScheduledTransferNotFound
+	}
+	return scheduled, nil
+}
+
+// Cancel stops a pending scheduled transfer. Transfers the executor has
+// already picked up can no longer be cancelled.
+func (s *scheduledTransferService) Cancel(userID uint, scheduledID string) (*models.ScheduledTransfer, error) {
+	scheduled, err := s.Get(userID, scheduledID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.scheduledRepo.UpdateStatus(
+		scheduled.ID,
+		[]models.ScheduledTransferStatus{models.ScheduledTransferStatusPending},
+		models.ScheduledTransferStatusCancelled,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling scheduled transfer: %w", err)
+	}
+	if !updated {
+		return nil, ErrScheduledTransferNotPending
+	}
+
+	scheduled.Status = models.ScheduledTransferStatusCancelled
+	return scheduled, nil
+}
+
+// ExecuteDue runs every scheduled transfer due by now through
+// WalletService.Transfer and returns how many were executed or failed.
+//
+// Each scheduled transfer uses a deterministic idempotency key, so running it
+// again after a crash, or from two servers at once, never moves money twice.
+// A scheduled transfer that hits an unexpected error is skipped and retried on
+// the next run; the errors are returned together at the end.
+func (s *scheduledTransferService) ExecuteDue(now time.Time) (int, error) {
+	done := 0
+	var errs []error
+	for {
+		due, err := s.scheduledRepo.FindDue(now, scheduledTransferBatchSize)
+		if err != nil {
+			return done, fmt.Errorf("error finding due scheduled transfers: %w", err)
+		}
+
+		progressed := false
+		for i := range due {
+			finished, err := s.execute(&due[i])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if finished {
+				done++
+				progressed = true
+			}
+		}
+
+		// Stop when the batch was the last one, or when nothing in it could
+		// finish (e.g. all in progress elsewhere) to avoid spinning
+		if len(due) < scheduledTransferBatchSize || !progressed {
+			return done, errors.Join(errs...)
+		}
+	}
+}
+
+// execute runs one scheduled transfer and reports whether it reached a final
+// status
+func (s *scheduledTransferService) execute(scheduled *models.ScheduledTransfer) (bool, error) {
+	claimed, err := s.scheduledRepo.UpdateStatus(
+		scheduled.ID,
+		[]models.ScheduledTransferStatus{models.ScheduledTransferStatusPending, models.ScheduledTransferStatusProcessing},
+		models.ScheduledTransferStatusProcessing,
+		nil,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error claiming scheduled transfer %s: %w", scheduled.PublicID, err)
+	}
+	if !claimed {
+		// Cancelled or finished since it was listed
+		return false, nil
+	}
+
+	result, err := s.walletService.Transfer(
+		scheduled.UserID,
+		scheduled.RecipientEmail,
+		scheduled.Amount,
+		"",
+		scheduled.Notes,
+		scheduledTransferKey(scheduled.PublicID),
+	)
+	if errors.Is(err, ErrIdempotencyInProgress) {
+		return false, nil
+	}
+	if err != nil {
+		if !isTransferFailure(err) {
+			// Stays processing and is retried on the next run
+			return false, fmt.Errorf("error executing scheduled transfer %s: %w", scheduled.PublicID, err)
+		}
+		reason := err.Error()
+		_, err = s.scheduledRepo.UpdateStatus(
+			scheduled.ID,
+			[]models.ScheduledTransferStatus{models.ScheduledTransferStatusProcessing},
+			models.ScheduledTransferStatusFailed,
+			map[string]interface{}{"failure_reason": reason},
+		)
+		if err != nil {
+			return false, fmt.Errorf("error updating scheduled transfer %s: %w", scheduled.PublicID, err)
+		}
+		return true, nil
+	}
+
+	executedAt := time.Now()
+	_, err = s.scheduledRepo.UpdateStatus(
+		scheduled.ID,
+		[]models.ScheduledTransferStatus{models.ScheduledTransferStatusProcessing},
+		models.ScheduledTransferStatusExecuted,
+		map[string]interface{}{"transfer_id": result.Transfer.PublicID, "executed_at": executedAt},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error updating scheduled transfer %s: %w", scheduled.PublicID, err)
+	}
+	return true, nil
+}
+
+// scheduledTransferKey is the idempotency key a scheduled transfer executes
+// with
+func scheduledTransferKey(scheduledID string) string {
+	return "scheduled:" + scheduledID
+}
+
+func isTransferFailure(err error) bool {
+	for _, failure := range transferFailures {
+		if errors.Is(err, failure) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestScheduledTransferService(t *testing.T) {
+	db := setupLedgerTestDB(t, "scheduled_transfers")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	scheduledRepo := repository.NewScheduledTransferRepository(db)
+
+	walletService := newTestWalletService(db)
+	scheduledService := NewScheduledTransferService(scheduledRepo, userRepo, walletService, db)
+
+	sender := createTestUser(t, db, "scheduled-sender@example.com")
+	recipient := createTestUser(t, db, "scheduled-recipient@example.com")
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	dayAfter := tomorrow.Add(24 * time.Hour)
+	balanceOf := func(user *models.User) money.Amount {
+		wallet, _ := walletRepo.FindByUserID(user.ID)
+		return wallet.Balance
+	}
+
+	t.Run("schedule validation", func(t *testing.T) {
+		_, err := scheduledService.Schedule(sender.ID, recipient.Email, money.FromMajor(10), "", time.Now().Add(-time.Minute))
+		if !errors.Is(err, ErrExecuteAtInPast) {
+			t.Errorf("expected ErrExecuteAtInPast, got %v", err)
+		}
+		_, err = scheduledService.Schedule(sender.ID, "nobody@example.com", money.FromMajor(10), "", tomorrow)
+		if !errors.Is(err, ErrRecipientNotFound) {
+			t.Errorf("expected ErrRecipientNotFound, got %v", err)
+		}
+		_, err = scheduledService.Schedule(sender.ID, sender.Email, money.FromMajor(10), "", tomorrow)
+		if !errors.Is(err, ErrSelfTransfer) {
+			t.Errorf("expected ErrSelfTransfer, got %v", err)
+		}
+	})
+
+	rent, err := scheduledService.Schedule(sender.ID, recipient.Email, money.FromMajor(300), "Rent", tomorrow)
+	if err != nil {
+		t.Fatalf("failed to schedule: %v", err)
+	}
+	tooMuch, _ := scheduledService.Schedule(sender.ID, recipient.Email, money.FromMajor(5000), "Car", tomorrow)
+	cancelled, _ := scheduledService.Schedule(sender.ID, recipient.Email, money.FromMajor(20), "Gift", tomorrow)
+	later, _ := scheduledService.Schedule(sender.ID, recipient.Email, money.FromMajor(10), "Later", dayAfter)
+
+	t.Run("cancel", func(t *testing.T) {
+		result, err := scheduledService.Cancel(sender.ID, cancelled.PublicID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Status != models.ScheduledTransferStatusCancelled {
+			t.Errorf("expected cancelled, got %s", result.Status)
+		}
+
+		_, err = scheduledService.Cancel(sender.ID, cancelled.PublicID)
+		if !errors.Is(err, ErrScheduledTransferNotPending) {
+			t.Errorf("expected ErrScheduledTransferNotPending, got %v", err)
+		}
+		_, err = scheduledService.Cancel(recipient.ID, rent.PublicID)
+		if !errors.Is(err, ErrScheduledTransferNotFound) {
+			t.Errorf("expected ErrScheduledTransferNotFound, got %v", err)
+		}
+	})
+
+	t.Run("nothing runs before it is due", func(t *testing.T) {
+		done, err := scheduledService.ExecuteDue(time.Now())
+		if err != nil || done != 0 {
+			t.Errorf("expected nothing to run, got %d, %v", done, err)
+		}
+	})
+
+	t.Run("due transfers execute or fail", func(t *testing.T) {
+		done, err := scheduledService.ExecuteDue(tomorrow.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if done != 2 {
+			t.Errorf("expected 2 processed, got %d", done)
+		}
+
+		executed, _ := scheduledService.Get(sender.ID, rent.PublicID)
+		if executed.Status != models.ScheduledTransferStatusExecuted || executed.TransferID == nil || executed.ExecutedAt == nil {
+			t.Errorf("expected executed with a transfer, got %+v", executed)
+		}
+		if balanceOf(sender) != money.FromMajor(700) || balanceOf(recipient) != money.FromMajor(1300) {
+			t.Errorf("expected balances 700 and 1300, got %s and %s", balanceOf(sender), balanceOf(recipient))
+		}
+
+		failed, _ := scheduledService.Get(sender.ID, tooMuch.PublicID)
+		if failed.Status != models.ScheduledTransferStatusFailed || failed.FailureReason != ErrInsufficientBalance.Error() {
+			t.Errorf("expected failure with insufficient balance, got %+v", failed)
+		}
+
+		untouched, _ := scheduledService.Get(sender.ID, later.PublicID)
+		if untouched.Status != models.ScheduledTransferStatusPending {
+			t.Errorf("expected later transfer to stay pending, got %s", untouched.Status)
+		}
+	})
+
+	t.Run("executed transfers never run again", func(t *testing.T) {
+		done, err := scheduledService.ExecuteDue(tomorrow.Add(time.Minute))
+		if err != nil || done != 0 {
+			t.Errorf("expected nothing to run, got %d, %v", done, err)
+		}
+		if balanceOf(sender) != money.FromMajor(700) {
+			t.Errorf("expected balance 700, got %s", balanceOf(sender))
+		}
+	})
+
+	t.Run("a run interrupted after the transfer resumes without paying twice", func(t *testing.T) {
+		// The executor crashed after the transfer but before recording it
+		first, err := walletService.Transfer(sender.ID, recipient.Email, later.Amount, "", later.Notes, scheduledTransferKey(later.PublicID))
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		db.Model(&models.ScheduledTransfer{}).Where("id = ?", later.ID).Update("status", models.ScheduledTransferStatusProcessing)
+
+		done, err := scheduledService.ExecuteDue(dayAfter.Add(time.Minute))
+		if err != nil || done != 1 {
+			t.Fatalf("expected 1 processed, got %d, %v", done, err)
+		}
+
+		resumed, _ := scheduledService.Get(sender.ID, later.PublicID)
+		if resumed.Status != models.ScheduledTransferStatusExecuted || *resumed.TransferID != first.Transfer.PublicID {
+			t.Errorf("expected the original transfer to be recorded, got %+v", resumed)
+		}
+		if balanceOf(sender) != money.FromMajor(690) {
+			t.Errorf("expected balance 690, got %s", balanceOf(sender))
+		}
+	})
+
+	t.Run("list by status", func(t *testing.T) {
+		all, _ := scheduledService.List(sender.ID, "")
+		if len(all) != 4 {
+			t.Errorf("expected 4 scheduled transfers, got %d", len(all))
+		}
+		executed, _ := scheduledService.List(sender.ID, models.ScheduledTransferStatusExecuted)
+		if len(executed) != 2 {
+			t.Errorf("expected 2 executed, got %d", len(executed))
+		}
+		_, err := scheduledService.List(sender.ID, "bogus")
+		if !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("expected ErrInvalidStatus, got %v", err)
+		}
+	})
+
+	t.Run("a transfer that can never run fails instead of retrying", func(t *testing.T) {
+		closed := createTestUser(t, db, "scheduled-closed@example.com")
+		orphaned, err := scheduledService.Schedule(closed.ID, recipient.Email, money.FromMajor(10), "", tomorrow)
+		if err != nil {
+			t.Fatalf("failed to schedule: %v", err)
+		}
+		// The sender's wallet is closed before the transfer is due
+		if err := db.Where("user_id = ?", closed.ID).Delete(&models.Wallet{}).Error; err != nil {
+			t.Fatalf("failed to delete wallet: %v", err)
+		}
+
+		done, err := scheduledService.ExecuteDue(tomorrow.Add(time.Minute))
+		if err != nil || done != 1 {
+			t.Fatalf("expected 1 processed, got %d, %v", done, err)
+		}
+		failed, _ := scheduledService.Get(closed.ID, orphaned.PublicID)
+		if failed.Status != models.ScheduledTransferStatusFailed || failed.FailureReason != ErrWalletNotFound.Error() {
+			t.Errorf("expected failure with wallet not found, got %+v", failed)
+		}
+	})
+}
@@ -0,0 +1,497 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+// hundredPercent is 100.00% in hundredths of a percent
+const hundredPercent = 10000
+
+var (
+	ErrGroupNotFound       = errors.New("group not found")
+	ErrExpenseNotFound     = errors.New("expense not found")
+	ErrNotGroupMember      = errors.New("participant is not a member of the group")
+	ErrInvalidSplit        = errors.New("invalid split")
+	ErrSharesDoNotAddUp    = errors.New("shares do not add up to the total")
+	ErrNoShareToSettle     = errors.New("you have no share to settle in this expense")
+	ErrShareAlreadySettled = errors.New("share is already paid")
+)
+
+// ShareInput is one participant of an expense. Amount is used by exact
+// splits and Percentage (with up to two decimals) by percentage splits.
+type ShareInput struct {
+	Email      string
+	Amount     money.Amount
+	Percentage money.Amount
+}
+
+// ExpenseInput describes a bill the caller paid. Equal splits without shares
+// are split between every member of the group.
+type ExpenseInput struct {
+	Description string
+	Total       money.Amount
+	Split       models.SplitType
+	Settlement  models.SplitSettlement
+	Shares      []ShareInput
+}
+
+// MemberBalance is what a member is owed (positive) or owes (negative) within
+// a group, counting the shares not paid yet
+type MemberBalance struct {
+	Email string       `json:"email"`
+	Net   money.Amount `json:"net"`
+}
+
+type SplitService interface {
+	CreateGroup(userID uint, name string, memberEmails []string) (*models.SplitGroup, error)
+	ListGroups(userID uint) ([]models.SplitGroup, error)
+	GetGroup(userID uint, groupID string) (*models.SplitGroup, error)
+	AddExpense(userID uint, groupID string, input ExpenseInput) (*models.SplitExpense, error)
+	ListExpenses(userID uint, groupID string) ([]models.SplitExpense, error)
+	Settle(userID uint, groupID string, expenseID string) (*models.SplitExpense, *TransferResult, error)
+	Balances(userID uint, groupID string) ([]MemberBalance, error)
+}
+
+type splitService struct {
+	splitRepo           repository.SplitRepository
+	userRepo            repository.UserRepository
+	walletService       WalletService
+	moneyRequestService MoneyRequestService
+	db                  *gorm.DB
+}
+
+func NewSplitService(
+	splitRepo repository.SplitRepository,
+	userRepo repository.UserRepository,
+	walletService WalletService,
+	moneyRequestService MoneyRequestService,
+	db *gorm.DB,
+) SplitService {
+	return &splitService{
+		splitRepo:           splitRepo,
+		userRepo:            userRepo,
+		walletService:       walletService,
+		moneyRequestService: moneyRequestService,
+		db:                  db,
+	}
+}
+
+// CreateGroup creates a group of the caller and the given members
+func (s *splitService) CreateGroup(userID uint, name string, memberEmails []string) (*models.SplitGroup, error) {
+	creator, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+
+	group := &models.SplitGroup{
+		PublicID:    uuid.NewString(),
+		Name:        name,
+		CreatedByID: creator.ID,
+		Members:     []models.SplitGroupMember{{UserID: creator.ID, Email: creator.Email}},
+	}
+	seen := map[uint]bool{creator.ID: true}
+	for _, email := range memberEmails {
+		member, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrRecipientNotFound, email)
+			}
+			return nil, fmt.Errorf("error finding member: %w", err)
+		}
+		if seen[member.ID] {
+			continue
+		}
+		seen[member.ID] = true
+		group.Members = append(group.Members, models.SplitGroupMember{UserID: member.ID, Email: member.Email})
+	}
+
+	if err := s.splitRepo.CreateGroup(s.db, group); err != nil {
+		return nil, fmt.Errorf("error creating group: %w", err)
+	}
+	return group, nil
+}
+
+func (s *splitService) ListGroups(userID uint) ([]models.SplitGroup, error) {
+	groups, err := s.splitRepo.FindGroupsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding groups: %w", err)
+	}
+	return groups, nil
+}
+
+// GetGroup returns a group to its members
+func (s *splitService) GetGroup(userID uint, groupID string) (*models.SplitGroup, error) {
+	group, err := s.splitRepo.FindGroupByPublicID(groupID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("error finding group: %w", err)
+	}
+	if memberOf(group, userID) == nil {
+		return nil, ErrGroupNotFound
+	}
+	return group, nil
+}
+
+// AddExpense records a bill the caller paid for some members of the group and
+// splits it into shares that always add up to the total. With request
+// settlement every other participant is sent a money request for their share.
+func (s *splitService) AddExpense(userID uint, groupID string, input ExpenseInput) (*models.SplitExpense, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Total <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if input.Settlement == "" {
+		input.Settlement = models.SplitSettlementRequest
+	}
+	if input.Settlement != models.SplitSettlementRequest && input.Settlement != models.SplitSettlementTransfer {
+		return nil, fmt.Errorf("%w: settlement must be request or transfer", ErrInvalidSplit)
+	}
+
+	shares, err := splitShares(group, input)
+	if err != nil {
+		return nil, err
+	}
+
+	payer := memberOf(group, userID)
+	now := time.Now()
+	for i := range shares {
+		shares[i].Status = models.SplitShareStatusPending
+		// The payer's own share was paid with the bill
+		if shares[i].UserID == userID {
+			shares[i].Status = models.SplitShareStatusPaid
+			shares[i].PaidAt = &now
+		}
+	}
+
+	expense := &models.SplitExpense{
+		PublicID:    uuid.NewString(),
+		GroupID:     group.ID,
+		PayerID:     userID,
+		PayerEmail:  payer.Email,
+		Description: input.Description,
+		Total:       input.Total,
+		Split:       input.Split,
+		Settlement:  input.Settlement,
+		Shares:      shares,
+	}
+	// The expense and the money requests for its shares are stored together,
+	// so a failed request leaves no expense with shares nobody was asked for
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.splitRepo.CreateExpense(tx, expense); err != nil {
+			return fmt.Errorf("error creating expense: %w", err)
+		}
+		if expense.Settlement != models.SplitSettlementRequest {
+			return nil
+		}
+
+		for i := range expense.Shares {
+			share := &expense.Shares[i]
+			if share.Status != models.SplitShareStatusPending || share.Amount == 0 {
+				continue
+			}
+			request, err := s.moneyRequestService.CreateTx(tx, userID, share.Email, share.Amount, expense.Description)
+			if err != nil {
+				return fmt.Errorf("error requesting share of %s: %w", share.Email, err)
+			}
+			if err := s.splitRepo.SetShareMoneyRequest(tx, share.ID, request.PublicID); err != nil {
+				return fmt.Errorf("error linking money request: %w", err)
+			}
+			share.MoneyRequestID = &request.PublicID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expense, nil
+}
+
+// ListExpenses returns the group's expenses with up-to-date share statuses
+func (s *splitService) ListExpenses(userID uint, groupID string) ([]models.SplitExpense, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	expenses, err := s.splitRepo.FindExpensesByGroupID(group.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding expenses: %w", err)
+	}
+	for i := range expenses {
+		if err := s.syncShares(&expenses[i]); err != nil {
+			return nil, err
+		}
+	}
+	return expenses, nil
+}
+
+// Settle pays the caller's share of an expense to its payer. A share with a
+// pending money request is paid by accepting it. A share whose request was
+// declined, cancelled or expired, or that never had one, is paid with a
+// transfer made while its row is locked, so settling twice never pays twice.
+func (s *splitService) Settle(userID uint, groupID string, expenseID string) (*models.SplitExpense, *TransferResult, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	expense, err := s.splitRepo.FindExpenseByPublicID(expenseID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrExpenseNotFound
+		}
+		return nil, nil, fmt.Errorf("error finding expense: %w", err)
+	}
+	if expense.GroupID != group.ID {
+		return nil, nil, ErrExpenseNotFound
+	}
+	if err := s.syncShares(expense); err != nil {
+		return nil, nil, err
+	}
+
+	var share *models.SplitShare
+	for i := range expense.Shares {
+		if expense.Shares[i].UserID == userID {
+			share = &expense.Shares[i]
+		}
+	}
+	if share == nil || userID == expense.PayerID {
+		return nil, nil, ErrNoShareToSettle
+	}
+	if share.Status == models.SplitShareStatusPaid {
+		return nil, nil, ErrShareAlreadySettled
+	}
+
+	if share.MoneyRequestID == nil {
+		return s.settleByTransfer(expense, share)
+	}
+
+	_, result, err := s.moneyRequestService.Accept(userID, *share.MoneyRequestID)
+	if errors.Is(err, ErrMoneyRequestNotPending) || errors.Is(err, ErrMoneyRequestExpired) {
+		return s.settleUnaccepted(expense, share)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.markPaid(s.db, share, result.Transfer.PublicID); err != nil {
+		return nil, nil, err
+	}
+	return expense, result, nil
+}
+
+// Balances nets the unpaid shares of every expense in the group per member
+func (s *splitService) Balances(userID uint, groupID string) ([]MemberBalance, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	expenses, err := s.ListExpenses(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	net := make(map[uint]money.Amount)
+	for _, expense := range expenses {
+		for _, share := range expense.Shares {
+			if share.Status == models.SplitShareStatusPaid {
+				continue
+			}
+			net[share.UserID] -= share.Amount
+			net[expense.PayerID] += share.Amount
+		}
+	}
+
+	balances := make([]MemberBalance, len(group.Members))
+	for i, member := range group.Members {
+		balances[i] = MemberBalance{Email: member.Email, Net: net[member.UserID]}
+	}
+	return balances, nil
+}
+
+// settleUnaccepted settles a share whose money request could not be accepted.
+// If the request was accepted and paid in the meantime, e.g. by a concurrent
+// settle, the share is marked paid with that transfer. Otherwise the request
+// was declined, cancelled or expired, and the share is paid directly.
+func (s *splitService) settleUnaccepted(expense *models.SplitExpense, share *models.SplitShare) (*models.SplitExpense, *TransferResult, error) {
+	request, err := s.moneyRequestService.Get(expense.PayerID, *share.MoneyRequestID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error checking money request: %w", err)
+	}
+	if request.Status == models.MoneyRequestStatusAccepted {
+		// Still being paid; the share is marked once the transfer is known
+		if request.TransferID == nil {
+			return nil, nil, ErrMoneyRequestNotPending
+		}
+		if err := s.markPaid(s.db, share, *request.TransferID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrShareAlreadySettled
+	}
+	return s.settleByTransfer(expense, share)
+}
+
+// settleByTransfer pays a share straight to the payer. The share's row stays
+// locked until it is marked paid, so concurrent settles pay it once.
+func (s *splitService) settleByTransfer(expense *models.SplitExpense, share *models.SplitShare) (*models.SplitExpense, *TransferResult, error) {
+	var result *TransferResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		locked, err := s.splitRepo.FindShareForUpdate(tx, share.ID)
+		if err != nil {
+			return fmt.Errorf("error finding share: %w", err)
+		}
+		if locked.Status == models.SplitShareStatusPaid {
+			return ErrShareAlreadySettled
+		}
+
+		result, err = s.walletService.Transfer(share.UserID, expense.PayerEmail, share.Amount, "", expense.Description, splitShareKey(expense.PublicID))
+		if err != nil {
+			return err
+		}
+		return s.markPaid(tx, share, result.Transfer.PublicID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return expense, result, nil
+}
+
+// syncShares marks shares whose money request was accepted as paid
+func (s *splitService) syncShares(expense *models.SplitExpense) error {
+	for i := range expense.Shares {
+		share := &expense.Shares[i]
+		if share.Status != models.SplitShareStatusPending || share.MoneyRequestID == nil {
+			continue
+		}
+		request, err := s.moneyRequestService.Get(expense.PayerID, *share.MoneyRequestID)
+		if err != nil {
+			return fmt.Errorf("error checking money request: %w", err)
+		}
+		if request.Status == models.MoneyRequestStatusAccepted && request.TransferID != nil {
+			if err := s.markPaid(s.db, share, *request.TransferID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *splitService) markPaid(tx *gorm.DB, share *models.SplitShare, transferID string) error {
+	paidAt := time.Now()
+	if err := s.splitRepo.MarkSharePaid(tx, share.ID, transferID, paidAt); err != nil {
+		return fmt.Errorf("error updating share: %w", err)
+	}
+	share.Status = models.SplitShareStatusPaid
+	share.TransferID = &transferID
+	share.PaidAt = &paidAt
+	return nil
+}
+
+// splitShares works out what each participant owes. Leftover minor units of
+// equal and percentage splits go to the first participants, so the shares
+// always add up to the total.
+func splitShares(group *models.SplitGroup, input ExpenseInput) ([]models.SplitShare, error) {
+	participants := input.Shares
+	if len(participants) == 0 {
+		if input.Split != models.SplitTypeEqual {
+			return nil, fmt.Errorf("%w: %s splits need shares", ErrInvalidSplit, input.Split)
+		}
+		for _, member := range group.Members {
+			participants = append(participants, ShareInput{Email: member.Email})
+		}
+	}
+
+	shares := make([]models.SplitShare, len(participants))
+	seen := make(map[uint]bool)
+	for i, participant := range participants {
+		member := memberByEmail(group, participant.Email)
+		if member == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotGroupMember, participant.Email)
+		}
+		if seen[member.UserID] {
+			return nil, fmt.Errorf("%w: %s is listed twice", ErrInvalidSplit, member.Email)
+		}
+		seen[member.UserID] = true
+		shares[i] = models.SplitShare{UserID: member.UserID, Email: member.Email}
+	}
+
+	switch input.Split {
+	case models.SplitTypeEqual:
+		weights := make([]int64, len(shares))
+		for i := range weights {
+			weights[i] = 1
+		}
+		for i, amount := range input.Total.Allocate(weights...) {
+			shares[i].Amount = amount
+		}
+	case models.SplitTypeExact:
+		var sum money.Amount
+		for i, participant := range participants {
+			if participant.Amount < 0 {
+				return nil, ErrInvalidAmount
+			}
+			shares[i].Amount = participant.Amount
+			sum += participant.Amount
+		}
+		if sum != input.Total {
+			return nil, fmt.Errorf("%w: shares sum to %s, total is %s", ErrSharesDoNotAddUp, sum, input.Total)
+		}
+	case models.SplitTypePercentage:
+		weights := make([]int64, len(shares))
+		var sum int64
+		for i, participant := range participants {
+			if participant.Percentage < 0 {
+				return nil, fmt.Errorf("%w: percentages cannot be negative", ErrInvalidSplit)
+			}
+			weights[i] = participant.Percentage.Minor()
+			sum += weights[i]
+		}
+		if sum != hundredPercent {
+			return nil, fmt.Errorf("%w: percentages sum to %s", ErrSharesDoNotAddUp, money.FromMinor(sum))
+		}
+		for i, amount := range input.Total.Allocate(weights...) {
+			shares[i].Amount = amount
+		}
+	default:
+		return nil, fmt.Errorf("%w: split must be equal, exact or percentage", ErrInvalidSplit)
+	}
+
+	return shares, nil
+}
+
+// splitShareKey is the idempotency key a share is transferred with
+func splitShareKey(expenseID string) string {
+	return "split:" + expenseID
+}
+
+func memberOf(group *models.SplitGroup, userID uint) *models.SplitGroupMember {
+	for i := range group.Members {
+		if group.Members[i].UserID == userID {
+			return &group.Members[i]
+		}
+	}
+	return nil
+}
+
+func memberByEmail(group *models.SplitGroup, email string) *models.SplitGroupMember {
+	for i := range group.Members {
+		if strings.EqualFold(group.Members[i].Email, email) {
+			return &group.Members[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+// failingMoneyRequestService fails every request after the first few, to
+// stop an expense halfway through asking for its shares
+type failingMoneyRequestService struct {
+	MoneyRequestService
+	remaining int
+}
+
+func (s *failingMoneyRequestService) CreateTx(tx *gorm.DB, userID uint, payeeEmail string, amount money.Amount, notes string) (*models.MoneyRequest, error) {
+	if s.remaining == 0 {
+		return nil, errors.New("request failed")
+	}
+	s.remaining--
+	return s.MoneyRequestService.CreateTx(tx, userID, payeeEmail, amount, notes)
+}
+
+// interleavingMoneyRequestService runs beforeAccept once, before the first
+// accept, so another settle can slip in after the share was found pending
+type interleavingMoneyRequestService struct {
+	MoneyRequestService
+	beforeAccept func()
+}
+
+func (s *interleavingMoneyRequestService) Accept(userID uint, requestID string) (*models.MoneyRequest, *TransferResult, error) {
+	if hook := s.beforeAccept; hook != nil {
+		s.beforeAccept = nil
+		hook()
+	}
+	return s.MoneyRequestService.Accept(userID, requestID)
+}
+
+func TestSplitService(t *testing.T) {
+	db := setupLedgerTestDB(t, "splits")
+	userRepo := repository.NewUserRepository(db)
+	walletRepo := repository.NewWalletRepository(db)
+	moneyRequestRepo := repository.NewMoneyRequestRepository(db)
+	splitRepo := repository.NewSplitRepository(db)
+
+	walletService := newTestWalletService(db)
+	requestService := NewMoneyRequestService(moneyRequestRepo, userRepo, walletService, db, time.Hour)
+	splitService := NewSplitService(splitRepo, userRepo, walletService, requestService, db)
+
+	ana := createTestUser(t, db, "split-ana@example.com")
+	ben := createTestUser(t, db, "split-ben@example.com")
+	cy := createTestUser(t, db, "split-cy@example.com")
+	outsider := createTestUser(t, db, "split-outsider@example.com")
+
+	balanceOf := func(user *models.User) money.Amount {
+		wallet, _ := walletRepo.FindByUserID(user.ID)
+		return wallet.Balance
+	}
+	sharesOf := func(expense *models.SplitExpense) []money.Amount {
+		amounts := make([]money.Amount, len(expense.Shares))
+		for i, share := range expense.Shares {
+			amounts[i] = share.Amount
+		}
+		return amounts
+	}
+
+	group, err := splitService.CreateGroup(ana.ID, "Trip", []string{ben.Email, cy.Email, ben.Email})
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	if len(group.Members) != 3 || group.Members[0].Email != ana.Email {
+		t.Fatalf("expected the creator and two members, got %+v", group.Members)
+	}
+
+	t.Run("group access", func(t *testing.T) {
+		if _, err := splitService.GetGroup(outsider.ID, group.PublicID); !errors.Is(err, ErrGroupNotFound) {
+			t.Errorf("expected ErrGroupNotFound, got %v", err)
+		}
+		groups, _ := splitService.ListGroups(cy.ID)
+		if len(groups) != 1 || groups[0].PublicID != group.PublicID {
+			t.Errorf("expected the group in cy's list, got %+v", groups)
+		}
+		if _, err := splitService.CreateGroup(ana.ID, "Bad", []string{"nobody@example.com"}); !errors.Is(err, ErrRecipientNotFound) {
+			t.Errorf("expected ErrRecipientNotFound, got %v", err)
+		}
+	})
+
+	t.Run("split validation", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			input ExpenseInput
+			want  error
+		}{
+			{"unknown split", ExpenseInput{Total: money.FromMajor(10), Split: "random"}, ErrInvalidSplit},
+			{"exact needs shares", ExpenseInput{Total: money.FromMajor(10), Split: models.SplitTypeExact}, ErrInvalidSplit},
+			{"non member", ExpenseInput{Total: money.FromMajor(10), Split: models.SplitTypeEqual, Shares: []ShareInput{{Email: outsider.Email}}}, ErrNotGroupMember},
+			{"exact off by a cent", ExpenseInput{Total: money.FromMajor(10), Split: models.SplitTypeExact, Shares: []ShareInput{
+				{Email: ana.Email, Amount: money.MustParse("5.00")},
+				{Email: ben.Email, Amount: money.MustParse("4.99")},
+			}}, ErrSharesDoNotAddUp},
+			{"percentages under 100", ExpenseInput{Total: money.FromMajor(10), Split: models.SplitTypePercentage, Shares: []ShareInput{
+				{Email: ana.Email, Percentage: money.MustParse("50")},
+				{Email: ben.Email, Percentage: money.MustParse("49.99")},
+			}}, ErrSharesDoNotAddUp},
+			{"unknown settlement", ExpenseInput{Total: money.FromMajor(10), Split: models.SplitTypeEqual, Settlement: "cash"}, ErrInvalidSplit},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := splitService.AddExpense(ana.ID, group.PublicID, tt.input); !errors.Is(err, tt.want) {
+					t.Errorf("expected %v, got %v", tt.want, err)
+				}
+			})
+		}
+	})
+
+	t.Run("equal split sends money requests", func(t *testing.T) {
+		expense, err := splitService.AddExpense(ana.ID, group.PublicID, ExpenseInput{
+			Description: "Dinner",
+			Total:       money.FromMajor(100),
+			Split:       models.SplitTypeEqual,
+		})
+		if err != nil {
+			t.Fatalf("failed to add expense: %v", err)
+		}
+
+		want := []money.Amount{money.MustParse("33.34"), money.MustParse("33.33"), money.MustParse("33.33")}
+		for i, amount := range sharesOf(expense) {
+			if amount != want[i] {
+				t.Errorf("expected shares %v, got %v", want, sharesOf(expense))
+				break
+			}
+		}
+		if expense.Shares[0].Status != models.SplitShareStatusPaid || expense.Shares[0].MoneyRequestID != nil {
+			t.Errorf("expected the payer's share to be paid, got %+v", expense.Shares[0])
+		}
+
+		incoming, _ := requestService.ListIncoming(ben.ID, models.MoneyRequestStatusPending)
+		if len(incoming) != 1 || incoming[0].Amount != money.MustParse("33.33") || incoming[0].RequesterEmail != ana.Email {
+			t.Fatalf("expected a money request to ben, got %+v", incoming)
+		}
+
+		// Paying through the money request marks the share as paid
+		if _, _, err := requestService.Accept(ben.ID, incoming[0].PublicID); err != nil {
+			t.Fatalf("failed to accept: %v", err)
+		}
+		expenses, _ := splitService.ListExpenses(cy.ID, group.PublicID)
+		if expenses[0].Shares[1].Status != models.SplitShareStatusPaid || expenses[0].Shares[1].TransferID == nil {
+			t.Errorf("expected ben's share to be paid, got %+v", expenses[0].Shares[1])
+		}
+		if _, _, err := splitService.Settle(ben.ID, group.PublicID, expense.PublicID); !errors.Is(err, ErrShareAlreadySettled) {
+			t.Errorf("expected ErrShareAlreadySettled, got %v", err)
+		}
+
+		// Settling accepts cy's pending request
+		settled, result, err := splitService.Settle(cy.ID, group.PublicID, expense.PublicID)
+		if err != nil {
+			t.Fatalf("failed to settle: %v", err)
+		}
+		if settled.Shares[2].Status != models.SplitShareStatusPaid || *settled.Shares[2].TransferID != result.Transfer.PublicID {
+			t.Errorf("expected cy's share to be paid, got %+v", settled.Shares[2])
+		}
+		request, _ := requestService.Get(cy.ID, *settled.Shares[2].MoneyRequestID)
+		if request.Status != models.MoneyRequestStatusAccepted {
+			t.Errorf("expected cy's request to be accepted, got %s", request.Status)
+		}
+
+		if _, _, err := splitService.Settle(ana.ID, group.PublicID, expense.PublicID); !errors.Is(err, ErrNoShareToSettle) {
+			t.Errorf("expected ErrNoShareToSettle, got %v", err)
+		}
+		if balanceOf(ana) != money.MustParse("1066.66") {
+			t.Errorf("expected ana to receive 66.66, got %s", balanceOf(ana))
+		}
+	})
+
+	t.Run("percentage split settled by transfer", func(t *testing.T) {
+		expense, err := splitService.AddExpense(ben.ID, group.PublicID, ExpenseInput{
+			Description: "Car rental",
+			Total:       money.MustParse("123.45"),
+			Split:       models.SplitTypePercentage,
+			Settlement:  models.SplitSettlementTransfer,
+			Shares: []ShareInput{
+				{Email: ben.Email, Percentage: money.MustParse("50")},
+				{Email: ana.Email, Percentage: money.MustParse("25")},
+				{Email: cy.Email, Percentage: money.MustParse("25")},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to add expense: %v", err)
+		}
+		want := []money.Amount{money.MustParse("61.73"), money.MustParse("30.86"), money.MustParse("30.86")}
+		for i, amount := range sharesOf(expense) {
+			if amount != want[i] {
+				t.Errorf("expected shares %v, got %v", want, sharesOf(expense))
+				break
+			}
+		}
+		if expense.Shares[1].MoneyRequestID != nil {
+			t.Errorf("expected no money request for transfer settlement")
+		}
+
+		before := balanceOf(ana)
+		if _, _, err := splitService.Settle(ana.ID, group.PublicID, expense.PublicID); err != nil {
+			t.Fatalf("failed to settle: %v", err)
+		}
+		if balanceOf(ana) != before-money.MustParse("30.86") {
+			t.Errorf("expected ana to pay 30.86, got %s", before-balanceOf(ana))
+		}
+	})
+
+	t.Run("net balances count unpaid shares", func(t *testing.T) {
+		_, err := splitService.AddExpense(cy.ID, group.PublicID, ExpenseInput{
+			Description: "Tickets",
+			Total:       money.FromMajor(60),
+			Split:       models.SplitTypeExact,
+			Shares: []ShareInput{
+				{Email: ana.Email, Amount: money.FromMajor(40)},
+				{Email: ben.Email, Amount: money.FromMajor(20)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to add expense: %v", err)
+		}
+
+		balances, err := splitService.Balances(ana.ID, group.PublicID)
+		if err != nil {
+			t.Fatalf("failed to get balances: %v", err)
+		}
+		// Unpaid: cy owes ben 30.86 (rental); ana owes cy 40, ben owes cy 20 (tickets)
+		want := map[string]money.Amount{
+			ana.Email: money.FromMajor(-40),
+			ben.Email: money.MustParse("10.86"),
+			cy.Email:  money.MustParse("29.14"),
+		}
+		var sum money.Amount
+		for _, balance := range balances {
+			sum += balance.Net
+			if balance.Net != want[balance.Email] {
+				t.Errorf("%s: expected %s, got %s", balance.Email, want[balance.Email], balance.Net)
+			}
+		}
+		if sum != 0 {
+			t.Errorf("expected net balances to sum to zero, got %s", sum)
+		}
+	})
+
+	t.Run("failed money request leaves no expense", func(t *testing.T) {
+		before, _ := splitService.ListExpenses(ana.ID, group.PublicID)
+		incomingBefore, _ := requestService.ListIncoming(ben.ID, "")
+
+		failing := NewSplitService(splitRepo, userRepo, walletService, &failingMoneyRequestService{MoneyRequestService: requestService, remaining: 1}, db)
+		_, err := failing.AddExpense(ana.ID, group.PublicID, ExpenseInput{
+			Description: "Groceries",
+			Total:       money.FromMajor(30),
+			Split:       models.SplitTypeEqual,
+		})
+		if err == nil {
+			t.Fatal("expected the second money request to fail the expense")
+		}
+
+		after, _ := splitService.ListExpenses(ana.ID, group.PublicID)
+		if len(after) != len(before) {
+			t.Errorf("expected no new expense, got %d expenses instead of %d", len(after), len(before))
+		}
+		incomingAfter, _ := requestService.ListIncoming(ben.ID, "")
+		if len(incomingAfter) != len(incomingBefore) {
+			t.Errorf("expected ben's money request to be rolled back, got %+v", incomingAfter)
+		}
+	})
+
+	t.Run("a share is paid once when settles overlap", func(t *testing.T) {
+		expense, err := splitService.AddExpense(ana.ID, group.PublicID, ExpenseInput{
+			Description: "Museum",
+			Total:       money.FromMajor(30),
+			Split:       models.SplitTypeEqual,
+		})
+		if err != nil {
+			t.Fatalf("failed to add expense: %v", err)
+		}
+
+		// The other settle accepts ben's request between this one finding the
+		// share pending and accepting it
+		interleaving := &interleavingMoneyRequestService{MoneyRequestService: requestService}
+		racing := NewSplitService(splitRepo, userRepo, walletService, interleaving, db)
+		var first *TransferResult
+		interleaving.beforeAccept = func() {
+			if _, first, err = splitService.Settle(ben.ID, group.PublicID, expense.PublicID); err != nil {
+				t.Fatalf("failed to settle: %v", err)
+			}
+		}
+
+		before := balanceOf(ben)
+		if _, _, err := racing.Settle(ben.ID, group.PublicID, expense.PublicID); !errors.Is(err, ErrShareAlreadySettled) {
+			t.Fatalf("expected ErrShareAlreadySettled, got %v", err)
+		}
+		if balanceOf(ben) != before-money.FromMajor(10) {
+			t.Errorf("expected ben to pay 10 once, paid %s", before-balanceOf(ben))
+		}
+		expenses, _ := splitService.ListExpenses(ben.ID, group.PublicID)
+		share := expenses[len(expenses)-1].Shares[1]
+		if share.Status != models.SplitShareStatusPaid || *share.TransferID != first.Transfer.PublicID {
+			t.Errorf("expected ben's share to be paid by the first settle, got %+v", share)
+		}
+
+		// A declined request is settled by a direct transfer, once
+		if _, err := requestService.Decline(cy.ID, *expense.Shares[2].MoneyRequestID); err != nil {
+			t.Fatalf("failed to decline: %v", err)
+		}
+		before = balanceOf(cy)
+		if _, _, err := splitService.Settle(cy.ID, group.PublicID, expense.PublicID); err != nil {
+			t.Fatalf("failed to settle: %v", err)
+		}
+		if _, _, err := splitService.Settle(cy.ID, group.PublicID, expense.PublicID); !errors.Is(err, ErrShareAlreadySettled) {
+			t.Errorf("expected ErrShareAlreadySettled, got %v", err)
+		}
+		if balanceOf(cy) != before-money.FromMajor(10) {
+			t.Errorf("expected cy to pay 10 once, paid %s", before-balanceOf(cy))
+		}
+	})
+}
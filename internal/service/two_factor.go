@@ -0,0 +1,460 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/totp"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("no pending two-factor enrollment; enroll first")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidLoginChallenge   = errors.New("invalid or expired login challenge")
+	ErrTwoFactorLocked         = errors.New("too many invalid two-factor codes; try again later")
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes issued at a time
+	RecoveryCodeCount = 10
+	// MaxChallengeAttempts is the number of wrong codes after which a login
+	// challenge stops working and the user has to enter their password again
+	MaxChallengeAttempts = 5
+	// MaxTwoFactorFailures is the number of wrong codes in a row, over any
+	// number of challenges, after which the user's second factor is locked
+	MaxTwoFactorFailures = 10
+	// TwoFactorLockout is how long a locked second factor refuses every code.
+	// Each wrong code after a lockout locks it again until a code is right.
+	TwoFactorLockout = 15 * time.Minute
+)
+
+// recoveryCodeEncoding spells recovery codes in lowercase base32
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// LoginResult is the outcome of the password step of a login: either the
+// tokens of a new session, or, for a user with two-factor authentication, a
+// challenge to complete with VerifyLogin
+type LoginResult struct {
+	Tokens    *TokenPair
+	User      *models.User
+	Challenge *TwoFactorChallenge
+}
+
+// TwoFactorChallenge is the opaque token that stands for a correct password
+// until a code is entered
+type TwoFactorChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// TOTPEnrollment is what an authenticator app needs to generate codes
+type TOTPEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// VerifyLogin completes a login that needs a second factor. The code is
+// either the current code of the user's authenticator app or one of their
+// recovery codes. Every wrong code counts against the challenge and against
+// the user's second factor.
+func (s *authService) VerifyLogin(challengeToken, code string) (*TokenPair, *models.User, error) {
+	var userID uint
+	invalid := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		challenge, err := s.twoFactorRepo.FindChallengeByHashForUpdate(tx, hashToken(challengeToken))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidLoginChallenge
+			}
+			return fmt.Errorf("error finding login challenge: %w", err)
+		}
+
+		now := time.Now()
+		if challenge.UsedAt != nil || !now.Before(challenge.ExpiresAt) || challenge.Attempts >= MaxChallengeAttempts {
+			return ErrInvalidLoginChallenge
+		}
+
+		// Two-factor authentication may have been disabled since the password step
+		credential, err := s.twoFactorRepo.FindCredentialForUpdate(tx, challenge.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidLoginChallenge
+			}
+			return fmt.Errorf("error finding TOTP credential: %w", err)
+		}
+		if !credential.Confirmed() {
+			return ErrInvalidLoginChallenge
+		}
+
+		ok, err := s.verifyTwoFactorCode(tx, credential, code, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Commit the failed attempt, then report it
+			invalid = true
+			challenge.Attempts++
+		} else {
+			challenge.UsedAt = &now
+			userID = challenge.UserID
+		}
+		if err := s.twoFactorRepo.SaveChallenge(tx, challenge); err != nil {
+			return fmt.Errorf("error updating login challenge: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if invalid {
+		return nil, nil, ErrInvalidTwoFactorCode
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidLoginChallenge
+		}
+		return nil, nil, fmt.Errorf("error finding user: %w", err)
+	}
+	tokens, err := s.issueTokens(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// EnrollTOTP generates a new authenticator secret for the user. It does not
+// take effect until ConfirmTOTP; enrolling again replaces a pending secret.
+func (s *authService) EnrollTOTP(userID uint) (*TOTPEnrollment, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		credential, err := s.twoFactorRepo.FindCredentialForUpdate(tx, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			credential = &models.TOTPCredential{UserID: userID}
+		} else if err != nil {
+			return fmt.Errorf("error finding TOTP credential: %w", err)
+		}
+		if credential.Confirmed() {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		credential.Secret = secret
+		credential.LastCounter = 0
+		if err := s.twoFactorRepo.SaveCredential(tx, credential); err != nil {
+			return fmt.Errorf("error saving TOTP credential: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, s.totpIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user enters a code
+// from the enrolled app, and returns the recovery codes. They are shown only
+// this once.
+func (s *authService) ConfirmTOTP(userID uint, code string) ([]string, error) {
+	var recoveryCodes []string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		credential, err := s.twoFactorRepo.FindCredentialForUpdate(tx, userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTwoFactorNotEnrolled
+			}
+			return fmt.Errorf("error finding TOTP credential: %w", err)
+		}
+		if credential.Confirmed() {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		now := time.Now()
+		counter, ok, err := totp.Validate(credential.Secret, code, now)
+		if err != nil {
+			return fmt.Errorf("error validating TOTP code: %w", err)
+		}
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		credential.ConfirmedAt = &now
+		credential.LastCounter = counter
+		if err := s.twoFactorRepo.SaveCredential(tx, credential); err != nil {
+			return fmt.Errorf("error saving TOTP credential: %w", err)
+		}
+
+		recoveryCodes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not,
+// with new ones. It needs a valid code, like disabling.
+func (s *authService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var recoveryCodes []string
+
+	err := s.withTwoFactorCode(userID, code, func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns two-factor authentication off and deletes the secret and
+// recovery codes. It needs a valid code, so a stolen session alone cannot
+// remove the second factor.
+func (s *authService) DisableTOTP(userID uint, code string) error {
+	return s.withTwoFactorCode(userID, code, func(tx *gorm.DB) error {
+		if err := s.twoFactorRepo.DeleteCredential(tx, userID); err != nil {
+			return fmt.Errorf("error deleting TOTP credential: %w", err)
+		}
+		if err := s.twoFactorRepo.DeleteRecoveryCodes(tx, userID); err != nil {
+			return fmt.Errorf("error deleting recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteExpiredLoginChallenges deletes the login challenges that expired at or
+// before now and returns how many were deleted
+func (s *authService) DeleteExpiredLoginChallenges(now time.Time) (int64, error) {
+	deleted, err := s.twoFactorRepo.DeleteExpiredChallenges(now)
+	if err != nil {
+		return deleted, fmt.Errorf("error deleting expired login challenges: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *authService) TwoFactorStatus(userID uint) (*TwoFactorStatus, error) {
+	credential, err := s.twoFactorRepo.FindCredential(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !credential.Confirmed()) {
+		return &TwoFactorStatus{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding TOTP credential: %w", err)
+	}
+
+	left, err := s.twoFactorRepo.CountUnusedRecoveryCodes(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting recovery codes: %w", err)
+	}
+
+	return &TwoFactorStatus{
+		Enabled:           true,
+		EnabledAt:         credential.ConfirmedAt,
+		RecoveryCodesLeft: left,
+	}, nil
+}
+
+// startChallenge returns a login challenge if the user has two-factor
+// authentication enabled, and nil otherwise
+func (s *authService) startChallenge(user *models.User) (*TwoFactorChallenge, error) {
+	credential, err := s.twoFactorRepo.FindCredential(user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding TOTP credential: %w", err)
+	}
+	if !credential.Confirmed() {
+		return nil, nil
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating login challenge: %w", err)
+	}
+	challenge := &models.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.challengeTTL),
+	}
+	if err := s.twoFactorRepo.CreateChallenge(challenge); err != nil {
+		return nil, fmt.Errorf("error creating login challenge: %w", err)
+	}
+
+	return &TwoFactorChallenge{
+		Token:     token,
+		ExpiresAt: challenge.ExpiresAt,
+	}, nil
+}
+
+// withTwoFactorCode runs fn in a transaction once code is verified against
+// the user's enabled second factor. A wrong code is counted like one entered
+// at login.
+func (s *authService) withTwoFactorCode(userID uint, code string, fn func(tx *gorm.DB) error) error {
+	invalid := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		credential, err := s.twoFactorRepo.FindCredentialForUpdate(tx, userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTwoFactorNotEnabled
+			}
+			return fmt.Errorf("error finding TOTP credential: %w", err)
+		}
+		if !credential.Confirmed() {
+			return ErrTwoFactorNotEnabled
+		}
+
+		ok, err := s.verifyTwoFactorCode(tx, credential, code, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Commit the failed attempt, then report it
+			invalid = true
+			return nil
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		return err
+	}
+	if invalid {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// verifyTwoFactorCode checks a code with checkTwoFactorCode unless the second
+// factor is locked, and keeps count of the wrong codes in a row. The caller
+// must commit tx for a wrong code to count.
+func (s *authService) verifyTwoFactorCode(tx *gorm.DB, credential *models.TOTPCredential, code string, now time.Time) (bool, error) {
+	if credential.Locked(now) {
+		return false, ErrTwoFactorLocked
+	}
+
+	ok, err := s.checkTwoFactorCode(tx, credential, code, now)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		credential.FailedAttempts = 0
+		credential.LockedUntil = nil
+	} else {
+		credential.FailedAttempts++
+		if credential.FailedAttempts >= MaxTwoFactorFailures {
+			lockedUntil := now.Add(TwoFactorLockout)
+			credential.LockedUntil = &lockedUntil
+		}
+	}
+	if err := s.twoFactorRepo.SaveCredential(tx, credential); err != nil {
+		return false, fmt.Errorf("error saving TOTP credential: %w", err)
+	}
+	return ok, nil
+}
+
+// checkTwoFactorCode accepts a TOTP code newer than the last one accepted, or
+// an unused recovery code, and consumes it
+func (s *authService) checkTwoFactorCode(tx *gorm.DB, credential *models.TOTPCredential, code string, now time.Time) (bool, error) {
+	counter, ok, err := totp.Validate(credential.Secret, code, now)
+	if err != nil {
+		return false, fmt.Errorf("error validating TOTP code: %w", err)
+	}
+	if ok {
+		if counter <= credential.LastCounter {
+			return false, nil
+		}
+		credential.LastCounter = counter
+		if err := s.twoFactorRepo.SaveCredential(tx, credential); err != nil {
+			return false, fmt.Errorf("error saving TOTP credential: %w", err)
+		}
+		return true, nil
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(tx, credential.UserID, hashToken(normalizeRecoveryCode(code)), now)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	return used, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and issues a new set
+func (s *authService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := s.twoFactorRepo.DeleteRecoveryCodes(tx, userID); err != nil {
+		return nil, fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]models.RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}
+	}
+	if err := s.twoFactorRepo.CreateRecoveryCodes(tx, records); err != nil {
+		return nil, fmt.Errorf("error creating recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCode returns 50 random bits as ten base32 characters in two
+// groups, e.g. "k7mq2-xw4ta"
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 7)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := recoveryCodeEncoding.EncodeToString(raw)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode lets a recovery code be typed without the dash, with
+// spaces or in capitals
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -3,9 +3,15 @@ package service
 import (
 	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -14,145 +20,483 @@ var (
 	ErrRecipientNotFound   = errors.New("recipient not found")
 	ErrInvalidAmount       = errors.New("amount must be greater than 0")
 	ErrSelfTransfer        = errors.New("cannot transfer to yourself")
+	ErrTransferNotFound    = errors.New("transfer not found")
 )
 
 type WalletService interface {
-	GetWallet(userID uint) (*models.Wallet, []models.Transaction, error)
-	Transfer(senderID uint, recipientEmail string, amount float64, notes string, idempotencyKey string) error
+	GetWallet(userID uint) (*models.Wallet, *TransactionPage, error)
+	ListTransactions(userID uint, query TransactionQuery) (*TransactionPage, error)
+	ListWallets(userID uint) ([]models.Wallet, error)
+	OpenWallet(userID uint, currency string) (*models.Wallet, error)
+	Transfer(senderID uint, recipientEmail string, amount money.Amount, currency string, notes string, idempotencyKey string) (*TransferResult, error)
+	QuoteTransfer(senderID uint, recipientEmail string, amount money.Amount, currency string) (*FeeQuote, error)
+	GetTransfer(userID uint, transferID string) (*models.Transfer, error)
+	GetBalanceAt(userID uint, currency string, at time.Time) (*BalanceAt, error)
+	Refund(userID uint, transferID string, amount *money.Amount, notes string, idempotencyKey string) (*TransferResult, error)
+	Reverse(adminID uint, transferID string, amount *money.Amount, reason string, idempotencyKey string) (*TransferResult, error)
+	AuthorizeHold(userID uint, recipientEmail string, amount money.Amount, currency string, notes string, idempotencyKey string) (*HoldResult, error)
+	CaptureHold(userID uint, holdID string, amount *money.Amount, idempotencyKey string) (*TransferResult, error)
+	VoidHold(userID uint, holdID string) (*models.Hold, error)
+	GetHold(userID uint, holdID string) (*models.Hold, error)
+	ExpireHolds(now time.Time) (int, error)
+	BatchTransfer(senderID uint, mode models.TransferBatchMode, items []BatchItem, idempotencyKey string) (*BatchResult, error)
+	GetBatch(userID uint, batchID string) (*models.TransferBatch, error)
+	GetLimits(userID uint) (*LimitStatus, error)
+	SetLimits(userID uint, override *models.TransferLimit) (*LimitStatus, error)
+	ListRates() ([]models.ExchangeRate, error)
+	SetRate(from, to string, rate money.Rate, spread money.Amount) (*models.ExchangeRate, error)
+	DeleteRate(from, to string) error
+	ImportRates(r io.Reader) (int, error)
+	QuoteConversion(userID uint, from, to string, amount money.Amount) (*models.FXQuote, error)
+	Convert(userID uint, quoteID string, recipientEmail string, notes string, idempotencyKey string) (*TransferResult, error)
+	DeleteExpiredIdempotencyKeys(now time.Time) (int64, error)
+}
+
+// BalanceAt is a wallet's balance at a point in time
+type BalanceAt struct {
+	WalletID uint         `json:"wallet_id"`
+	Currency string       `json:"currency"`
+	Balance  money.Amount `json:"balance"`
+	At       time.Time    `json:"at"`
+}
+
+// TransferResult wraps the transfer created by WalletService.Transfer.
+// Replayed is set when the transfer was returned for a repeated idempotency key.
+type TransferResult struct {
+	Transfer *models.Transfer
+	Replayed bool
 }
 
 type walletService struct {
 	userRepo        repository.UserRepository
 	walletRepo      repository.WalletRepository
 	transactionRepo repository.TransactionRepository
+	transferRepo    repository.TransferRepository
+	holdRepo        repository.HoldRepository
+	limitRepo       repository.LimitRepository
+	fxRepo          repository.FXRepository
+	ledger          *ledger
+	idempotency     *idempotencyStore
 	db              *gorm.DB
+	holdTTL         time.Duration
+	fxQuoteTTL      time.Duration
+	limits          Limits
+	fees            FeePolicy
+}
+
+// WalletOptions are the settings of a WalletService: how long idempotency
+// keys, holds and FX quotes last, and the default limits and fees. Zero
+// limits and fees turn them off.
+type WalletOptions struct {
+	IdempotencyTTL time.Duration
+	HoldTTL        time.Duration
+	FXQuoteTTL     time.Duration
+	Limits         Limits
+	Fees           FeePolicy
 }
 
 func NewWalletService(
 	userRepo repository.UserRepository,
 	walletRepo repository.WalletRepository,
 	transactionRepo repository.TransactionRepository,
+	transferRepo repository.TransferRepository,
+	ledgerRepo repository.LedgerRepository,
+	idempotencyRepo repository.IdempotencyRepository,
+	holdRepo repository.HoldRepository,
+	limitRepo repository.LimitRepository,
+	fxRepo repository.FXRepository,
 	db *gorm.DB,
+	options WalletOptions,
 ) WalletService {
 	return &walletService{
 		userRepo:        userRepo,
 		walletRepo:      walletRepo,
 		transactionRepo: transactionRepo,
+		transferRepo:    transferRepo,
+		holdRepo:        holdRepo,
+		limitRepo:       limitRepo,
+		fxRepo:          fxRepo,
+		ledger:          newLedger(ledgerRepo, walletRepo),
+		idempotency:     newIdempotencyStore(idempotencyRepo, options.IdempotencyTTL),
 		db:              db,
+		holdTTL:         options.HoldTTL,
+		fxQuoteTTL:      options.FXQuoteTTL,
+		limits:          options.Limits,
+		fees:            options.Fees,
 	}
 }
 
-func (s *walletService) GetWallet(userID uint) (*models.Wallet, []models.Transaction, error) {
+func (s *walletService) GetWallet(userID uint) (*models.Wallet, *TransactionPage, error) {
 	// Get wallet
 	wallet, err := s.walletRepo.FindByUserID(userID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error finding wallet: %w", err)
 	}
 
-	// Get recent transactions (limit 50)
-	transactions, err := s.transactionRepo.FindByWalletID(wallet.ID, 50)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, nil, fmt.Errorf("error finding transactions: %w", err)
+	// Get the latest page of transactions
+	page, err := s.listTransactions(wallet.ID, TransactionQuery{})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return wallet, transactions, nil
+	return wallet, page, nil
 }
 
-func (s *walletService) Transfer(senderID uint, recipientEmail string, amount float64, notes string, idempotencyKey string) error {
-	// Check for duplicate request using idempotency key
-	if idempotencyKey != "" {
-		existingTx, err := s.transactionRepo.FindByIdempotencyKey(idempotencyKey)
-		if err == nil && existingTx != nil {
-			// Transaction already processed, return success (idempotent)
-			return nil
-		}
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("error checking idempotency: %w", err)
-		}
+// Transfer sends amount from the sender's wallet in currency, or their primary
+// wallet when currency is empty, to the recipient's wallet in the same currency
+func (s *walletService) Transfer(senderID uint, recipientEmail string, amount money.Amount, currency string, notes string, idempotencyKey string) (*TransferResult, error) {
+	// Reserve the idempotency key, or replay the response it already produced
+	var replay models.Transfer
+	record, replayed, err := s.idempotency.begin(
+		senderID,
+		idempotencyKey,
+		fingerprint("transfer", senderID, strings.ToLower(recipientEmail), amount, strings.ToUpper(currency), notes),
+		&replay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &TransferResult{Transfer: &replay, Replayed: true}, nil
+	}
+
+	transfer, err := s.transfer(senderID, recipientEmail, amount, currency, notes, record)
+	if err != nil {
+		s.idempotency.release(record)
+		return nil, err
 	}
+	return &TransferResult{Transfer: transfer}, nil
+}
 
+func (s *walletService) transfer(senderID uint, recipientEmail string, amount money.Amount, currency string, notes string, record *models.IdempotencyRecord) (*models.Transfer, error) {
 	// Validate amount
 	if amount <= 0 {
-		return ErrInvalidAmount
+		return nil, ErrInvalidAmount
 	}
 
 	// Find sender
 	sender, err := s.userRepo.FindByID(senderID)
 	if err != nil {
-		return fmt.Errorf("error finding sender: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error finding sender: %w", err)
 	}
 
 	// Find recipient
 	recipient, err := s.userRepo.FindByEmail(recipientEmail)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrRecipientNotFound
+			return nil, ErrRecipientNotFound
 		}
-		return fmt.Errorf("error finding recipient: %w", err)
+		return nil, fmt.Errorf("error finding recipient: %w", err)
 	}
 
 	// Check self-transfer
 	if sender.ID == recipient.ID {
-		return ErrSelfTransfer
+		return nil, ErrSelfTransfer
 	}
 
-	// Execute transfer in transaction
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Get sender wallet with row lock
-		senderWallet, err := s.walletRepo.FindByUserID(sender.ID)
-		if err != nil {
-			return fmt.Errorf("error finding sender wallet: %w", err)
+	// Resolve wallet IDs up front; balances are read again under lock below
+	senderWallet, err := s.findWallet(sender.ID, currency)
+	if err != nil {
+		return nil, err
+	}
+	recipientWallet, err := s.recipientWallet(recipient.ID, senderWallet.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	params := transferParams{
+		senderWalletID:    senderWallet.ID,
+		recipientWalletID: recipientWallet.ID,
+		senderID:          sender.ID,
+		recipientID:       recipient.ID,
+		amount:            amount,
+		notes:             notes,
+		kind:              models.TransferKindTransfer,
+		entryKind:         models.JournalEntryKindTransfer,
+		initiated:         true,
+	}
+	params.ledgerKey = s.idempotency.ledgerKey("transfer", record)
+
+	// Execute transfer in transaction, retrying on serialization failures and deadlocks
+	var transfer *models.Transfer
+	err = withRetry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			transfer, err = s.executeTransfer(tx, params)
+			if err != nil {
+				return err
+			}
+			return s.idempotency.complete(tx, record, transfer)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// DeleteExpiredIdempotencyKeys forgets the keys whose TTL has passed and the
+// reservations whose lease ran out
+func (s *walletService) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	return s.idempotency.deleteExpired(now)
+}
+
+func (s *walletService) GetTransfer(userID uint, transferID string) (*models.Transfer, error) {
+	transfer, err := s.transferRepo.FindByPublicID(transferID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransferNotFound
 		}
+		return nil, fmt.Errorf("error finding transfer: %w", err)
+	}
 
-		// Get recipient wallet with row lock
-		recipientWallet, err := s.walletRepo.FindByUserID(recipient.ID)
+	// Only the two parties of a transfer may see it, from any of their wallets
+	for _, walletID := range []uint{transfer.SenderWalletID, transfer.RecipientWalletID} {
+		owned, err := s.ownsWallet(userID, walletID)
 		if err != nil {
-			return fmt.Errorf("error finding recipient wallet: %w", err)
+			return nil, err
 		}
-
-		// Check sufficient balance
-		if senderWallet.Balance < amount {
-			return ErrInsufficientBalance
+		if owned {
+			return transfer, nil
 		}
+	}
+	return nil, ErrTransferNotFound
+}
 
-		// Update balances
-		newSenderBalance := senderWallet.Balance - amount
-		newRecipientBalance := recipientWallet.Balance + amount
+// GetBalanceAt answers from the ledger what the user's wallet in currency, or
+// their primary wallet when currency is empty, held at the given time
+func (s *walletService) GetBalanceAt(userID uint, currency string, at time.Time) (*BalanceAt, error) {
+	wallet, err := s.findWallet(userID, currency)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := s.walletRepo.UpdateBalance(tx, senderWallet.ID, newSenderBalance); err != nil {
-			return fmt.Errorf("error updating sender balance: %w", err)
-		}
+	balance, err := s.ledger.walletBalanceAt(s.db, wallet.ID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BalanceAt{WalletID: wallet.ID, Currency: wallet.Currency, Balance: balance, At: at}, nil
+}
+
+// transferParams describes a movement of money between two wallets
+type transferParams struct {
+	senderWalletID    uint
+	recipientWalletID uint
+	senderID          uint
+	recipientID       uint
+	amount            money.Amount
+	notes             string
+	kind              models.TransferKind
+	entryKind         models.JournalEntryKind
+	// originalTransferID is the public ID of the transfer a refund returns
+	originalTransferID *string
+	// batchID is the public ID of the batch the transfer belongs to
+	batchID *string
+	// initiated marks a transfer the sender made themselves: it is checked
+	// against their transfer limits and charged the transfer fee
+	initiated bool
+	// conversion is the locked quote of a transfer that converts currencies
+	conversion *models.FXQuote
+	// ledgerKey is written to the legs' unique idempotency_key column as a last
+	// line of defence against double execution; the transfer ID is used if empty
+	ledgerKey string
+}
 
-		if err := s.walletRepo.UpdateBalance(tx, recipientWallet.ID, newRecipientBalance); err != nil {
-			return fmt.Errorf("error updating recipient balance: %w", err)
+// executeTransfer moves money between two wallets inside tx and records the
+// transfer with its debit and credit legs. Both wallets are locked before the
+// balance check so concurrent transfers cannot overdraw.
+func (s *walletService) executeTransfer(tx *gorm.DB, p transferParams) (*models.Transfer, error) {
+	wallets, err := s.lockWallets(tx, p.senderWalletID, p.recipientWalletID)
+	if err != nil {
+		return nil, err
+	}
+	return s.recordTransfer(tx, wallets[p.senderWalletID], wallets[p.recipientWalletID], p)
+}
+
+// recordTransfer does the work of executeTransfer once the caller holds the
+// locks of both wallets
+func (s *walletService) recordTransfer(tx *gorm.DB, senderWallet, recipientWallet *models.Wallet, p transferParams) (*models.Transfer, error) {
+	// Money moves between wallets of the same currency unless converted at a
+	// quoted rate, and then only between the quoted currencies
+	from, to := senderWallet.Currency, recipientWallet.Currency
+	credited := p.amount
+	if p.conversion != nil {
+		if from != p.conversion.FromCurrency || to != p.conversion.ToCurrency {
+			return nil, fmt.Errorf("%w: quote converts %s to %s", ErrCurrencyMismatch, p.conversion.FromCurrency, p.conversion.ToCurrency)
 		}
+		credited = p.conversion.ConvertedAmount
+	} else if from != to {
+		return nil, fmt.Errorf("%w: %s to %s", ErrCurrencyMismatch, from, to)
+	}
+	if err := checkAmount(senderWallet, p.amount); err != nil {
+		return nil, err
+	}
 
-		// Create debit transaction for sender
-		debitTx := &models.Transaction{
-			WalletID:       senderWallet.ID,
-			Amount:         amount,
-			Type:           models.TransactionTypeDebit,
-			RelatedUserID:  &recipient.ID,
-			Notes:          notes,
-			IdempotencyKey: idempotencyKey,
+	// The fee is paid on top of the amount, so price the transfer first
+	var fee money.Amount
+	if p.initiated {
+		if err := s.lockSender(tx, p.senderID); err != nil {
+			return nil, err
 		}
-		if err := s.transactionRepo.Create(tx, debitTx); err != nil {
-			return fmt.Errorf("error creating debit transaction: %w", err)
+		var err error
+		if fee, err = s.transferFee(tx, senderWallet, p.amount); err != nil {
+			return nil, err
 		}
+	}
 
-		// Create credit transaction for recipient
-		creditTx := &models.Transaction{
-			WalletID:       recipientWallet.ID,
-			Amount:         amount,
-			Type:           models.TransactionTypeCredit,
-			RelatedUserID:  &sender.ID,
-			Notes:          notes,
-			IdempotencyKey: idempotencyKey + "-credit", // Different key for credit side
+	// Check sufficient balance; held funds cannot be spent
+	if senderWallet.AvailableBalance() < p.amount+fee {
+		return nil, ErrInsufficientBalance
+	}
+	if p.initiated {
+		if err := s.checkLimits(tx, p.senderID, senderWallet.Currency, p.amount); err != nil {
+			return nil, err
 		}
-		if err := s.transactionRepo.Create(tx, creditTx); err != nil {
-			return fmt.Errorf("error creating credit transaction: %w", err)
+	}
+
+	// Create the transfer both legs point to
+	transfer := &models.Transfer{
+		PublicID:           uuid.NewString(),
+		Kind:               p.kind,
+		OriginalTransferID: p.originalTransferID,
+		BatchID:            p.batchID,
+		SenderWalletID:     senderWallet.ID,
+		RecipientWalletID:  recipientWallet.ID,
+		Amount:             p.amount,
+		Fee:                fee,
+		Notes:              p.notes,
+		Status:             models.TransferStatusCompleted,
+	}
+	if p.conversion != nil {
+		transfer.ConvertedAmount = &credited
+		transfer.ExchangeRate = &p.conversion.Rate
+		transfer.Spread = &p.conversion.Spread
+	}
+	if err := s.transferRepo.Create(tx, transfer); err != nil {
+		return nil, fmt.Errorf("error creating transfer: %w", err)
+	}
+
+	debitEntry, creditEntry, err := s.postTransfer(tx, transfer, p, credited)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgerKey := p.ledgerKey
+	if ledgerKey == "" {
+		ledgerKey = transfer.PublicID
+	}
+
+	// The wallets are locked, so their balances after this transfer are exact
+	senderBalance := senderWallet.Balance - p.amount
+	recipientBalance := recipientWallet.Balance + credited
+
+	// Create debit transaction for sender
+	debitTx := &models.Transaction{
+		WalletID:       senderWallet.ID,
+		TransferID:     &transfer.ID,
+		JournalEntryID: &debitEntry.ID,
+		Amount:         p.amount,
+		Fee:            fee,
+		ExchangeRate:   transfer.ExchangeRate,
+		Spread:         transfer.Spread,
+		BalanceAfter:   &senderBalance,
+		Type:           models.TransactionTypeDebit,
+		RelatedUserID:  &p.recipientID,
+		Notes:          p.notes,
+		IdempotencyKey: ledgerKey,
+	}
+	if err := s.transactionRepo.Create(tx, debitTx); err != nil {
+		return nil, fmt.Errorf("error creating debit transaction: %w", err)
+	}
+
+	// Create credit transaction for recipient
+	creditTx := &models.Transaction{
+		WalletID:       recipientWallet.ID,
+		TransferID:     &transfer.ID,
+		JournalEntryID: &creditEntry.ID,
+		Amount:         credited,
+		ExchangeRate:   transfer.ExchangeRate,
+		Spread:         transfer.Spread,
+		BalanceAfter:   &recipientBalance,
+		Type:           models.TransactionTypeCredit,
+		RelatedUserID:  &p.senderID,
+		Notes:          p.notes,
+		IdempotencyKey: ledgerKey + "-credit", // Different key for credit side
+	}
+	if err := s.transactionRepo.Create(tx, creditTx); err != nil {
+		return nil, fmt.Errorf("error creating credit transaction: %w", err)
+	}
+
+	if fee > 0 {
+		if _, err := s.chargeFee(tx, senderWallet.ID, transfer, senderBalance, ledgerKey); err != nil {
+			return nil, err
 		}
+	}
 
-		return nil
-	})
+	transfer.Legs = []models.Transaction{*debitTx, *creditTx}
+	return transfer, nil
+}
+
+// postTransfer posts the double entry of a transfer; this also updates both
+// cached wallet balances. A conversion is posted as one entry per currency,
+// into the FX account of the source currency and out of the FX account of the
+// target currency. It returns the entries of the debit and the credit leg.
+func (s *walletService) postTransfer(tx *gorm.DB, transfer *models.Transfer, p transferParams, credited money.Amount) (*models.JournalEntry, *models.JournalEntry, error) {
+	debitLine, err := s.ledger.walletLine(tx, transfer.SenderWalletID, -transfer.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	creditLine, err := s.ledger.walletLine(tx, transfer.RecipientWalletID, credited)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.conversion == nil {
+		entry, err := s.ledger.post(tx, p.entryKind, &transfer.ID, p.notes, debitLine, creditLine)
+		if err != nil {
+			return nil, nil, err
+		}
+		return entry, entry, nil
+	}
+
+	sourceLine, err := s.ledger.systemLine(tx, models.FXAccountCode(p.conversion.FromCurrency), transfer.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetLine, err := s.ledger.systemLine(tx, models.FXAccountCode(p.conversion.ToCurrency), -credited)
+	if err != nil {
+		return nil, nil, err
+	}
+	debitEntry, err := s.ledger.post(tx, p.entryKind, &transfer.ID, p.notes, debitLine, sourceLine)
+	if err != nil {
+		return nil, nil, err
+	}
+	creditEntry, err := s.ledger.post(tx, p.entryKind, &transfer.ID, p.notes, targetLine, creditLine)
+	if err != nil {
+		return nil, nil, err
+	}
+	return debitEntry, creditEntry, nil
+}
+
+// lockWallets locks the given wallets FOR UPDATE in ascending ID order so that
+// concurrent transfers between the same pair of wallets can never deadlock
+func (s *walletService) lockWallets(tx *gorm.DB, walletIDs ...uint) (map[uint]*models.Wallet, error) {
+	ids := slices.Clone(walletIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	wallets := make(map[uint]*models.Wallet, len(ids))
+	for _, id := range ids {
+		wallet, err := s.walletRepo.FindByIDForUpdate(tx, id)
+		if err != nil {
+			return nil, fmt.Errorf("error locking wallet %d: %w", id, err)
+		}
+		wallets[id] = wallet
+	}
+	return wallets, nil
 }
@@ -2,10 +2,17 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
 	"github.com/roychanmeliaz/btechdevcases/internal/models"
 	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -16,7 +23,7 @@ func setupWalletTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("failed to connect to test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{})
+	err = database.Migrate(db)
 	if err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
@@ -33,57 +40,117 @@ func createTestUser(t *testing.T, db *gorm.DB, email string) *models.User {
 		t.Fatalf("failed to create test user: %v", err)
 	}
 
-	wallet := &models.Wallet{
-		UserID:  user.ID,
-		Balance: 1000.0,
-	}
-	if err := db.Create(wallet).Error; err != nil {
+	// Open the wallet with 1000 funded by the treasury so the ledger stays balanced
+	ledger := newLedger(repository.NewLedgerRepository(db), repository.NewWalletRepository(db))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		wallet := &models.Wallet{UserID: user.ID, Currency: models.DefaultCurrency}
+		if err := tx.Create(wallet).Error; err != nil {
+			return err
+		}
+		if err := ledger.openWallet(tx, wallet); err != nil {
+			return err
+		}
+		walletLine, err := ledger.walletLine(tx, wallet.ID, money.FromMajor(1000))
+		if err != nil {
+			return err
+		}
+		treasuryLine, err := ledger.systemLine(tx, models.AccountCodeTreasury, -money.FromMajor(1000))
+		if err != nil {
+			return err
+		}
+		_, err = ledger.post(tx, models.JournalEntryKindOpeningBalance, nil, "Opening balance", walletLine, treasuryLine)
+		return err
+	})
+	if err != nil {
 		t.Fatalf("failed to create test wallet: %v", err)
 	}
 
 	return user
 }
 
+// newTestWalletService builds a wallet service on db. Idempotency keys and
+// holds last an hour and FX quotes a minute; options can set limits and fees.
+func newTestWalletService(db *gorm.DB, options ...WalletOptions) WalletService {
+	opts := WalletOptions{IdempotencyTTL: time.Hour, HoldTTL: time.Hour, FXQuoteTTL: time.Minute}
+	for _, o := range options {
+		opts.Limits, opts.Fees = o.Limits, o.Fees
+	}
+	return NewWalletService(
+		repository.NewUserRepository(db),
+		repository.NewWalletRepository(db),
+		repository.NewTransactionRepository(db),
+		repository.NewTransferRepository(db),
+		repository.NewLedgerRepository(db),
+		repository.NewIdempotencyRepository(db),
+		repository.NewHoldRepository(db),
+		repository.NewLimitRepository(db),
+		repository.NewFXRepository(db),
+		db,
+		opts,
+	)
+}
+
+// fundWallet credits a wallet from the treasury
+func fundWallet(t *testing.T, db *gorm.DB, wallet *models.Wallet, amount money.Amount) {
+	t.Helper()
+	ledger := newLedger(repository.NewLedgerRepository(db), repository.NewWalletRepository(db))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		walletLine, err := ledger.walletLine(tx, wallet.ID, amount)
+		if err != nil {
+			return err
+		}
+		treasuryLine, err := ledger.systemLine(tx, models.AccountCodeTreasury, -amount)
+		if err != nil {
+			return err
+		}
+		_, err = ledger.post(tx, models.JournalEntryKindOpeningBalance, nil, "Opening balance", walletLine, treasuryLine)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to fund wallet: %v", err)
+	}
+}
+
 func TestWalletService_GetWallet(t *testing.T) {
 	db := setupWalletTestDB(t)
-	userRepo := repository.NewUserRepository(db)
-	walletRepo := repository.NewWalletRepository(db)
-	transactionRepo := repository.NewTransactionRepository(db)
 
-	walletService := NewWalletService(userRepo, walletRepo, transactionRepo, db)
+	walletService := newTestWalletService(db)
 
 	user := createTestUser(t, db, "wallet@example.com")
 
 	t.Run("get wallet with no transactions", func(t *testing.T) {
-		wallet, transactions, err := walletService.GetWallet(user.ID)
+		wallet, page, err := walletService.GetWallet(user.ID)
 		if err != nil {
 			t.Errorf("expected no error, got %v", err)
 		}
 		if wallet == nil {
 			t.Error("expected wallet, got nil")
 		}
-		if wallet.Balance != 1000.0 {
-			t.Errorf("expected balance 1000, got %f", wallet.Balance)
+		if wallet.Balance != money.FromMajor(1000) {
+			t.Errorf("expected balance 1000, got %s", wallet.Balance)
+		}
+		if len(page.Transactions) != 0 {
+			t.Errorf("expected 0 transactions, got %d", len(page.Transactions))
 		}
-		if len(transactions) != 0 {
-			t.Errorf("expected 0 transactions, got %d", len(transactions))
+		if page.HasMore {
+			t.Error("expected no more transactions")
 		}
 	})
 }
 
 func TestWalletService_Transfer(t *testing.T) {
 	db := setupWalletTestDB(t)
-	userRepo := repository.NewUserRepository(db)
 	walletRepo := repository.NewWalletRepository(db)
 	transactionRepo := repository.NewTransactionRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
 
-	walletService := NewWalletService(userRepo, walletRepo, transactionRepo, db)
+	walletService := newTestWalletService(db)
 
 	sender := createTestUser(t, db, "sender@example.com")
 	recipient := createTestUser(t, db, "recipient@example.com")
 
 	t.Run("successful transfer", func(t *testing.T) {
-		err := walletService.Transfer(sender.ID, recipient.Email, 200.0, "Test payment", "test-key-1")
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(200), "", "Test payment", "test-key-1")
 		if err != nil {
 			t.Errorf("expected no error, got %v", err)
 		}
@@ -93,8 +160,8 @@ func TestWalletService_Transfer(t *testing.T) {
 		if err != nil {
 			t.Errorf("failed to get sender wallet: %v", err)
 		}
-		if senderWallet.Balance != 800.0 {
-			t.Errorf("expected sender balance 800, got %f", senderWallet.Balance)
+		if senderWallet.Balance != money.FromMajor(800) {
+			t.Errorf("expected sender balance 800, got %s", senderWallet.Balance)
 		}
 
 		// Verify recipient balance
@@ -102,8 +169,8 @@ func TestWalletService_Transfer(t *testing.T) {
 		if err != nil {
 			t.Errorf("failed to get recipient wallet: %v", err)
 		}
-		if recipientWallet.Balance != 1200.0 {
-			t.Errorf("expected recipient balance 1200, got %f", recipientWallet.Balance)
+		if recipientWallet.Balance != money.FromMajor(1200) {
+			t.Errorf("expected recipient balance 1200, got %s", recipientWallet.Balance)
 		}
 
 		// Verify transactions were created
@@ -131,33 +198,33 @@ func TestWalletService_Transfer(t *testing.T) {
 	})
 
 	t.Run("insufficient balance", func(t *testing.T) {
-		err := walletService.Transfer(sender.ID, recipient.Email, 10000.0, "Too much", "test-key-2")
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(10000), "", "Too much", "test-key-2")
 		if !errors.Is(err, ErrInsufficientBalance) {
 			t.Errorf("expected ErrInsufficientBalance, got %v", err)
 		}
 	})
 
 	t.Run("recipient not found", func(t *testing.T) {
-		err := walletService.Transfer(sender.ID, "nonexistent@example.com", 50.0, "To nobody", "test-key-3")
+		_, err := walletService.Transfer(sender.ID, "nonexistent@example.com", money.FromMajor(50), "", "To nobody", "test-key-3")
 		if !errors.Is(err, ErrRecipientNotFound) {
 			t.Errorf("expected ErrRecipientNotFound, got %v", err)
 		}
 	})
 
 	t.Run("self transfer", func(t *testing.T) {
-		err := walletService.Transfer(sender.ID, sender.Email, 50.0, "To myself", "test-key-4")
+		_, err := walletService.Transfer(sender.ID, sender.Email, money.FromMajor(50), "", "To myself", "test-key-4")
 		if !errors.Is(err, ErrSelfTransfer) {
 			t.Errorf("expected ErrSelfTransfer, got %v", err)
 		}
 	})
 
 	t.Run("invalid amount", func(t *testing.T) {
-		err := walletService.Transfer(sender.ID, recipient.Email, -50.0, "Negative", "test-key-5")
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(-50), "", "Negative", "test-key-5")
 		if !errors.Is(err, ErrInvalidAmount) {
 			t.Errorf("expected ErrInvalidAmount, got %v", err)
 		}
 
-		err = walletService.Transfer(sender.ID, recipient.Email, 0, "Zero", "test-key-6")
+		_, err = walletService.Transfer(sender.ID, recipient.Email, 0, "", "Zero", "test-key-6")
 		if !errors.Is(err, ErrInvalidAmount) {
 			t.Errorf("expected ErrInvalidAmount, got %v", err)
 		}
@@ -169,29 +236,418 @@ func TestWalletService_Transfer(t *testing.T) {
 		initialBalance := senderWallet.Balance
 
 		// First transfer
-		err := walletService.Transfer(sender.ID, recipient.Email, 50.0, "First", "idempotent-key")
+		first, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(50), "", "First", "idempotent-key")
 		if err != nil {
-			t.Errorf("expected no error on first transfer, got %v", err)
+			t.Fatalf("expected no error on first transfer, got %v", err)
 		}
 
 		// Verify balance changed
 		senderWallet, _ = walletRepo.FindByUserID(sender.ID)
 		afterFirstBalance := senderWallet.Balance
-		if afterFirstBalance != initialBalance-50.0 {
-			t.Errorf("expected balance %f after first transfer, got %f", initialBalance-50.0, afterFirstBalance)
+		if afterFirstBalance != initialBalance-money.FromMajor(50) {
+			t.Errorf("expected balance %s after first transfer, got %s", initialBalance-money.FromMajor(50), afterFirstBalance)
 		}
 
 		// Duplicate transfer with same idempotency key
-		err = walletService.Transfer(sender.ID, recipient.Email, 50.0, "Duplicate", "idempotent-key")
+		replay, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(50), "", "First", "idempotent-key")
 		if err != nil {
-			t.Errorf("expected no error on duplicate transfer, got %v", err)
+			t.Fatalf("expected no error on duplicate transfer, got %v", err)
+		}
+		if !replay.Replayed {
+			t.Error("expected duplicate transfer to be a replay")
+		}
+		if replay.Transfer.PublicID != first.Transfer.PublicID {
+			t.Errorf("expected replay to return transfer %s, got %s", first.Transfer.PublicID, replay.Transfer.PublicID)
+		}
+		if len(replay.Transfer.Legs) != 2 || replay.Transfer.Legs[0].ID != first.Transfer.Legs[0].ID {
+			t.Errorf("expected replay to return the original legs, got %+v", replay.Transfer.Legs)
+		}
+		if !replay.Transfer.CreatedAt.Equal(first.Transfer.CreatedAt) {
+			t.Errorf("expected replay created_at %v, got %v", first.Transfer.CreatedAt, replay.Transfer.CreatedAt)
 		}
 
 		// Verify balance did not change
 		senderWallet, _ = walletRepo.FindByUserID(sender.ID)
 		finalBalance := senderWallet.Balance
 		if finalBalance != afterFirstBalance {
-			t.Errorf("expected balance %f after duplicate transfer, got %f", afterFirstBalance, finalBalance)
+			t.Errorf("expected balance %s after duplicate transfer, got %s", afterFirstBalance, finalBalance)
+		}
+	})
+
+	t.Run("idempotency key reused with different payload", func(t *testing.T) {
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(10), "", "Original", "mismatch-key")
+		if err != nil {
+			t.Fatalf("expected no error on first transfer, got %v", err)
+		}
+
+		_, err = walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(20), "", "Original", "mismatch-key")
+		if !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Errorf("expected ErrIdempotencyKeyReused for different amount, got %v", err)
+		}
+
+		_, err = walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(10), "", "Changed", "mismatch-key")
+		if !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Errorf("expected ErrIdempotencyKeyReused for different notes, got %v", err)
+		}
+	})
+
+	t.Run("idempotency keys are scoped per user", func(t *testing.T) {
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(5), "", "Shared", "shared-key")
+		if err != nil {
+			t.Fatalf("expected no error for sender, got %v", err)
+		}
+
+		result, err := walletService.Transfer(recipient.ID, sender.Email, money.FromMajor(5), "", "Shared", "shared-key")
+		if err != nil {
+			t.Fatalf("expected no error for recipient using the same key, got %v", err)
+		}
+		if result.Replayed {
+			t.Error("expected a new transfer, got a replay")
+		}
+	})
+
+	t.Run("idempotency key in progress", func(t *testing.T) {
+		// Simulate a concurrent request that reserved the key and has not finished
+		key := "in-progress-key"
+		fp := fingerprint("transfer", sender.ID, recipient.Email, money.FromMajor(5), "", "Busy")
+		if _, err := idempotencyRepo.Reserve(&models.IdempotencyRecord{
+			UserID:      sender.ID,
+			Key:         key,
+			Fingerprint: fp,
+			Status:      models.IdempotencyStatusProcessing,
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("failed to reserve key: %v", err)
+		}
+
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(5), "", "Busy", key)
+		if !errors.Is(err, ErrIdempotencyInProgress) {
+			t.Errorf("expected ErrIdempotencyInProgress, got %v", err)
+		}
+	})
+
+	t.Run("expired idempotency key runs again", func(t *testing.T) {
+		key := "expired-key"
+		first, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(5), "", "Fresh", key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		db.Model(&models.IdempotencyRecord{}).
+			Where("user_id = ? AND idempotency_key = ?", sender.ID, key).
+			Update("expires_at", time.Now().Add(-time.Minute))
+
+		// The first run's ledger legs are still there; the retry must not
+		// collide with them
+		result, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(5), "", "Fresh", key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Replayed || result.Transfer.PublicID == first.Transfer.PublicID {
+			t.Error("expected a new transfer after the key expired")
+		}
+	})
+
+	t.Run("stale reservation is taken over", func(t *testing.T) {
+		// A request that crashed after reserving the key holds it only for the lease
+		key := "crashed-key"
+		fp := fingerprint("transfer", sender.ID, recipient.Email, money.FromMajor(5), "", "Crashed")
+		stale := &models.IdempotencyRecord{
+			UserID:      sender.ID,
+			Key:         key,
+			Fingerprint: fp,
+			Status:      models.IdempotencyStatusProcessing,
+			ExpiresAt:   time.Now().Add(-time.Second),
+		}
+		if _, err := idempotencyRepo.Reserve(stale); err != nil {
+			t.Fatalf("failed to reserve key: %v", err)
+		}
+
+		result, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(5), "", "Crashed", key)
+		if err != nil {
+			t.Fatalf("expected the key to be taken over, got %v", err)
+		}
+		if result.Replayed {
+			t.Error("expected a new transfer, got a replay")
+		}
+
+		// The request whose reservation was taken over cannot complete it
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return newIdempotencyStore(idempotencyRepo, time.Hour).complete(tx, stale, result.Transfer)
+		})
+		if !errors.Is(err, ErrIdempotencyInProgress) {
+			t.Errorf("expected ErrIdempotencyInProgress, got %v", err)
+		}
+
+		record, err := idempotencyRepo.FindByUserAndKey(sender.ID, key)
+		if err != nil {
+			t.Fatalf("failed to find key: %v", err)
+		}
+		if record.Status != models.IdempotencyStatusCompleted || time.Until(record.ExpiresAt) < 30*time.Minute {
+			t.Errorf("expected the completed key to be kept for the TTL, got %+v", record)
+		}
+	})
+
+	t.Run("expired keys are deleted", func(t *testing.T) {
+		db.Model(&models.IdempotencyRecord{}).
+			Where("user_id = ? AND idempotency_key = ?", sender.ID, "crashed-key").
+			Update("expires_at", time.Now().Add(-time.Minute))
+
+		deleted, err := walletService.DeleteExpiredIdempotencyKeys(time.Now())
+		if err != nil {
+			t.Fatalf("failed to delete expired keys: %v", err)
+		}
+		if deleted < 1 {
+			t.Errorf("expected the expired key to be deleted, got %d", deleted)
+		}
+		if _, err := idempotencyRepo.FindByUserAndKey(sender.ID, "crashed-key"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the key to be gone, got %v", err)
+		}
+	})
+
+	t.Run("failed transfer releases idempotency key", func(t *testing.T) {
+		key := "retry-after-failure-key"
+		_, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(100000), "", "Retry", key)
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+		}
+
+		_, err = walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(100000), "", "Retry", key)
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("expected the retry to run again, got %v", err)
+		}
+	})
+}
+
+func TestWalletService_GetTransfer(t *testing.T) {
+	db := setupWalletTestDB(t)
+
+	walletService := newTestWalletService(db)
+
+	sender := createTestUser(t, db, "get-transfer-sender@example.com")
+	recipient := createTestUser(t, db, "get-transfer-recipient@example.com")
+	outsider := createTestUser(t, db, "get-transfer-outsider@example.com")
+
+	result, err := walletService.Transfer(sender.ID, recipient.Email, money.FromMajor(25), "", "Lunch", "get-transfer-key")
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+	created := result.Transfer
+
+	t.Run("transfer links both legs", func(t *testing.T) {
+		if created.Status != models.TransferStatusCompleted {
+			t.Errorf("expected status completed, got %s", created.Status)
+		}
+		if len(created.Legs) != 2 {
+			t.Fatalf("expected 2 legs, got %d", len(created.Legs))
+		}
+		for _, leg := range created.Legs {
+			if leg.TransferID == nil || *leg.TransferID != created.ID {
+				t.Errorf("expected leg %d to reference transfer %d", leg.ID, created.ID)
+			}
+		}
+	})
+
+	t.Run("participants can fetch the transfer", func(t *testing.T) {
+		for _, user := range []*models.User{sender, recipient} {
+			transfer, err := walletService.GetTransfer(user.ID, created.PublicID)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if transfer.Amount != money.FromMajor(25) || transfer.Notes != "Lunch" {
+				t.Errorf("unexpected transfer: %+v", transfer)
+			}
+			if len(transfer.Legs) != 2 || transfer.Legs[0].Type != models.TransactionTypeDebit {
+				t.Errorf("expected debit and credit legs, got %+v", transfer.Legs)
+			}
+		}
+	})
+
+	t.Run("other users cannot fetch the transfer", func(t *testing.T) {
+		_, err := walletService.GetTransfer(outsider.ID, created.PublicID)
+		if !errors.Is(err, ErrTransferNotFound) {
+			t.Errorf("expected ErrTransferNotFound, got %v", err)
+		}
+	})
+
+	t.Run("unknown transfer", func(t *testing.T) {
+		_, err := walletService.GetTransfer(sender.ID, "00000000-0000-0000-0000-000000000000")
+		if !errors.Is(err, ErrTransferNotFound) {
+			t.Errorf("expected ErrTransferNotFound, got %v", err)
+		}
+	})
+}
+
+func TestWalletService_TransferFractionalAmounts(t *testing.T) {
+	db := setupWalletTestDB(t)
+	walletRepo := repository.NewWalletRepository(db)
+
+	walletService := newTestWalletService(db)
+
+	sender := createTestUser(t, db, "fraction-sender@example.com")
+	recipient := createTestUser(t, db, "fraction-recipient@example.com")
+
+	if _, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("0.1"), "", "First", "fraction-key-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("0.2"), "", "Second", "fraction-key-2"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	senderWallet, _ := walletRepo.FindByUserID(sender.ID)
+	if senderWallet.Balance != money.MustParse("999.70") {
+		t.Errorf("expected sender balance 999.70, got %s", senderWallet.Balance)
+	}
+
+	recipientWallet, _ := walletRepo.FindByUserID(recipient.ID)
+	if recipientWallet.Balance != money.MustParse("1000.30") {
+		t.Errorf("expected recipient balance 1000.30, got %s", recipientWallet.Balance)
+	}
+}
+
+func TestWalletService_BalanceHistory(t *testing.T) {
+	db := setupWalletTestDB(t)
+
+	walletService := newTestWalletService(db)
+
+	sender := createTestUser(t, db, "balance-sender@example.com")
+	recipient := createTestUser(t, db, "balance-recipient@example.com")
+
+	first, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("100.25"), "", "First", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	between := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	second, err := walletService.Transfer(sender.ID, recipient.Email, money.MustParse("50.00"), "", "Second", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("legs record the balance after the transfer", func(t *testing.T) {
+		legs := []struct {
+			leg  models.Transaction
+			want money.Amount
+		}{
+			{first.Transfer.Legs[0], money.MustParse("899.75")},
+			{first.Transfer.Legs[1], money.MustParse("1100.25")},
+			{second.Transfer.Legs[0], money.MustParse("849.75")},
+			{second.Transfer.Legs[1], money.MustParse("1150.25")},
+		}
+		for _, w := range legs {
+			if w.leg.BalanceAfter == nil || *w.leg.BalanceAfter != w.want {
+				t.Errorf("expected %s leg balance_after %s, got %v", w.leg.Type, w.want, w.leg.BalanceAfter)
+			}
 		}
 	})
+
+	t.Run("balance at a point in time", func(t *testing.T) {
+		tests := []struct {
+			name string
+			at   time.Time
+			want money.Amount
+		}{
+			{"before the wallet existed", between.Add(-time.Hour), 0},
+			{"between the transfers", between, money.MustParse("899.75")},
+			{"now", time.Now(), money.MustParse("849.75")},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				balance, err := walletService.GetBalanceAt(sender.ID, "", tt.at)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if balance.Balance != tt.want {
+					t.Errorf("expected balance %s, got %s", tt.want, balance.Balance)
+				}
+			})
+		}
+	})
+}
+
+func TestWalletService_ConcurrentTransfers(t *testing.T) {
+	// SQLite has no row locks, so every transaction takes the database write
+	// lock when it begins and the others wait for it. Transfers still run on
+	// separate connections, and reads outside a transaction run alongside
+	// them; an in-memory database cannot be shared that way, so this one is a
+	// file.
+	dsn := "file:" + filepath.Join(t.TempDir(), "concurrent_transfers.db") + "?_journal_mode=WAL&_txlock=immediate&_busy_timeout=30000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(8)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	walletRepo := repository.NewWalletRepository(db)
+
+	walletService := newTestWalletService(db)
+
+	const userCount = 8
+	const transferCount = 400
+	users := make([]*models.User, userCount)
+	for i := range users {
+		users[i] = createTestUser(t, db, fmt.Sprintf("concurrent%d@example.com", i))
+	}
+	expectedTotal := money.FromMajor(1000 * userCount)
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+	errs := make(chan error, transferCount)
+	for i := 0; i < transferCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sender := users[i%userCount]
+			recipient := users[(i*7+3)%userCount]
+			if sender.ID == recipient.ID {
+				recipient = users[(i+1)%userCount]
+			}
+			// Amounts large enough that some transfers must be rejected
+			amount := money.FromMinor(int64(1 + (i*7919)%40000))
+
+			_, err := walletService.Transfer(sender.ID, recipient.Email, amount, "", "concurrent", fmt.Sprintf("concurrent-key-%d", i))
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, ErrInsufficientBalance):
+			default:
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected transfer error: %v", err)
+	}
+
+	var total money.Amount
+	for _, user := range users {
+		wallet, err := walletRepo.FindByUserID(user.ID)
+		if err != nil {
+			t.Fatalf("failed to get wallet: %v", err)
+		}
+		if wallet.Balance < 0 {
+			t.Errorf("wallet %d overdrawn: %s", wallet.ID, wallet.Balance)
+		}
+		total += wallet.Balance
+	}
+	if total != expectedTotal {
+		t.Errorf("money not conserved: expected total %s, got %s", expectedTotal, total)
+	}
+
+	var legs int64
+	db.Model(&models.Transaction{}).Count(&legs)
+	if legs != 2*succeeded.Load() {
+		t.Errorf("expected %d transaction legs, got %d", 2*succeeded.Load(), legs)
+	}
+	if succeeded.Load() == 0 {
+		t.Error("expected some transfers to succeed")
+	}
 }
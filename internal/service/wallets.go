@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrWalletNotFound      = errors.New("wallet not found")
+	ErrWalletExists        = errors.New("a wallet in this currency already exists")
+	ErrCurrencyMismatch    = errors.New("wallets hold different currencies")
+	ErrAmountPrecision     = errors.New("amount has more decimal places than the currency allows")
+)
+
+// OpenWallet gives the user an empty wallet in another currency
+func (s *walletService) OpenWallet(userID uint, currency string) (*models.Wallet, error) {
+	c, err := money.LookupCurrency(currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+
+	if _, err := s.walletRepo.FindByUserIDAndCurrency(userID, c.Code); err == nil {
+		return nil, ErrWalletExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error finding wallet: %w", err)
+	}
+
+	wallet := &models.Wallet{UserID: userID, Currency: c.Code}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.walletRepo.Create(tx, wallet); err != nil {
+			return fmt.Errorf("error creating wallet: %w", err)
+		}
+		return s.ledger.openWallet(tx, wallet)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// ListWallets returns all of the user's wallets, primary first
+func (s *walletService) ListWallets(userID uint) ([]models.Wallet, error) {
+	wallets, err := s.walletRepo.FindAllByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding wallets: %w", err)
+	}
+	return wallets, nil
+}
+
+// findWallet returns the user's wallet in the currency, or their primary
+// wallet when currency is empty
+func (s *walletService) findWallet(userID uint, currency string) (*models.Wallet, error) {
+	if currency == "" {
+		wallet, err := s.walletRepo.FindByUserID(userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrWalletNotFound
+			}
+			return nil, fmt.Errorf("error finding wallet: %w", err)
+		}
+		return wallet, nil
+	}
+
+	c, err := money.LookupCurrency(currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	wallet, err := s.walletRepo.FindByUserIDAndCurrency(userID, c.Code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: no %s wallet", ErrWalletNotFound, c.Code)
+		}
+		return nil, fmt.Errorf("error finding wallet: %w", err)
+	}
+	return wallet, nil
+}
+
+// recipientWallet finds the wallet that receives a payment in currency. Money
+// is never converted on the way, so the recipient needs a wallet in the same
+// currency.
+func (s *walletService) recipientWallet(recipientID uint, currency string) (*models.Wallet, error) {
+	wallet, err := s.walletRepo.FindByUserIDAndCurrency(recipientID, currency)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: recipient has no %s wallet", ErrCurrencyMismatch, currency)
+		}
+		return nil, fmt.Errorf("error finding recipient wallet: %w", err)
+	}
+	return wallet, nil
+}
+
+// ownsWallet reports whether the wallet belongs to the user
+func (s *walletService) ownsWallet(userID, walletID uint) (bool, error) {
+	wallet, err := s.walletRepo.FindByID(walletID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error finding wallet: %w", err)
+	}
+	return wallet.UserID == userID, nil
+}
+
+// currencyOf returns the currency of the wallet
+func currencyOf(wallet *models.Wallet) (money.Currency, error) {
+	c, err := money.LookupCurrency(wallet.Currency)
+	if err != nil {
+		return money.Currency{}, fmt.Errorf("%w: wallet %d holds %q", ErrUnsupportedCurrency, wallet.ID, wallet.Currency)
+	}
+	return c, nil
+}
+
+// checkAmount rejects an amount the wallet's currency cannot represent, e.g.
+// fractions of a yen
+func checkAmount(wallet *models.Wallet, amount money.Amount) error {
+	c, err := currencyOf(wallet)
+	if err != nil {
+		return err
+	}
+	if !c.Fits(amount) {
+		return fmt.Errorf("%w: %s has %d decimal places", ErrAmountPrecision, c.Code, c.Exponent)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"github.com/roychanmeliaz/btechdevcases/internal/repository"
+	"github.com/roychanmeliaz/btechdevcases/pkg/money"
+)
+
+func TestWalletService_MultiCurrency(t *testing.T) {
+	db := setupLedgerTestDB(t, "multi_currency")
+	walletRepo := repository.NewWalletRepository(db)
+
+	fees := FeePolicy{Percent: money.MustParse("1.5")}
+	walletService := newTestWalletService(db, WalletOptions{Fees: fees})
+	reconciliationService := newTestReconciliationService(db)
+
+	alice := createTestUser(t, db, "alice-fx@example.com")
+	bob := createTestUser(t, db, "bob-fx@example.com")
+
+	var aliceJPY *models.Wallet
+	t.Run("open a wallet per currency", func(t *testing.T) {
+		var err error
+		aliceJPY, err = walletService.OpenWallet(alice.ID, "jpy")
+		if err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+		if aliceJPY.Currency != "JPY" || aliceJPY.Balance != 0 {
+			t.Errorf("expected an empty JPY wallet, got %+v", aliceJPY)
+		}
+
+		if _, err := walletService.OpenWallet(alice.ID, "JPY"); !errors.Is(err, ErrWalletExists) {
+			t.Errorf("expected ErrWalletExists, got %v", err)
+		}
+		if _, err := walletService.OpenWallet(alice.ID, "XYZ"); !errors.Is(err, ErrUnsupportedCurrency) {
+			t.Errorf("expected ErrUnsupportedCurrency, got %v", err)
+		}
+
+		wallets, err := walletService.ListWallets(alice.ID)
+		if err != nil {
+			t.Fatalf("failed to list wallets: %v", err)
+		}
+		if len(wallets) != 2 || wallets[0].Currency != models.DefaultCurrency || wallets[1].Currency != "JPY" {
+			t.Errorf("expected the USD wallet first, then JPY, got %+v", wallets)
+		}
+
+		// The primary wallet is still the first one
+		primary, _, err := walletService.GetWallet(alice.ID)
+		if err != nil {
+			t.Fatalf("failed to get wallet: %v", err)
+		}
+		if primary.Currency != models.DefaultCurrency {
+			t.Errorf("expected the USD wallet to stay primary, got %s", primary.Currency)
+		}
+
+		fundWallet(t, db, aliceJPY, money.FromMajor(10000))
+	})
+
+	t.Run("transfers across currencies are rejected", func(t *testing.T) {
+		_, err := walletService.Transfer(alice.ID, bob.Email, money.FromMajor(500), "JPY", "", "")
+		if !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("expected ErrCurrencyMismatch, got %v", err)
+		}
+		if _, err := walletService.QuoteTransfer(alice.ID, bob.Email, money.FromMajor(500), "JPY"); !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("expected the quote to be rejected too, got %v", err)
+		}
+		if _, err := walletService.Transfer(bob.ID, alice.Email, money.FromMajor(5), "EUR", "", ""); !errors.Is(err, ErrWalletNotFound) {
+			t.Errorf("expected ErrWalletNotFound for a currency the sender has no wallet in, got %v", err)
+		}
+	})
+
+	t.Run("transfer in a secondary currency", func(t *testing.T) {
+		bobJPY, err := walletService.OpenWallet(bob.ID, "JPY")
+		if err != nil {
+			t.Fatalf("failed to open wallet: %v", err)
+		}
+
+		if _, err := walletService.Transfer(alice.ID, bob.Email, money.MustParse("500.50"), "JPY", "", ""); !errors.Is(err, ErrAmountPrecision) {
+			t.Errorf("expected ErrAmountPrecision, got %v", err)
+		}
+
+		// 1.5% of 1234 yen is 18.51, charged as 19
+		result, err := walletService.Transfer(alice.ID, bob.Email, money.FromMajor(1234), "JPY", "Sushi", "")
+		if err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+		if result.Transfer.SenderWalletID != aliceJPY.ID || result.Transfer.RecipientWalletID != bobJPY.ID {
+			t.Errorf("expected the JPY wallets, got %d to %d", result.Transfer.SenderWalletID, result.Transfer.RecipientWalletID)
+		}
+		if result.Transfer.Fee != money.FromMajor(19) {
+			t.Errorf("expected a fee of 19, got %s", result.Transfer.Fee)
+		}
+
+		alicePrimary, _ := walletRepo.FindByUserID(alice.ID)
+		aliceYen, _ := walletRepo.FindByID(aliceJPY.ID)
+		bobYen, _ := walletRepo.FindByID(bobJPY.ID)
+		if alicePrimary.Balance != money.FromMajor(1000) || aliceYen.Balance != money.FromMajor(8747) || bobYen.Balance != money.FromMajor(1234) {
+			t.Errorf("expected only the JPY wallets to move, got %s USD, %s and %s JPY", alicePrimary.Balance, aliceYen.Balance, bobYen.Balance)
+		}
+
+		// Either party sees the transfer, and the recipient can refund it
+		if _, err := walletService.GetTransfer(bob.ID, result.Transfer.PublicID); err != nil {
+			t.Errorf("expected the recipient to see the transfer, got %v", err)
+		}
+		if _, err := walletService.Refund(bob.ID, result.Transfer.PublicID, nil, "", ""); err != nil {
+			t.Errorf("expected the recipient to refund the transfer, got %v", err)
+		}
+	})
+
+	t.Run("history and balance by currency", func(t *testing.T) {
+		page, err := walletService.ListTransactions(bob.ID, TransactionQuery{Currency: "jpy"})
+		if err != nil {
+			t.Fatalf("failed to list transactions: %v", err)
+		}
+		if len(page.Transactions) != 2 {
+			t.Errorf("expected the transfer and its refund, got %d transactions", len(page.Transactions))
+		}
+
+		balance, err := walletService.GetBalanceAt(alice.ID, "JPY", time.Now())
+		if err != nil {
+			t.Fatalf("failed to get balance: %v", err)
+		}
+		if balance.Currency != "JPY" || balance.Balance != money.FromMajor(9981) {
+			t.Errorf("expected 9981 JPY, got %s %s", balance.Balance, balance.Currency)
+		}
+	})
+
+	t.Run("ledger reconciles", func(t *testing.T) {
+		report, err := reconciliationService.Run(false)
+		if err != nil {
+			t.Fatalf("failed to reconcile: %v", err)
+		}
+		if !report.OK {
+			t.Errorf("expected a clean reconciliation, got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+)
+
+// MemoryStore keeps sessions in the process, for tests and single-node
+// deployments. Sessions are lost on restart. Expired sessions are evicted
+// when they are looked up, and all of them at most once per idle timeout.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]models.Session
+	lastSweep time.Time
+	lifetime
+}
+
+func NewMemoryStore(idleTimeout time.Duration, maxLifetime time.Duration) *MemoryStore {
+	return &MemoryStore{
+		sessions:  make(map[string]models.Session),
+		lastSweep: time.Now(),
+		lifetime:  lifetime{idleTimeout: idleTimeout, maxLifetime: maxLifetime},
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, sess *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	s.start(sess, now)
+	s.sessions[sess.ID] = *sess
+	return nil
+}
+
+func (s *MemoryStore) Touch(ctx context.Context, id string, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sess, ok := s.lookup(id, now)
+	if !ok || sess.UserID != userID || !s.touch(&sess, now) {
+		return ErrNotFound
+	}
+	s.sessions[id] = sess
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.lookup(id, time.Now())
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &sess, nil
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lookup(id, time.Now()); !ok {
+		return ErrNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemoryStore) ListByUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	sessions := []models.Session{}
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && alive(&sess, now) {
+			sessions = append(sessions, sess)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// lookup returns a live session, evicting it if it has expired. The caller
+// must hold the lock.
+func (s *MemoryStore) lookup(id string, now time.Time) (models.Session, bool) {
+	sess, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, false
+	}
+	if !alive(&sess, now) {
+		delete(s.sessions, id)
+		return models.Session{}, false
+	}
+	return sess, true
+}
+
+// sweep evicts every expired session, at most once per idle timeout. The
+// caller must hold the lock.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.idleTimeout {
+		return
+	}
+	s.lastSweep = now
+
+	for id, sess := range s.sessions {
+		if !alive(&sess, now) {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/gorm"
+)
+
+// PostgresStore keeps sessions in the sessions table of the main database.
+// Expired rows are ignored on reads and deleted whenever a session is
+// created.
+type PostgresStore struct {
+	db *gorm.DB
+	lifetime
+}
+
+func NewPostgresStore(db *gorm.DB, idleTimeout time.Duration, maxLifetime time.Duration) *PostgresStore {
+	return &PostgresStore{
+		db:       db,
+		lifetime: lifetime{idleTimeout: idleTimeout, maxLifetime: maxLifetime},
+	}
+}
+
+func (s *PostgresStore) Create(ctx context.Context, sess *models.Session) error {
+	now := time.Now()
+	err := s.db.WithContext(ctx).
+		Where("idle_expires_at <= ?", now).
+		Delete(&models.Session{}).Error
+	if err != nil {
+		return err
+	}
+
+	s.start(sess, now)
+	return s.db.WithContext(ctx).Create(sess).Error
+}
+
+func (s *PostgresStore) Touch(ctx context.Context, id string, userID uint) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if sess.UserID != userID || !s.touch(sess, now) {
+		return ErrNotFound
+	}
+
+	// The session may expire or be revoked between the read and the update
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND idle_expires_at > ?", id, now).
+		Updates(map[string]interface{}{
+			"last_seen_at":    sess.LastSeenAt,
+			"idle_expires_at": sess.IdleExpiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	var sess models.Session
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND idle_expires_at > ?", id, time.Now()).
+		First(&sess).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *PostgresStore) Revoke(ctx context.Context, id string) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND idle_expires_at > ?", id, time.Now()).
+		Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListByUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND idle_expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
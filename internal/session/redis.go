@@ -0,0 +1,180 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+)
+
+// RedisStore keeps sessions in Redis, where they expire on their own:
+//
+//	session:<id>            -> hash of the session, expiring at IdleExpiresAt
+//	user-sessions:<user ID> -> set of the user's session IDs
+type RedisStore struct {
+	client *redis.Client
+	lifetime
+}
+
+func NewRedisStore(client *redis.Client, idleTimeout time.Duration, maxLifetime time.Duration) *RedisStore {
+	return &RedisStore{
+		client:   client,
+		lifetime: lifetime{idleTimeout: idleTimeout, maxLifetime: maxLifetime},
+	}
+}
+
+func (s *RedisStore) Create(ctx context.Context, sess *models.Session) error {
+	now := time.Now()
+	s.start(sess, now)
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey(sess.ID), map[string]interface{}{
+			"user_id":         sess.UserID,
+			"user_agent":      sess.UserAgent,
+			"ip":              sess.IP,
+			"created_at":      formatTime(sess.CreatedAt),
+			"last_seen_at":    formatTime(sess.LastSeenAt),
+			"idle_expires_at": formatTime(sess.IdleExpiresAt),
+			"expires_at":      formatTime(sess.ExpiresAt),
+		})
+		pipe.ExpireAt(ctx, sessionKey(sess.ID), sess.IdleExpiresAt)
+		pipe.SAdd(ctx, userKey(sess.UserID), sess.ID)
+		pipe.ExpireAt(ctx, userKey(sess.UserID), sess.ExpiresAt)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Touch(ctx context.Context, id string, userID uint) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sess.UserID != userID || !s.touch(sess, time.Now()) {
+		return ErrNotFound
+	}
+
+	touched, err := touchScript.Run(ctx, s.client, []string{sessionKey(id)},
+		formatTime(sess.LastSeenAt),
+		formatTime(sess.IdleExpiresAt),
+		sess.IdleExpiresAt.UnixMilli(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if touched == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// touchScript updates the timestamps of a session and extends its key in one
+// step, and only if the key still exists, so a session revoked or expired in
+// the meantime is not recreated with only its timestamps and no TTL
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "last_seen_at", ARGV[1], "idle_expires_at", ARGV[2])
+redis.call("PEXPIREAT", KEYS[1], ARGV[3])
+return 1
+`)
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	fields, err := s.client.HGetAll(ctx, sessionKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+
+	userID, err := strconv.ParseUint(fields["user_id"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", id, err)
+	}
+	sess := &models.Session{
+		ID:        id,
+		UserID:    uint(userID),
+		UserAgent: fields["user_agent"],
+		IP:        fields["ip"],
+	}
+	for _, field := range []struct {
+		name string
+		dest *time.Time
+	}{
+		{"created_at", &sess.CreatedAt},
+		{"last_seen_at", &sess.LastSeenAt},
+		{"idle_expires_at", &sess.IdleExpiresAt},
+		{"expires_at", &sess.ExpiresAt},
+	} {
+		if *field.dest, err = time.Parse(time.RFC3339Nano, fields[field.name]); err != nil {
+			return nil, fmt.Errorf("invalid session %s: %w", id, err)
+		}
+	}
+
+	// Redis may not have evicted the key yet
+	if !alive(sess, time.Now()) {
+		return nil, ErrNotFound
+	}
+	return sess, nil
+}
+
+func (s *RedisStore) Revoke(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(id))
+		pipe.SRem(ctx, userKey(sess.UserID), id)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) ListByUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	ids, err := s.client.SMembers(ctx, userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0, len(ids))
+	for _, id := range ids {
+		sess, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// Expired sessions are only dropped from the index here
+			if err := s.client.SRem(ctx, userKey(userID), id).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userKey(userID uint) string {
+	return fmt.Sprintf("user-sessions:%d", userID)
+}
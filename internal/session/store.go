@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+)
+
+var ErrNotFound = errors.New("session not found or expired")
+
+// SessionStore keeps the sessions of logged-in users. Expired sessions behave
+// as if they did not exist.
+type SessionStore interface {
+	// Create starts a session, setting its timestamps
+	Create(ctx context.Context, sess *models.Session) error
+	// Touch records activity on the user's session and restarts its idle
+	// timer. It returns ErrNotFound once the session has expired, was revoked
+	// or belongs to someone else.
+	Touch(ctx context.Context, id string, userID uint) error
+	// Get returns a live session
+	Get(ctx context.Context, id string) (*models.Session, error)
+	// Revoke ends a session; its access tokens stop working immediately
+	Revoke(ctx context.Context, id string) error
+	// ListByUser returns the user's live sessions, most recently used first
+	ListByUser(ctx context.Context, userID uint) ([]models.Session, error)
+}
+
+// lifetime holds the two timeouts that end a session
+type lifetime struct {
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+}
+
+// start sets the timestamps of a new session
+func (l lifetime) start(sess *models.Session, now time.Time) {
+	sess.CreatedAt = now
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(l.maxLifetime)
+	sess.IdleExpiresAt = l.idleExpiry(sess, now)
+}
+
+// touch records activity on the session and reports whether it is still
+// alive
+func (l lifetime) touch(sess *models.Session, now time.Time) bool {
+	if !alive(sess, now) {
+		return false
+	}
+	sess.LastSeenAt = now
+	sess.IdleExpiresAt = l.idleExpiry(sess, now)
+	return true
+}
+
+// idleExpiry is when the session ends without further activity: after the
+// idle timeout, cut short by the maximum lifetime
+func (l lifetime) idleExpiry(sess *models.Session, now time.Time) time.Time {
+	idle := now.Add(l.idleTimeout)
+	if sess.ExpiresAt.Before(idle) {
+		return sess.ExpiresAt
+	}
+	return idle
+}
+
+// alive reports whether the session has neither been idle too long nor
+// reached its maximum lifetime, which caps IdleExpiresAt
+func alive(sess *models.Session, now time.Time) bool {
+	return now.Before(sess.IdleExpiresAt)
+}
@@ -0,0 +1,128 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roychanmeliaz/btechdevcases/internal/database"
+	"github.com/roychanmeliaz/btechdevcases/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	testIdleTimeout = 200 * time.Millisecond
+	testMaxLifetime = 500 * time.Millisecond
+)
+
+func TestMemoryStore(t *testing.T) {
+	testSessionStore(t, NewMemoryStore(testIdleTimeout, testMaxLifetime))
+}
+
+func TestPostgresStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:session_store?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	testSessionStore(t, NewPostgresStore(db, testIdleTimeout, testMaxLifetime))
+}
+
+// testSessionStore runs the behaviour every SessionStore must have
+func testSessionStore(t *testing.T, store SessionStore) {
+	ctx := context.Background()
+
+	create := func(t *testing.T, id string, userID uint) {
+		t.Helper()
+		sess := &models.Session{ID: id, UserID: userID, UserAgent: "curl/8.0", IP: "10.0.0.1"}
+		if err := store.Create(ctx, sess); err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+		if sess.CreatedAt.IsZero() || sess.IdleExpiresAt.After(sess.ExpiresAt) {
+			t.Errorf("expected the timestamps to be set, got %+v", sess)
+		}
+	}
+
+	t.Run("create, get and list", func(t *testing.T) {
+		create(t, "list-1", 1)
+		create(t, "list-2", 1)
+		create(t, "list-3", 2)
+		if err := store.Touch(ctx, "list-1", 1); err != nil {
+			t.Fatalf("failed to touch session: %v", err)
+		}
+
+		sess, err := store.Get(ctx, "list-1")
+		if err != nil {
+			t.Fatalf("failed to get session: %v", err)
+		}
+		if sess.UserID != 1 || sess.UserAgent != "curl/8.0" || sess.IP != "10.0.0.1" {
+			t.Errorf("unexpected session: %+v", sess)
+		}
+
+		sessions, err := store.ListByUser(ctx, 1)
+		if err != nil {
+			t.Fatalf("failed to list sessions: %v", err)
+		}
+		if len(sessions) != 2 || sessions[0].ID != "list-1" {
+			t.Errorf("expected both sessions of the user, most recently used first, got %+v", sessions)
+		}
+	})
+
+	t.Run("touch checks the owner", func(t *testing.T) {
+		create(t, "owner", 1)
+		if err := store.Touch(ctx, "owner", 2); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for another user, got %v", err)
+		}
+		if err := store.Touch(ctx, "missing", 1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		create(t, "revoke", 3)
+		if err := store.Revoke(ctx, "revoke"); err != nil {
+			t.Fatalf("failed to revoke session: %v", err)
+		}
+		if _, err := store.Get(ctx, "revoke"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound after revoking, got %v", err)
+		}
+		if err := store.Revoke(ctx, "revoke"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound when revoking twice, got %v", err)
+		}
+	})
+
+	t.Run("idle timeout and maximum lifetime", func(t *testing.T) {
+		create(t, "idle", 4)
+		create(t, "active", 4)
+
+		// Activity keeps a session alive past the idle timeout...
+		for i := 0; i < 3; i++ {
+			time.Sleep(150 * time.Millisecond)
+			if err := store.Touch(ctx, "active", 4); err != nil {
+				t.Fatalf("expected the active session to be alive after %d touches, got %v", i, err)
+			}
+		}
+		if _, err := store.Get(ctx, "idle"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the idle session to expire, got %v", err)
+		}
+
+		// ...but not past the maximum lifetime
+		time.Sleep(150 * time.Millisecond)
+		if err := store.Touch(ctx, "active", 4); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the session to end at its maximum lifetime, got %v", err)
+		}
+
+		sessions, err := store.ListByUser(ctx, 4)
+		if err != nil {
+			t.Fatalf("failed to list sessions: %v", err)
+		}
+		if sessions == nil || len(sessions) != 0 {
+			t.Errorf("expected expired sessions to be left out of an empty list, got %#v", sessions)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is a task that runs periodically in the background
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Runner runs jobs on their intervals until its context is cancelled
+type Runner struct {
+	jobs []Job
+	wg   sync.WaitGroup
+}
+
+func NewRunner(jobs ...Job) *Runner {
+	return &Runner{jobs: jobs}
+}
+
+// Start launches every job with a positive interval in its own goroutine.
+// Each job first runs one interval after Start, never overlaps with itself
+// and stops once ctx is cancelled.
+func (r *Runner) Start(ctx context.Context) {
+	for _, job := range r.jobs {
+		if job.Interval <= 0 {
+			log.Printf("job %s disabled", job.Name)
+			continue
+		}
+
+		r.wg.Add(1)
+		go func(job Job) {
+			defer r.wg.Done()
+			r.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Wait blocks until every running job has finished its current run and exited
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Runner) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job.Run(ctx); err != nil {
+				log.Printf("job %s failed: %v", job.Name, err)
+			}
+		}
+	}
+}
@@ -7,12 +7,19 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Claims identify the user and, in the jti (ID) claim, the session the token
+// belongs to
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	jwt.RegisteredClaims
 }
 
+// SessionID returns the ID of the session the token was issued for
+func (c *Claims) SessionID() string {
+	return c.ID
+}
+
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrExpiredToken = errors.New("token has expired")
@@ -30,8 +37,8 @@ func NewManager(secret string, accessExpiration time.Duration) *Manager {
 	}
 }
 
-// GenerateToken creates a new JWT token for a user
-func (m *Manager) GenerateToken(userID uint, email string) (string, error) {
+// GenerateToken creates a new JWT token for a user's session
+func (m *Manager) GenerateToken(userID uint, email string, sessionID string) (string, error) {
 	now := time.Now()
 	expirationTime := now.Add(m.accessExpiration)
 
@@ -39,6 +46,7 @@ func (m *Manager) GenerateToken(userID uint, email string) (string, error) {
 		UserID: userID,
 		Email:  email,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
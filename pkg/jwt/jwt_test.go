@@ -9,7 +9,7 @@ func TestJWTManager_GenerateToken(t *testing.T) {
 	manager := NewManager("test-secret", 24*time.Hour)
 
 	t.Run("generate valid token", func(t *testing.T) {
-		token, err := manager.GenerateToken(1, "test@example.com")
+		token, err := manager.GenerateToken(1, "test@example.com", "session-1")
 		if err != nil {
 			t.Errorf("expected no error, got %v", err)
 		}
@@ -22,7 +22,7 @@ func TestJWTManager_GenerateToken(t *testing.T) {
 		userID := uint(123)
 		email := "user@example.com"
 
-		token, err := manager.GenerateToken(userID, email)
+		token, err := manager.GenerateToken(userID, email, "session-1")
 		if err != nil {
 			t.Fatalf("failed to generate token: %v", err)
 		}
@@ -44,7 +44,7 @@ func TestJWTManager_ValidateToken(t *testing.T) {
 	manager := NewManager("test-secret", 24*time.Hour)
 
 	t.Run("validate valid token", func(t *testing.T) {
-		token, _ := manager.GenerateToken(1, "test@example.com")
+		token, _ := manager.GenerateToken(1, "test@example.com", "session-1")
 
 		claims, err := manager.ValidateToken(token)
 		if err != nil {
@@ -67,7 +67,7 @@ func TestJWTManager_ValidateToken(t *testing.T) {
 
 	t.Run("reject token with wrong secret", func(t *testing.T) {
 		wrongManager := NewManager("wrong-secret", 24*time.Hour)
-		token, _ := manager.GenerateToken(1, "test@example.com")
+		token, _ := manager.GenerateToken(1, "test@example.com", "session-1")
 
 		_, err := wrongManager.ValidateToken(token)
 		if err == nil {
@@ -77,7 +77,7 @@ func TestJWTManager_ValidateToken(t *testing.T) {
 
 	t.Run("reject expired token", func(t *testing.T) {
 		shortManager := NewManager("test-secret", -1*time.Hour)
-		token, _ := shortManager.GenerateToken(1, "test@example.com")
+		token, _ := shortManager.GenerateToken(1, "test@example.com", "session-1")
 
 		// Wait a tiny bit to ensure expiration
 		time.Sleep(10 * time.Millisecond)
@@ -94,7 +94,7 @@ func TestJWTManager_TokenExpiration(t *testing.T) {
 		expiration := 1 * time.Hour
 		manager := NewManager("test-secret", expiration)
 
-		token, err := manager.GenerateToken(1, "test@example.com")
+		token, err := manager.GenerateToken(1, "test@example.com", "session-1")
 		if err != nil {
 			t.Fatalf("failed to generate token: %v", err)
 		}
@@ -128,7 +128,7 @@ func TestJWTManager_ClaimsContent(t *testing.T) {
 		userID := uint(456)
 		email := "claims@example.com"
 
-		token, err := manager.GenerateToken(userID, email)
+		token, err := manager.GenerateToken(userID, email, "session-1")
 		if err != nil {
 			t.Fatalf("failed to generate token: %v", err)
 		}
@@ -144,6 +144,9 @@ func TestJWTManager_ClaimsContent(t *testing.T) {
 		if claims.Email != email {
 			t.Errorf("expected email %s, got %s", email, claims.Email)
 		}
+		if claims.SessionID() != "session-1" {
+			t.Errorf("expected session ID session-1, got %q", claims.SessionID())
+		}
 		if claims.ExpiresAt == nil {
 			t.Error("expected ExpiresAt to be set")
 		}
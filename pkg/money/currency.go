@@ -0,0 +1,72 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+var ErrUnknownCurrency = errors.New("unknown or unsupported currency")
+
+// Currency is an ISO 4217 currency with the number of decimal places
+// (exponent) its amounts use
+type Currency struct {
+	Code     string
+	Exponent int
+}
+
+// currencies lists the supported ISO 4217 currencies. Currencies with more
+// decimal places than Scale (e.g. KWD, BHD) cannot be represented by an
+// Amount and are left out.
+var currencies = map[string]Currency{
+	"AUD": {"AUD", 2},
+	"CAD": {"CAD", 2},
+	"CHF": {"CHF", 2},
+	"CNY": {"CNY", 2},
+	"EUR": {"EUR", 2},
+	"GBP": {"GBP", 2},
+	"HKD": {"HKD", 2},
+	"IDR": {"IDR", 2},
+	"INR": {"INR", 2},
+	"JPY": {"JPY", 0},
+	"KRW": {"KRW", 0},
+	"MYR": {"MYR", 2},
+	"NZD": {"NZD", 2},
+	"PHP": {"PHP", 2},
+	"SGD": {"SGD", 2},
+	"THB": {"THB", 2},
+	"USD": {"USD", 2},
+	"VND": {"VND", 0},
+}
+
+// LookupCurrency returns the currency with the given code, in any case
+func LookupCurrency(code string) (Currency, error) {
+	currency, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Currency{}, ErrUnknownCurrency
+	}
+	return currency, nil
+}
+
+// step is the number of minor units (of Scale) in the currency's smallest unit
+func (c Currency) step() int64 {
+	return pow10(Scale - c.Exponent)
+}
+
+// Fits reports whether a has no more decimal places than the currency allows,
+// e.g. 1500 fits JPY but 1500.50 does not
+func (c Currency) Fits(a Amount) bool {
+	return int64(a)%c.step() == 0
+}
+
+// Round rounds a to the currency's smallest unit with the given mode. It
+// returns ErrOutOfRange if rounding up leaves the range of an Amount.
+func (c Currency) Round(a Amount, mode RoundingMode) (Amount, error) {
+	step := c.step()
+	// Dividing cannot overflow
+	units, _ := a.MulRatio(1, step, mode)
+	if units > math.MaxInt64/Amount(step) || units < math.MinInt64/Amount(step) {
+		return 0, ErrOutOfRange
+	}
+	return units * Amount(step), nil
+}
@@ -0,0 +1,71 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+	c, err := LookupCurrency("jpy")
+	if err != nil {
+		t.Fatalf("expected JPY, got %v", err)
+	}
+	if c.Code != "JPY" || c.Exponent != 0 {
+		t.Errorf("unexpected currency: %+v", c)
+	}
+
+	for _, code := range []string{"", "XYZ", "KWD"} {
+		if _, err := LookupCurrency(code); !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("%q: expected ErrUnknownCurrency, got %v", code, err)
+		}
+	}
+}
+
+func TestCurrency_Precision(t *testing.T) {
+	usd := mustLookupCurrency(t, "USD")
+	jpy := mustLookupCurrency(t, "JPY")
+
+	cases := []struct {
+		name     string
+		currency Currency
+		amount   string
+		fits     bool
+		rounded  string
+	}{
+		{"cents fit USD", usd, "10.05", true, "10.05"},
+		{"whole yen", jpy, "1500", true, "1500.00"},
+		{"fraction of a yen", jpy, "1500.50", false, "1501.00"},
+		{"rounds down below half", jpy, "12.49", false, "12.00"},
+		{"negative", jpy, "-2.50", false, "-3.00"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			amount := MustParse(tc.amount)
+			if got := tc.currency.Fits(amount); got != tc.fits {
+				t.Errorf("expected Fits to be %v", tc.fits)
+			}
+			got, err := tc.currency.Round(amount, RoundHalfUp)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != MustParse(tc.rounded) {
+				t.Errorf("expected %s, got %s", tc.rounded, got)
+			}
+		})
+	}
+
+	t.Run("rounding up past the largest amount", func(t *testing.T) {
+		if _, err := jpy.Round(MustParse("92233720368547758.07"), RoundUp); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("expected ErrOutOfRange, got %v", err)
+		}
+	})
+}
+
+func mustLookupCurrency(t *testing.T, code string) Currency {
+	t.Helper()
+	c, err := LookupCurrency(code)
+	if err != nil {
+		t.Fatalf("unknown currency %s", code)
+	}
+	return c
+}
@@ -0,0 +1,272 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places an Amount can represent
+const Scale = 2
+
+// unit is the number of minor units in one major unit (10^Scale)
+const unit = 100
+
+var (
+	ErrInvalidFormat   = errors.New("invalid amount format")
+	ErrTooManyDecimals = errors.New("amount has too many decimal places")
+	ErrOutOfRange      = errors.New("amount is out of range")
+)
+
+// Amount is an exact monetary value stored as an integer number of minor
+// units (cents). It marshals to and from JSON as a decimal number so the API
+// keeps accepting and returning values like 150.50.
+type Amount int64
+
+// RoundingMode controls how a fractional minor unit is resolved when an
+// Amount is derived from another one (e.g. a percentage)
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest minor unit, ties to the even one (banker's rounding)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest minor unit, ties away from zero
+	RoundHalfUp
+	// RoundDown truncates towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+)
+
+// FromMinor creates an Amount from a number of minor units
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// FromMajor creates an Amount from a whole number of major units
+func FromMajor(major int64) Amount {
+	return Amount(major * unit)
+}
+
+// Parse converts a decimal string such as "150.5" into an Amount. It never
+// rounds: values with more than Scale decimal places are rejected.
+func Parse(s string) (Amount, error) {
+	value, err := parseFixed(s, Scale)
+	return Amount(value), err
+}
+
+// parseFixed converts a decimal string into an integer number of 10^-scale
+// units, rejecting values with more than scale decimal places
+func parseFixed(s string, scale int) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidFormat
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, hasPoint := strings.Cut(s, ".")
+	if intPart == "" || (hasPoint && fracPart == "") {
+		return 0, ErrInvalidFormat
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, ErrInvalidFormat
+	}
+
+	// Trailing zeros do not add precision ("1.500" is 1.50)
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > scale {
+		return 0, ErrTooManyDecimals
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+
+	unit := pow10(scale)
+	var minor int64
+	if fracPart != "" {
+		minor, _ = strconv.ParseInt(fracPart, 10, 64)
+	}
+	major, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || major > (math.MaxInt64-minor)/unit {
+		return 0, ErrOutOfRange
+	}
+
+	value := major*unit + minor
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// MustParse is like Parse but panics on error. Intended for constants and tests.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Minor returns the amount as a number of minor units
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// String formats the amount with exactly Scale decimal places
+func (a Amount) String() string {
+	value := int64(a)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+	}
+
+	abs := new(big.Int).Abs(big.NewInt(value))
+	major, minor := new(big.Int).QuoRem(abs, big.NewInt(unit), new(big.Int))
+
+	frac := minor.String()
+	frac = strings.Repeat("0", Scale-len(frac)) + frac
+	return sign + major.String() + "." + frac
+}
+
+// MulRatio returns a * num / den, resolving any fractional minor unit with the
+// given rounding mode. It is the only way derived amounts (percentages, shares,
+// conversions) should be computed. It returns ErrOutOfRange if the result does
+// not fit an Amount.
+func (a Amount) MulRatio(num, den int64, mode RoundingMode) (Amount, error) {
+	if den == 0 {
+		panic("money: division by zero")
+	}
+
+	n := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(num))
+	d := big.NewInt(den)
+	if d.Sign() < 0 {
+		n.Neg(n)
+		d.Neg(d)
+	}
+
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() != 0 {
+		// Away-from-zero step for the quotient's sign
+		step := big.NewInt(int64(n.Sign()))
+		twiceR := new(big.Int).Abs(new(big.Int).Mul(r, big.NewInt(2)))
+
+		switch mode {
+		case RoundUp:
+			q.Add(q, step)
+		case RoundHalfUp:
+			if twiceR.Cmp(d) >= 0 {
+				q.Add(q, step)
+			}
+		case RoundHalfEven:
+			if c := twiceR.Cmp(d); c > 0 || (c == 0 && q.Bit(0) == 1) {
+				q.Add(q, step)
+			}
+		}
+	}
+
+	if !q.IsInt64() {
+		return 0, ErrOutOfRange
+	}
+	return Amount(q.Int64()), nil
+}
+
+// Allocate splits a into parts proportional to weights that always sum to a.
+// Each part is rounded down, and the minor units left over go one at a time to
+// the parts with the largest remainders, earlier parts first on ties. Equal
+// weights split a evenly, e.g. 100.00 in three is 33.34, 33.33 and 33.33.
+func (a Amount) Allocate(weights ...int64) []Amount {
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			panic("money: negative weight")
+		}
+		total += w
+	}
+	if total == 0 {
+		panic("money: weights sum to zero")
+	}
+	if a < 0 {
+		parts := (-a).Allocate(weights...)
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+		return parts
+	}
+
+	parts := make([]Amount, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	left := a
+	for i, w := range weights {
+		// A part of a is never larger than a
+		parts[i], _ = a.MulRatio(w, total, RoundDown)
+		left -= parts[i]
+		remainders[i] = new(big.Int).Mod(
+			new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(w)),
+			big.NewInt(total),
+		)
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]].Cmp(remainders[order[j]]) > 0
+	})
+	for i := 0; left > 0; i++ {
+		parts[order[i]]++
+		left--
+	}
+
+	return parts
+}
+
+// MarshalJSON encodes the amount as a JSON number with Scale decimal places
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts either a JSON number or a quoted decimal string.
+// The literal text is parsed directly so no float rounding ever happens.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
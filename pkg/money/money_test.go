@@ -0,0 +1,198 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("valid amounts", func(t *testing.T) {
+		cases := map[string]Amount{
+			"150.50": 15050,
+			"150.5":  15050,
+			"1":      100,
+			"0.01":   1,
+			"1.500":  150,
+			"-2.25":  -225,
+			"+3":     300,
+		}
+		for input, expected := range cases {
+			got, err := Parse(input)
+			if err != nil {
+				t.Errorf("Parse(%q): expected no error, got %v", input, err)
+				continue
+			}
+			if got != expected {
+				t.Errorf("Parse(%q): expected %d, got %d", input, expected, got)
+			}
+		}
+	})
+
+	t.Run("too many decimal places", func(t *testing.T) {
+		for _, input := range []string{"1.005", "0.001", "10.123"} {
+			if _, err := Parse(input); !errors.Is(err, ErrTooManyDecimals) {
+				t.Errorf("Parse(%q): expected ErrTooManyDecimals, got %v", input, err)
+			}
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		for _, input := range []string{"", "abc", "1.", ".5", "1e3", "1,00", "--1"} {
+			if _, err := Parse(input); !errors.Is(err, ErrInvalidFormat) {
+				t.Errorf("Parse(%q): expected ErrInvalidFormat, got %v", input, err)
+			}
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		for _, input := range []string{"99999999999999999999", "92233720368547758.08", "-92233720368547758.08", "92233720368547759"} {
+			if _, err := Parse(input); !errors.Is(err, ErrOutOfRange) {
+				t.Errorf("Parse(%q): expected ErrOutOfRange, got %v", input, err)
+			}
+		}
+	})
+
+	t.Run("largest amounts", func(t *testing.T) {
+		cases := map[string]Amount{
+			"92233720368547758.07":  math.MaxInt64,
+			"-92233720368547758.07": -math.MaxInt64,
+		}
+		for input, expected := range cases {
+			got, err := Parse(input)
+			if err != nil || got != expected {
+				t.Errorf("Parse(%q): expected %d, got %d, %v", input, expected, got, err)
+			}
+		}
+	})
+}
+
+func TestAmount_String(t *testing.T) {
+	cases := map[Amount]string{
+		15050: "150.50",
+		1:     "0.01",
+		0:     "0.00",
+		-5:    "-0.05",
+		-1234: "-12.34",
+	}
+	for amount, expected := range cases {
+		if got := amount.String(); got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestAmount_NoFloatDrift(t *testing.T) {
+	sum := MustParse("0.1") + MustParse("0.2")
+	if sum != MustParse("0.3") {
+		t.Errorf("expected 0.30, got %s", sum)
+	}
+}
+
+func TestAmount_MulRatio(t *testing.T) {
+	cases := []struct {
+		name     string
+		amount   Amount
+		num, den int64
+		mode     RoundingMode
+		expected Amount
+	}{
+		{"exact", 1000, 1, 4, RoundHalfEven, 250},
+		{"half even rounds down to even", 25, 1, 10, RoundHalfEven, 2},
+		{"half even rounds up to even", 35, 1, 10, RoundHalfEven, 4},
+		{"half up", 25, 1, 10, RoundHalfUp, 3},
+		{"down", 29, 1, 10, RoundDown, 2},
+		{"up", 21, 1, 10, RoundUp, 3},
+		{"negative half up", -25, 1, 10, RoundHalfUp, -3},
+		{"negative down", -29, 1, 10, RoundDown, -2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.amount.MulRatio(tc.num, tc.den, tc.mode)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("out of range", func(t *testing.T) {
+		for _, num := range []int64{2, -2} {
+			if _, err := Amount(math.MaxInt64).MulRatio(num, 1, RoundDown); !errors.Is(err, ErrOutOfRange) {
+				t.Errorf("MulRatio(%d, 1): expected ErrOutOfRange, got %v", num, err)
+			}
+		}
+		if got, err := Amount(math.MaxInt64).MulRatio(3, 3, RoundDown); err != nil || got != math.MaxInt64 {
+			t.Errorf("expected the largest amount back, got %d, %v", got, err)
+		}
+	})
+}
+
+func TestAmount_Allocate(t *testing.T) {
+	cases := []struct {
+		name     string
+		amount   Amount
+		weights  []int64
+		expected []Amount
+	}{
+		{"even", 900, []int64{1, 1, 1}, []Amount{300, 300, 300}},
+		{"leftover to the first parts", 10000, []int64{1, 1, 1}, []Amount{3334, 3333, 3333}},
+		{"two leftover units", 1000, []int64{1, 1, 1, 1, 1, 1}, []Amount{167, 167, 167, 167, 166, 166}},
+		{"largest remainder first", 100, []int64{3333, 3333, 3334}, []Amount{33, 33, 34}},
+		{"percentages", 12345, []int64{5000, 2500, 2500}, []Amount{6173, 3086, 3086}},
+		{"zero weight", 500, []int64{0, 1}, []Amount{0, 500}},
+		{"negative", -10000, []int64{1, 1, 1}, []Amount{-3334, -3333, -3333}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.amount.Allocate(tc.weights...)
+			var sum Amount
+			for i := range got {
+				sum += got[i]
+				if got[i] != tc.expected[i] {
+					t.Errorf("expected %v, got %v", tc.expected, got)
+					break
+				}
+			}
+			if sum != tc.amount {
+				t.Errorf("parts sum to %d, expected %d", sum, tc.amount)
+			}
+		})
+	}
+}
+
+func TestAmount_JSON(t *testing.T) {
+	t.Run("marshal as decimal number", func(t *testing.T) {
+		data, err := json.Marshal(map[string]Amount{"amount": 84950})
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		if string(data) != `{"amount":849.50}` {
+			t.Errorf("unexpected JSON: %s", data)
+		}
+	})
+
+	t.Run("unmarshal number and string", func(t *testing.T) {
+		var req struct {
+			A Amount `json:"a"`
+			B Amount `json:"b"`
+		}
+		if err := json.Unmarshal([]byte(`{"a":150.5,"b":"0.30"}`), &req); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+		if req.A != 15050 || req.B != 30 {
+			t.Errorf("unexpected values: %d, %d", req.A, req.B)
+		}
+	})
+
+	t.Run("unmarshal rejects excess precision", func(t *testing.T) {
+		var a Amount
+		err := json.Unmarshal([]byte(`1.005`), &a)
+		if !errors.Is(err, ErrTooManyDecimals) {
+			t.Errorf("expected ErrTooManyDecimals, got %v", err)
+		}
+	})
+}
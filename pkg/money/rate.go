@@ -0,0 +1,104 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RateScale is the number of decimal places a Rate can represent
+const RateScale = 8
+
+// rateUnit is 10^RateScale
+const rateUnit = 100_000_000
+
+var ErrInvalidRate = errors.New("rate must be a positive decimal with at most 8 decimal places")
+
+// Rate is an exchange rate stored as an integer number of 10^-8 units: how
+// many units of one currency buy one unit of another. Like Amount it
+// marshals to and from JSON as a decimal number, e.g. 151.2345.
+type Rate int64
+
+// ParseRate converts a decimal string such as "0.9215" into a Rate. Zero,
+// negative and over-precise rates are rejected.
+func ParseRate(s string) (Rate, error) {
+	value, err := parseFixed(s, RateScale)
+	if err != nil || value <= 0 {
+		return 0, ErrInvalidRate
+	}
+	return Rate(value), nil
+}
+
+// MustParseRate is like ParseRate but panics on error. Intended for constants and tests.
+func MustParseRate(s string) Rate {
+	r, err := ParseRate(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// String formats the rate without trailing zeros, e.g. "151.2345" or "2"
+func (r Rate) String() string {
+	value := int64(r)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	major, minor := value/rateUnit, value%rateUnit
+	frac := strconv.FormatInt(minor, 10)
+	frac = strings.TrimRight(strings.Repeat("0", RateScale-len(frac))+frac, "0")
+	s := sign + strconv.FormatInt(major, 10)
+	if frac != "" {
+		s += "." + frac
+	}
+	return s
+}
+
+// Less returns the rate reduced by percent, a percentage with two decimals
+// (e.g. 0.50 for 0.5%), rounded down so the reduction is never understated
+func (r Rate) Less(percent Amount) Rate {
+	// A reduction cannot overflow
+	less, _ := Amount(r).MulRatio(100*100-percent.Minor(), 100*100, RoundDown)
+	return Rate(less)
+}
+
+// Convert converts a into a currency at the rate, rounding to that currency's
+// smallest unit with the given mode. It returns ErrOutOfRange if the result
+// does not fit an Amount.
+func (r Rate) Convert(a Amount, to Currency, mode RoundingMode) (Amount, error) {
+	step := to.step()
+	units, err := a.MulRatio(int64(r), rateUnit*step, mode)
+	if err != nil {
+		return 0, err
+	}
+	if units > math.MaxInt64/Amount(step) || units < math.MinInt64/Amount(step) {
+		return 0, ErrOutOfRange
+	}
+	return units * Amount(step), nil
+}
+
+// MarshalJSON encodes the rate as a JSON number
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accepts either a JSON number or a quoted decimal string
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
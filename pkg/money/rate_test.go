@@ -0,0 +1,107 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected Rate
+		err      error
+	}{
+		{"1", 100_000_000, nil},
+		{"0.9215", 92_150_000, nil},
+		{"151.23456789", 15_123_456_789, nil},
+		{"0", 0, ErrInvalidRate},
+		{"-1.5", 0, ErrInvalidRate},
+		{"1.123456789", 0, ErrInvalidRate},
+		{"abc", 0, ErrInvalidRate},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseRate(tc.input)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRate_String(t *testing.T) {
+	for input, expected := range map[string]string{"2": "2", "0.9215": "0.9215", "151.00000001": "151.00000001"} {
+		if got := MustParseRate(input).String(); got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestRate_Convert(t *testing.T) {
+	usd := mustLookupCurrency(t, "USD")
+	jpy := mustLookupCurrency(t, "JPY")
+
+	cases := []struct {
+		name     string
+		rate     string
+		amount   string
+		to       Currency
+		expected string
+	}{
+		{"dollars to yen", "151.2345", "10.00", jpy, "1512.00"},
+		{"rounds down to the yen", "151.2345", "10.05", jpy, "1519.00"},
+		{"yen to dollars", "0.00661", "1500", usd, "9.91"},
+		{"dollars to euros", "0.9215", "100.00", usd, "92.15"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := MustParseRate(tc.rate).Convert(MustParse(tc.amount), tc.to, RoundDown)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != MustParse(tc.expected) {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRate_ConvertOutOfRange(t *testing.T) {
+	jpy := mustLookupCurrency(t, "JPY")
+	if _, err := MustParseRate("151.2345").Convert(MustParse("1000000000000000.00"), jpy, RoundDown); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestRate_Less(t *testing.T) {
+	got := MustParseRate("151.2345").Less(MustParse("0.50"))
+	// 151.2345 * 0.995 = 150.4783275
+	if got != MustParseRate("150.4783275") {
+		t.Errorf("expected 150.4783275, got %s", got)
+	}
+}
+
+func TestRate_JSON(t *testing.T) {
+	data, err := json.Marshal(map[string]Rate{"rate": MustParseRate("0.9215")})
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if string(data) != `{"rate":0.9215}` {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+
+	var req struct {
+		A Rate `json:"a"`
+		B Rate `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a":151.2345,"b":"0.5"}`), &req); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if req.A != MustParseRate("151.2345") || req.B != MustParseRate("0.5") {
+		t.Errorf("unexpected values: %s, %s", req.A, req.B)
+	}
+}
@@ -0,0 +1,125 @@
+// Package totp implements time-based one-time passwords (RFC 6238) with the
+// parameters authenticator apps assume by default: HMAC-SHA1, 6 digits and a
+// 30-second time step.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of a code
+	Digits = 6
+	// Period is how long a code is valid for, before clock skew
+	Period = 30 * time.Second
+	// Skew is the number of periods before and after the current one whose
+	// codes are still accepted, to allow for clock drift and slow typing
+	Skew = 1
+
+	// secretSize is the length of a generated secret in bytes, the size of an
+	// HMAC-SHA1 key recommended by RFC 4226
+	secretSize = 20
+)
+
+var ErrInvalidSecret = errors.New("invalid TOTP secret")
+
+// encoding is base32 without padding, the form authenticator apps expect
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32-encoded
+func GenerateSecret() (string, error) {
+	key := make([]byte, secretSize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	return encoding.EncodeToString(key), nil
+}
+
+// Counter returns the number of the time step t falls in
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of the secret for the time step t falls in
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Counter(t)), nil
+}
+
+// Validate checks a code against the time steps around t and returns the
+// counter of the step it matched. Callers that must not accept the same code
+// twice should remember the counter and reject codes whose counter is not
+// greater.
+func Validate(secret string, passcode string, t time.Time) (int64, bool, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != Digits {
+		return 0, false, nil
+	}
+
+	current := Counter(t)
+	for counter := current - Skew; counter <= current+Skew; counter++ {
+		if hmac.Equal([]byte(code(key, counter)), []byte(passcode)) {
+			return counter, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// ProvisioningURI returns the otpauth:// URI that authenticator apps import,
+// usually by scanning it as a QR code
+func ProvisioningURI(secret, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// code computes the HOTP value (RFC 4226) of the key for the counter
+func code(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := encoding.DecodeString(strings.TrimRight(normalized, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
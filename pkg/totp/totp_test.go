@@ -0,0 +1,112 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+
+	if _, err := Code("not base32!", time.Now()); err != ErrInvalidSecret {
+		t.Errorf("expected ErrInvalidSecret, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	t.Run("current and adjacent steps", func(t *testing.T) {
+		for _, offset := range []time.Duration{-Period, 0, Period} {
+			passcode, _ := Code(secret, now.Add(offset))
+			counter, ok, err := Validate(secret, passcode, now)
+			if err != nil || !ok {
+				t.Fatalf("expected the code %v away to be valid, got %v, %v", offset, ok, err)
+			}
+			if counter != Counter(now.Add(offset)) {
+				t.Errorf("expected counter %d, got %d", Counter(now.Add(offset)), counter)
+			}
+		}
+	})
+
+	t.Run("outside the window", func(t *testing.T) {
+		for _, offset := range []time.Duration{-2 * Period, 2 * Period} {
+			passcode, _ := Code(secret, now.Add(offset))
+			if _, ok, _ := Validate(secret, passcode, now); ok {
+				t.Errorf("expected the code %v away to be rejected", offset)
+			}
+		}
+	})
+
+	t.Run("malformed codes", func(t *testing.T) {
+		for _, passcode := range []string{"", "12345", "1234567", "abcdef"} {
+			if _, ok, _ := Validate(secret, passcode, now); ok {
+				t.Errorf("expected %q to be rejected", passcode)
+			}
+		}
+	})
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("expected different secrets")
+	}
+	if len(a) != 32 || strings.Contains(a, "=") {
+		t.Errorf("expected 32 base32 characters without padding, got %q", a)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI(rfcSecret, "Auth Wallet", "user@example.com")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("failed to parse URI: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("expected an otpauth://totp URI, got %s", uri)
+	}
+	if parsed.Path != "/Auth Wallet:user@example.com" {
+		t.Errorf("unexpected label %q", parsed.Path)
+	}
+	query := parsed.Query()
+	if query.Get("secret") != rfcSecret || query.Get("issuer") != "Auth Wallet" ||
+		query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("unexpected parameters %v", query)
+	}
+}